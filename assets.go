@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"circles.diy/internal/assets"
+	"circles.diy/internal/config"
+	"circles.diy/internal/utils"
+)
+
+// runAssets writes the generated static files the binary embeds: the
+// compiled CSS and brotli and gzip copies of the text assets. It runs from
+// go generate, so it must come before go build for production.
+func runAssets(cfg *config.Config, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: assets")
+	}
+	if err := utils.BuildCSS(); err != nil {
+		return err
+	}
+	return assets.Compress(".")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"circles.diy/internal/config"
+)
+
+const usage = `Usage: %s [command]
+
+With no command the web server is started.
+
+Commands:
+  migrate up       apply all pending migrations
+  migrate down     revert the most recent migration
+  migrate redo     revert and re-apply the most recent migration
+  migrate status   list migrations and whether they are applied
+  seed             load the demo dataset (safe to run repeatedly)
+  purge            delete circles whose deletion grace period has ended
+  assets           compile and precompress static files for embedding (run by go generate)
+  version          print the release and build metadata
+`
+
+// runCommand runs the CLI subcommand name with its arguments.
+func runCommand(cfg *config.Config, name string, args []string) error {
+	switch name {
+	case "migrate":
+		return runMigrate(cfg, args)
+	case "seed":
+		return runSeed(cfg, args)
+	case "purge":
+		return runPurge(cfg, args)
+	case "assets":
+		return runAssets(cfg, args)
+	case "version":
+		return runVersion(cfg, args)
+	case "help", "-h", "--help":
+		fmt.Printf(usage, filepath.Base(os.Args[0]))
+		return nil
+	default:
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import "embed"
+
+// The compiled CSS must exist before the binary is built so it is embedded
+// with the rest of the static files.
+//go:generate go run . assets
+
+// siteFiles holds the templates and static files built into the binary,
+// so production serves them without either directory beside it.
+//
+//go:embed templates static
+var siteFiles embed.FS
@@ -1,5 +1,24 @@
 module circles.diy
 
-go 1.24
+go 1.24.0
 
-require golang.org/x/time v0.12.0
+require (
+	github.com/andybalholm/brotli v1.2.0
+	github.com/coder/websocket v1.8.14
+	golang.org/x/crypto v0.42.0
+	golang.org/x/time v0.12.0
+	modernc.org/sqlite v1.40.1
+)
+
+require (
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
+	golang.org/x/sys v0.36.0 // indirect
+	modernc.org/libc v1.66.10 // indirect
+	modernc.org/mathutil v1.7.1 // indirect
+	modernc.org/memory v1.11.0 // indirect
+)
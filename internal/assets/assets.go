@@ -0,0 +1,63 @@
+// Package assets provides the files the server reads at runtime: the
+// templates and static files built into the binary, or read from disk in
+// development, with an optional override directory layered on top.
+package assets
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+)
+
+// Layer returns a file system that reads each file from upper, falling
+// back to lower for files upper lacks. Directory listings merge both, so
+// upper only needs the files it replaces or adds.
+func Layer(upper, lower fs.FS) fs.FS {
+	return layered{upper: upper, lower: lower}
+}
+
+type layered struct {
+	upper, lower fs.FS
+}
+
+func (l layered) Open(name string) (fs.File, error) {
+	f, err := l.upper.Open(name)
+	if err == nil {
+		info, statErr := f.Stat()
+		if statErr == nil && !info.IsDir() {
+			return f, nil
+		}
+		f.Close()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	f, lowerErr := l.lower.Open(name)
+	if lowerErr != nil && err == nil {
+		// A directory only the override has
+		return l.upper.Open(name)
+	}
+	return f, lowerErr
+}
+
+func (l layered) ReadDir(name string) ([]fs.DirEntry, error) {
+	upper, upperErr := fs.ReadDir(l.upper, name)
+	lower, lowerErr := fs.ReadDir(l.lower, name)
+	if upperErr != nil && lowerErr != nil {
+		return nil, lowerErr
+	}
+
+	entries := make(map[string]fs.DirEntry, len(upper)+len(lower))
+	for _, e := range lower {
+		entries[e.Name()] = e
+	}
+	for _, e := range upper {
+		entries[e.Name()] = e
+	}
+	merged := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		merged = append(merged, e)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
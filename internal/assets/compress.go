@@ -0,0 +1,109 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/andybalholm/brotli"
+)
+
+// variantExts maps content codings to the extensions of precompressed
+// copies of static files.
+var variantExts = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+// compressedExts are the static files worth precompressing. Other images
+// are compressed already.
+var compressedExts = map[string]bool{
+	".css":  true,
+	".js":   true,
+	".svg":  true,
+	".json": true,
+}
+
+func isVariant(p string) bool {
+	ext := path.Ext(p)
+	return ext == ".br" || ext == ".gz"
+}
+
+// variants finds the precompressed copies of a static file. A copy that
+// no longer decompresses to content, such as one left behind when the
+// override directory replaces the file, is ignored.
+func variants(site fs.FS, p string, content []byte) map[string]string {
+	found := map[string]string{}
+	for encoding, ext := range variantExts {
+		compressed, err := fs.ReadFile(site, p+ext)
+		if err != nil {
+			continue
+		}
+		decoded, err := decompress(encoding, compressed)
+		if err != nil || !bytes.Equal(decoded, content) {
+			log.Printf("Ignoring stale %s", p+ext)
+			continue
+		}
+		found[encoding] = p + ext
+	}
+	return found
+}
+
+func decompress(encoding string, compressed []byte) ([]byte, error) {
+	var r io.Reader = brotli.NewReader(bytes.NewReader(compressed))
+	if encoding == "gzip" {
+		gr, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	return io.ReadAll(r)
+}
+
+// Compress writes brotli and gzip copies beside each text asset under
+// dir, at the highest compression, for the server to send instead of
+// compressing on every request.
+func Compress(dir string) error {
+	m, err := Build(os.DirFS(dir))
+	if err != nil {
+		return err
+	}
+	for p := range m.byPath {
+		if !compressedExts[path.Ext(p)] {
+			continue
+		}
+		name := filepath.Join(dir, filepath.FromSlash(p))
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", p, err)
+		}
+		for encoding, ext := range variantExts {
+			var buf bytes.Buffer
+			var w io.WriteCloser
+			if encoding == "gzip" {
+				w, _ = gzip.NewWriterLevel(&buf, gzip.BestCompression)
+			} else {
+				w = brotli.NewWriterLevel(&buf, brotli.BestCompression)
+			}
+			if _, err := w.Write(content); err != nil {
+				return fmt.Errorf("failed to compress %s: %v", p, err)
+			}
+			if err := w.Close(); err != nil {
+				return fmt.Errorf("failed to compress %s: %v", p, err)
+			}
+			if err := os.WriteFile(name+ext, buf.Bytes(), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %v", p+ext, err)
+			}
+		}
+		log.Printf("Precompressed %s", p)
+	}
+	return nil
+}
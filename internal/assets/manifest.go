@@ -0,0 +1,181 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fingerprinted lists the static files served under content-hashed URLs.
+// CSS partials are left out; only the compiled style.css is served.
+var fingerprinted = []string{
+	"static/css/*.css",
+	"static/js/*.js",
+	"static/img/*",
+}
+
+// unfingerprinted are static files whose URL must not change between
+// releases, so they are served from their own routes.
+var unfingerprinted = map[string]bool{
+	"static/js/sw.js":      true,
+	"static/manifest.json": true,
+}
+
+// Asset is a static file and the URL it is served from.
+type Asset struct {
+	// Path is the file's path in the site files, e.g. static/css/style.css.
+	Path string
+	// URL has the first bytes of the file's SHA-256 before its extension,
+	// e.g. /static/css/style.3f9a1c2b.css.
+	URL string
+	// Hash is the start of the file's SHA-256 in hex, its strong ETag.
+	Hash string
+	// Encodings maps content codings to precompressed copies of the file
+	// that match its current content.
+	Encodings map[string]string
+}
+
+// Manifest maps static files to their fingerprinted URLs.
+type Manifest struct {
+	byPath map[string]Asset
+	byURL  map[string]Asset
+	// Version changes whenever any asset does.
+	Version string
+}
+
+var (
+	files fs.FS
+	dev   bool
+
+	mu       sync.Mutex
+	manifest *Manifest
+	// modTime is when an asset last changed, to rebuild the manifest in
+	// development
+	modTime time.Time
+)
+
+// Init fingerprints the static files in site. In development the manifest
+// is rebuilt whenever a file changes.
+func Init(site fs.FS, isDev bool) error {
+	files, dev = site, isDev
+	latest := latestModTime(files)
+	m, err := Build(files)
+	if err != nil {
+		return err
+	}
+	manifest, modTime = m, latest
+	log.Printf("Fingerprinted %d static files (version %s)", len(m.byPath), m.Version)
+	return nil
+}
+
+// Current returns the manifest for the static files as they are now.
+func Current() *Manifest {
+	mu.Lock()
+	defer mu.Unlock()
+	if dev {
+		if latest := latestModTime(files); latest.After(modTime) {
+			m, err := Build(files)
+			if err != nil {
+				log.Printf("Error fingerprinting static files: %v", err)
+			} else {
+				manifest, modTime = m, latest
+			}
+		}
+	}
+	return manifest
+}
+
+// URL returns the fingerprinted URL of a static file, named by its path
+// under static/ ("css/style.css"). Unknown files get their plain URL.
+func URL(name string) string {
+	return Current().URL(name)
+}
+
+// Build fingerprints the static files in site.
+func Build(site fs.FS) (*Manifest, error) {
+	m := &Manifest{byPath: map[string]Asset{}, byURL: map[string]Asset{}}
+	for _, pattern := range fingerprinted {
+		matches, err := fs.Glob(site, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %v", pattern, err)
+		}
+		for _, p := range matches {
+			if unfingerprinted[p] || isVariant(p) {
+				continue
+			}
+			content, err := fs.ReadFile(site, p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %v", p, err)
+			}
+			sum := sha256.Sum256(content)
+			a := Asset{
+				Path:      p,
+				URL:       "/" + withHash(p, hex.EncodeToString(sum[:4])),
+				Hash:      hex.EncodeToString(sum[:16]),
+				Encodings: variants(site, p, content),
+			}
+			m.byPath[p] = a
+			m.byURL[a.URL] = a
+		}
+	}
+
+	// The version hashes every fingerprinted URL, in a fixed order
+	urls := make([]string, 0, len(m.byURL))
+	for url := range m.byURL {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	sum := sha256.Sum256([]byte(strings.Join(urls, "\n")))
+	m.Version = hex.EncodeToString(sum[:4])
+	return m, nil
+}
+
+// withHash puts hash before the extension of p: style.css becomes
+// style.<hash>.css.
+func withHash(p, hash string) string {
+	ext := path.Ext(p)
+	return strings.TrimSuffix(p, ext) + "." + hash + ext
+}
+
+// URL returns the fingerprinted URL of a static file, named by its path
+// under static/.
+func (m *Manifest) URL(name string) string {
+	p := "static/" + strings.TrimPrefix(name, "/")
+	if a, ok := m.byPath[p]; ok {
+		return a.URL
+	}
+	return "/" + p
+}
+
+// Lookup finds the asset served at urlPath, reporting whether urlPath is
+// its fingerprinted URL. Assets are also found by their plain URL, which
+// links stored outside the templates still use.
+func (m *Manifest) Lookup(urlPath string) (a Asset, fingerprinted bool, ok bool) {
+	if a, ok := m.byURL[urlPath]; ok {
+		return a, true, true
+	}
+	a, ok = m.byPath[strings.TrimPrefix(urlPath, "/")]
+	return a, false, ok
+}
+
+// latestModTime returns when a static file last changed.
+func latestModTime(site fs.FS) time.Time {
+	var latest time.Time
+	fs.WalkDir(site, "static", func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
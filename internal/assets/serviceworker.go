@@ -0,0 +1,47 @@
+package assets
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+)
+
+// ServiceWorkerPath is the service worker's source in the site files.
+const ServiceWorkerPath = "static/js/sw.js"
+
+var (
+	cacheNamePattern = regexp.MustCompile(`const CACHE_NAME = '[^']*';`)
+	cacheURLsPattern = regexp.MustCompile(`(?s)const STATIC_CACHE_URLS = \[(.*?)\];`)
+	quotedPattern    = regexp.MustCompile(`'([^']*)'`)
+)
+
+// ServiceWorker returns sw.js with its cache named after the manifest
+// version, so each release replaces the cache, and the static files it
+// precaches pointed at their fingerprinted URLs. Only fingerprinted files
+// may be precached: pages are per-user and must never outlive a session in
+// the cache.
+func (m *Manifest) ServiceWorker(site fs.FS) ([]byte, error) {
+	source, err := fs.ReadFile(site, ServiceWorkerPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service worker: %v", err)
+	}
+
+	list := cacheURLsPattern.FindSubmatch(source)
+	if list == nil || !cacheNamePattern.Match(source) {
+		return nil, fmt.Errorf("failed to find CACHE_NAME and STATIC_CACHE_URLS in %s", ServiceWorkerPath)
+	}
+	var urls []string
+	for _, quoted := range quotedPattern.FindAllSubmatch(list[1], -1) {
+		url := string(quoted[1])
+		a, _, ok := m.Lookup(url)
+		if !strings.HasPrefix(url, "/static/") || !ok {
+			return nil, fmt.Errorf("failed to precache %s: not a fingerprinted static file", url)
+		}
+		urls = append(urls, "  '"+a.URL+"'")
+	}
+
+	out := cacheNamePattern.ReplaceAllLiteral(source, []byte("const CACHE_NAME = 'circles-diy-"+m.Version+"';"))
+	out = cacheURLsPattern.ReplaceAllLiteral(out, []byte("const STATIC_CACHE_URLS = [\n"+strings.Join(urls, ",\n")+"\n];"))
+	return out, nil
+}
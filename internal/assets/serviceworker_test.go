@@ -0,0 +1,54 @@
+package assets
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func serviceWorkerSite(urls ...string) fstest.MapFS {
+	return fstest.MapFS{
+		"static/css/style.css": {Data: []byte("body{}")},
+		"static/js/app.js":     {Data: []byte("app()")},
+		"static/js/sw.js": {Data: []byte("const CACHE_NAME = 'circles-diy-v1';\n" +
+			"const STATIC_CACHE_URLS = [\n  '" + strings.Join(urls, "',\n  '") + "'\n];\n")},
+	}
+}
+
+func TestServiceWorkerPrecachesFingerprintedURLs(t *testing.T) {
+	site := serviceWorkerSite("/static/css/style.css", "/static/js/app.js")
+	m, err := Build(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := m.ServiceWorker(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(script)
+	for _, want := range []string{
+		"const CACHE_NAME = 'circles-diy-" + m.Version + "';",
+		"'" + m.URL("css/style.css") + "'",
+		"'" + m.URL("js/app.js") + "'",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("service worker lacks %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "'/static/css/style.css'") {
+		t.Errorf("service worker kept a plain static URL:\n%s", out)
+	}
+}
+
+func TestServiceWorkerRejectsOtherURLs(t *testing.T) {
+	for _, url := range []string{"/", "/dashboard", "/chat/c1", "/static/js/missing.js", "/static/js/sw.js"} {
+		site := serviceWorkerSite("/static/css/style.css", url)
+		m, err := Build(site)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.ServiceWorker(site); err == nil {
+			t.Errorf("service worker precaching %s was generated", url)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"context"
+
+	"circles.diy/internal/models"
+)
+
+type contextKey struct{}
+
+// WithUser returns a copy of ctx carrying the signed-in user.
+func WithUser(ctx context.Context, user models.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// CurrentUser returns the signed-in user for a request context, if any.
+func CurrentUser(ctx context.Context) (models.User, bool) {
+	user, ok := ctx.Value(contextKey{}).(models.User)
+	return user, ok
+}
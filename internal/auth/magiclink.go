@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+)
+
+// LoginTokenTTL is how long an emailed sign-in link stays valid.
+const LoginTokenTTL = 15 * time.Minute
+
+// IssueLoginToken creates a single-use sign-in token for userID. Only its
+// hash is stored; the returned token goes in the emailed link.
+func IssueLoginToken(ctx context.Context, userID string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	err = dataStore.CreateLoginToken(ctx, models.LoginToken{
+		ID:        hashToken(token),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(LoginTokenTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store login token: %v", err)
+	}
+	return token, nil
+}
+
+// RedeemLoginToken uses up a sign-in token and returns the user it was
+// issued to. Unknown, expired and used tokens return store.ErrNotFound.
+func RedeemLoginToken(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", store.ErrNotFound
+	}
+	t, err := dataStore.ConsumeLoginToken(ctx, hashToken(token))
+	if err != nil {
+		return "", err
+	}
+	return t.UserID, nil
+}
@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/webauthn"
+)
+
+// CeremonyCookieName holds the ID of the passkey ceremony a browser has in
+// progress. The challenge itself never leaves the server.
+const CeremonyCookieName = "circles_webauthn"
+
+const (
+	ceremonyRegister = "register"
+	ceremonyLogin    = "login"
+
+	// maxCeremonies bounds the pending challenges kept in memory
+	maxCeremonies = 10000
+
+	MaxPasskeyNameLength = 60
+)
+
+var (
+	// ErrNoCeremony means the browser has no matching ceremony in progress,
+	// usually because the options expired before the user finished.
+	ErrNoCeremony = errors.New("auth: no passkey ceremony in progress")
+	// ErrUnknownPasskey is returned when a sign-in uses a credential that is
+	// not registered, e.g. one the user revoked.
+	ErrUnknownPasskey = errors.New("auth: passkey not registered")
+)
+
+type ceremony struct {
+	kind      string
+	userID    string
+	challenge []byte
+	expiresAt time.Time
+}
+
+var ceremonies = struct {
+	sync.Mutex
+	pending map[string]ceremony
+}{pending: make(map[string]ceremony)}
+
+// beginCeremony remembers challenge for this browser until it is finished
+// or times out.
+func beginCeremony(w http.ResponseWriter, c ceremony) error {
+	id, err := newToken()
+	if err != nil {
+		return err
+	}
+	c.expiresAt = time.Now().Add(webauthn.Timeout)
+
+	ceremonies.Lock()
+	if len(ceremonies.pending) >= maxCeremonies {
+		evictCeremonies(time.Now())
+	}
+	ceremonies.pending[id] = c
+	ceremonies.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CeremonyCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(webauthn.Timeout.Seconds()),
+		Secure:   secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+// evictCeremonies makes room in the full table by dropping the expired
+// ceremonies, or failing that the oldest one, so a flood of unfinished
+// sign-ins can only push out other unfinished ones rather than lock everyone
+// out. The caller holds the lock.
+func evictCeremonies(now time.Time) {
+	var oldest string
+	for k, c := range ceremonies.pending {
+		if now.After(c.expiresAt) {
+			delete(ceremonies.pending, k)
+		} else if oldest == "" || c.expiresAt.Before(ceremonies.pending[oldest].expiresAt) {
+			oldest = k
+		}
+	}
+	if len(ceremonies.pending) >= maxCeremonies {
+		delete(ceremonies.pending, oldest)
+	}
+}
+
+// finishCeremony takes the browser's pending ceremony of kind. Each
+// challenge can be answered once, whether or not verification succeeds.
+func finishCeremony(w http.ResponseWriter, r *http.Request, kind string) (ceremony, error) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CeremonyCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	cookie, err := r.Cookie(CeremonyCookieName)
+	if err != nil {
+		return ceremony{}, ErrNoCeremony
+	}
+
+	ceremonies.Lock()
+	c, ok := ceremonies.pending[cookie.Value]
+	delete(ceremonies.pending, cookie.Value)
+	ceremonies.Unlock()
+
+	if !ok || c.kind != kind || time.Now().After(c.expiresAt) {
+		return ceremony{}, ErrNoCeremony
+	}
+	return c, nil
+}
+
+func passkeyCredentials(passkeys []models.Passkey) []webauthn.Credential {
+	creds := make([]webauthn.Credential, 0, len(passkeys))
+	for _, p := range passkeys {
+		id, err := webauthn.Decode(p.ID)
+		if err != nil {
+			continue
+		}
+		creds = append(creds, webauthn.Credential{ID: id, Transports: p.Transports})
+	}
+	return creds
+}
+
+// BeginPasskeyRegistration starts adding a passkey to user's account and
+// returns the options for navigator.credentials.create.
+func BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request, rp webauthn.RelyingParty, user models.User) (webauthn.CreationOptions, error) {
+	existing, err := dataStore.ListPasskeys(r.Context(), user.ID)
+	if err != nil {
+		return webauthn.CreationOptions{}, fmt.Errorf("failed to list passkeys: %v", err)
+	}
+
+	name := user.Handle
+	if name == "" {
+		name = user.ID
+	}
+	opts, challenge, err := rp.BeginRegistration(webauthn.User{
+		ID:          []byte(user.ID),
+		Name:        name,
+		DisplayName: user.Name,
+	}, passkeyCredentials(existing))
+	if err != nil {
+		return opts, err
+	}
+	return opts, beginCeremony(w, ceremony{kind: ceremonyRegister, userID: user.ID, challenge: challenge})
+}
+
+// NormalizePasskeyName trims a user-supplied passkey label, falling back to
+// a generic one.
+func NormalizePasskeyName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	for utf8.RuneCountInString(name) > MaxPasskeyNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" {
+		return "Passkey"
+	}
+	return name
+}
+
+// FinishPasskeyRegistration verifies the browser's response and saves the
+// new passkey for userID. Invalid responses wrap
+// webauthn.ErrInvalidResponse.
+func FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request, rp webauthn.RelyingParty, userID, name string, resp webauthn.RegistrationResponse) (models.Passkey, error) {
+	c, err := finishCeremony(w, r, ceremonyRegister)
+	if err != nil {
+		return models.Passkey{}, err
+	}
+	if c.userID != userID {
+		return models.Passkey{}, ErrNoCeremony
+	}
+
+	cred, err := rp.FinishRegistration(c.challenge, resp)
+	if err != nil {
+		return models.Passkey{}, err
+	}
+
+	passkey := models.Passkey{
+		ID:         webauthn.Encode(cred.ID),
+		UserID:     userID,
+		Name:       NormalizePasskeyName(name),
+		PublicKey:  cred.PublicKey,
+		Algorithm:  cred.Algorithm,
+		SignCount:  cred.SignCount,
+		Transports: cred.Transports,
+		CreatedAt:  time.Now(),
+	}
+	if err := dataStore.SavePasskey(r.Context(), passkey); err != nil {
+		return models.Passkey{}, fmt.Errorf("failed to save passkey: %v", err)
+	}
+	return passkey, nil
+}
+
+// BeginPasskeyLogin starts a sign-in with any passkey registered for this
+// site and returns the options for navigator.credentials.get.
+func BeginPasskeyLogin(w http.ResponseWriter, rp webauthn.RelyingParty) (webauthn.RequestOptions, error) {
+	opts, challenge, err := rp.BeginLogin(nil)
+	if err != nil {
+		return opts, err
+	}
+	return opts, beginCeremony(w, ceremony{kind: ceremonyLogin, challenge: challenge})
+}
+
+// FinishPasskeyLogin verifies a sign-in assertion and returns the user it
+// belongs to. The caller starts the session.
+func FinishPasskeyLogin(w http.ResponseWriter, r *http.Request, rp webauthn.RelyingParty, resp webauthn.AssertionResponse) (string, error) {
+	c, err := finishCeremony(w, r, ceremonyLogin)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := r.Context()
+	passkey, err := dataStore.GetPasskey(ctx, resp.RawID)
+	if errors.Is(err, store.ErrNotFound) {
+		return "", ErrUnknownPasskey
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load passkey: %v", err)
+	}
+	// Discoverable credentials name their account; it must be the owner
+	if resp.Response.UserHandle != "" {
+		handle, err := webauthn.Decode(resp.Response.UserHandle)
+		if err != nil || string(handle) != passkey.UserID {
+			return "", ErrUnknownPasskey
+		}
+	}
+
+	id, err := webauthn.Decode(passkey.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode passkey ID: %v", err)
+	}
+	signCount, err := rp.FinishLogin(c.challenge, webauthn.Credential{
+		ID:        id,
+		PublicKey: passkey.PublicKey,
+		Algorithm: passkey.Algorithm,
+		SignCount: passkey.SignCount,
+	}, resp)
+	if err != nil {
+		return "", err
+	}
+
+	if err := dataStore.UpdatePasskeyUsage(ctx, passkey.ID, signCount, time.Now()); err != nil {
+		return "", fmt.Errorf("failed to record passkey use: %v", err)
+	}
+	return passkey.UserID, nil
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// A full ceremony table makes room for new sign-ins rather than refusing
+// them.
+func TestBeginCeremonyEvictsOldest(t *testing.T) {
+	ceremonies.Lock()
+	now := time.Now()
+	for i := 0; i < maxCeremonies; i++ {
+		ceremonies.pending[fmt.Sprint(i)] = ceremony{kind: ceremonyLogin, expiresAt: now.Add(time.Minute + time.Duration(i)*time.Millisecond)}
+	}
+	ceremonies.Unlock()
+	t.Cleanup(func() {
+		ceremonies.Lock()
+		clear(ceremonies.pending)
+		ceremonies.Unlock()
+	})
+
+	w := httptest.NewRecorder()
+	if err := beginCeremony(w, ceremony{kind: ceremonyLogin}); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CeremonyCookieName {
+		t.Fatalf("cookies = %v, want the ceremony cookie", cookies)
+	}
+
+	ceremonies.Lock()
+	defer ceremonies.Unlock()
+	if n := len(ceremonies.pending); n != maxCeremonies {
+		t.Errorf("%d ceremonies pending, want %d", n, maxCeremonies)
+	}
+	if _, ok := ceremonies.pending["0"]; ok {
+		t.Error("oldest ceremony was kept")
+	}
+	if _, ok := ceremonies.pending[cookies[0].Value]; !ok {
+		t.Error("new ceremony was not stored")
+	}
+}
+
+func TestBeginCeremonyDropsExpired(t *testing.T) {
+	ceremonies.Lock()
+	expired := time.Now().Add(-time.Minute)
+	for i := 0; i < maxCeremonies; i++ {
+		ceremonies.pending[fmt.Sprint(i)] = ceremony{kind: ceremonyLogin, expiresAt: expired}
+	}
+	ceremonies.Unlock()
+	t.Cleanup(func() {
+		ceremonies.Lock()
+		clear(ceremonies.pending)
+		ceremonies.Unlock()
+	})
+
+	if err := beginCeremony(httptest.NewRecorder(), ceremony{kind: ceremonyLogin}); err != nil {
+		t.Fatal(err)
+	}
+	ceremonies.Lock()
+	defer ceremonies.Unlock()
+	if n := len(ceremonies.pending); n != 1 {
+		t.Errorf("%d ceremonies pending, want only the new one", n)
+	}
+}
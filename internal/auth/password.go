@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MinPasswordLength = 10
+	// bcrypt ignores everything past 72 bytes, so longer passwords are
+	// refused rather than silently truncated.
+	MaxPasswordLength = 72
+
+	passwordCost = 12
+)
+
+var (
+	ErrPasswordTooShort = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	ErrPasswordTooLong  = fmt.Errorf("password must be at most %d bytes", MaxPasswordLength)
+)
+
+// dummyHash is compared against when a login names an unknown account, so
+// that unknown and known accounts take the same time to reject.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("circles.diy"), passwordCost)
+
+// ValidatePassword checks a new password against the length rules.
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > MaxPasswordLength {
+		return ErrPasswordTooLong
+	}
+	return nil
+}
+
+func HashPassword(password string) (string, error) {
+	if err := ValidatePassword(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches hash. An empty hash stands
+// for an unknown account and never matches.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,143 @@
+// Package auth handles passwords, sign-in sessions and the signed-in user
+// carried on each request.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+)
+
+const (
+	SessionCookieName = "circles_session"
+	SessionTTL        = 30 * 24 * time.Hour
+)
+
+var (
+	dataStore     store.Store
+	secureCookies bool
+)
+
+// Init sets the store sessions are kept in. secure marks the session cookie
+// HTTPS-only and should be set everywhere but local development.
+func Init(s store.Store, secure bool) {
+	dataStore = s
+	secureCookies = secure
+}
+
+// newToken returns a random URL-safe token.
+func newToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken is what the store keeps in place of session and sign-in link
+// tokens, so a leaked database cannot be replayed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func setCookie(w http.ResponseWriter, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(time.Until(expires).Seconds()),
+		Secure:   secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// StartSession signs userID in on this browser.
+func StartSession(ctx context.Context, w http.ResponseWriter, userID string) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	session := models.Session{
+		ID:        hashToken(token),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(SessionTTL),
+	}
+	if err := dataStore.CreateSession(ctx, session); err != nil {
+		return fmt.Errorf("failed to create session: %v", err)
+	}
+	setCookie(w, token, session.ExpiresAt)
+	return nil
+}
+
+// EndSession signs the browser out. It is safe to call without a session.
+func EndSession(w http.ResponseWriter, r *http.Request) error {
+	clearCookie(w)
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return nil
+	}
+	if err := dataStore.DeleteSession(r.Context(), hashToken(cookie.Value)); err != nil {
+		return fmt.Errorf("failed to delete session: %v", err)
+	}
+	return nil
+}
+
+// Authenticate returns the user the request's session cookie belongs to,
+// or store.ErrNotFound when there is no valid session. Sessions past half
+// their lifetime are extended so active users stay signed in.
+func Authenticate(w http.ResponseWriter, r *http.Request) (models.User, error) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return models.User{}, store.ErrNotFound
+	}
+
+	ctx := r.Context()
+	session, err := dataStore.GetSession(ctx, hashToken(cookie.Value))
+	if errors.Is(err, store.ErrNotFound) {
+		clearCookie(w)
+		return models.User{}, err
+	}
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to load session: %v", err)
+	}
+
+	user, err := dataStore.GetUser(ctx, session.UserID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to load session user: %v", err)
+	}
+
+	if time.Until(session.ExpiresAt) < SessionTTL/2 {
+		expires := time.Now().Add(SessionTTL)
+		if err := dataStore.ExtendSession(ctx, session.ID, expires); err != nil {
+			return models.User{}, fmt.Errorf("failed to extend session: %v", err)
+		}
+		setCookie(w, cookie.Value, expires)
+	}
+	return user, nil
+}
@@ -0,0 +1,117 @@
+// Package authz decides what members may do in a circle. Every membership
+// has one role; each role grants a fixed set of permissions, and roles are
+// ranked so members can only manage those below them.
+package authz
+
+type Role string
+
+const (
+	RoleOwner     Role = "owner"
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+	RoleMember    Role = "member"
+	RoleGuest     Role = "guest"
+)
+
+// Roles lists every role, highest first.
+var Roles = []Role{RoleOwner, RoleAdmin, RoleModerator, RoleMember, RoleGuest}
+
+type Permission string
+
+const (
+	// PermView allows reading the circle and its member list
+	PermView         Permission = "view"
+	PermPost         Permission = "post"
+	PermModerate     Permission = "moderate"
+	PermInvite       Permission = "invite"
+	PermEditSettings Permission = "edit_settings"
+	PermManageTithes Permission = "manage_tithes"
+	// PermDelete covers archiving, restoring and deleting the circle
+	PermDelete   Permission = "delete"
+	PermTransfer Permission = "transfer"
+)
+
+// matrix is the permission table. Guests can look but not take part.
+var matrix = map[Role][]Permission{
+	RoleOwner:     {PermView, PermPost, PermModerate, PermInvite, PermEditSettings, PermManageTithes, PermDelete, PermTransfer},
+	RoleAdmin:     {PermView, PermPost, PermModerate, PermInvite, PermEditSettings, PermManageTithes},
+	RoleModerator: {PermView, PermPost, PermModerate, PermInvite},
+	RoleMember:    {PermView, PermPost},
+	RoleGuest:     {PermView},
+}
+
+// ParseRole validates a stored or submitted role name.
+func ParseRole(s string) (Role, bool) {
+	r := Role(s)
+	_, ok := matrix[r]
+	return r, ok
+}
+
+// Can reports whether role grants p. The empty role, for people outside
+// the circle, grants nothing.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range matrix[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Rank orders roles from guest (1) to owner (5); unknown roles rank 0.
+func (r Role) Rank() int {
+	for i, role := range Roles {
+		if role == r {
+			return len(Roles) - i
+		}
+	}
+	return 0
+}
+
+// Label is the role's display name.
+func (r Role) Label() string {
+	switch r {
+	case RoleOwner:
+		return "Owner"
+	case RoleAdmin:
+		return "Admin"
+	case RoleModerator:
+		return "Moderator"
+	case RoleMember:
+		return "Member"
+	case RoleGuest:
+		return "Guest"
+	}
+	return ""
+}
+
+// CanAssign reports whether actor may change a member's role from current
+// to next. Only settings editors assign roles, only to members they
+// outrank, and never to a role at or above their own. Ownership changes
+// hands by transfer, not assignment.
+func CanAssign(actor, current, next Role) bool {
+	if !actor.Can(PermEditSettings) || next == RoleOwner || next.Rank() == 0 {
+		return false
+	}
+	return actor.Rank() > current.Rank() && actor.Rank() > next.Rank()
+}
+
+// AssignableRoles lists the roles actor may hand out, highest first.
+func AssignableRoles(actor Role) []Role {
+	if !actor.Can(PermEditSettings) {
+		return nil
+	}
+	var roles []Role
+	for _, r := range Roles {
+		if r != RoleOwner && r.Rank() < actor.Rank() {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+// CanRemove reports whether actor may remove or ban a member holding
+// target. Moderators and above can, for members ranked below them.
+func CanRemove(actor, target Role) bool {
+	return actor.Can(PermModerate) && actor.Rank() > target.Rank()
+}
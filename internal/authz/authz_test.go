@@ -0,0 +1,118 @@
+package authz
+
+import (
+	"slices"
+	"testing"
+)
+
+// The expected grants are spelled out rather than read from matrix, so a
+// change to the table has to be made here as well.
+func TestCan(t *testing.T) {
+	perms := []Permission{PermView, PermPost, PermModerate, PermInvite, PermEditSettings, PermManageTithes, PermDelete, PermTransfer}
+	want := map[Role]string{
+		//              VPMIEMDT
+		RoleOwner:     "xxxxxxxx",
+		RoleAdmin:     "xxxxxx..",
+		RoleModerator: "xxxx....",
+		RoleMember:    "xx......",
+		RoleGuest:     "x.......",
+		"":            "........",
+		"superuser":   "........",
+	}
+	for role, grants := range want {
+		for i, p := range perms {
+			if got := role.Can(p); got != (grants[i] == 'x') {
+				t.Errorf("%q.Can(%s) = %v", role, p, got)
+			}
+		}
+	}
+}
+
+func TestParseRoleAndRank(t *testing.T) {
+	for i, r := range Roles {
+		if got, ok := ParseRole(string(r)); !ok || got != r {
+			t.Errorf("ParseRole(%q) = %q, %v", r, got, ok)
+		}
+		if r.Rank() != len(Roles)-i {
+			t.Errorf("%q.Rank() = %d, want %d", r, r.Rank(), len(Roles)-i)
+		}
+		if r.Label() == "" {
+			t.Errorf("%q has no label", r)
+		}
+	}
+	for _, s := range []string{"", "Owner", "superuser"} {
+		if _, ok := ParseRole(s); ok {
+			t.Errorf("ParseRole(%q) accepted", s)
+		}
+		if Role(s).Rank() != 0 {
+			t.Errorf("%q.Rank() = %d, want 0", s, Role(s).Rank())
+		}
+	}
+}
+
+func TestCanAssign(t *testing.T) {
+	tests := []struct {
+		actor, current, next Role
+		want                 bool
+	}{
+		{RoleOwner, RoleMember, RoleAdmin, true},
+		{RoleOwner, RoleAdmin, RoleGuest, true},
+		{RoleOwner, RoleMember, RoleOwner, false},
+		{RoleOwner, RoleOwner, RoleAdmin, false},
+		{RoleOwner, RoleMember, "superuser", false},
+		{RoleAdmin, RoleMember, RoleModerator, true},
+		{RoleAdmin, RoleGuest, RoleMember, true},
+		{RoleAdmin, RoleMember, RoleAdmin, false},
+		{RoleAdmin, RoleAdmin, RoleMember, false},
+		{RoleAdmin, RoleOwner, RoleMember, false},
+		{RoleModerator, RoleMember, RoleGuest, false},
+		{RoleMember, RoleGuest, RoleGuest, false},
+		{"", RoleGuest, RoleMember, false},
+	}
+	for _, tt := range tests {
+		if got := CanAssign(tt.actor, tt.current, tt.next); got != tt.want {
+			t.Errorf("CanAssign(%q, %q, %q) = %v, want %v", tt.actor, tt.current, tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestAssignableRoles(t *testing.T) {
+	tests := []struct {
+		actor Role
+		want  []Role
+	}{
+		{RoleOwner, []Role{RoleAdmin, RoleModerator, RoleMember, RoleGuest}},
+		{RoleAdmin, []Role{RoleModerator, RoleMember, RoleGuest}},
+		{RoleModerator, nil},
+		{RoleMember, nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := AssignableRoles(tt.actor); !slices.Equal(got, tt.want) {
+			t.Errorf("AssignableRoles(%q) = %v, want %v", tt.actor, got, tt.want)
+		}
+	}
+}
+
+func TestCanRemove(t *testing.T) {
+	tests := []struct {
+		actor, target Role
+		want          bool
+	}{
+		{RoleOwner, RoleAdmin, true},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, false},
+		{RoleAdmin, RoleOwner, false},
+		{RoleModerator, RoleMember, true},
+		{RoleModerator, RoleGuest, true},
+		{RoleModerator, RoleModerator, false},
+		{RoleMember, RoleGuest, false},
+		{RoleGuest, RoleGuest, false},
+		{"", RoleGuest, false},
+	}
+	for _, tt := range tests {
+		if got := CanRemove(tt.actor, tt.target); got != tt.want {
+			t.Errorf("CanRemove(%q, %q) = %v, want %v", tt.actor, tt.target, got, tt.want)
+		}
+	}
+}
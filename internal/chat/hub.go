@@ -0,0 +1,127 @@
+// Package chat delivers chat events to the people they concern while they
+// are connected. Events are fanned out in process; anything a connection
+// misses while it is away is read back from the store when it reconnects.
+package chat
+
+import (
+	"sync"
+
+	"circles.diy/internal/models"
+)
+
+type EventType string
+
+const (
+	// EventMessage is a new message in a conversation
+	EventMessage EventType = "message"
+	// EventRead is a participant reading a conversation to its last message
+	EventRead EventType = "read"
+	// EventPresence is a participant coming online, going idle or leaving
+	EventPresence EventType = "presence"
+	// EventTyping is a participant typing in a conversation
+	EventTyping EventType = "typing"
+	// EventRemoved is a participant leaving or being taken out of a group,
+	// sent to them alone
+	EventRemoved EventType = "removed"
+)
+
+// Event is something that happened in a conversation.
+type Event struct {
+	Type           EventType
+	ConversationID string
+	Message        models.Message
+	// UserID is who read, changed status or is typing
+	UserID string
+}
+
+// subscriptionBuffer is how many events a connection may fall behind by
+// before it is dropped. A slow client must not hold up everyone else.
+const subscriptionBuffer = 32
+
+// Hub hands events to the subscriptions of the users they are published
+// to. It is safe for concurrent use.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[string]map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscription receives the events published to one user, for one
+// connection.
+type Subscription struct {
+	UserID string
+
+	hub    *Hub
+	events chan Event
+	// closed and lagged are guarded by hub.mu
+	closed bool
+	lagged bool
+}
+
+// Subscribe starts receiving the events published to userID. The caller
+// must Close the subscription when its connection ends.
+func (h *Hub) Subscribe(userID string) *Subscription {
+	sub := &Subscription{UserID: userID, hub: h, events: make(chan Event, subscriptionBuffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+// Publish hands e to every subscription of each user, without waiting. A
+// subscription whose buffer is full is dropped: its channel is closed and
+// Lagged reports true, and the connection should end so the client comes
+// back and catches up from the store.
+func (h *Hub) Publish(e Event, userIDs ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, userID := range userIDs {
+		for sub := range h.subs[userID] {
+			select {
+			case sub.events <- e:
+			default:
+				sub.lagged = true
+				h.remove(sub)
+			}
+		}
+	}
+}
+
+// remove closes sub and forgets it. h.mu must be held.
+func (h *Hub) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.events)
+	delete(h.subs[sub.UserID], sub)
+	if len(h.subs[sub.UserID]) == 0 {
+		delete(h.subs, sub.UserID)
+	}
+}
+
+// Events delivers the subscription's events in the order they were
+// published. It is closed when the subscription is.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Lagged reports whether the subscription was dropped for falling behind.
+// It is only meaningful once Events is closed.
+func (s *Subscription) Lagged() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.lagged
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"circles.diy/internal/models"
+)
+
+// receive returns the next event on sub, failing if none is waiting.
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case e, ok := <-sub.Events():
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+// pending reports whether an event is waiting on sub.
+func pending(sub *Subscription) bool {
+	select {
+	case <-sub.Events():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestPublishFansOut(t *testing.T) {
+	h := NewHub()
+	ana1, ana2 := h.Subscribe("ana"), h.Subscribe("ana")
+	ben, cy := h.Subscribe("ben"), h.Subscribe("cy")
+	defer ana1.Close()
+	defer ana2.Close()
+	defer ben.Close()
+	defer cy.Close()
+
+	e := Event{Type: EventMessage, ConversationID: "d1", Message: models.Message{ID: "m1"}}
+	h.Publish(e, "ana", "ben", "nobody")
+	for name, sub := range map[string]*Subscription{"ana's first page": ana1, "ana's second page": ana2, "ben": ben} {
+		if got := receive(t, sub); got.Message.ID != "m1" || got.ConversationID != "d1" {
+			t.Errorf("%s got %+v, want m1 in d1", name, got)
+		}
+	}
+	if pending(cy) {
+		t.Error("cy got an event published to others")
+	}
+}
+
+func TestPublishKeepsOrder(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe("ana")
+	defer sub.Close()
+	for _, id := range []string{"m1", "m2", "m3"} {
+		h.Publish(Event{Type: EventMessage, Message: models.Message{ID: id}}, "ana")
+	}
+	for _, want := range []string{"m1", "m2", "m3"} {
+		if got := receive(t, sub); got.Message.ID != want {
+			t.Errorf("got %s, want %s", got.Message.ID, want)
+		}
+	}
+}
+
+// A subscriber that stops reading is dropped once its buffer fills, and
+// the others keep receiving.
+func TestPublishDropsSlowSubscriber(t *testing.T) {
+	h := NewHub()
+	slow, fast := h.Subscribe("ana"), h.Subscribe("ben")
+	defer fast.Close()
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		h.Publish(Event{Type: EventTyping, UserID: "cy"}, "ana", "ben")
+		receive(t, fast)
+	}
+
+	for i := 0; i < subscriptionBuffer; i++ {
+		receive(t, slow)
+	}
+	if _, ok := <-slow.Events(); ok {
+		t.Fatal("slow subscription still open after falling behind")
+	}
+	if !slow.Lagged() {
+		t.Error("slow subscription not marked as lagged")
+	}
+	if fast.Lagged() {
+		t.Error("fast subscription marked as lagged")
+	}
+
+	// A dropped subscriber gets nothing more, and closing it again is safe
+	h.Publish(Event{Type: EventTyping, UserID: "cy"}, "ana")
+	slow.Close()
+	if len(h.subs["ana"]) != 0 {
+		t.Errorf("hub still holds %d subscriptions for ana", len(h.subs["ana"]))
+	}
+}
+
+func TestClose(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe("ana")
+	sub.Close()
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Events still open after Close")
+	}
+	if sub.Lagged() {
+		t.Error("closed subscription marked as lagged")
+	}
+	h.Publish(Event{Type: EventRead, ConversationID: "d1"}, "ana")
+	if _, ok := h.subs["ana"]; ok {
+		t.Error("hub still holds ana after their only subscription closed")
+	}
+}
@@ -1,11 +1,46 @@
 package config
 
-import "os"
+import (
+	"errors"
+	"os"
+	"strings"
+)
 
 type Config struct {
-	Port        string
-	Environment string
-	IsDev       bool
+	Port         string
+	Environment  string
+	IsDev        bool
+	StoreDriver  string
+	DatabasePath string
+	AutoMigrate  bool
+
+	// OverrideDir holds files that replace the built-in templates and
+	// static files at the same paths, such as static/css/style.css or
+	// templates/layouts/base.html, for theming a node.
+	OverrideDir string
+
+	// SecretKey signs CSRF tokens. Without SECRET_KEY a random key is used
+	// and tokens stop working when the server restarts.
+	SecretKey string
+
+	// CSPImageHosts and CSPMediaHosts are extra origins the
+	// Content-Security-Policy allows images and audio or video from, from
+	// the comma-separated CSP_IMG_HOSTS and CSP_MEDIA_HOSTS.
+	CSPImageHosts []string
+	CSPMediaHosts []string
+
+	// BaseURL is the public origin used in links sent by email. It must be
+	// set in production; in development links fall back to the request's
+	// Host header.
+	BaseURL string
+
+	MailTransport string
+	MailFrom      string
+	MailDir       string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
 }
 
 func NewConfig() *Config {
@@ -17,9 +52,82 @@ func NewConfig() *Config {
 	env := os.Getenv("ENV")
 	isDev := env != "production"
 
+	// STORE=memory runs without a database file; nothing is persisted
+	storeDriver := "sqlite"
+	if envStore := os.Getenv("STORE"); envStore != "" {
+		storeDriver = envStore
+	}
+
+	dbPath := "data/circles.db"
+	if envDBPath := os.Getenv("DATABASE_PATH"); envDBPath != "" {
+		dbPath = envDBPath
+	}
+
+	// AUTO_MIGRATE=true applies pending migrations at startup instead of
+	// refusing to serve
+	autoMigrate := os.Getenv("AUTO_MIGRATE") == "true"
+
+	// MAIL_TRANSPORT picks how email is delivered: "smtp" through
+	// SMTP_HOST, "file" as .eml files in MAIL_DIR, or, in development only,
+	// "log" to the server log
+	mailTransport := "smtp"
+	if isDev {
+		mailTransport = "log"
+	}
+	mailTransport = getEnv("MAIL_TRANSPORT", mailTransport)
+
 	return &Config{
-		Port:        port,
-		Environment: env,
-		IsDev:       isDev,
+		Port:          port,
+		Environment:   env,
+		IsDev:         isDev,
+		StoreDriver:   storeDriver,
+		DatabasePath:  dbPath,
+		AutoMigrate:   autoMigrate,
+		OverrideDir:   os.Getenv("OVERRIDE_DIR"),
+		SecretKey:     os.Getenv("SECRET_KEY"),
+		CSPImageHosts: getList("CSP_IMG_HOSTS"),
+		CSPMediaHosts: getList("CSP_MEDIA_HOSTS"),
+		BaseURL:       strings.TrimSuffix(os.Getenv("BASE_URL"), "/"),
+		MailTransport: mailTransport,
+		MailFrom:      getEnv("MAIL_FROM", "circles.diy <noreply@circles.diy>"),
+		MailDir:       getEnv("MAIL_DIR", "data/mail"),
+		SMTPHost:      os.Getenv("SMTP_HOST"),
+		SMTPPort:      getEnv("SMTP_PORT", "587"),
+		SMTPUsername:  os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:  os.Getenv("SMTP_PASSWORD"),
 	}
-}
\ No newline at end of file
+}
+
+// Validate reports settings the server must not run with. In production
+// sign-in links must not be built from request headers, which anyone can
+// forge, nor written to the log.
+func (c *Config) Validate() error {
+	if c.IsDev {
+		return nil
+	}
+	if c.BaseURL == "" {
+		return errors.New("BASE_URL must be set when ENV=production")
+	}
+	if c.MailTransport == "log" {
+		return errors.New("MAIL_TRANSPORT=log writes sign-in links to the log; use smtp or file when ENV=production")
+	}
+	return nil
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getList splits a comma-separated variable, dropping empty entries.
+func getList(key string) []string {
+	var list []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
+}
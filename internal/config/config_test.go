@@ -0,0 +1,34 @@
+package config
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"development defaults", Config{IsDev: true, MailTransport: "log"}, true},
+		{"production", Config{BaseURL: "https://circles.diy", MailTransport: "smtp"}, true},
+		{"production file mail", Config{BaseURL: "https://circles.diy", MailTransport: "file"}, true},
+		{"production without BASE_URL", Config{MailTransport: "smtp"}, false},
+		{"production logging mail", Config{BaseURL: "https://circles.diy", MailTransport: "log"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestMailTransportDefault(t *testing.T) {
+	t.Setenv("MAIL_TRANSPORT", "")
+	t.Setenv("ENV", "production")
+	if got := NewConfig().MailTransport; got != "smtp" {
+		t.Errorf("production MailTransport = %q, want smtp", got)
+	}
+	t.Setenv("ENV", "")
+	if got := NewConfig().MailTransport; got != "log" {
+		t.Errorf("development MailTransport = %q, want log", got)
+	}
+}
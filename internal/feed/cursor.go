@@ -0,0 +1,71 @@
+package feed
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"circles.diy/internal/models"
+)
+
+// ErrInvalidCursor is returned for mixed feed cursors that can't be read.
+var ErrInvalidCursor = errors.New("invalid feed cursor")
+
+// MixCursor marks a place in the mixed feed: the time its first page was
+// ranked at, and the score and ID of the last item shown. Later pages are
+// ranked as of the same time, so new posts and replies don't move items
+// from one page to another.
+type MixCursor struct {
+	At    time.Time
+	Score float64
+	ID    string
+}
+
+// ParseMixCursor reads a cursor made by String. The empty cursor is the
+// zero MixCursor, the start of the feed.
+func ParseMixCursor(cursor string) (MixCursor, error) {
+	if cursor == "" {
+		return MixCursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return MixCursor{}, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return MixCursor{}, ErrInvalidCursor
+	}
+	at, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return MixCursor{}, ErrInvalidCursor
+	}
+	score, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return MixCursor{}, ErrInvalidCursor
+	}
+	return MixCursor{At: at.UTC(), Score: score, ID: parts[2]}, nil
+}
+
+func (c MixCursor) String() string {
+	raw := c.At.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatFloat(c.Score, 'g', -1, 64) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Page returns up to limit of items, ranked by Rank as of c.At, that come
+// after the cursor, and the cursor for the rest, empty on the last page.
+func (c MixCursor) Page(items []models.FeedItem, limit int) ([]models.FeedItem, string) {
+	start := 0
+	if c.ID != "" {
+		for start < len(items) && !ranksAbove(c.Score, c.ID, items[start].Reason.Score, items[start].ID) {
+			start++
+		}
+	}
+	items = items[start:]
+	if len(items) <= limit {
+		return items, ""
+	}
+	last := items[limit-1]
+	return items[:limit], MixCursor{At: c.At, Score: last.Reason.Score, ID: last.ID}.String()
+}
@@ -0,0 +1,72 @@
+package feed
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"circles.diy/internal/models"
+)
+
+func TestMixCursorRoundTrip(t *testing.T) {
+	want := MixCursor{At: time.Date(2026, 3, 14, 15, 9, 26, 5, time.UTC), Score: 0.1 + 0.2, ID: "with|bar"}
+	got, err := ParseMixCursor(want.String())
+	if err != nil || !got.At.Equal(want.At) || got.Score != want.Score || got.ID != want.ID {
+		t.Errorf("ParseMixCursor(String()) = %+v, %v; want %+v", got, err, want)
+	}
+	if got, err := ParseMixCursor(""); err != nil || got != (MixCursor{}) {
+		t.Errorf("ParseMixCursor(\"\") = %+v, %v; want the zero cursor", got, err)
+	}
+}
+
+func TestParseMixCursorRejectsTampering(t *testing.T) {
+	enc := base64.RawURLEncoding.EncodeToString
+	valid := MixCursor{At: time.Now(), Score: 1.5, ID: "p1"}.String()
+	tests := map[string]string{
+		"not base64":   "not a cursor!",
+		"truncated":    valid[:len(valid)-3],
+		"two parts":    enc([]byte("2026-03-14T15:09:26Z|1.5")),
+		"no ID":        enc([]byte("2026-03-14T15:09:26Z|1.5|")),
+		"bad time":     enc([]byte("yesterday|1.5|p1")),
+		"bad score":    enc([]byte("2026-03-14T15:09:26Z|high|p1")),
+		"store cursor": enc([]byte("2026-03-14T15:09:26Z|p1")),
+	}
+	for name, cursor := range tests {
+		if _, err := ParseMixCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: ParseMixCursor(%q) error = %v, want ErrInvalidCursor", name, cursor, err)
+		}
+	}
+}
+
+// Paging with each returned cursor visits every item once, in order.
+func TestMixCursorPage(t *testing.T) {
+	var items []models.FeedItem
+	for i := 0; i < 7; i++ {
+		// Pairs of equal scores are ordered by ID, highest first
+		items = append(items, models.FeedItem{
+			ID:     fmt.Sprintf("p%d", 9-i),
+			Reason: &models.FeedReason{Score: float64(10 - i/2)},
+		})
+	}
+
+	var seen []string
+	c := MixCursor{At: time.Now()}
+	for pages := 0; pages < 10; pages++ {
+		page, next := c.Page(items, 3)
+		for _, item := range page {
+			seen = append(seen, item.ID)
+		}
+		if next == "" {
+			break
+		}
+		var err error
+		if c, err = ParseMixCursor(next); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fmt.Sprint(seen) != "[p9 p8 p7 p6 p5 p4 p3]" {
+		t.Errorf("paged through %v", seen)
+	}
+}
@@ -0,0 +1,202 @@
+// Package feed decides what goes in a member's feed and in which order.
+// Members pick one of a few plain strategies, the weights of the mixed one
+// are public, and every item carries the reason it was included.
+package feed
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"circles.diy/internal/models"
+)
+
+type Strategy string
+
+const (
+	// Chronological shows everything the member can see, newest first
+	Chronological Strategy = "chronological"
+	Circles       Strategy = "circles"
+	Connections   Strategy = "connections"
+	// Mixed ranks recent posts by the weighted score in MixWeights
+	Mixed Strategy = "mixed"
+)
+
+// Default is the strategy of members who haven't picked one.
+const Default = Chronological
+
+// Strategies lists every strategy in the order they are offered.
+var Strategies = []Strategy{Chronological, Circles, Connections, Mixed}
+
+// MixWindow is how many of the newest posts the mixed feed ranks.
+const MixWindow = 200
+
+// Parse returns the named strategy, or Default and false for unknown names.
+func Parse(name string) (Strategy, bool) {
+	for _, s := range Strategies {
+		if string(s) == name {
+			return s, true
+		}
+	}
+	return Default, false
+}
+
+func (s Strategy) Label() string {
+	switch s {
+	case Circles:
+		return "Circles only"
+	case Connections:
+		return "Connections only"
+	case Mixed:
+		return "Weighted mix"
+	}
+	return "Chronological"
+}
+
+func (s Strategy) Description() string {
+	switch s {
+	case Circles:
+		return "Posts in your circles, newest first."
+	case Connections:
+		return "Posts by people you're connected with, newest first."
+	case Mixed:
+		return "Recent posts ranked by the weights below."
+	}
+	return "Your posts, your circles and your connections, newest first."
+}
+
+// Sources reports which posts the strategy draws from: the member's own,
+// those in their circles and those by their connections.
+func (s Strategy) Sources() (own, circles, connections bool) {
+	switch s {
+	case Circles:
+		return false, true, false
+	case Connections:
+		return false, false, true
+	}
+	return true, true, true
+}
+
+// Weight is one term of the mixed feed's score.
+type Weight struct {
+	Name        string
+	Label       string
+	Description string
+	Weight      float64
+	value       func(item models.FeedItem, now time.Time) float64
+}
+
+// MixWeights are the terms of the mixed feed's score. They add up to 1, so
+// scores run from 0 to 1.
+var MixWeights = []Weight{
+	{
+		Name: "recency", Label: "Recency", Weight: 0.4,
+		Description: "Newer posts score higher; a day-old post gets half.",
+		value: func(item models.FeedItem, now time.Time) float64 {
+			age := now.Sub(item.CreatedAt).Hours()
+			return 1 / (1 + math.Max(age, 0)/24)
+		},
+	},
+	{
+		Name: "circle", Label: "Your circles", Weight: 0.25,
+		Description: "Posted in a circle you're in.",
+		value: func(item models.FeedItem, _ time.Time) float64 {
+			return boolValue(item.Signals.InCircle)
+		},
+	},
+	{
+		Name: "connection", Label: "Your connections", Weight: 0.25,
+		Description: "Posted by someone you're connected with.",
+		value: func(item models.FeedItem, _ time.Time) float64 {
+			return boolValue(item.Signals.Connection)
+		},
+	},
+	{
+		Name: "conversation", Label: "Conversation", Weight: 0.1,
+		Description: "Posts with replies score higher, up to 10 replies.",
+		value: func(item models.FeedItem, _ time.Time) float64 {
+			return math.Min(float64(item.Signals.Replies), 10) / 10
+		},
+	},
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Rank orders items, as loaded newest first from the strategy's sources,
+// and sets the reason each is included.
+func Rank(s Strategy, items []models.FeedItem, now time.Time) []models.FeedItem {
+	for i := range items {
+		items[i].Reason = explain(s, items[i])
+	}
+	if s != Mixed {
+		return items
+	}
+
+	for i := range items {
+		r := items[i].Reason
+		for _, w := range MixWeights {
+			f := models.FeedFactor{Name: w.Name, Label: w.Label, Weight: w.Weight, Value: w.value(items[i], now)}
+			r.Factors = append(r.Factors, f)
+			r.Score += f.Weight * f.Value
+		}
+		r.Score = math.Round(r.Score*1000) / 1000
+		r.Text += " " + mixSummary(r)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return ranksAbove(items[i].Reason.Score, items[i].ID, items[j].Reason.Score, items[j].ID)
+	})
+	return items
+}
+
+// ranksAbove orders mixed feed items by score, breaking ties by ID so
+// every page is cut from the same order.
+func ranksAbove(score float64, id string, otherScore float64, otherID string) bool {
+	if score != otherScore {
+		return score > otherScore
+	}
+	return id > otherID
+}
+
+// explain gives the relationship that put item in the feed, preferring
+// the one the strategy selects on.
+func explain(s Strategy, item models.FeedItem) *models.FeedReason {
+	sig := item.Signals
+	switch {
+	case sig.Own && s != Circles && s != Connections:
+		return &models.FeedReason{Code: "own", Text: "You posted this."}
+	case sig.Connection && s != Circles:
+		text := "Posted by " + item.User.Handle + ", one of your connections."
+		if sig.InCircle && item.Circle != "" {
+			text = "Posted by " + item.User.Handle + ", one of your connections, in " + item.Circle + "."
+		}
+		return &models.FeedReason{Code: "connection", Text: text}
+	case sig.InCircle:
+		return &models.FeedReason{Code: "circle", Text: "Posted in " + item.Circle + ", one of your circles."}
+	}
+	return &models.FeedReason{Code: "visible", Text: "Shared where you can see it."}
+}
+
+// mixSummary names the factors that contributed most to a mixed score.
+func mixSummary(r *models.FeedReason) string {
+	factors := append([]models.FeedFactor(nil), r.Factors...)
+	sort.SliceStable(factors, func(i, j int) bool {
+		return factors[i].Weight*factors[i].Value > factors[j].Weight*factors[j].Value
+	})
+	var top []string
+	for _, f := range factors {
+		if f.Weight*f.Value > 0 && len(top) < 2 {
+			top = append(top, strings.ToLower(f.Label))
+		}
+	}
+	if len(top) == 0 {
+		return fmt.Sprintf("Scored %.2f in your weighted mix.", r.Score)
+	}
+	return fmt.Sprintf("Scored %.2f in your weighted mix, mostly for %s.", r.Score, strings.Join(top, " and "))
+}
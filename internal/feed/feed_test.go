@@ -0,0 +1,167 @@
+package feed
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"circles.diy/internal/models"
+)
+
+var rankNow = time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+
+func item(id string, age time.Duration, signals models.FeedSignals) models.FeedItem {
+	return models.FeedItem{
+		ID: id, User: models.User{Handle: "@" + id}, Circle: "Garden",
+		CreatedAt: rankNow.Add(-age), Signals: signals,
+	}
+}
+
+func ids(items []models.FeedItem) []string {
+	var list []string
+	for _, it := range items {
+		list = append(list, it.ID)
+	}
+	return list
+}
+
+func TestRankMixed(t *testing.T) {
+	both := models.FeedSignals{InCircle: true, Connection: true}
+	circle := models.FeedSignals{InCircle: true}
+	tests := []struct {
+		name   string
+		items  []models.FeedItem
+		want   []string
+		scores []float64
+	}{
+		{
+			name: "by score",
+			items: []models.FeedItem{
+				item("new", 0, models.FeedSignals{}),
+				item("busy", time.Hour, models.FeedSignals{Connection: true, Replies: 25}),
+				item("friend", 24*time.Hour, both),
+			},
+			// 0.4; 0.4/(1+1/24) + 0.25 + 0.1; 0.2 + 0.25 + 0.25
+			want:   []string{"busy", "friend", "new"},
+			scores: []float64{0.4, 0.734, 0.7},
+		},
+		{
+			name: "recency only",
+			items: []models.FeedItem{
+				item("a", 0, models.FeedSignals{}),
+				item("b", 24*time.Hour, models.FeedSignals{}),
+				item("c", 72*time.Hour, models.FeedSignals{}),
+			},
+			want:   []string{"a", "b", "c"},
+			scores: []float64{0.4, 0.2, 0.1},
+		},
+		{
+			name: "future posts count as new",
+			items: []models.FeedItem{
+				item("now", 0, circle),
+				item("later", -time.Hour, circle),
+			},
+			want:   []string{"now", "later"},
+			scores: []float64{0.65, 0.65},
+		},
+		{
+			name: "ties by ID, highest first",
+			items: []models.FeedItem{
+				item("p2", 24*time.Hour, circle),
+				item("p3", 24*time.Hour, circle),
+				item("p1", 24*time.Hour, circle),
+			},
+			want:   []string{"p3", "p2", "p1"},
+			scores: []float64{0.45, 0.45, 0.45},
+		},
+		{
+			// A second's age is lost to rounding, so the order is
+			// the same whichever page the items are loaded on
+			name: "near ties round to ties",
+			items: []models.FeedItem{
+				item("p1", 24*time.Hour, circle),
+				item("p2", 24*time.Hour+time.Second, circle),
+			},
+			want:   []string{"p2", "p1"},
+			scores: []float64{0.45, 0.45},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores := make(map[string]float64)
+			for i, it := range tt.items {
+				scores[it.ID] = tt.scores[i]
+			}
+			got := Rank(Mixed, tt.items, rankNow)
+			if !slices.Equal(ids(got), tt.want) {
+				t.Errorf("order = %v, want %v", ids(got), tt.want)
+			}
+			for _, it := range got {
+				if it.Reason.Score != scores[it.ID] {
+					t.Errorf("%s scored %v, want %v", it.ID, it.Reason.Score, scores[it.ID])
+				}
+				if len(it.Reason.Factors) != len(MixWeights) {
+					t.Errorf("%s has %d factors, want %d", it.ID, len(it.Reason.Factors), len(MixWeights))
+				}
+			}
+		})
+	}
+}
+
+// Rank's order agrees with ranksAbove, which cursors page by.
+func TestRankMatchesCursorOrder(t *testing.T) {
+	var items []models.FeedItem
+	for i, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		items = append(items, item(id, time.Duration(i%3)*12*time.Hour, models.FeedSignals{InCircle: i%2 == 0}))
+	}
+	got := Rank(Mixed, items, rankNow)
+	for i := 1; i < len(got); i++ {
+		a, b := got[i-1], got[i]
+		if !ranksAbove(a.Reason.Score, a.ID, b.Reason.Score, b.ID) {
+			t.Errorf("%s (%v) ranked above %s (%v)", a.ID, a.Reason.Score, b.ID, b.Reason.Score)
+		}
+	}
+}
+
+func TestRankKeepsOrderOutsideMixed(t *testing.T) {
+	for _, s := range []Strategy{Chronological, Circles, Connections} {
+		items := []models.FeedItem{
+			item("old", 0, models.FeedSignals{}),
+			item("friend", time.Hour, models.FeedSignals{Connection: true, Replies: 10}),
+		}
+		got := Rank(s, items, rankNow)
+		if !slices.Equal(ids(got), []string{"old", "friend"}) {
+			t.Errorf("%s: order = %v, want as loaded", s, ids(got))
+		}
+		for _, it := range got {
+			if it.Reason == nil || it.Reason.Score != 0 || it.Reason.Factors != nil {
+				t.Errorf("%s: %s reason = %+v, want no score", s, it.ID, it.Reason)
+			}
+		}
+	}
+}
+
+func TestRankReasons(t *testing.T) {
+	all := models.FeedSignals{Own: true, InCircle: true, Connection: true}
+	tests := []struct {
+		strategy Strategy
+		signals  models.FeedSignals
+		code     string
+		text     string
+	}{
+		{Chronological, all, "own", "You posted this."},
+		{Circles, all, "circle", "Posted in Garden, one of your circles."},
+		{Connections, all, "connection", "Posted by @p1, one of your connections, in Garden."},
+		{Chronological, models.FeedSignals{Connection: true}, "connection", "Posted by @p1, one of your connections."},
+		{Chronological, models.FeedSignals{}, "visible", "Shared where you can see it."},
+		{Mixed, models.FeedSignals{Connection: true}, "connection",
+			"Posted by @p1, one of your connections. Scored 0.65 in your weighted mix, mostly for recency and your connections."},
+		{Mixed, models.FeedSignals{}, "visible", "Shared where you can see it. Scored 0.40 in your weighted mix, mostly for recency."},
+	}
+	for _, tt := range tests {
+		got := Rank(tt.strategy, []models.FeedItem{item("p1", 0, tt.signals)}, rankNow)[0].Reason
+		if got.Code != tt.code || got.Text != tt.text {
+			t.Errorf("%s %+v: reason = %s %q, want %s %q", tt.strategy, tt.signals, got.Code, got.Text, tt.code, tt.text)
+		}
+	}
+}
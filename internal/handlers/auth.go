@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"circles.diy/internal/auth"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+	"circles.diy/internal/utils"
+)
+
+// safeNext keeps post-login redirects on this site. Anything that is not a
+// plain local path falls back to the dashboard.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/dashboard"
+	}
+	return next
+}
+
+func newAuthPageData(ctx context.Context, title, next string) models.AuthPageData {
+	return models.AuthPageData{
+		BaseData: newBaseData(ctx, title, ""),
+		Next:     next,
+		Values:   map[string]string{},
+		Errors:   map[string]string{},
+	}
+}
+
+func renderAuthPage(w http.ResponseWriter, r *http.Request, status int, name string, data models.AuthPageData) {
+	render(w, r, templates.View{Set: name, Page: name, Data: data, Status: status})
+}
+
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if _, signedIn := auth.CurrentUser(r.Context()); signedIn {
+		http.Redirect(w, r, safeNext(r.URL.Query().Get("next")), http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data := newAuthPageData(r.Context(), "Sign in", r.URL.Query().Get("next"))
+		renderAuthPage(w, r, http.StatusOK, "login", data)
+	case http.MethodPost:
+		login(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func login(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	data := newAuthPageData(ctx, "Sign in", r.FormValue("next"))
+	identifier := strings.TrimSpace(r.FormValue("login"))
+	data.Values["login"] = identifier
+
+	account, err := findAccount(ctx, identifier)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error looking up account: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// Unknown accounts still go through a hash comparison, so the response
+	// time does not reveal which accounts exist
+	if !auth.CheckPassword(account.PasswordHash, r.FormValue("password")) {
+		data.Errors["form"] = "That email or handle and password don't match."
+		renderAuthPage(w, r, http.StatusUnauthorized, "login", data)
+		return
+	}
+
+	if err := auth.StartSession(ctx, w, account.UserID); err != nil {
+		log.Printf("Error starting session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, safeNext(data.Next), http.StatusSeeOther)
+}
+
+// findAccount looks an account up by email address or handle.
+func findAccount(ctx context.Context, identifier string) (models.Account, error) {
+	if email, ok := utils.ValidateEmail(identifier); ok {
+		return dataStore.GetAccountByEmail(ctx, email)
+	}
+	handle, ok := utils.ValidateHandle(identifier)
+	if !ok {
+		return models.Account{}, store.ErrNotFound
+	}
+	user, err := dataStore.GetUserByHandle(ctx, handle)
+	if err != nil {
+		return models.Account{}, err
+	}
+	return dataStore.GetAccount(ctx, user.ID)
+}
+
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if _, signedIn := auth.CurrentUser(r.Context()); signedIn {
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data := newAuthPageData(r.Context(), "Create an account", r.URL.Query().Get("next"))
+		renderAuthPage(w, r, http.StatusOK, "register", data)
+	case http.MethodPost:
+		register(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func register(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	data := newAuthPageData(ctx, "Create an account", r.FormValue("next"))
+	for _, field := range []string{"name", "handle", "email"} {
+		data.Values[field] = strings.TrimSpace(r.FormValue(field))
+	}
+
+	name, ok := utils.ValidateDisplayName(data.Values["name"])
+	if !ok {
+		data.Errors["name"] = "Enter a name of up to 80 characters."
+	}
+	handle, ok := utils.ValidateHandle(data.Values["handle"])
+	if !ok {
+		data.Errors["handle"] = "Handles are 3-30 lowercase letters, numbers or underscores."
+	}
+	email, ok := utils.ValidateEmail(data.Values["email"])
+	if !ok {
+		data.Errors["email"] = "Enter a valid email address."
+	}
+	// The password is optional; without one the account signs in by link
+	password := r.FormValue("password")
+	if password != "" {
+		switch auth.ValidatePassword(password) {
+		case auth.ErrPasswordTooShort:
+			data.Errors["password"] = "Use at least 10 characters."
+		case auth.ErrPasswordTooLong:
+			data.Errors["password"] = "Use at most 72 characters."
+		}
+	}
+	if len(data.Errors) > 0 {
+		renderAuthPage(w, r, http.StatusUnprocessableEntity, "register", data)
+		return
+	}
+
+	var hash string
+	if password != "" {
+		var err error
+		if hash, err = auth.HashPassword(password); err != nil {
+			log.Printf("Error hashing password: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	user := models.User{ID: utils.NewID(), Handle: handle, Name: name}
+	err := dataStore.CreateAccount(ctx, user, models.Account{Email: email, PasswordHash: hash})
+	switch {
+	case errors.Is(err, store.ErrHandleTaken):
+		data.Errors["handle"] = "That handle is already taken."
+	case errors.Is(err, store.ErrEmailTaken):
+		data.Errors["email"] = "An account with that email already exists."
+	case err != nil:
+		log.Printf("Error creating account: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(data.Errors) > 0 {
+		renderAuthPage(w, r, http.StatusConflict, "register", data)
+		return
+	}
+
+	log.Printf("New account registered: %s", handle)
+
+	// Passwordless accounts prove they own the address before signing in
+	if hash == "" {
+		sendLoginLink(r, user, email, data.Next)
+		login := newAuthPageData(ctx, "Sign in", data.Next)
+		login.Values["email"] = email
+		login.Notice = "Account created. Check your email for a link to sign in."
+		renderAuthPage(w, r, http.StatusOK, "login", login)
+		return
+	}
+
+	if err := auth.StartSession(ctx, w, user.ID); err != nil {
+		log.Printf("Error starting session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, safeNext(data.Next), http.StatusSeeOther)
+}
+
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	if err := auth.EndSession(w, r); err != nil {
+		log.Printf("Error ending session: %v", err)
+	}
+	// Drop whatever the browser kept of this person's pages and files
+	w.Header().Set("Clear-Site-Data", `"cache"`)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
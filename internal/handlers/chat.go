@@ -1,21 +1,338 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"circles.diy/internal/chat"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
 	"circles.diy/internal/templates"
+	"circles.diy/internal/utils"
 )
 
+const (
+	chatMessageCount = 50
+	maxMessageLength = 4000
+)
+
+// chatHub delivers new messages to the chat pages participants have open.
+var chatHub = chat.NewHub()
+
+// sendMu makes storing a message and publishing it one step, so streams
+// see messages in the order the store numbers them and a stream resuming
+// after one misses none stored before it.
+var sendMu sync.Mutex
+
 func ChatHandler(w http.ResponseWriter, r *http.Request) {
-	// Get mock chat data
-	data := templates.GetMockChatData()
-	
-	// Render the chat template
-	err := templates.GetTemplates().Chat.ExecuteTemplate(w, "chat", data)
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	// Conversations are private and change with every message, so no page
+	// or fragment is kept by the browser or anything between. Attachments
+	// and the event stream set their own caching.
+	w.Header().Set("Cache-Control", "no-store")
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/chat"), "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "events":
+		chatEventsHandler(w, r, userID)
+	case len(parts) == 1 && parts[0] == "settings":
+		chatSettingsHandler(w, r, userID)
+	case len(parts) == 1 && parts[0] == "new":
+		newGroupHandler(w, r, userID)
+	case len(parts) == 2 && parts[0] == "attachments":
+		attachmentHandler(w, r, parts[1], userID, false)
+	case len(parts) == 3 && parts[0] == "attachments" && parts[2] == "thumbnail":
+		attachmentHandler(w, r, parts[1], userID, true)
+	case len(parts) <= 1:
+		// /chat opens the most recent conversation, /chat/:id a specific one
+		conversationID := ""
+		if len(parts) == 1 {
+			conversationID = parts[0]
+		}
+		chatPageHandler(w, r, userID, conversationID)
+	case len(parts) == 2 && parts[1] == "messages":
+		sendMessageHandler(w, r, parts[0], userID)
+	case len(parts) == 2 && parts[1] == "attachments":
+		uploadAttachmentHandler(w, r, parts[0], userID, false)
+	case len(parts) == 2 && parts[1] == "voice":
+		uploadAttachmentHandler(w, r, parts[0], userID, true)
+	case len(parts) == 2 && parts[1] == "read":
+		readConversationHandler(w, r, parts[0], userID)
+	case len(parts) == 2 && parts[1] == "typing":
+		typingHandler(w, r, parts[0], userID)
+	case len(parts) == 2 && parts[1] == "members":
+		groupMembersHandler(w, r, parts[0], userID)
+	case len(parts) == 3 && parts[1] == "members" && parts[2] == "remove":
+		removeGroupMemberHandler(w, r, parts[0], userID)
+	case len(parts) == 3 && parts[1] == "members" && parts[2] == "role":
+		setGroupRoleHandler(w, r, parts[0], userID)
+	case len(parts) == 2 && parts[1] == "settings":
+		groupSettingsHandler(w, r, parts[0], userID)
+	case len(parts) == 2 && parts[1] == "leave":
+		leaveGroupHandler(w, r, parts[0], userID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func chatPageHandler(w http.ResponseWriter, r *http.Request, userID, conversationID string) {
+	presenceTracker.Touch(userID)
+	data, err := loadChatData(r.Context(), userID, conversationID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading chat data: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, templates.View{
+		Set:       "chat",
+		Page:      "chat",
+		Fragments: map[string]templates.Fragment{"chat-main": {Name: "chat-main"}},
+		Data:      data,
+	})
+}
+
+func loadChatData(ctx context.Context, userID, conversationID string) (models.ChatPageData, error) {
+	data := models.ChatPageData{BaseData: newBaseData(ctx, "Chat", "chat")}
+
+	var err error
+	if data.Conversations, err = dataStore.ListConversations(ctx, userID); err != nil {
+		return data, err
+	}
+	if data.Contacts, err = dataStore.ListContacts(ctx, userID); err != nil {
+		return data, err
+	}
+	if data.LastMessageID, err = dataStore.LatestMessageID(ctx, userID); err != nil {
+		return data, err
+	}
+	if data.ReadReceipts, err = dataStore.GetReadReceipts(ctx, userID); err != nil {
+		return data, err
+	}
+	if data.SharePresence, err = dataStore.GetSharePresence(ctx, userID); err != nil {
+		return data, err
+	}
+	for i := range data.Conversations {
+		conversationPresence(&data.Conversations[i])
+	}
+	contactsPresence(data.Contacts)
+
+	if conversationID == "" {
+		if len(data.Conversations) == 0 {
+			return data, nil
+		}
+		conversationID = data.Conversations[0].ID
+	}
+
+	active, err := dataStore.GetConversation(ctx, conversationID, userID)
 	if err != nil {
-		log.Printf("Error rendering chat template: %v", err)
+		return data, err
+	}
+	// Opening a conversation reads it
+	if err := markRead(ctx, active, userID); err != nil {
+		return data, err
+	}
+	active.IsActive = true
+	active.UnreadCount = 0
+	conversationPresence(&active)
+	data.ActiveChat = &active
+	for i := range data.Conversations {
+		if data.Conversations[i].ID == active.ID {
+			data.Conversations[i].IsActive = true
+			data.Conversations[i].UnreadCount = 0
+		}
+	}
+	if data.Messages, err = dataStore.ListMessages(ctx, conversationID, userID, chatMessageCount); err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+// sendMessageHandler adds a message to a conversation and publishes it to
+// its participants. HTMX gets the message to append to the list; others
+// go back to the conversation.
+func sendMessageHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	ctx := r.Context()
+	conversation, err := dataStore.GetConversation(ctx, conversationID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading conversation %s: %v", conversationID, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-}
\ No newline at end of file
+
+	presenceTracker.Touch(userID)
+	content := strings.TrimSpace(r.FormValue("content"))
+	switch {
+	case content == "":
+		http.Error(w, "Write something to send.", http.StatusUnprocessableEntity)
+		return
+	case utf8.RuneCountInString(content) > maxMessageLength:
+		http.Error(w, "Keep messages under 4000 characters.", http.StatusUnprocessableEntity)
+		return
+	}
+
+	message := models.Message{
+		ID:        utils.NewID(),
+		Content:   content,
+		Type:      "text",
+		Sender:    models.User{ID: userID},
+		CreatedAt: time.Now(),
+	}
+	recipients := []string{userID}
+	for _, p := range conversation.Participants {
+		recipients = append(recipients, p.ID)
+	}
+
+	saved, err := postMessage(ctx, conversation.ID, message, recipients)
+	if err != nil {
+		log.Printf("Error saving message to conversation %s: %v", conversation.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !wantsFragment(r) {
+		http.Redirect(w, r, "/chat/"+url.PathEscape(conversation.ID)+"#message-"+saved.ID, http.StatusSeeOther)
+		return
+	}
+	render(w, r, templates.View{Set: "chat", Fragment: "chat-message", Data: saved})
+}
+
+// postMessage stores a message and publishes it to recipients, returning
+// it as its sender sees it.
+func postMessage(ctx context.Context, conversationID string, message models.Message, recipients []string) (models.Message, error) {
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	if err := dataStore.SaveMessage(ctx, conversationID, message); err != nil {
+		return models.Message{}, err
+	}
+	return publishMessage(ctx, message.ID, message.Sender.ID, recipients)
+}
+
+// publishMessage sends a stored message to recipients, returning it as
+// viewerID sees it. The caller holds sendMu, so messages go out in the
+// order they were stored.
+func publishMessage(ctx context.Context, messageID, viewerID string, recipients []string) (models.Message, error) {
+	saved, err := dataStore.GetMessage(ctx, messageID, viewerID)
+	if err != nil {
+		return saved, err
+	}
+	chatHub.Publish(chat.Event{Type: chat.EventMessage, ConversationID: saved.ConversationID, Message: saved}, recipients...)
+	return saved, nil
+}
+
+// markRead moves userID's read cursor to the end of the conversation. When
+// it moves, their other pages are told, and so are the other participants
+// unless userID has turned read receipts off.
+func markRead(ctx context.Context, conversation models.Conversation, userID string) error {
+	moved, err := dataStore.MarkConversationRead(ctx, conversation.ID, userID)
+	if err != nil || !moved {
+		return err
+	}
+	receipts, err := dataStore.GetReadReceipts(ctx, userID)
+	if err != nil {
+		return err
+	}
+	recipients := []string{userID}
+	if receipts {
+		for _, p := range conversation.Participants {
+			recipients = append(recipients, p.ID)
+		}
+	}
+	chatHub.Publish(chat.Event{Type: chat.EventRead, ConversationID: conversation.ID, UserID: userID}, recipients...)
+	return nil
+}
+
+// readConversationHandler marks a conversation read, which the chat page
+// does when a message arrives in the conversation it has open.
+func readConversationHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	ctx := r.Context()
+	conversation, err := dataStore.GetConversation(ctx, conversationID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err == nil {
+		presenceTracker.Touch(userID)
+		err = markRead(ctx, conversation, userID)
+	}
+	if err != nil {
+		log.Printf("Error marking conversation %s read: %v", conversationID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !wantsFragment(r) {
+		http.Redirect(w, r, "/chat/"+url.PathEscape(conversation.ID), http.StatusSeeOther)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// chatSettingsHandler saves whether the member sends read receipts and
+// shares their presence. HTMX gets the settings form back; others return
+// to chat.
+func chatSettingsHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	ctx := r.Context()
+	receipts := r.FormValue("read_receipts") == "on"
+	share := r.FormValue("share_presence") == "on"
+	err := dataStore.SetReadReceipts(ctx, userID, receipts)
+	if err == nil {
+		err = dataStore.SetSharePresence(ctx, userID, share)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving chat settings for %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	presenceTracker.SetHidden(userID, !share)
+
+	if !wantsFragment(r) {
+		http.Redirect(w, r, "/chat", http.StatusSeeOther)
+		return
+	}
+	render(w, r, templates.View{
+		Set:      "chat",
+		Fragment: "chat-settings",
+		Data: models.ChatPageData{
+			BaseData:      newBaseData(ctx, "Chat", "chat"),
+			ReadReceipts:  receipts,
+			SharePresence: share,
+		},
+	})
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"circles.diy/internal/media"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+	"circles.diy/internal/utils"
+)
+
+const (
+	// maxUploadBody leaves room around the largest file for the caption
+	// and multipart framing
+	maxUploadBody = 21 << 20
+	// uploadMemory is how much of an upload is held in memory before the
+	// rest goes to a temporary file
+	uploadMemory      = 1 << 20
+	maxFileNameLength = 200
+)
+
+// uploadAttachmentHandler sends an uploaded file as a message, with an
+// optional caption: an image, which gets a thumbnail, a PDF, text or zip
+// file, or with voice set, a recorded voice note. HTMX gets the message to
+// append to the list; others go back to the conversation.
+func uploadAttachmentHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string, voice bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBody)
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Files can be up to 20 MB.", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	ctx := r.Context()
+	conversation, err := dataStore.GetConversation(ctx, conversationID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading conversation %s: %v", conversationID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	presenceTracker.Touch(userID)
+	caption := strings.TrimSpace(r.FormValue("content"))
+	if utf8.RuneCountInString(caption) > maxMessageLength {
+		http.Error(w, "Keep messages under 4000 characters.", http.StatusUnprocessableEntity)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Choose a file to send.", http.StatusUnprocessableEntity)
+		return
+	}
+	defer file.Close()
+
+	head := make([]byte, media.SniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		log.Printf("Error reading upload: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	kind, contentType, ok := media.Sniff(head[:n], voice)
+	switch {
+	case !ok && voice:
+		http.Error(w, "Voice notes must be Opus audio in WebM or Ogg.", http.StatusUnsupportedMediaType)
+		return
+	case !ok:
+		http.Error(w, "Send a JPEG, PNG, GIF or WebP image, or a PDF, text or zip file.", http.StatusUnsupportedMediaType)
+		return
+	case header.Size > media.MaxSize[kind]:
+		http.Error(w, fmt.Sprintf("Keep %s under %d MB.", kindPlural(kind), media.MaxSize[kind]>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	data, err := io.ReadAll(io.MultiReader(bytes.NewReader(head[:n]), file))
+	if err != nil {
+		log.Printf("Error reading upload: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	attachment := models.Attachment{
+		ID:             utils.NewID(),
+		ConversationID: conversation.ID,
+		MessageID:      utils.NewID(),
+		UploaderID:     userID,
+		Kind:           kind,
+		Name:           attachmentName(header.Filename, kind, contentType),
+		ContentType:    contentType,
+		Size:           int64(len(data)),
+		Data:           data,
+		CreatedAt:      time.Now(),
+	}
+	if kind == media.Image {
+		attachment.Thumbnail, err = media.Thumbnail(data, contentType)
+		if errors.Is(err, media.ErrUnreadableImage) {
+			http.Error(w, "That image couldn't be read, or is too large.", http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			log.Printf("Error making thumbnail: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	link := "/chat/attachments/" + attachment.ID
+	item := &models.MediaItem{
+		URL:         link,
+		Alt:         attachment.Name,
+		Name:        attachment.Name,
+		ContentType: contentType,
+		Size:        attachment.Size,
+	}
+	if len(attachment.Thumbnail) > 0 {
+		item.Thumbnail = link + "/thumbnail"
+	}
+	recipients := []string{userID}
+	for _, p := range conversation.Participants {
+		recipients = append(recipients, p.ID)
+	}
+	saved, err := postAttachment(ctx, attachment, models.Message{
+		ID:        attachment.MessageID,
+		Content:   caption,
+		Type:      kind,
+		Media:     item,
+		Sender:    models.User{ID: userID},
+		CreatedAt: attachment.CreatedAt,
+	}, recipients)
+	if err != nil {
+		log.Printf("Error saving attachment to conversation %s: %v", conversation.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !wantsFragment(r) {
+		http.Redirect(w, r, "/chat/"+url.PathEscape(conversation.ID)+"#message-"+saved.ID, http.StatusSeeOther)
+		return
+	}
+	render(w, r, templates.View{Set: "chat", Fragment: "chat-message", Data: saved})
+}
+
+// postAttachment stores an attachment with the message that sends it and
+// sends the message to recipients, like postMessage.
+func postAttachment(ctx context.Context, attachment models.Attachment, message models.Message, recipients []string) (models.Message, error) {
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	if err := dataStore.SaveAttachment(ctx, attachment, message); err != nil {
+		return models.Message{}, err
+	}
+	return publishMessage(ctx, message.ID, message.Sender.ID, recipients)
+}
+
+func kindPlural(kind string) string {
+	switch kind {
+	case media.Image:
+		return "images"
+	case media.Voice:
+		return "voice notes"
+	}
+	return "files"
+}
+
+// attachmentName keeps the base of the uploaded file's name, without
+// control characters, or names it after its kind.
+func attachmentName(filename, kind, contentType string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filepath.Base(strings.ReplaceAll(filename, "\\", "/")))
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		name = kind
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	if utf8.RuneCountInString(name) > maxFileNameLength {
+		name = string([]rune(name)[:maxFileNameLength])
+	}
+	return name
+}
+
+// attachmentHandler serves an attachment, or its thumbnail, to those who
+// can see the message it was sent with. Files are always downloaded rather
+// than shown.
+func attachmentHandler(w http.ResponseWriter, r *http.Request, attachmentID, userID string, thumbnail bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	attachment, err := dataStore.GetAttachment(r.Context(), attachmentID, userID, thumbnail)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading attachment %s: %v", attachmentID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := attachment.ContentType
+	if thumbnail && attachment.HasThumbnail {
+		contentType = "image/jpeg"
+	}
+	disposition := "inline"
+	if attachment.Kind == media.File {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}))
+	// Attachments never change, but are only for this viewer
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	http.ServeContent(w, r, "", attachment.CreatedAt, bytes.NewReader(attachment.Data))
+}
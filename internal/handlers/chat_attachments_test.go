@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"circles.diy/internal/media"
+)
+
+// upload sends data as ana's file in d1, named filename and declared as
+// contentType by the browser.
+func upload(t *testing.T, filename, contentType string, data []byte, voice bool) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("content", "look")
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="`+filename+`"`)
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/chat/d1/attachments", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	uploadAttachmentHandler(w, r, "d1", "ana", voice)
+	return w
+}
+
+// fetch gets the attachment sent with the message w redirected to, as
+// viewerID.
+func fetch(t *testing.T, w *httptest.ResponseRecorder, viewerID string) *httptest.ResponseRecorder {
+	t.Helper()
+	_, messageID, _ := strings.Cut(w.Header().Get("Location"), "#message-")
+	message, err := dataStore.GetMessage(context.Background(), messageID, "ana")
+	if err != nil || message.Media == nil {
+		t.Fatalf("sent message %q = %+v, %v", messageID, message, err)
+	}
+	r := httptest.NewRequest(http.MethodGet, message.Media.URL, nil)
+	got := httptest.NewRecorder()
+	attachmentHandler(got, r, strings.TrimPrefix(message.Media.URL, "/chat/attachments/"), viewerID, false)
+	return got
+}
+
+func pngBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// What was sent decides how it is stored and served, whatever its name
+// and declared type say.
+func TestUploadAttachmentSniffs(t *testing.T) {
+	tests := []struct {
+		name                  string
+		filename, contentType string
+		data                  []byte
+		wantType, wantDisp    string
+	}{
+		{"image", "cat.png", "image/png", pngBytes(t, 4, 4), "image/png", `inline; filename=cat.png`},
+		{"image named as text", "cat.txt", "text/plain", pngBytes(t, 4, 4), "image/png", `inline; filename=cat.txt`},
+		{"text named as an image", "cat.png", "image/png", []byte("not a cat"), "text/plain; charset=utf-8", `attachment; filename=cat.png`},
+		{"svg", "logo.svg", "image/svg+xml", []byte("<svg xmlns='http://www.w3.org/2000/svg'><script>alert(1)</script></svg>"),
+			"text/plain; charset=utf-8", `attachment; filename=logo.svg`},
+		{"path in the name", `..\..\etc\passwd`, "text/plain", []byte("root"), "text/plain; charset=utf-8", `attachment; filename=passwd`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newChatStore(t)
+			w := upload(t, tt.filename, tt.contentType, tt.data, false)
+			if w.Code != http.StatusSeeOther {
+				t.Fatalf("upload = %d %s, want 303", w.Code, w.Body)
+			}
+			got := fetch(t, w, "ben")
+			if got.Code != http.StatusOK || !bytes.Equal(got.Body.Bytes(), tt.data) {
+				t.Fatalf("fetch = %d, %d bytes; want 200 with the upload", got.Code, got.Body.Len())
+			}
+			if ct := got.Header().Get("Content-Type"); ct != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.wantType)
+			}
+			if cd := got.Header().Get("Content-Disposition"); cd != tt.wantDisp {
+				t.Errorf("Content-Disposition = %q, want %q", cd, tt.wantDisp)
+			}
+			if outsider := fetch(t, w, "cy"); outsider.Code != http.StatusNotFound {
+				t.Errorf("fetch by someone outside = %d, want 404", outsider.Code)
+			}
+		})
+	}
+}
+
+func TestUploadAttachmentRejects(t *testing.T) {
+	tooBig := append(pngBytes(t, 4, 4), make([]byte, media.MaxSize[media.Image])...)
+	tests := []struct {
+		name                  string
+		filename, contentType string
+		data                  []byte
+		voice                 bool
+		want                  int
+	}{
+		{"html", "page.png", "image/png", []byte("<!DOCTYPE html><script>alert(1)</script>"), false, http.StatusUnsupportedMediaType},
+		{"executable", "setup.pdf", "application/pdf", []byte("MZ\x90\x00\x03\x00\x00\x00"), false, http.StatusUnsupportedMediaType},
+		{"image as a voice note", "note.webm", "audio/webm", pngBytes(t, 4, 4), true, http.StatusUnsupportedMediaType},
+		{"image over the size limit", "big.png", "image/png", tooBig, false, http.StatusRequestEntityTooLarge},
+		{"undecodable image", "cat.png", "image/png", pngBytes(t, 40, 40)[:60], false, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newChatStore(t)
+			w := upload(t, tt.filename, tt.contentType, tt.data, tt.voice)
+			if w.Code != tt.want {
+				t.Errorf("upload = %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+			messages, err := dataStore.ListMessages(context.Background(), "d1", "ana", 10)
+			if err != nil || len(messages) != 0 {
+				t.Errorf("rejected upload left %d messages, %v", len(messages), err)
+			}
+		})
+	}
+}
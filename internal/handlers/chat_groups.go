@@ -0,0 +1,572 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"circles.diy/internal/chat"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+	"circles.diy/internal/utils"
+)
+
+// defaultGroupAvatar stands in for a group without a photo.
+const defaultGroupAvatar = "/static/img/icon-192.png"
+
+func newGroupPageData(ctx context.Context, title string) models.ChatGroupPageData {
+	return models.ChatGroupPageData{
+		BaseData: newBaseData(ctx, title, "chat"),
+		Selected: map[string]bool{},
+		Values:   map[string]string{},
+		Errors:   map[string]string{},
+	}
+}
+
+// groupPageData starts the settings page of group with its current name
+// and photo in the form.
+func groupPageData(ctx context.Context, group models.Conversation) models.ChatGroupPageData {
+	data := newGroupPageData(ctx, group.Name)
+	data.Conversation = group
+	data.Values["name"] = group.Name
+	if group.Avatar != defaultGroupAvatar {
+		data.Values["avatar"] = group.Avatar
+	}
+	return data
+}
+
+// readGroupForm validates the submitted name and photo into group.
+func readGroupForm(r *http.Request, data *models.ChatGroupPageData, group *models.Conversation) {
+	for _, field := range []string{"name", "avatar"} {
+		data.Values[field] = strings.TrimSpace(r.FormValue(field))
+	}
+
+	var ok bool
+	if group.Name, ok = utils.ValidateGroupName(data.Values["name"]); !ok {
+		data.Errors["name"] = "Enter a name of up to 60 characters."
+	}
+	if group.Avatar, ok = utils.ValidateImageURL(data.Values["avatar"]); !ok {
+		data.Errors["avatar"] = "Enter an http(s) image URL or leave it blank."
+	}
+	if group.Avatar == "" {
+		group.Avatar = defaultGroupAvatar
+	}
+}
+
+// chosenContacts returns the contacts submitted as user_id, marking them
+// in selected. Anyone who isn't one of the actor's contacts is ignored.
+func chosenContacts(r *http.Request, contacts []models.Contact, selected map[string]bool) []models.User {
+	for _, id := range r.Form["user_id"] {
+		selected[id] = true
+	}
+	var users []models.User
+	for _, c := range contacts {
+		if selected[c.ID] {
+			users = append(users, c.User)
+		}
+	}
+	return users
+}
+
+// firstName is how system messages refer to someone.
+func firstName(u models.User) string {
+	if fields := strings.Fields(u.Name); len(fields) > 0 {
+		return fields[0]
+	}
+	return u.Handle
+}
+
+// listNames joins first names as "Ana, Ben and Cam".
+func listNames(users []models.User) string {
+	names := make([]string, len(users))
+	for i, u := range users {
+		names[i] = firstName(u)
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// systemMessage is a message from actorID telling everyone in a group
+// what happened.
+func systemMessage(actorID, content string) models.Message {
+	return models.Message{
+		ID:        utils.NewID(),
+		Content:   content,
+		Type:      "system",
+		Sender:    models.User{ID: actorID},
+		CreatedAt: time.Now(),
+	}
+}
+
+// groupRecipients lists everyone in a group, actorID first.
+func groupRecipients(ctx context.Context, conversationID, actorID string) ([]string, error) {
+	members, err := dataStore.ListParticipants(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	recipients := []string{actorID}
+	for _, m := range members {
+		if m.User.ID != actorID {
+			recipients = append(recipients, m.User.ID)
+		}
+	}
+	return recipients, nil
+}
+
+// announce posts a system message from actorID to everyone in the group.
+func announce(ctx context.Context, conversationID, actorID, content string) error {
+	recipients, err := groupRecipients(ctx, conversationID, actorID)
+	if err != nil {
+		return err
+	}
+	_, err = postMessage(ctx, conversationID, systemMessage(actorID, content), recipients)
+	return err
+}
+
+// authorizeGroup loads a group conversation as userID sees it. Direct
+// conversations and groups they aren't in get a 404; when admin is set,
+// members who aren't admins get a 403 page. ok is false when the response
+// has been written.
+func authorizeGroup(w http.ResponseWriter, r *http.Request, conversationID, userID string, admin bool) (group models.Conversation, ok bool) {
+	group, err := dataStore.GetConversation(r.Context(), conversationID, userID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !group.IsGroup) {
+		http.NotFound(w, r)
+		return group, false
+	}
+	if err != nil {
+		log.Printf("Error loading conversation %s: %v", conversationID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return group, false
+	}
+	if admin && group.UserRole != models.GroupAdmin {
+		renderForbidden(w, r, "Only admins of "+group.Name+" can do this.")
+		return group, false
+	}
+	return group, true
+}
+
+// renderChatGroup shows a group's settings and members, with the contacts
+// an admin could add.
+func renderChatGroup(w http.ResponseWriter, r *http.Request, status int, data models.ChatGroupPageData) {
+	ctx := r.Context()
+	group := data.Conversation
+	var err error
+	if data.Members, err = dataStore.ListParticipants(ctx, group.ID); err == nil && group.UserRole == models.GroupAdmin {
+		var contacts []models.Contact
+		if contacts, err = dataStore.ListContacts(ctx, currentUserID(r)); err == nil {
+			in := make(map[string]bool, len(data.Members))
+			for _, m := range data.Members {
+				in[m.User.ID] = true
+			}
+			for _, c := range contacts {
+				if !in[c.ID] {
+					data.Contacts = append(data.Contacts, c)
+				}
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Error loading members of conversation %s: %v", group.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, templates.View{Set: "chat-group", Page: "chat-group", Data: data, Status: status})
+}
+
+// newGroupHandler shows the form for starting a group with some of the
+// member's contacts, and creates it with the member as its admin.
+func newGroupHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	ctx := r.Context()
+	data := newGroupPageData(ctx, "New group")
+	var err error
+	if data.Contacts, err = dataStore.ListContacts(ctx, userID); err != nil {
+		log.Printf("Error loading contacts for %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		render(w, r, templates.View{Set: "chat-group", Page: "chat-group", Data: data})
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	group := models.Conversation{ID: utils.NewID(), IsGroup: true}
+	readGroupForm(r, &data, &group)
+	members := chosenContacts(r, data.Contacts, data.Selected)
+	if len(members) == 0 {
+		data.Errors["members"] = "Choose at least one contact to add."
+	}
+	if len(data.Errors) > 0 {
+		render(w, r, templates.View{Set: "chat-group", Page: "chat-group", Data: data, Status: http.StatusUnprocessableEntity})
+		return
+	}
+
+	actor, err := dataStore.GetUser(ctx, userID)
+	if err == nil {
+		group.Participants = append([]models.User{actor}, members...)
+		err = createGroup(ctx, group, actor, members)
+	}
+	if err != nil {
+		log.Printf("Error creating group: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Group %s created by %s", group.ID, userID)
+	redirectAfter(w, r, "/chat/"+group.ID)
+}
+
+// createGroup saves a new group with actor as its admin and tells everyone
+// added to it.
+func createGroup(ctx context.Context, group models.Conversation, actor models.User, members []models.User) error {
+	message := systemMessage(actor.ID, firstName(actor)+" created the group with "+listNames(members))
+	recipients := make([]string, len(group.Participants))
+	for i, u := range group.Participants {
+		recipients[i] = u.ID
+	}
+
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	if err := dataStore.CreateGroup(ctx, group, actor.ID, message); err != nil {
+		return err
+	}
+	_, err := publishMessage(ctx, message.ID, actor.ID, recipients)
+	return err
+}
+
+// groupMembersHandler lists a group's members to anyone in it. Admins post
+// to it to add some of their contacts, who see only what is sent from then
+// on.
+func groupMembersHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	switch r.Method {
+	case http.MethodGet:
+		group, ok := authorizeGroup(w, r, conversationID, userID, false)
+		if !ok {
+			return
+		}
+		renderChatGroup(w, r, http.StatusOK, groupPageData(r.Context(), group))
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	group, ok := authorizeGroup(w, r, conversationID, userID, true)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	data := groupPageData(ctx, group)
+	contacts, err := dataStore.ListContacts(ctx, userID)
+	if err != nil {
+		log.Printf("Error loading contacts for %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	var added []models.User
+	for _, u := range chosenContacts(r, contacts, data.Selected) {
+		if !hasParticipant(group, u.ID) {
+			added = append(added, u)
+		}
+	}
+	if len(added) == 0 {
+		data.Errors["members"] = "Choose at least one contact to add."
+		renderChatGroup(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	actor, err := dataStore.GetUser(ctx, userID)
+	if err == nil {
+		err = addGroupMembers(ctx, group.ID, actor, added)
+	}
+	if err != nil {
+		log.Printf("Error adding members to conversation %s: %v", group.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("%d members added to conversation %s by %s", len(added), group.ID, userID)
+	data.Selected = map[string]bool{}
+	data.Notice = "Added to the group."
+	renderChatGroup(w, r, http.StatusOK, data)
+}
+
+// addGroupMembers adds members to a group and tells everyone in it,
+// including them.
+func addGroupMembers(ctx context.Context, conversationID string, actor models.User, members []models.User) error {
+	message := systemMessage(actor.ID, firstName(actor)+" added "+listNames(members))
+	ids := make([]string, len(members))
+	for i, u := range members {
+		ids[i] = u.ID
+	}
+
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	if err := dataStore.AddGroupMembers(ctx, conversationID, ids, message); err != nil {
+		return err
+	}
+	recipients, err := groupRecipients(ctx, conversationID, actor.ID)
+	if err != nil {
+		return err
+	}
+	_, err = publishMessage(ctx, message.ID, actor.ID, recipients)
+	return err
+}
+
+// removeGroupMemberHandler takes someone out of a group. Admins remove
+// others; everyone leaves by themselves.
+func removeGroupMemberHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	group, ok := authorizeGroup(w, r, conversationID, userID, true)
+	if !ok {
+		return
+	}
+	memberID := r.FormValue("user_id")
+	if memberID == userID {
+		renderForbidden(w, r, "Leave "+group.Name+" to take yourself out of it.")
+		return
+	}
+
+	ctx := r.Context()
+	member, err := dataStore.GetUser(ctx, memberID)
+	if err == nil {
+		err = dataStore.RemoveParticipant(ctx, group.ID, memberID)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	var actor models.User
+	if err == nil {
+		actor, err = dataStore.GetUser(ctx, userID)
+	}
+	if err == nil {
+		err = announce(ctx, group.ID, userID, firstName(actor)+" removed "+firstName(member))
+	}
+	if err != nil {
+		log.Printf("Error removing %s from conversation %s: %v", memberID, group.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// The announcement no longer reaches them, so their open pages are
+	// told to close the group
+	chatHub.Publish(chat.Event{Type: chat.EventRemoved, ConversationID: group.ID, UserID: memberID}, memberID)
+	log.Printf("Member %s removed from conversation %s by %s", memberID, group.ID, userID)
+	data := groupPageData(ctx, group)
+	data.Notice = "Removed from the group."
+	renderChatGroup(w, r, http.StatusOK, data)
+}
+
+// setGroupRoleHandler makes a member an admin or takes it back. An admin
+// may step down only while there is another.
+func setGroupRoleHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	group, ok := authorizeGroup(w, r, conversationID, userID, true)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	data := groupPageData(ctx, group)
+	memberID, role := r.FormValue("user_id"), r.FormValue("role")
+	if role != models.GroupAdmin && role != models.GroupMember {
+		data.Errors["role-"+memberID] = "Choose admin or member."
+		renderChatGroup(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+	current, err := dataStore.GetParticipantRole(ctx, group.ID, memberID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading role in conversation %s: %v", group.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if current == role {
+		renderChatGroup(w, r, http.StatusOK, data)
+		return
+	}
+	if memberID == userID {
+		admins, err := groupAdmins(ctx, group.ID)
+		if err != nil {
+			log.Printf("Error listing members of conversation %s: %v", group.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if admins < 2 {
+			renderForbidden(w, r, "Make someone else an admin of "+group.Name+" before stepping down.")
+			return
+		}
+	}
+
+	err = dataStore.SetParticipantRole(ctx, group.ID, memberID, role)
+	var actor, member models.User
+	if err == nil {
+		actor, err = dataStore.GetUser(ctx, userID)
+	}
+	if err == nil {
+		member, err = dataStore.GetUser(ctx, memberID)
+	}
+	if err == nil {
+		content := firstName(actor) + " made " + firstName(member) + " an admin"
+		switch {
+		case memberID == userID:
+			content = firstName(actor) + " stepped down as admin"
+		case role == models.GroupMember:
+			content = firstName(actor) + " removed " + firstName(member) + " as admin"
+		}
+		err = announce(ctx, group.ID, userID, content)
+	}
+	if err != nil {
+		log.Printf("Error changing role of %s in conversation %s: %v", memberID, group.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Member %s of conversation %s made %s by %s", memberID, group.ID, role, userID)
+	if memberID == userID {
+		data.Conversation.UserRole = role
+	}
+	data.Notice = "Role updated."
+	renderChatGroup(w, r, http.StatusOK, data)
+}
+
+func groupAdmins(ctx context.Context, conversationID string) (int, error) {
+	members, err := dataStore.ListParticipants(ctx, conversationID)
+	admins := 0
+	for _, m := range members {
+		if m.Role == models.GroupAdmin {
+			admins++
+		}
+	}
+	return admins, err
+}
+
+// groupSettingsHandler renames a group and changes its photo.
+func groupSettingsHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	group, ok := authorizeGroup(w, r, conversationID, userID, true)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	data := groupPageData(ctx, group)
+	updated := models.Conversation{ID: group.ID, IsGroup: true}
+	readGroupForm(r, &data, &updated)
+	if len(data.Errors) > 0 {
+		renderChatGroup(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	err := dataStore.SaveConversation(ctx, updated)
+	var actor models.User
+	if err == nil {
+		actor, err = dataStore.GetUser(ctx, userID)
+	}
+	if err == nil && updated.Name != group.Name {
+		err = announce(ctx, group.ID, userID, firstName(actor)+" renamed the group to "+updated.Name)
+	}
+	if err == nil && updated.Avatar != group.Avatar {
+		err = announce(ctx, group.ID, userID, firstName(actor)+" changed the group photo")
+	}
+	if err != nil {
+		log.Printf("Error saving conversation %s: %v", group.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	group.Name, group.Avatar = updated.Name, updated.Avatar
+	data = groupPageData(ctx, group)
+	data.Notice = "Group updated."
+	renderChatGroup(w, r, http.StatusOK, data)
+}
+
+// leaveGroupHandler takes the member out of a group. When the last admin
+// leaves, whoever has been in the group longest takes over.
+func leaveGroupHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	group, ok := authorizeGroup(w, r, conversationID, userID, false)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	actor, err := dataStore.GetUser(ctx, userID)
+	if err == nil {
+		err = leaveGroup(ctx, group.ID, actor)
+	}
+	if err != nil {
+		log.Printf("Error leaving conversation %s: %v", group.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %s left conversation %s", userID, group.ID)
+	redirectAfter(w, r, "/chat")
+}
+
+// leaveGroup takes actor out of a group, making whoever has been in it
+// longest an admin if actor was the last, and tells everyone who was in it.
+func leaveGroup(ctx context.Context, conversationID string, actor models.User) error {
+	recipients, err := groupRecipients(ctx, conversationID, actor.ID)
+	if err != nil {
+		return err
+	}
+	left := systemMessage(actor.ID, firstName(actor)+" left")
+	var promoted models.Message
+
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	successor, err := dataStore.LeaveGroup(ctx, conversationID, actor.ID, left, func(u models.User) models.Message {
+		promoted = systemMessage(u.ID, firstName(u)+" is now an admin")
+		return promoted
+	})
+	if err != nil {
+		return err
+	}
+	// actor's other pages close the group
+	chatHub.Publish(chat.Event{Type: chat.EventRemoved, ConversationID: conversationID, UserID: actor.ID}, actor.ID)
+
+	// actor can no longer see the group, so its messages are fetched as
+	// someone still in it
+	members, err := dataStore.ListParticipants(ctx, conversationID)
+	if err != nil || len(members) == 0 {
+		return err
+	}
+	if _, err := publishMessage(ctx, left.ID, members[0].User.ID, recipients); err != nil {
+		return err
+	}
+	if successor.ID != "" {
+		_, err = publishMessage(ctx, promoted.ID, successor.ID, recipients)
+	}
+	return err
+}
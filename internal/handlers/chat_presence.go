@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"circles.diy/internal/chat"
+	"circles.diy/internal/models"
+	"circles.diy/internal/presence"
+	"circles.diy/internal/store"
+	"circles.diy/internal/utils"
+)
+
+// presenceTracker knows who has chat open, who has gone idle and who is
+// typing. Chat event streams are the connections it counts.
+var presenceTracker = presence.NewTracker(publishPresence)
+
+// TrackPresence marks idle members away and forgets old presence, for as
+// long as the process runs.
+func TrackPresence() {
+	presenceTracker.Run()
+}
+
+// publishPresence tells everyone userID shares a conversation with that
+// their status changed.
+func publishPresence(userID string, status presence.Status) {
+	conversations, err := dataStore.ListConversations(context.Background(), userID)
+	if err != nil {
+		log.Printf("Error loading conversations to announce %s is %s: %v", userID, status, err)
+		return
+	}
+	seen := make(map[string]bool)
+	var recipients []string
+	for _, c := range conversations {
+		for _, p := range c.Participants {
+			if !seen[p.ID] {
+				seen[p.ID] = true
+				recipients = append(recipients, p.ID)
+			}
+		}
+	}
+	chatHub.Publish(chat.Event{Type: chat.EventPresence, UserID: userID}, recipients...)
+}
+
+// conversationPresence sets a conversation's status from its other
+// participants: online when any of them is, away when any is idle. A
+// direct conversation whose other member has left shows when they were
+// last seen.
+func conversationPresence(c *models.Conversation) {
+	status := presence.Offline
+	for _, p := range c.Participants {
+		switch presenceTracker.Status(p.ID) {
+		case presence.Online:
+			status = presence.Online
+		case presence.Away:
+			if status == presence.Offline {
+				status = presence.Away
+			}
+		}
+	}
+	c.Status = string(status)
+	c.IsOnline = status != presence.Offline
+	c.LastSeen = ""
+	if status == presence.Offline && !c.IsGroup && len(c.Participants) > 0 {
+		if at, ok := presenceTracker.LastSeen(c.Participants[0].ID); ok {
+			c.LastSeen = utils.TimeAgo(at)
+		}
+	}
+}
+
+// contactsPresence sets each contact's status, keeping those who are
+// around first.
+func contactsPresence(contacts []models.Contact) {
+	for i := range contacts {
+		c := &contacts[i]
+		status := presenceTracker.Status(c.ID)
+		c.Status = string(status)
+		c.IsOnline = status != presence.Offline
+		if c.IsOnline {
+			c.LastSeen = ""
+		} else if at, ok := presenceTracker.LastSeen(c.ID); ok {
+			c.LastSeen = utils.TimeAgo(at)
+		}
+	}
+	sort.SliceStable(contacts, func(i, j int) bool {
+		return contacts[i].IsOnline && !contacts[j].IsOnline
+	})
+}
+
+// circlesPresence sets how many of each circle's members are online or
+// away.
+func circlesPresence(ctx context.Context, circles []models.Circle) error {
+	around := presenceTracker.Around()
+	ids := make([]string, len(circles))
+	for i, c := range circles {
+		ids[i] = c.ID
+	}
+	counts, err := dataStore.CountMembersAmong(ctx, ids, around)
+	if err != nil {
+		return err
+	}
+	for i := range circles {
+		circles[i].OnlineCount = counts[circles[i].ID]
+	}
+	return nil
+}
+
+// typingHandler passes on that the member is typing in a conversation.
+// The chat page calls it as they type; the tracker decides how often the
+// other participants hear of it.
+func typingHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	conversation, err := dataStore.GetConversation(r.Context(), conversationID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading conversation %s: %v", conversationID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	presenceTracker.Touch(userID)
+	if presenceTracker.Typing(userID, conversation.ID) {
+		// The typist's own pages have nothing to show
+		recipients := make([]string, 0, len(conversation.Participants))
+		for _, p := range conversation.Participants {
+			if p.ID != userID {
+				recipients = append(recipients, p.ID)
+			}
+		}
+		chatHub.Publish(chat.Event{Type: chat.EventTyping, ConversationID: conversation.ID, UserID: userID}, recipients...)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
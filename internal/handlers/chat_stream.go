@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"circles.diy/internal/chat"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+)
+
+const (
+	// heartbeatInterval is how often an idle stream is written to, well
+	// inside the server's 15 second timeouts and those of proxies
+	heartbeatInterval = 10 * time.Second
+	// writeWait is how long one write, or a WebSocket ping's pong, may
+	// take before the client is given up on
+	writeWait = 10 * time.Second
+	// resumeLimit is how many missed messages a reconnecting client is
+	// sent. Clients further behind are told to reload instead.
+	resumeLimit = 200
+)
+
+// errLagged ends a stream whose client fell too far behind. The client
+// reconnects and catches up from the store.
+var errLagged = errors.New("client fell behind")
+
+// chatStream is one client's connection to its chat events.
+type chatStream interface {
+	// send delivers an event. id, when set, is the message the client
+	// resumes after if it reconnects.
+	send(event, id, data string) error
+	heartbeat() error
+}
+
+// chatEventsHandler streams the signed-in user's chat events: over a
+// WebSocket when the request asks to upgrade, and as Server-Sent Events,
+// which HTMX's sse extension can consume, otherwise. A client reconnecting
+// passes the last message it saw as Last-Event-ID or ?after= and is sent
+// what it missed first.
+func chatEventsHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// EventSource reconnects to the URL it started with, adding the last
+	// event it saw as a header
+	after := r.Header.Get("Last-Event-ID")
+	if after == "" {
+		after = r.URL.Query().Get("after")
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		serveChatWebSocket(w, r, userID, after)
+		return
+	}
+	serveChatSSE(w, r, userID, after)
+}
+
+func serveChatSSE(w http.ResponseWriter, r *http.Request, userID, after string) {
+	rc := http.NewResponseController(w)
+	// The server's ReadTimeout would otherwise end the stream: nothing
+	// more is read from the client, and heartbeats find when it has gone
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	// Stops nginx buffering the stream
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &sseStream{w: w, rc: rc}
+	// Clients wait a few seconds before reconnecting, so a restart is not
+	// met by every client at once
+	if err := stream.write("retry: 3000\n\n"); err != nil {
+		return
+	}
+	if err := runChatStream(r.Context(), userID, after, stream); err != nil && !errors.Is(err, errLagged) {
+		log.Printf("Chat stream for %s ended: %v", userID, err)
+	}
+}
+
+type sseStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (s *sseStream) send(event, id, data string) error {
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	fmt.Fprintf(&b, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+func (s *sseStream) heartbeat() error {
+	return s.write(": heartbeat\n\n")
+}
+
+// write sends and flushes p. Each write moves the server's write deadline
+// past the next heartbeat, so an open stream outlives WriteTimeout while a
+// client that stops reading is still let go.
+func (s *sseStream) write(p string) error {
+	if err := s.rc.SetWriteDeadline(time.Now().Add(heartbeatInterval + writeWait)); err != nil {
+		return err
+	}
+	if _, err := s.w.Write([]byte(p)); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func serveChatWebSocket(w http.ResponseWriter, r *http.Request, userID, after string) {
+	// Accept refuses other origins, which keeps other sites from reading
+	// a member's messages with their cookies
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		log.Printf("Error accepting chat WebSocket: %v", err)
+		return
+	}
+	defer conn.CloseNow()
+
+	// Clients only listen for now; CloseRead answers pings and ends ctx
+	// when the connection closes
+	ctx := conn.CloseRead(r.Context())
+	err = runChatStream(ctx, userID, after, &wsStream{ctx: ctx, conn: conn})
+	switch {
+	case errors.Is(err, errLagged):
+		conn.Close(websocket.StatusTryAgainLater, "fell behind")
+	case err != nil && ctx.Err() == nil:
+		log.Printf("Chat WebSocket for %s ended: %v", userID, err)
+		conn.Close(websocket.StatusInternalError, "")
+	default:
+		conn.Close(websocket.StatusNormalClosure, "")
+	}
+}
+
+type wsStream struct {
+	ctx  context.Context
+	conn *websocket.Conn
+}
+
+// wsFrame is an event sent over a WebSocket, carrying what a Server-Sent
+// Event would.
+type wsFrame struct {
+	Event string `json:"event"`
+	ID    string `json:"id,omitempty"`
+	Data  string `json:"data"`
+}
+
+func (s *wsStream) send(event, id, data string) error {
+	frame, err := json.Marshal(wsFrame{Event: event, ID: id, Data: data})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, writeWait)
+	defer cancel()
+	return s.conn.Write(ctx, websocket.MessageText, frame)
+}
+
+// heartbeat pings the client, failing when no pong comes back in time.
+func (s *wsStream) heartbeat() error {
+	ctx, cancel := context.WithTimeout(s.ctx, writeWait)
+	defer cancel()
+	return s.conn.Ping(ctx)
+}
+
+// runChatStream sends userID what they missed since the message after,
+// then their events as they happen, until ctx ends or the stream fails.
+func runChatStream(ctx context.Context, userID, after string, stream chatStream) error {
+	// Subscribing before reading the store leaves no gap between the two;
+	// messages found in both are sent once
+	sub := chatHub.Subscribe(userID)
+	defer sub.Close()
+
+	share, err := dataStore.GetSharePresence(ctx, userID)
+	if err != nil {
+		return err
+	}
+	presenceTracker.Connect(userID, !share)
+	defer presenceTracker.Disconnect(userID)
+
+	sent := map[string]bool{}
+	if after != "" {
+		missed, err := dataStore.ListMessagesAfter(ctx, userID, after, resumeLimit+1)
+		if errors.Is(err, store.ErrNotFound) || len(missed) > resumeLimit {
+			// Too far behind to catch up message by message
+			missed = nil
+			if err := stream.send("reset", "", "reload"); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		for _, m := range missed {
+			if err := sendChatMessage(ctx, stream, userID, m); err != nil {
+				return err
+			}
+			sent[m.ID] = true
+		}
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := stream.heartbeat(); err != nil {
+				return err
+			}
+		case e, ok := <-sub.Events():
+			if !ok {
+				if sub.Lagged() {
+					return errLagged
+				}
+				return nil
+			}
+			var err error
+			switch {
+			case e.Type == chat.EventMessage && !sent[e.Message.ID]:
+				err = sendChatMessage(ctx, stream, userID, e.Message)
+			case e.Type == chat.EventRead:
+				err = sendChatReceipt(ctx, stream, userID, e.ConversationID)
+			case e.Type == chat.EventPresence:
+				err = sendChatPresence(ctx, stream, userID, e.UserID)
+			case e.Type == chat.EventTyping:
+				err = sendChatTyping(ctx, stream, e)
+			case e.Type == chat.EventRemoved:
+				err = stream.send(string(chat.EventRemoved), "", e.ConversationID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendChatMessage sends a message as userID sees it, followed by their
+// entry for its conversation in the conversation list. Messages in groups
+// userID has since left are skipped.
+func sendChatMessage(ctx context.Context, stream chatStream, userID string, m models.Message) error {
+	m.IsOwn = m.Sender.ID == userID
+	conversation, err := dataStore.GetConversation(ctx, m.ConversationID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	conversationPresence(&conversation)
+	set, err := templates.Lookup("chat")
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := set.ExecuteTemplate(&buf, "chat-message", m); err != nil {
+		return err
+	}
+	if err := set.ExecuteTemplate(&buf, "conversation-item", conversation); err != nil {
+		return err
+	}
+	return stream.send(string(chat.EventMessage), m.ID, strings.TrimSpace(buf.String()))
+}
+
+// sendChatReceipt tells userID a conversation was read: by them elsewhere,
+// which clears its unread count, or by someone else, which changes the
+// status of userID's own messages in it. It sends their entry for the
+// conversation followed by the status of their recent messages. Groups
+// userID has since left are skipped.
+func sendChatReceipt(ctx context.Context, stream chatStream, userID, conversationID string) error {
+	conversation, err := dataStore.GetConversation(ctx, conversationID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	conversationPresence(&conversation)
+	messages, err := dataStore.ListMessages(ctx, conversationID, userID, chatMessageCount)
+	if err != nil {
+		return err
+	}
+	set, err := templates.Lookup("chat")
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := set.ExecuteTemplate(&buf, "conversation-item", conversation); err != nil {
+		return err
+	}
+	for _, m := range messages {
+		if !m.IsOwn {
+			continue
+		}
+		if err := set.ExecuteTemplate(&buf, "message-status", m); err != nil {
+			return err
+		}
+	}
+	return stream.send(string(chat.EventRead), "", strings.TrimSpace(buf.String()))
+}
+
+// sendChatPresence sends userID the entries of the conversations they
+// share with otherID, whose status changed, with the status line of the
+// direct one.
+func sendChatPresence(ctx context.Context, stream chatStream, userID, otherID string) error {
+	conversations, err := dataStore.ListConversations(ctx, userID)
+	if err != nil {
+		return err
+	}
+	set, err := templates.Lookup("chat")
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, c := range conversations {
+		if !hasParticipant(c, otherID) {
+			continue
+		}
+		conversationPresence(&c)
+		if err := set.ExecuteTemplate(&buf, "conversation-item", c); err != nil {
+			return err
+		}
+		if c.IsGroup {
+			continue
+		}
+		if err := set.ExecuteTemplate(&buf, "chat-presence", c); err != nil {
+			return err
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return stream.send(string(chat.EventPresence), "", strings.TrimSpace(buf.String()))
+}
+
+func hasParticipant(c models.Conversation, userID string) bool {
+	for _, p := range c.Participants {
+		if p.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// sendChatTyping sends the indicator for someone typing in a conversation.
+func sendChatTyping(ctx context.Context, stream chatStream, e chat.Event) error {
+	user, err := dataStore.GetUser(ctx, e.UserID)
+	if err != nil {
+		return err
+	}
+	set, err := templates.Lookup("chat")
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	indicator := models.TypingIndicator{ConversationID: e.ConversationID, User: user}
+	if err := set.ExecuteTemplate(&buf, "typing-indicator", indicator); err != nil {
+		return err
+	}
+	return stream.send(string(chat.EventTyping), "", strings.TrimSpace(buf.String()))
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"circles.diy/internal/chat"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+)
+
+func TestMain(m *testing.M) {
+	if err := templates.Init(os.DirFS("../.."), false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+type streamFrame struct {
+	event, id, data string
+}
+
+// testStream hands each frame to the test as it is sent. Sends block until
+// the test reads them, like a client that has stopped reading.
+type testStream struct {
+	frames chan streamFrame
+}
+
+func (s *testStream) send(event, id, data string) error {
+	s.frames <- streamFrame{event, id, data}
+	return nil
+}
+
+func (s *testStream) heartbeat() error { return nil }
+
+// next returns the next frame of the given event, skipping others.
+func (s *testStream) next(t *testing.T, event string) streamFrame {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case f := <-s.frames:
+			if f.event == event {
+				return f
+			}
+		case <-timeout:
+			t.Fatalf("no %s event", event)
+		}
+	}
+}
+
+// startStream runs userID's chat stream from after until the test ends,
+// reporting the error it ends with.
+func startStream(t *testing.T, userID, after string) (*testStream, <-chan error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &testStream{frames: make(chan streamFrame)}
+	done := make(chan error, 1)
+	finished := make(chan struct{})
+	go func() {
+		done <- runChatStream(ctx, userID, after, stream)
+		close(finished)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		// Let a send in progress finish so the stream can see ctx end
+		for {
+			select {
+			case <-stream.frames:
+			case <-finished:
+				return
+			}
+		}
+	})
+	// Give the stream time to subscribe before anything is published
+	time.Sleep(50 * time.Millisecond)
+	return stream, done
+}
+
+// newChatStore makes ana and ben, with a direct conversation d1 between
+// them.
+func newChatStore(t *testing.T) {
+	t.Helper()
+	s := store.NewMemoryStore()
+	ctx := context.Background()
+	for _, id := range []string{"ana", "ben"} {
+		if err := s.SaveUser(ctx, models.User{ID: id, Handle: id, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.SaveConversation(ctx, models.Conversation{
+		ID: "d1", CreatedAt: time.Now(), Participants: []models.User{{ID: "ana"}, {ID: "ben"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetStore(s)
+	chatHub = chat.NewHub()
+}
+
+// send posts a message from ana to ben in d1.
+func send(t *testing.T, id string) {
+	t.Helper()
+	message := models.Message{ID: id, Content: id, Sender: models.User{ID: "ana"}, CreatedAt: time.Now()}
+	if _, err := postMessage(context.Background(), "d1", message, []string{"ana", "ben"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChatStreamResumes(t *testing.T) {
+	newChatStore(t)
+	for _, id := range []string{"m1", "m2", "m3"} {
+		send(t, id)
+	}
+
+	stream, _ := startStream(t, "ben", "m1")
+	for _, want := range []string{"m2", "m3"} {
+		if f := stream.next(t, "message"); f.id != want {
+			t.Errorf("missed message = %s, want %s", f.id, want)
+		}
+	}
+	send(t, "m4")
+	if f := stream.next(t, "message"); f.id != "m4" {
+		t.Errorf("live message = %s, want m4", f.id)
+	}
+}
+
+func TestChatStreamResetsWhenTooFarBehind(t *testing.T) {
+	tests := []struct {
+		name  string
+		after string
+	}{
+		{"more than resumeLimit missed", "m0"},
+		{"unknown message", "nope"},
+	}
+	newChatStore(t)
+	for i := 0; i <= resumeLimit+1; i++ {
+		send(t, fmt.Sprintf("m%d", i))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, _ := startStream(t, "ben", tt.after)
+			f := <-stream.frames
+			if f.event != "reset" {
+				t.Errorf("first event = %s %s, want reset", f.event, f.id)
+			}
+		})
+	}
+}
+
+// A client that stops reading is dropped, and catches up on what it
+// missed when it reconnects.
+func TestChatStreamDropsSlowClient(t *testing.T) {
+	newChatStore(t)
+	stream, done := startStream(t, "ben", "")
+
+	// The stream blocks sending m0 while the rest fill its subscription
+	count := 40
+	for i := 0; i < count; i++ {
+		send(t, fmt.Sprintf("m%d", i))
+	}
+	last := -1
+	timeout := time.After(2 * time.Second)
+read:
+	for {
+		select {
+		case f := <-stream.frames:
+			if f.event == "message" {
+				fmt.Sscanf(f.id, "m%d", &last)
+			}
+		case err := <-done:
+			if !errors.Is(err, errLagged) {
+				t.Fatalf("stream ended with %v, want errLagged", err)
+			}
+			break read
+		case <-timeout:
+			t.Fatal("slow stream was not dropped")
+		}
+	}
+	if last < 0 || last == count-1 {
+		t.Fatalf("dropped stream sent up to m%d, want some but not all", last)
+	}
+
+	resumed, _ := startStream(t, "ben", fmt.Sprintf("m%d", last))
+	for i := last + 1; i < count; i++ {
+		if f := resumed.next(t, "message"); f.id != fmt.Sprintf("m%d", i) {
+			t.Fatalf("resumed stream sent %s, want m%d", f.id, i)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"circles.diy/internal/authz"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+	"circles.diy/internal/utils"
+)
+
+const (
+	maxJoinMessageLength = 280
+	maxBanReasonLength   = 280
+	maxInviteUses        = 1000
+)
+
+// inviteLifetimes are the expiry choices offered when creating an invite.
+var inviteLifetimes = map[string]time.Duration{
+	"1d":    24 * time.Hour,
+	"7d":    7 * 24 * time.Hour,
+	"30d":   30 * 24 * time.Hour,
+	"never": 0,
+}
+
+// openToJoin reports whether anyone who can reach the circle may join
+// without approval. Private circles need an approved request or an invite.
+func openToJoin(c models.Circle) bool {
+	return c.Visibility != models.VisibilityPrivate
+}
+
+// redirectAfter sends the browser to target, using HX-Redirect for HTMX
+// requests so the whole page changes rather than a fragment.
+func redirectAfter(w http.ResponseWriter, r *http.Request, target string) {
+	if isHTMX(r) {
+		w.Header().Set("HX-Redirect", target)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func renderCircleJoin(w http.ResponseWriter, r *http.Request, status int, data models.CircleJoinPageData) {
+	render(w, r, templates.View{Set: "circle-join", Page: "circle-join", Data: data, Status: status})
+}
+
+// newCircleJoinPageData loads circleID as userID sees it, with whether they
+// are banned from it or waiting for approval.
+func newCircleJoinPageData(r *http.Request, circleID, userID string) (models.CircleJoinPageData, error) {
+	ctx := r.Context()
+	data := models.CircleJoinPageData{
+		BaseData: newBaseData(ctx, "Join a circle", "circles"),
+		Values:   map[string]string{},
+		Errors:   map[string]string{},
+	}
+	if circleID == "" {
+		return data, nil
+	}
+
+	var err error
+	if data.Circle, err = dataStore.GetCircle(ctx, circleID, userID); err != nil {
+		return data, err
+	}
+	circles := []models.Circle{data.Circle}
+	if err := circlesPresence(ctx, circles); err != nil {
+		return data, err
+	}
+	data.Circle = circles[0]
+	data.Title = "Join " + data.Circle.Name
+	if data.Banned, err = dataStore.IsBanned(ctx, circleID, userID); err != nil {
+		return data, err
+	}
+	data.Requested, err = dataStore.HasJoinRequest(ctx, circleID, userID)
+	return data, err
+}
+
+// circleJoinHandler serves /circles/{id}/join. Public and unlisted circles
+// are joined straight away; private ones queue a request for approval.
+func circleJoinHandler(w http.ResponseWriter, r *http.Request, circleID, userID string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := newCircleJoinPageData(r, circleID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading circle %s to join: %v", circleID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodGet {
+		renderCircleJoin(w, r, http.StatusOK, data)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	circle := data.Circle
+	switch {
+	case circle.UserRole != "":
+		http.Redirect(w, r, "/circles/"+circle.ID+"/members", http.StatusSeeOther)
+		return
+	case data.Banned:
+		renderForbidden(w, r, "You can't join "+circle.Name+".")
+		return
+	case circle.Archived():
+		renderForbidden(w, r, circle.Name+" is archived and not taking new members.")
+		return
+	}
+
+	ctx := r.Context()
+	if openToJoin(circle) {
+		err = dataStore.JoinCircle(ctx, circle.ID, userID, time.Now())
+	} else {
+		data.Values["message"] = strings.TrimSpace(r.FormValue("message"))
+		if utf8.RuneCountInString(data.Values["message"]) > maxJoinMessageLength {
+			data.Errors["message"] = "Keep your message under 280 characters."
+			renderCircleJoin(w, r, http.StatusUnprocessableEntity, data)
+			return
+		}
+		err = dataStore.RequestToJoin(ctx, circle.ID, userID, data.Values["message"], time.Now())
+	}
+	if errors.Is(err, store.ErrBanned) {
+		renderForbidden(w, r, "You can't join "+circle.Name+".")
+		return
+	}
+	if err != nil {
+		log.Printf("Error joining circle %s: %v", circle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if openToJoin(circle) {
+		log.Printf("User %s joined circle %s", userID, circle.ID)
+		http.Redirect(w, r, "/circles/"+circle.ID+"/members", http.StatusSeeOther)
+		return
+	}
+	data.Requested = true
+	data.Notice = "Request sent. You'll be a member once someone approves it."
+	renderCircleJoin(w, r, http.StatusOK, data)
+}
+
+// cancelJoinRequestHandler withdraws the user's own pending request.
+func cancelJoinRequestHandler(w http.ResponseWriter, r *http.Request, circleID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	err := dataStore.DeleteJoinRequest(r.Context(), circleID, userID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error cancelling join request: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/circles/"+circleID+"/join", http.StatusSeeOther)
+}
+
+// leaveCircleHandler ends the user's own membership. Owners must hand the
+// circle to someone else first.
+func leaveCircleHandler(w http.ResponseWriter, r *http.Request, circleID string) {
+	circle, role, ok := circleLifecycleForm(w, r, circleID, authz.PermView)
+	if !ok {
+		return
+	}
+	if role == authz.RoleOwner {
+		renderForbidden(w, r, "Transfer ownership of "+circle.Name+" to another member before leaving.")
+		return
+	}
+	userID := currentUserID(r)
+	if err := dataStore.RemoveMember(r.Context(), circle.ID, userID); err != nil {
+		log.Printf("Error leaving circle %s: %v", circle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %s left circle %s", userID, circle.ID)
+	redirectAfter(w, r, "/circles")
+}
+
+// joinRequestDecisionHandler approves or declines a pending request.
+func joinRequestDecisionHandler(w http.ResponseWriter, r *http.Request, circleID string, approve bool) {
+	circle, role, ok := circleLifecycleForm(w, r, circleID, authz.PermInvite)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	userID := r.FormValue("user_id")
+	var err error
+	notice := "Request declined."
+	if approve {
+		err = dataStore.ApproveJoinRequest(ctx, circle.ID, userID, time.Now())
+		notice = "Request approved."
+	} else {
+		err = dataStore.DeleteJoinRequest(ctx, circle.ID, userID)
+	}
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		notice = "That request was already handled."
+	case errors.Is(err, store.ErrBanned):
+		notice = "That person is banned from this circle."
+	case err != nil:
+		log.Printf("Error deciding join request: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	renderCircleMembers(w, r, circle, role, http.StatusOK, notice, nil)
+}
+
+// removeMemberHandler removes a member, and with ban keeps them from
+// rejoining. Only members ranked below the actor can be removed.
+func removeMemberHandler(w http.ResponseWriter, r *http.Request, circleID string, ban bool) {
+	circle, role, ok := circleLifecycleForm(w, r, circleID, authz.PermModerate)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	memberID := r.FormValue("user_id")
+	current, err := dataStore.GetMemberRole(ctx, circle.ID, memberID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading member role: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !authz.CanRemove(role, authz.Role(current)) {
+		renderForbidden(w, r, "You can only remove members ranked below you.")
+		return
+	}
+
+	notice := "Member removed."
+	if ban {
+		reason := strings.TrimSpace(r.FormValue("reason"))
+		if utf8.RuneCountInString(reason) > maxBanReasonLength {
+			renderCircleMembers(w, r, circle, role, http.StatusUnprocessableEntity, "",
+				map[string]string{"ban-" + memberID: "Keep the reason under 280 characters."})
+			return
+		}
+		err = dataStore.BanMember(ctx, circle.ID, memberID, currentUserID(r), reason, time.Now())
+		notice = "Member banned. They can't rejoin until unbanned."
+	} else {
+		err = dataStore.RemoveMember(ctx, circle.ID, memberID)
+	}
+	if err != nil {
+		log.Printf("Error removing member %s from %s: %v", memberID, circle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Member %s removed from circle %s by %s (ban: %t)", memberID, circle.ID, currentUserID(r), ban)
+	renderCircleMembers(w, r, circle, role, http.StatusOK, notice, nil)
+}
+
+func unbanMemberHandler(w http.ResponseWriter, r *http.Request, circleID string) {
+	circle, role, ok := circleLifecycleForm(w, r, circleID, authz.PermModerate)
+	if !ok {
+		return
+	}
+	err := dataStore.UnbanMember(r.Context(), circle.ID, r.FormValue("user_id"))
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error unbanning member: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	renderCircleMembers(w, r, circle, role, http.StatusOK, "Ban lifted.", nil)
+}
+
+// createInviteHandler makes an invite link with an optional use limit and
+// expiry.
+func createInviteHandler(w http.ResponseWriter, r *http.Request, circleID string) {
+	circle, role, ok := circleLifecycleForm(w, r, circleID, authz.PermInvite)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	maxUses := 0
+	if raw := strings.TrimSpace(r.FormValue("max_uses")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > maxInviteUses {
+			errs["max_uses"] = "Enter a number from 1 to 1000, or leave it blank for no limit."
+		}
+		maxUses = n
+	}
+	lifetime, valid := inviteLifetimes[r.FormValue("expires")]
+	if !valid {
+		errs["expires"] = "Choose when the invite expires."
+	}
+	if len(errs) > 0 {
+		renderCircleMembers(w, r, circle, role, http.StatusUnprocessableEntity, "", errs)
+		return
+	}
+
+	now := time.Now()
+	invite := models.CircleInvite{
+		Code:      utils.NewInviteCode(),
+		CircleID:  circle.ID,
+		CreatedBy: currentUserID(r),
+		MaxUses:   maxUses,
+		CreatedAt: now,
+	}
+	if lifetime > 0 {
+		invite.ExpiresAt = now.Add(lifetime)
+	}
+	if err := dataStore.CreateInvite(r.Context(), invite); err != nil {
+		log.Printf("Error creating invite for %s: %v", circle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	renderCircleMembers(w, r, circle, role, http.StatusOK, "Invite created. Share the link or the code.", nil)
+}
+
+func revokeInviteHandler(w http.ResponseWriter, r *http.Request, circleID string) {
+	circle, role, ok := circleLifecycleForm(w, r, circleID, authz.PermInvite)
+	if !ok {
+		return
+	}
+	err := dataStore.RevokeInvite(r.Context(), circle.ID, r.FormValue("code"), time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking invite: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	renderCircleMembers(w, r, circle, role, http.StatusOK, "Invite revoked.", nil)
+}
+
+// circleInviteHandler serves /circles/invite, where a code can be typed in,
+// and /circles/invite/{code}, which previews the circle and accepts.
+func circleInviteHandler(w http.ResponseWriter, r *http.Request, code, userID string) {
+	if code == "" {
+		if typed := utils.NormalizeInviteCode(r.URL.Query().Get("code")); typed != "" {
+			http.Redirect(w, r, "/circles/invite/"+typed, http.StatusSeeOther)
+			return
+		}
+		data, _ := newCircleJoinPageData(r, "", userID)
+		data.Title = "Use an invite code"
+		renderCircleJoin(w, r, http.StatusOK, data)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	code = utils.NormalizeInviteCode(code)
+	invite, err := dataStore.GetInvite(ctx, code)
+	if errors.Is(err, store.ErrNotFound) {
+		data, _ := newCircleJoinPageData(r, "", userID)
+		data.Title = "Use an invite code"
+		data.Values["code"] = code
+		data.Errors["code"] = "That invite code doesn't exist. Check it and try again."
+		renderCircleJoin(w, r, http.StatusNotFound, data)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading invite: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := newCircleJoinPageData(r, invite.CircleID, userID)
+	if err != nil {
+		log.Printf("Error loading invited circle: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	data.Invite = &invite
+	if r.Method == http.MethodGet {
+		renderCircleJoin(w, r, http.StatusOK, data)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	if data.Circle.Archived() && data.Circle.UserRole == "" {
+		renderForbidden(w, r, data.Circle.Name+" is archived and not taking new members.")
+		return
+	}
+
+	_, err = dataStore.RedeemInvite(ctx, code, userID, time.Now())
+	switch {
+	case errors.Is(err, store.ErrBanned):
+		renderForbidden(w, r, "You can't join "+data.Circle.Name+".")
+		return
+	case errors.Is(err, store.ErrInviteUnusable):
+		data.Errors["code"] = "This invite has expired or been used up. Ask for a new one."
+		renderCircleJoin(w, r, http.StatusGone, data)
+		return
+	case err != nil:
+		log.Printf("Error redeeming invite: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %s joined circle %s by invite", userID, invite.CircleID)
+	http.Redirect(w, r, "/circles/"+invite.CircleID+"/members", http.StatusSeeOther)
+}
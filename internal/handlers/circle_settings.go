@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"circles.diy/internal/authz"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+	"circles.diy/internal/utils"
+)
+
+const (
+	// circleDeleteGrace is how long a circle scheduled for deletion can
+	// still be restored before it is purged.
+	circleDeleteGrace = 14 * 24 * time.Hour
+
+	maxCircleDescriptionLength = 500
+	defaultCircleThumbnail     = "/static/img/icon-192.png"
+)
+
+var circleVisibilities = []string{models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate}
+
+func newCircleFormPageData(r *http.Request, title string) models.CircleFormPageData {
+	return models.CircleFormPageData{
+		BaseData:     newBaseData(r.Context(), title, "circles"),
+		Values:       map[string]string{},
+		Errors:       map[string]string{},
+		Visibilities: circleVisibilities,
+	}
+}
+
+func renderCircleForm(w http.ResponseWriter, r *http.Request, status int, data models.CircleFormPageData) {
+	render(w, r, templates.View{Set: "circle-form", Page: "circle-form", Data: data, Status: status})
+}
+
+// readCircleForm validates the submitted settings into circle, recording
+// the submitted values and any errors on data.
+func readCircleForm(r *http.Request, data *models.CircleFormPageData, circle *models.Circle) {
+	for _, field := range []string{"name", "description", "thumbnail", "banner", "visibility"} {
+		data.Values[field] = strings.TrimSpace(r.FormValue(field))
+	}
+
+	var ok bool
+	if circle.Name, ok = utils.ValidateCircleName(data.Values["name"]); !ok {
+		data.Errors["name"] = "Enter a name of 3-60 characters."
+	}
+	circle.Description = data.Values["description"]
+	if utf8.RuneCountInString(circle.Description) > maxCircleDescriptionLength {
+		data.Errors["description"] = "Keep the description under 500 characters."
+	}
+	if circle.Thumbnail, ok = utils.ValidateImageURL(data.Values["thumbnail"]); !ok {
+		data.Errors["thumbnail"] = "Enter an http(s) image URL or leave it blank."
+	}
+	if circle.Thumbnail == "" {
+		circle.Thumbnail = defaultCircleThumbnail
+	}
+	if circle.Banner, ok = utils.ValidateImageURL(data.Values["banner"]); !ok {
+		data.Errors["banner"] = "Enter an http(s) image URL or leave it blank."
+	}
+	circle.Visibility = data.Values["visibility"]
+	switch circle.Visibility {
+	case models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate:
+	default:
+		data.Errors["visibility"] = "Choose who can find this circle."
+	}
+}
+
+func circleFormValues(c models.Circle) map[string]string {
+	thumbnail := c.Thumbnail
+	if thumbnail == defaultCircleThumbnail {
+		thumbnail = ""
+	}
+	return map[string]string{
+		"name":        c.Name,
+		"description": c.Description,
+		"thumbnail":   thumbnail,
+		"banner":      c.Banner,
+		"visibility":  c.Visibility,
+	}
+}
+
+// newCircleHandler serves /circles/new: the creation form and its submission.
+// The creator becomes the circle's owner.
+func newCircleHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	data := newCircleFormPageData(r, "Create a circle")
+	switch r.Method {
+	case http.MethodGet:
+		data.Values["visibility"] = models.VisibilityPublic
+		renderCircleForm(w, r, http.StatusOK, data)
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	circle := models.Circle{ID: utils.NewID()}
+	readCircleForm(r, &data, &circle)
+	if len(data.Errors) > 0 {
+		renderCircleForm(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	if err := dataStore.CreateCircle(r.Context(), circle, userID); err != nil {
+		log.Printf("Error creating circle: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Circle %s created by %s", circle.ID, userID)
+	http.Redirect(w, r, "/circles/"+circle.ID+"/settings", http.StatusSeeOther)
+}
+
+// renderCircleSettings shows the settings page for circle, with the
+// ownership transfer candidates when role may transfer it.
+func renderCircleSettings(w http.ResponseWriter, r *http.Request, status int, data models.CircleFormPageData, role authz.Role) {
+	if role.Can(authz.PermTransfer) {
+		members, err := dataStore.ListMembers(r.Context(), data.Circle.ID)
+		if err != nil {
+			log.Printf("Error listing members of %s: %v", data.Circle.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, m := range members {
+			if m.Role != string(authz.RoleOwner) {
+				data.Members = append(data.Members, m)
+			}
+		}
+	}
+	renderCircleForm(w, r, status, data)
+}
+
+// reloadCircleSettings re-reads the circle after a change and shows its
+// settings with notice.
+func reloadCircleSettings(w http.ResponseWriter, r *http.Request, circleID, notice string) {
+	circle, err := dataStore.GetCircle(r.Context(), circleID, currentUserID(r))
+	if err != nil {
+		log.Printf("Error loading circle %s: %v", circleID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	data := newCircleFormPageData(r, circle.Name+" settings")
+	data.Circle = circle
+	data.Values = circleFormValues(circle)
+	data.Notice = notice
+	renderCircleSettings(w, r, http.StatusOK, data, authz.Role(circle.UserRole))
+}
+
+// circleSettingsHandler serves /circles/{id}/settings.
+func circleSettingsHandler(w http.ResponseWriter, r *http.Request, circleID string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+	}
+	circle, role, ok := authorizeCircle(w, r, circleID, authz.PermEditSettings)
+	if !ok {
+		return
+	}
+
+	data := newCircleFormPageData(r, circle.Name+" settings")
+	data.Circle = circle
+	if r.Method == http.MethodGet {
+		data.Values = circleFormValues(circle)
+		renderCircleSettings(w, r, http.StatusOK, data, role)
+		return
+	}
+
+	updated := models.Circle{ID: circle.ID}
+	readCircleForm(r, &data, &updated)
+	if len(data.Errors) > 0 {
+		renderCircleSettings(w, r, http.StatusUnprocessableEntity, data, role)
+		return
+	}
+	if err := dataStore.UpdateCircleSettings(r.Context(), updated); err != nil {
+		log.Printf("Error updating circle %s: %v", circle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	reloadCircleSettings(w, r, circle.ID, "Settings saved.")
+}
+
+// circleLifecycleForm parses a POST changing the circle or its membership
+// and authorizes it, answering the request itself on failure.
+func circleLifecycleForm(w http.ResponseWriter, r *http.Request, circleID string, perm authz.Permission) (models.Circle, authz.Role, bool) {
+	if !postForm(w, r) {
+		return models.Circle{}, "", false
+	}
+	return authorizeCircle(w, r, circleID, perm)
+}
+
+// transferCircleHandler hands ownership to another member. The previous
+// owner stays on as an admin.
+func transferCircleHandler(w http.ResponseWriter, r *http.Request, circleID string) {
+	circle, role, ok := circleLifecycleForm(w, r, circleID, authz.PermTransfer)
+	if !ok {
+		return
+	}
+
+	userID := currentUserID(r)
+	err := dataStore.TransferOwnership(r.Context(), circle.ID, userID, r.FormValue("user_id"))
+	if errors.Is(err, store.ErrNotFound) {
+		data := newCircleFormPageData(r, circle.Name+" settings")
+		data.Circle = circle
+		data.Values = circleFormValues(circle)
+		data.Errors["transfer"] = "Choose another member of the circle."
+		renderCircleSettings(w, r, http.StatusUnprocessableEntity, data, role)
+		return
+	}
+	if err != nil {
+		log.Printf("Error transferring circle %s: %v", circle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Ownership of circle %s transferred from %s to %s", circle.ID, userID, r.FormValue("user_id"))
+	reloadCircleSettings(w, r, circle.ID, "Ownership transferred. You are now an admin of this circle.")
+}
+
+func archiveCircleHandler(w http.ResponseWriter, r *http.Request, circleID string) {
+	circle, _, ok := circleLifecycleForm(w, r, circleID, authz.PermDelete)
+	if !ok {
+		return
+	}
+	if err := dataStore.ArchiveCircle(r.Context(), circle.ID, time.Now(), time.Time{}); err != nil {
+		log.Printf("Error archiving circle %s: %v", circle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	reloadCircleSettings(w, r, circle.ID, "Circle archived. Members can still read it, but nothing can be posted or changed.")
+}
+
+func restoreCircleHandler(w http.ResponseWriter, r *http.Request, circleID string) {
+	circle, _, ok := circleLifecycleForm(w, r, circleID, authz.PermDelete)
+	if !ok {
+		return
+	}
+	if err := dataStore.RestoreCircle(r.Context(), circle.ID); err != nil {
+		log.Printf("Error restoring circle %s: %v", circle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	reloadCircleSettings(w, r, circle.ID, "Circle restored.")
+}
+
+// deleteCircleHandler archives the circle and schedules it to be purged
+// once circleDeleteGrace has passed. The owner confirms by typing its name.
+func deleteCircleHandler(w http.ResponseWriter, r *http.Request, circleID string) {
+	circle, role, ok := circleLifecycleForm(w, r, circleID, authz.PermDelete)
+	if !ok {
+		return
+	}
+	if strings.TrimSpace(r.FormValue("confirm")) != circle.Name {
+		data := newCircleFormPageData(r, circle.Name+" settings")
+		data.Circle = circle
+		data.Values = circleFormValues(circle)
+		data.Errors["confirm"] = "Type the circle's name exactly to confirm."
+		renderCircleSettings(w, r, http.StatusUnprocessableEntity, data, role)
+		return
+	}
+
+	now := time.Now()
+	if err := dataStore.ArchiveCircle(r.Context(), circle.ID, now, now.Add(circleDeleteGrace)); err != nil {
+		log.Printf("Error scheduling deletion of circle %s: %v", circle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Circle %s scheduled for deletion by %s", circle.ID, currentUserID(r))
+	reloadCircleSettings(w, r, circle.ID, "Circle scheduled for deletion. Restore it within 14 days to keep it.")
+}
@@ -1,19 +1,209 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
 
+	"circles.diy/internal/authz"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
 	"circles.diy/internal/templates"
 )
 
+const (
+	circlesActivityCount = 10
+	circlesFeaturedCount = 6
+)
+
 func CirclesHandler(w http.ResponseWriter, r *http.Request) {
-	data := templates.GetMockCirclesPageData()
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/circles"), "/")
+	if path != "" {
+		parts := strings.Split(path, "/")
+		switch {
+		case len(parts) == 1 && parts[0] == "new":
+			newCircleHandler(w, r, userID)
+		case parts[0] == "invite" && len(parts) <= 2:
+			code := ""
+			if len(parts) == 2 {
+				code = parts[1]
+			}
+			circleInviteHandler(w, r, code, userID)
+		case len(parts) == 2 && parts[1] == "join":
+			circleJoinHandler(w, r, parts[0], userID)
+		case len(parts) == 3 && parts[1] == "join" && parts[2] == "cancel":
+			cancelJoinRequestHandler(w, r, parts[0], userID)
+		case len(parts) == 2 && parts[1] == "leave":
+			leaveCircleHandler(w, r, parts[0])
+		case len(parts) == 3 && parts[1] == "requests" && (parts[2] == "approve" || parts[2] == "decline"):
+			joinRequestDecisionHandler(w, r, parts[0], parts[2] == "approve")
+		case len(parts) == 3 && parts[1] == "members" && (parts[2] == "remove" || parts[2] == "ban"):
+			removeMemberHandler(w, r, parts[0], parts[2] == "ban")
+		case len(parts) == 3 && parts[1] == "members" && parts[2] == "unban":
+			unbanMemberHandler(w, r, parts[0])
+		case len(parts) == 2 && parts[1] == "invites":
+			createInviteHandler(w, r, parts[0])
+		case len(parts) == 3 && parts[1] == "invites" && parts[2] == "revoke":
+			revokeInviteHandler(w, r, parts[0])
+		case len(parts) == 2 && parts[1] == "settings":
+			circleSettingsHandler(w, r, parts[0])
+		case len(parts) == 2 && parts[1] == "transfer":
+			transferCircleHandler(w, r, parts[0])
+		case len(parts) == 2 && parts[1] == "archive":
+			archiveCircleHandler(w, r, parts[0])
+		case len(parts) == 2 && parts[1] == "restore":
+			restoreCircleHandler(w, r, parts[0])
+		case len(parts) == 2 && parts[1] == "delete":
+			deleteCircleHandler(w, r, parts[0])
+		case len(parts) == 2 && parts[1] == "members":
+			circleMembersHandler(w, r, parts[0])
+		case len(parts) == 3 && parts[1] == "members" && parts[2] == "role":
+			setMemberRoleHandler(w, r, parts[0])
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	data, err := loadCirclesPageData(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error loading circles data: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Each card can be fetched alone to refresh it in place
+	cards := make(map[string]templates.Fragment, len(data.Circles))
+	for _, circle := range data.Circles {
+		cards["circle-"+circle.ID] = templates.Fragment{Name: "circle-card", Data: circle}
+	}
+	render(w, r, templates.View{Set: "circles", Page: "circles", Fragments: cards, Data: data})
+}
+
+func loadCirclesPageData(ctx context.Context, userID string) (models.CirclesPageData, error) {
+	data := models.CirclesPageData{BaseData: newBaseData(ctx, "My Circles", "circles")}
+
+	var err error
+	if data.Circles, err = dataStore.ListCirclesForUser(ctx, userID); err != nil {
+		return data, err
+	}
+	if data.RecentActivity, err = dataStore.ListCircleActivity(ctx, userID, circlesActivityCount); err != nil {
+		return data, err
+	}
+	if data.Stats, err = dataStore.GetCircleStats(ctx, userID); err != nil {
+		return data, err
+	}
+	if data.FeaturedCircles, err = dataStore.ListFeaturedCircles(ctx, userID, circlesFeaturedCount); err != nil {
+		return data, err
+	}
+	if err := circlesPresence(ctx, data.Circles); err != nil {
+		return data, err
+	}
+	if err := circlesPresence(ctx, data.FeaturedCircles); err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+func circleMembersHandler(w http.ResponseWriter, r *http.Request, circleID string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	circle, role, ok := authorizeCircle(w, r, circleID, authz.PermView)
+	if !ok {
+		return
+	}
+	renderCircleMembers(w, r, circle, role, http.StatusOK, "", nil)
+}
 
-	err := templates.GetTemplates().Circles.ExecuteTemplate(w, "circles", data)
+// renderCircleMembers shows the member list with the join queue, invites
+// and bans role may manage.
+func renderCircleMembers(w http.ResponseWriter, r *http.Request, circle models.Circle, role authz.Role, status int, notice string, errs map[string]string) {
+	ctx := r.Context()
+	data := models.CircleMembersPageData{
+		BaseData:     newBaseData(ctx, circle.Name+" members", "circles"),
+		Circle:       circle,
+		InviteOrigin: linkOrigin(r),
+		Errors:       errs,
+		Notice:       notice,
+	}
+	for _, assignable := range authz.AssignableRoles(role) {
+		data.AssignableRoles = append(data.AssignableRoles, string(assignable))
+	}
+
+	var err error
+	if data.Members, err = dataStore.ListMembers(ctx, circle.ID); err == nil && role.Can(authz.PermInvite) {
+		if data.Requests, err = dataStore.ListJoinRequests(ctx, circle.ID); err == nil {
+			data.Invites, err = dataStore.ListInvites(ctx, circle.ID)
+		}
+	}
+	if err == nil && role.Can(authz.PermModerate) {
+		data.Bans, err = dataStore.ListBans(ctx, circle.ID)
+	}
+	if err != nil {
+		log.Printf("Error loading members of %s: %v", circle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, templates.View{Set: "circle-members", Page: "circle-members", Data: data, Status: status})
+}
+
+// setMemberRoleHandler changes a member's role. The actor must be able to
+// edit the circle's settings and outrank both the member's current and new
+// role.
+func setMemberRoleHandler(w http.ResponseWriter, r *http.Request, circleID string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	circle, role, ok := authorizeCircle(w, r, circleID, authz.PermEditSettings)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	memberID := r.FormValue("user_id")
+	next, valid := authz.ParseRole(r.FormValue("role"))
+	if !valid {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+	current, err := dataStore.GetMemberRole(ctx, circle.ID, memberID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
-		log.Printf("Error rendering circles template: %v", err)
+		log.Printf("Error loading member role: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !authz.CanAssign(role, authz.Role(current), next) {
+		renderForbidden(w, r, "You can only change the roles of members below you, and only to roles below your own.")
+		return
+	}
+
+	if err := dataStore.SetMemberRole(ctx, circle.ID, memberID, string(next)); err != nil {
+		log.Printf("Error setting member role: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-}
\ No newline at end of file
+	log.Printf("Role of %s in circle %s set to %s by %s", memberID, circle.ID, next, currentUserID(r))
+	http.Redirect(w, r, "/circles/"+circle.ID+"/members", http.StatusSeeOther)
+}
@@ -1,19 +1,102 @@
 package handlers
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"strings"
 
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
 	"circles.diy/internal/templates"
 )
 
+const (
+	dashboardFeedSize        = 20
+	dashboardDiscussionCount = 2
+	dashboardEventCount      = 2
+	dashboardRippleCount     = 10
+	dashboardListingCount    = 3
+)
+
 func DashboardHandler(w http.ResponseWriter, r *http.Request) {
-	data := templates.GetMockDashboardData()
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
 
-	err := templates.GetTemplates().Dashboard.ExecuteTemplate(w, "dashboard", data)
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/dashboard"), "/") {
+	case "":
+	case "feed":
+		feedHandler(w, r, userID)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := loadDashboardData(r.Context(), userID, r.URL.Query().Get("after"))
+	if invalidCursor(err) {
+		http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		log.Printf("Error rendering dashboard template: %v", err)
+		log.Printf("Error loading dashboard data: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-}
\ No newline at end of file
+
+	render(w, r, templates.View{
+		Set:       "dashboard",
+		Page:      "dashboard",
+		Fragments: map[string]templates.Fragment{"feed-section": {Name: "feed-section"}},
+		Data:      data,
+	})
+}
+
+// loadDashboardData loads the dashboard with the page of the feed after
+// the cursor, the first page when it is empty.
+func loadDashboardData(ctx context.Context, userID, after string) (models.DashboardData, error) {
+	data := models.DashboardData{BaseData: newBaseData(ctx, "Dashboard", "dashboard")}
+
+	strategy, err := feedStrategy(ctx, userID)
+	if err != nil {
+		return data, err
+	}
+	data.FeedSettings = newFeedSettings(strategy)
+	if data.Feed, data.FeedCursor, err = loadFeed(ctx, userID, strategy, dashboardFeedSize, after); err != nil {
+		return data, err
+	}
+	if data.Circles, err = dataStore.ListCirclesForUser(ctx, userID); err != nil {
+		return data, err
+	}
+	if data.Discussions, err = dataStore.ListDiscussions(ctx, userID, dashboardDiscussionCount); err != nil {
+		return data, err
+	}
+	if data.Ripples, err = dataStore.ListRipples(ctx, dashboardRippleCount); err != nil {
+		return data, err
+	}
+	if data.MarketplaceItems, _, err = dataStore.ListMarketplaceItems(ctx, store.MarketplaceQuery{Limit: dashboardListingCount}); err != nil {
+		return data, err
+	}
+	if data.Impact, err = dataStore.ListImpact(ctx, userID); err != nil {
+		return data, err
+	}
+
+	events, err := dataStore.ListAttendingEvents(ctx, userID, dashboardEventCount)
+	if err != nil {
+		return data, err
+	}
+	for _, e := range events {
+		starts := e.StartsAt.Local()
+		data.Events = append(data.Events, models.Event{
+			ID:    e.ID,
+			Title: e.Title,
+			Time:  starts.Format("3:04 PM"),
+			Day:   starts.Format("02"),
+			Month: starts.Format("Jan"),
+		})
+	}
+
+	return data, nil
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"circles.diy/internal/middleware"
+	"circles.diy/internal/models"
+	"circles.diy/internal/templates"
+)
+
+// wantsJSON reports whether the client expects a machine-readable error
+// rather than a page: fetch calls sending or accepting JSON, and HTMX
+// requests, whose error responses are not swapped in.
+func wantsJSON(r *http.Request) bool {
+	return isHTMX(r) ||
+		strings.Contains(r.Header.Get("Accept"), "application/json") ||
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
+
+// renderError answers with an error page, or a JSON error for clients that
+// want one. code is a stable identifier for scripts to branch on.
+func renderError(w http.ResponseWriter, r *http.Request, status int, code, heading, message string) {
+	if wantsJSON(r) {
+		writeJSON(w, status, map[string]string{"error": code, "message": message})
+		return
+	}
+
+	data := models.ErrorPageData{
+		BaseData: newBaseData(r.Context(), heading, ""),
+		Status:   status,
+		Heading:  heading,
+		Message:  message,
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	render(w, r, templates.View{Set: "error", Page: "error", Data: data, Status: status})
+}
+
+// CSRFFailureHandler answers requests rejected by the CSRF middleware.
+func CSRFFailureHandler(w http.ResponseWriter, r *http.Request) {
+	reason := middleware.CSRFFailureReason(r.Context())
+	message := "This form has expired. Go back, reload the page and try again."
+	if reason == middleware.CSRFReasonOrigin {
+		message = "This request came from another site, so it was blocked."
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error":   "csrf",
+			"reason":  reason,
+			"message": message,
+		})
+		return
+	}
+	renderError(w, r, http.StatusForbidden, "csrf", "Request blocked", message)
+}
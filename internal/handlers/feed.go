@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"circles.diy/internal/feed"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+)
+
+// feedStrategy returns the feed strategy userID picked, or the default.
+func feedStrategy(ctx context.Context, userID string) (feed.Strategy, error) {
+	name, err := dataStore.GetFeedStrategy(ctx, userID)
+	if err != nil {
+		return feed.Default, err
+	}
+	strategy, _ := feed.Parse(name)
+	return strategy, nil
+}
+
+// loadFeed assembles the page of userID's feed after the cursor. The
+// mixed strategy ranks a window of the posts made up to its first page and
+// pages through that ranking.
+func loadFeed(ctx context.Context, userID string, strategy feed.Strategy, limit int, after string) ([]models.FeedItem, string, error) {
+	own, circles, connections := strategy.Sources()
+	q := store.FeedQuery{Own: own, Circles: circles, Connections: connections, Limit: limit, After: after}
+	if strategy != feed.Mixed {
+		items, next, err := dataStore.ListFeed(ctx, userID, q)
+		if err != nil {
+			return nil, "", err
+		}
+		return feed.Rank(strategy, items, time.Now()), next, nil
+	}
+
+	cursor, err := feed.ParseMixCursor(after)
+	if err != nil {
+		return nil, "", err
+	}
+	if cursor.At.IsZero() {
+		cursor.At = time.Now().UTC()
+	}
+	q.Limit, q.After, q.Until = feed.MixWindow, "", cursor.At
+	items, _, err := dataStore.ListFeed(ctx, userID, q)
+	if err != nil {
+		return nil, "", err
+	}
+	items, next := cursor.Page(feed.Rank(strategy, items, cursor.At), limit)
+	return items, next, nil
+}
+
+// invalidCursor reports whether err comes from a page cursor that could
+// not be read, which requests should answer with 400.
+func invalidCursor(err error) bool {
+	return errors.Is(err, store.ErrInvalidCursor) || errors.Is(err, feed.ErrInvalidCursor)
+}
+
+func newFeedSettings(strategy feed.Strategy) models.FeedSettings {
+	settings := models.FeedSettings{Strategy: string(strategy)}
+	for _, s := range feed.Strategies {
+		settings.Strategies = append(settings.Strategies, models.FeedStrategy{
+			Name:        string(s),
+			Label:       s.Label(),
+			Description: s.Description(),
+		})
+	}
+	for _, w := range feed.MixWeights {
+		settings.Weights = append(settings.Weights, models.FeedWeight{
+			Name:        w.Name,
+			Label:       w.Label,
+			Description: w.Description,
+			Percent:     int(math.Round(w.Weight * 100)),
+		})
+	}
+	return settings
+}
+
+// feedHandler routes /dashboard/feed: GET loads the next page of the feed
+// for HTMX and POST picks the feed strategy.
+func feedHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	switch r.Method {
+	case http.MethodGet:
+		feedPageHandler(w, r, userID)
+	case http.MethodPost:
+		feedStrategyHandler(w, r, userID)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// feedPageHandler renders the feed entries after ?after=, with the button
+// for the page after them.
+func feedPageHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	ctx := r.Context()
+	strategy, err := feedStrategy(ctx, userID)
+	if err != nil {
+		log.Printf("Error loading feed strategy for %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	var data models.DashboardData
+	data.Feed, data.FeedCursor, err = loadFeed(ctx, userID, strategy, dashboardFeedSize, r.URL.Query().Get("after"))
+	if invalidCursor(err) {
+		http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading feed for %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, templates.View{
+		Set:      "dashboard",
+		Fragment: "feed-page",
+		Data:     data,
+		OOB:      []templates.OOB{{Target: "feed-more", Name: "feed-more", Data: data}},
+	})
+}
+
+// feedStrategyHandler saves the member's feed strategy. HTMX gets the feed
+// section rebuilt with it; others go back to the dashboard.
+func feedStrategyHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	strategy, ok := feed.Parse(r.FormValue("strategy"))
+	if !ok {
+		http.Error(w, "Unknown feed strategy", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	err := dataStore.SetFeedStrategy(ctx, userID, string(strategy))
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving feed strategy for %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !wantsFragment(r) {
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return
+	}
+	data := models.DashboardData{
+		BaseData:     newBaseData(ctx, "Dashboard", "dashboard"),
+		FeedSettings: newFeedSettings(strategy),
+	}
+	if data.Feed, data.FeedCursor, err = loadFeed(ctx, userID, strategy, dashboardFeedSize, ""); err != nil {
+		log.Printf("Error loading feed for %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, templates.View{Set: "dashboard", Fragment: "feed-section", Data: data})
+}
@@ -1,21 +1,105 @@
 package handlers
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"strings"
 
+	"circles.diy/internal/models"
 	"circles.diy/internal/templates"
 )
 
+const (
+	gatherFeaturedCount = 3
+	gatherUpcomingCount = 20
+	gatherLocationCount = 6
+)
+
 func GatherHandler(w http.ResponseWriter, r *http.Request) {
-	// Get mock gather data
-	data := templates.GetMockGatherData()
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/gather"), "/") {
+	case "":
+	case "events":
+		gatherEventsHandler(w, r, userID)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
 
-	// Render the gather template
-	err := templates.GetTemplates().Gather.ExecuteTemplate(w, "gather", data)
+	data, err := loadGatherData(r.Context(), userID, r.URL.Query().Get("after"))
+	if invalidCursor(err) {
+		http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		log.Printf("Error rendering gather template: %v", err)
+		log.Printf("Error loading gather data: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+
+	// Each upcoming event's card can be fetched alone to refresh it in place
+	cards := make(map[string]templates.Fragment, len(data.UpcomingEvents))
+	for _, event := range data.UpcomingEvents {
+		cards["event-"+event.ID] = templates.Fragment{Name: "event-card-list", Data: event}
+	}
+	render(w, r, templates.View{Set: "gather", Page: "gather", Fragments: cards, Data: data})
+}
+
+// gatherEventsHandler renders the upcoming events after ?after=, with the
+// button for the page after them.
+func gatherEventsHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var data models.GatherPageData
+	var err error
+	data.UpcomingEvents, data.UpcomingCursor, err = dataStore.ListUpcomingEvents(r.Context(), userID, gatherUpcomingCount, r.URL.Query().Get("after"))
+	if invalidCursor(err) {
+		http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading upcoming events: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, templates.View{
+		Set:      "gather",
+		Fragment: "events-page",
+		Data:     data,
+		OOB:      []templates.OOB{{Target: "upcoming-events-more", Name: "events-more", Data: data}},
+	})
+}
+
+// loadGatherData loads the gather page with the page of upcoming events
+// after the cursor.
+func loadGatherData(ctx context.Context, userID, after string) (models.GatherPageData, error) {
+	data := models.GatherPageData{BaseData: newBaseData(ctx, "Gather", "gather")}
+
+	var err error
+	if data.FeaturedEvents, err = dataStore.ListFeaturedEvents(ctx, userID, gatherFeaturedCount); err != nil {
+		return data, err
+	}
+	if data.UpcomingEvents, data.UpcomingCursor, err = dataStore.ListUpcomingEvents(ctx, userID, gatherUpcomingCount, after); err != nil {
+		return data, err
+	}
+	if data.MyEvents, err = dataStore.ListHostedEvents(ctx, userID); err != nil {
+		return data, err
+	}
+	if data.EventCategories, err = dataStore.ListEventCategories(ctx); err != nil {
+		return data, err
+	}
+	if data.PopularLocations, err = dataStore.ListEventLocations(ctx, gatherLocationCount); err != nil {
+		return data, err
+	}
+
+	return data, nil
 }
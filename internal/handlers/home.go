@@ -3,14 +3,15 @@ package handlers
 import (
 	"fmt"
 	"html"
-	"html/template"
 	"log"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"circles.diy/internal/middleware"
 	"circles.diy/internal/models"
+	"circles.diy/internal/templates"
 	"circles.diy/internal/utils"
 )
 
@@ -20,12 +21,11 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl := template.Must(template.ParseFiles("index.html"))
 	data := models.PageData{
 		Success:   false,
-		CSRFToken: utils.GenerateCSRFToken(),
+		CSRFToken: middleware.CSRFToken(r.Context()),
 	}
-	tmpl.Execute(w, data)
+	render(w, r, templates.View{Set: "index", Page: "index", Data: data})
 }
 
 func FeedbackHandler(w http.ResponseWriter, r *http.Request) {
@@ -39,12 +39,6 @@ func FeedbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	csrfToken := r.FormValue("csrf_token")
-	if csrfToken == "" {
-		http.Error(w, "Missing CSRF token", http.StatusBadRequest)
-		return
-	}
-
 	// Honeypot validation - if these fields are filled, it's likely a bot
 	if r.FormValue("website") != "" || r.FormValue("email_address") != "" {
 		log.Printf("Bot detected from %s: honeypot fields filled", r.RemoteAddr)
@@ -98,10 +92,9 @@ func FeedbackHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Feedback received from %s (personas: %s, length: %d)", r.RemoteAddr, personaText, len(validatedFeedback))
 	}
 
-	tmpl := template.Must(template.ParseFiles("index.html"))
 	data := models.PageData{
 		Success:   true,
-		CSRFToken: utils.GenerateCSRFToken(),
+		CSRFToken: middleware.CSRFToken(r.Context()),
 	}
-	tmpl.Execute(w, data)
+	render(w, r, templates.View{Set: "index", Page: "index", Data: data})
 }
\ No newline at end of file
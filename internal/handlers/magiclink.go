@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"circles.diy/internal/auth"
+	"circles.diy/internal/mail"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/utils"
+)
+
+var (
+	mailer  mail.Mailer
+	baseURL string
+)
+
+// SetMailer sets how sign-in links are delivered. publicURL is the origin
+// used in the links. It is always set in production; only in development is
+// it left empty and taken from the request, whose Host anyone can forge.
+func SetMailer(m mail.Mailer, publicURL string) {
+	mailer = m
+	baseURL = publicURL
+}
+
+func linkOrigin(r *http.Request) string {
+	if baseURL != "" {
+		return baseURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// sendLoginLink emails user a sign-in link. Delivery happens in the
+// background so a slow mail server does not hold up the response; failures
+// are only logged.
+func sendLoginLink(r *http.Request, user models.User, email, next string) {
+	token, err := auth.IssueLoginToken(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error issuing login token for %s: %v", user.Handle, err)
+		return
+	}
+
+	query := url.Values{"token": {token}}
+	if next != "" {
+		query.Set("next", next)
+	}
+	link := linkOrigin(r) + "/login/magic?" + query.Encode()
+
+	name := user.Name
+	if name == "" {
+		name = strings.TrimPrefix(user.Handle, "@")
+	}
+	msg := mail.Message{
+		To:      email,
+		Subject: "Your circles.diy sign-in link",
+		Text: fmt.Sprintf("Hi %s,\n\n"+
+			"Use this link to sign in to circles.diy. It works once and expires in %d minutes:\n\n"+
+			"%s\n\n"+
+			"If you didn't ask to sign in, you can ignore this email.\n",
+			name, int(auth.LoginTokenTTL.Minutes()), link),
+	}
+
+	go func() {
+		if err := mailer.Send(context.Background(), msg); err != nil {
+			log.Printf("Error sending sign-in link to %s: %v", user.Handle, err)
+		}
+	}()
+}
+
+// MagicLinkRequestHandler emails a sign-in link. It answers the same way
+// whether or not the address has an account.
+func MagicLinkRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	data := newAuthPageData(ctx, "Sign in", r.FormValue("next"))
+	data.Values["email"] = strings.TrimSpace(r.FormValue("email"))
+
+	email, ok := utils.ValidateEmail(data.Values["email"])
+	if !ok {
+		data.Errors["email"] = "Enter a valid email address."
+		renderAuthPage(w, r, http.StatusUnprocessableEntity, "login", data)
+		return
+	}
+
+	account, err := dataStore.GetAccountByEmail(ctx, email)
+	switch {
+	case err == nil:
+		user, err := dataStore.GetUser(ctx, account.UserID)
+		if err != nil {
+			log.Printf("Error loading user for sign-in link: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		sendLoginLink(r, user, account.Email, data.Next)
+	case !errors.Is(err, store.ErrNotFound):
+		log.Printf("Error looking up account: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	data.Notice = fmt.Sprintf("If an account uses %s, a sign-in link is on its way. It expires in %d minutes.",
+		email, int(auth.LoginTokenTTL.Minutes()))
+	renderAuthPage(w, r, http.StatusOK, "login", data)
+}
+
+// MagicLinkHandler signs in with an emailed link. Opening the link only
+// shows a confirmation button, so mail scanners that prefetch links cannot
+// use the token up; the POST redeems it.
+func MagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		data := newAuthPageData(r.Context(), "Finish signing in", r.URL.Query().Get("next"))
+		data.Token = r.URL.Query().Get("token")
+		renderAuthPage(w, r, http.StatusOK, "magic-link", data)
+	case http.MethodPost:
+		redeemLoginLink(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func redeemLoginLink(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	next := r.FormValue("next")
+	userID, err := auth.RedeemLoginToken(ctx, r.FormValue("token"))
+	if errors.Is(err, store.ErrNotFound) {
+		data := newAuthPageData(ctx, "Sign in", next)
+		data.Errors["form"] = "That sign-in link has expired or was already used. Request a new one below."
+		renderAuthPage(w, r, http.StatusGone, "login", data)
+		return
+	}
+	if err != nil {
+		log.Printf("Error redeeming login token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := auth.StartSession(ctx, w, userID); err != nil {
+		log.Printf("Error starting session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, safeNext(next), http.StatusSeeOther)
+}
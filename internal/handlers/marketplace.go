@@ -3,19 +3,142 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
 	"circles.diy/internal/templates"
 )
 
+const (
+	marketplacePageSize      = 12
+	marketplaceFeaturedCount = 4
+	marketplaceLocationCount = 6
+	marketplaceMaxDistance   = 25
+)
+
+var (
+	marketplacePriceTypes = []string{"sale", "trade", "free", "negotiable"}
+	marketplaceConditions = []string{"new", "like-new", "good", "fair", "poor"}
+)
+
 func MarketplaceHandler(w http.ResponseWriter, r *http.Request) {
-	// Get mock marketplace data
-	data := templates.GetMockMarketplaceData()
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/marketplace"), "/") {
+	case "":
+	case "items":
+		marketplaceItemsHandler(w, r)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := loadMarketplaceData(r)
+	if invalidCursor(err) {
+		http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading marketplace data: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, templates.View{Set: "marketplace", Page: "marketplace", Data: data})
+}
 
-	// Render the marketplace template
-	err := templates.GetTemplates().Marketplace.ExecuteTemplate(w, "marketplace", data)
+// marketplaceItemsHandler renders the listings after ?after= that match
+// the filters, with the button for the page after them.
+func marketplaceItemsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query, filters := marketplaceQuery(r.URL.Query())
+	data := models.MarketplacePageData{ActiveFilters: filters}
+	var err error
+	data.Items, data.NextCursor, err = dataStore.ListMarketplaceItems(r.Context(), query)
+	if invalidCursor(err) {
+		http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		log.Printf("Error rendering marketplace template: %v", err)
+		log.Printf("Error loading marketplace items: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	render(w, r, templates.View{
+		Set:      "marketplace",
+		Fragment: "marketplace-page",
+		Data:     data,
+		OOB:      []templates.OOB{{Target: "marketplace-more", Name: "marketplace-more", Data: data}},
+	})
+}
+
+// marketplaceQuery reads the listing filters and page cursor from params,
+// returning the filters that are set for carrying over to the next page.
+func marketplaceQuery(params url.Values) (store.MarketplaceQuery, map[string]interface{}) {
+	query := store.MarketplaceQuery{
+		Category:  params.Get("category"),
+		PriceType: params.Get("price_type"),
+		Location:  params.Get("location"),
+		Condition: params.Get("condition"),
+		Limit:     marketplacePageSize,
+		After:     params.Get("after"),
+	}
+	filters := make(map[string]interface{})
+	for key, value := range map[string]string{
+		"category":   query.Category,
+		"price_type": query.PriceType,
+		"location":   query.Location,
+		"condition":  query.Condition,
+	} {
+		if value != "" {
+			filters[key] = value
+		}
+	}
+	return query, filters
+}
+
+func loadMarketplaceData(r *http.Request) (models.MarketplacePageData, error) {
+	ctx := r.Context()
+	query, filters := marketplaceQuery(r.URL.Query())
+
+	data := models.MarketplacePageData{
+		BaseData:      newBaseData(ctx, "Marketplace", "marketplace"),
+		ItemsPerPage:  marketplacePageSize,
+		ActiveFilters: filters,
+	}
+
+	var err error
+	if data.Items, data.NextCursor, err = dataStore.ListMarketplaceItems(ctx, query); err != nil {
+		return data, err
+	}
+	if data.TotalItems, err = dataStore.CountMarketplaceItems(ctx, query); err != nil {
+		return data, err
+	}
+
+	featured := true
+	if data.FeaturedItems, _, err = dataStore.ListMarketplaceItems(ctx, store.MarketplaceQuery{Featured: &featured, Limit: marketplaceFeaturedCount}); err != nil {
+		return data, err
+	}
+	if data.Categories, err = dataStore.ListMarketplaceCategories(ctx); err != nil {
+		return data, err
+	}
+	if data.PopularLocations, err = dataStore.ListMarketplaceLocations(ctx, marketplaceLocationCount); err != nil {
+		return data, err
+	}
+
+	data.Filters = models.MarketplaceFilter{
+		PriceTypes:  marketplacePriceTypes,
+		Conditions:  marketplaceConditions,
+		MaxDistance: marketplaceMaxDistance,
+	}
+	for _, c := range data.Categories {
+		data.Filters.Categories = append(data.Filters.Categories, c.ID)
+	}
+
+	return data, nil
 }
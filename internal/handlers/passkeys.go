@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"circles.diy/internal/auth"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+	"circles.diy/internal/utils"
+	"circles.diy/internal/webauthn"
+)
+
+// maxCeremonyBody caps WebAuthn JSON request bodies; real responses are a
+// few kilobytes.
+const maxCeremonyBody = 64 << 10
+
+// relyingParty describes this site to authenticators, using the same public
+// origin as sign-in links.
+func relyingParty(r *http.Request) webauthn.RelyingParty {
+	origin := linkOrigin(r)
+	host := r.Host
+	if u, err := url.Parse(origin); err == nil {
+		host = u.Hostname()
+	}
+	return webauthn.RelyingParty{ID: host, Name: "circles.diy", Origin: origin}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing JSON response: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// readCeremonyJSON decodes a WebAuthn request body into v.
+func readCeremonyJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return false
+	}
+	if v == nil {
+		return true
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCeremonyBody)).Decode(v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+	return true
+}
+
+// ceremonyFailed answers a passkey ceremony that did not complete.
+func ceremonyFailed(w http.ResponseWriter, err error, rejected int) {
+	switch {
+	case errors.Is(err, auth.ErrNoCeremony):
+		writeJSONError(w, http.StatusBadRequest, "This passkey request expired. Please try again.")
+	case errors.Is(err, webauthn.ErrInvalidResponse),
+		errors.Is(err, webauthn.ErrClonedCredential),
+		errors.Is(err, auth.ErrUnknownPasskey):
+		log.Printf("Passkey rejected: %v", err)
+		writeJSONError(w, rejected, "That passkey could not be verified.")
+	default:
+		log.Printf("Error completing passkey ceremony: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// PasskeysHandler serves the passkey settings under /settings/passkeys:
+// the list page, the registration ceremony and rename and revoke forms.
+func PasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/settings/passkeys") {
+	case "", "/":
+		switch r.Method {
+		case http.MethodGet:
+			renderPasskeysPage(w, r, userID, http.StatusOK, "", nil)
+		case http.MethodPost:
+			registerPasskey(w, r, userID)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case "/options":
+		passkeyCreationOptions(w, r)
+	case "/rename":
+		renamePasskey(w, r, userID)
+	case "/delete":
+		deletePasskey(w, r, userID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func renderPasskeysPage(w http.ResponseWriter, r *http.Request, userID string, status int, notice string, errs map[string]string) {
+	passkeys, err := dataStore.ListPasskeys(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing passkeys: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for i := range passkeys {
+		passkeys[i].Added = utils.TimeAgoLong(passkeys[i].CreatedAt)
+		passkeys[i].LastUsed = utils.TimeAgo(passkeys[i].LastUsedAt)
+	}
+
+	data := models.PasskeysPageData{
+		BaseData: newBaseData(r.Context(), "Passkeys", ""),
+		Passkeys: passkeys,
+		Notice:   notice,
+		Errors:   errs,
+	}
+	render(w, r, templates.View{Set: "passkeys", Page: "passkeys", Data: data, Status: status})
+}
+
+func passkeyCreationOptions(w http.ResponseWriter, r *http.Request) {
+	if !readCeremonyJSON(w, r, nil) {
+		return
+	}
+	user, _ := auth.CurrentUser(r.Context())
+	opts, err := auth.BeginPasskeyRegistration(w, r, relyingParty(r), user)
+	if err != nil {
+		ceremonyFailed(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, opts)
+}
+
+func registerPasskey(w http.ResponseWriter, r *http.Request, userID string) {
+	var req struct {
+		Name       string                        `json:"name"`
+		Credential webauthn.RegistrationResponse `json:"credential"`
+	}
+	if !readCeremonyJSON(w, r, &req) {
+		return
+	}
+
+	passkey, err := auth.FinishPasskeyRegistration(w, r, relyingParty(r), userID, req.Name, req.Credential)
+	if err != nil {
+		ceremonyFailed(w, err, http.StatusBadRequest)
+		return
+	}
+	log.Printf("Passkey added for user %s", userID)
+	writeJSON(w, http.StatusCreated, passkey)
+}
+
+// postForm parses a submitted form, answering the request itself when it
+// is not a valid POST.
+func postForm(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func renamePasskey(w http.ResponseWriter, r *http.Request, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	id := r.FormValue("id")
+	if strings.TrimSpace(r.FormValue("name")) == "" {
+		renderPasskeysPage(w, r, userID, http.StatusUnprocessableEntity, "",
+			map[string]string{id: "Give the passkey a name."})
+		return
+	}
+
+	err := dataStore.RenamePasskey(r.Context(), userID, id, auth.NormalizePasskeyName(r.FormValue("name")))
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error renaming passkey: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/settings/passkeys", http.StatusSeeOther)
+}
+
+func deletePasskey(w http.ResponseWriter, r *http.Request, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+
+	err := dataStore.DeletePasskey(r.Context(), userID, r.FormValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking passkey: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Passkey revoked for user %s", userID)
+	renderPasskeysPage(w, r, userID, http.StatusOK, "Passkey removed. It can no longer be used to sign in.", nil)
+}
+
+// PasskeyLoginHandler runs the sign-in ceremony: /login/passkey/options
+// returns the challenge and /login/passkey verifies the signed answer and
+// starts a session.
+func PasskeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/login/passkey/options":
+		if !readCeremonyJSON(w, r, nil) {
+			return
+		}
+		opts, err := auth.BeginPasskeyLogin(w, relyingParty(r))
+		if err != nil {
+			ceremonyFailed(w, err, http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, http.StatusOK, opts)
+	case "/login/passkey":
+		passkeyLogin(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func passkeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Next       string                     `json:"next"`
+		Credential webauthn.AssertionResponse `json:"credential"`
+	}
+	if !readCeremonyJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := auth.FinishPasskeyLogin(w, r, relyingParty(r), req.Credential)
+	if err != nil {
+		ceremonyFailed(w, err, http.StatusUnauthorized)
+		return
+	}
+	if err := auth.StartSession(r.Context(), w, userID); err != nil {
+		log.Printf("Error starting session: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"redirect": safeNext(req.Next)})
+}
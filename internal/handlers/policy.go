@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"circles.diy/internal/authz"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+)
+
+// renderForbidden answers a request the signed-in user is not allowed to
+// make.
+func renderForbidden(w http.ResponseWriter, r *http.Request, message string) {
+	renderError(w, r, http.StatusForbidden, "forbidden", "You can't do that here", message)
+}
+
+// authorizeCircle loads a circle as the signed-in user sees it and checks
+// their role grants perm. Unknown circles get a 404 and refusals a 403
+// page; ok is false in both cases and the response has been written.
+// Changes to archived circles are refused except for PermDelete, which
+// covers restoring them.
+func authorizeCircle(w http.ResponseWriter, r *http.Request, circleID string, perm authz.Permission) (circle models.Circle, role authz.Role, ok bool) {
+	circle, err := dataStore.GetCircle(r.Context(), circleID, currentUserID(r))
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return circle, "", false
+	}
+	if err != nil {
+		log.Printf("Error loading circle %s: %v", circleID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return circle, "", false
+	}
+
+	role = authz.Role(circle.UserRole)
+	if !role.Can(perm) {
+		message := "Your role in " + circle.Name + " doesn't allow this."
+		if role == "" {
+			message = "Only members of " + circle.Name + " can do this."
+		}
+		renderForbidden(w, r, message)
+		return circle, role, false
+	}
+	// Archived circles are read-only until restored
+	if circle.Archived() && r.Method != http.MethodGet && perm != authz.PermView && perm != authz.PermDelete {
+		renderForbidden(w, r, circle.Name+" is archived. Restore it to make changes.")
+		return circle, role, false
+	}
+	return circle, role, true
+}
@@ -0,0 +1,533 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"circles.diy/internal/authz"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+	"circles.diy/internal/utils"
+)
+
+const (
+	maxPostLength     = 5000
+	maxMediaAltLength = 300
+	maxGallerySize    = 10
+)
+
+var postKinds = []string{"text", "image", "video", "gallery"}
+
+// PostsHandler serves the composer, post threads and the post, draft and
+// reply actions under /posts.
+func PostsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/posts"), "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(parts) == 0:
+		createPostHandler(w, r, userID)
+	case len(parts) == 1 && parts[0] == "new":
+		composePostHandler(w, r, userID)
+	case len(parts) == 1 && parts[0] == "drafts":
+		autosaveDraftHandler(w, r, userID)
+	case len(parts) == 3 && parts[0] == "drafts" && parts[2] == "publish":
+		publishDraftHandler(w, r, parts[1], userID)
+	case len(parts) == 3 && parts[0] == "drafts" && parts[2] == "delete":
+		deleteDraftHandler(w, r, parts[1], userID)
+	case len(parts) == 1:
+		postThreadHandler(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "replies":
+		repliesHandler(w, r, parts[0], userID)
+	case len(parts) == 2 && parts[1] == "edit":
+		editPostHandler(w, r, parts[0], userID)
+	case len(parts) == 2 && parts[1] == "delete":
+		deletePostHandler(w, r, parts[0], userID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// postableCircles returns the circles userID may post in right now.
+func postableCircles(ctx context.Context, userID string) ([]models.Circle, error) {
+	circles, err := dataStore.ListCirclesForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var postable []models.Circle
+	for _, c := range circles {
+		if authz.Role(c.UserRole).Can(authz.PermPost) && !c.Archived() {
+			postable = append(postable, c)
+		}
+	}
+	return postable, nil
+}
+
+func newPostFormPageData(r *http.Request, title, userID string) (models.PostFormPageData, error) {
+	data := models.PostFormPageData{
+		BaseData: newBaseData(r.Context(), title, "profile"),
+		Kinds:    postKinds,
+		Values:   map[string]string{"kind": "text"},
+		Errors:   map[string]string{},
+	}
+	var err error
+	data.Circles, err = postableCircles(r.Context(), userID)
+	return data, err
+}
+
+func renderPostForm(w http.ResponseWriter, r *http.Request, status int, data models.PostFormPageData) {
+	for len(data.Media) < maxGallerySize {
+		data.Media = append(data.Media, models.MediaItem{})
+	}
+	render(w, r, templates.View{Set: "post-form", Page: "post-form", Data: data, Status: status})
+}
+
+// postKind names the kind of post the media makes up.
+func postKind(image, video *models.MediaItem, gallery []models.MediaItem) string {
+	switch {
+	case len(gallery) > 0:
+		return "gallery"
+	case video != nil:
+		return "video"
+	case image != nil:
+		return "image"
+	}
+	return "text"
+}
+
+// fillPostForm loads an existing draft or post into the composer.
+func fillPostForm(data *models.PostFormPageData, content, circleID string, image, video *models.MediaItem, gallery []models.MediaItem) {
+	data.Values["content"] = content
+	data.Values["circle_id"] = circleID
+	data.Values["kind"] = postKind(image, video, gallery)
+	switch {
+	case image != nil:
+		data.Media = []models.MediaItem{*image}
+	case video != nil:
+		data.Media = []models.MediaItem{*video}
+	default:
+		data.Media = append([]models.MediaItem(nil), gallery...)
+	}
+}
+
+// readPostForm validates the submitted composer into a draft, recording
+// the values and any errors on data. Publishing also requires the post to
+// have something in it and the right number of media items for its kind.
+// The circle is only read for new posts; edits keep theirs.
+func readPostForm(r *http.Request, data *models.PostFormPageData, publishing bool) models.DraftPost {
+	var d models.DraftPost
+	data.Values["content"] = strings.TrimSpace(r.FormValue("content"))
+	data.Values["kind"] = r.FormValue("kind")
+	d.Content = data.Values["content"]
+	if utf8.RuneCountInString(d.Content) > maxPostLength {
+		data.Errors["content"] = "Keep posts under 5000 characters."
+	}
+
+	if data.Post == nil {
+		data.Values["circle_id"] = r.FormValue("circle_id")
+		d.CircleID = data.Values["circle_id"]
+		if d.CircleID != "" && !canPostIn(data.Circles, d.CircleID) {
+			data.Errors["circle_id"] = "Choose a circle you can post in, or your profile."
+		}
+	}
+
+	// Media slots are kept when switching to a text post but not checked.
+	urls, alts := r.Form["media_url"], r.Form["media_alt"]
+	var media []models.MediaItem
+	mediaErr := ""
+	for i, raw := range urls {
+		item := models.MediaItem{}
+		if i < len(alts) {
+			item.Alt = strings.TrimSpace(alts[i])
+		}
+		var ok bool
+		if item.URL, ok = utils.ValidateImageURL(raw); !ok {
+			item.URL = strings.TrimSpace(raw)
+			mediaErr = "Media links must be http(s) URLs."
+		}
+		if utf8.RuneCountInString(item.Alt) > maxMediaAltLength {
+			mediaErr = "Keep descriptions under 300 characters."
+		}
+		if item.URL == "" && item.Alt != "" {
+			mediaErr = "Each description needs a link to go with it."
+		}
+		if item.URL != "" || item.Alt != "" {
+			media = append(media, item)
+		}
+	}
+	data.Media = media
+	if mediaErr != "" && data.Values["kind"] != "text" {
+		data.Errors["media"] = mediaErr
+	}
+
+	switch data.Values["kind"] {
+	case "text":
+	case "image", "video":
+		if len(media) > 1 {
+			data.Errors["media"] = "Add just one " + data.Values["kind"] + ", or make it a gallery."
+		} else if len(media) == 1 && data.Values["kind"] == "image" {
+			d.Image = &media[0]
+		} else if len(media) == 1 {
+			d.Video = &media[0]
+		} else if publishing {
+			data.Errors["media"] = "Add the " + data.Values["kind"] + "'s link."
+		}
+	case "gallery":
+		if len(media) > maxGallerySize || (publishing && len(media) < 2) {
+			data.Errors["media"] = "A gallery holds 2 to 10 images."
+		}
+		d.Gallery = media
+	default:
+		data.Errors["kind"] = "Choose what kind of post this is."
+	}
+	if publishing && d.Content == "" && d.Image == nil && d.Video == nil && len(d.Gallery) == 0 {
+		data.Errors["content"] = "Write something or add media before posting."
+	}
+	return d
+}
+
+func canPostIn(circles []models.Circle, circleID string) bool {
+	for _, c := range circles {
+		if c.ID == circleID {
+			return true
+		}
+	}
+	return false
+}
+
+// ownDraftID returns the draft_id submitted with the form, answering 404
+// when it is not one of userID's drafts. An empty id starts a new draft.
+func ownDraftID(w http.ResponseWriter, r *http.Request, userID string) (string, bool) {
+	id := r.FormValue("draft_id")
+	if id == "" {
+		return utils.NewID(), true
+	}
+	_, err := dataStore.GetDraft(r.Context(), userID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return "", false
+	}
+	if err != nil {
+		log.Printf("Error loading draft %s: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", false
+	}
+	return id, true
+}
+
+// composePostHandler shows an empty composer, or one filled from ?draft=.
+// ?circle= preselects a circle.
+func composePostHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := newPostFormPageData(r, "New post", userID)
+	if err != nil {
+		log.Printf("Error loading circles for composer: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if id := r.URL.Query().Get("draft"); id != "" {
+		d, err := dataStore.GetDraft(r.Context(), userID, id)
+		if errors.Is(err, store.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading draft %s: %v", id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		data.Title = "Edit draft"
+		data.DraftID = d.ID
+		data.SavedAt = "Draft saved " + utils.TimeAgo(d.UpdatedAt)
+		fillPostForm(&data, d.Content, d.CircleID, d.Image, d.Video, d.Gallery)
+	} else if circleID := r.URL.Query().Get("circle"); canPostIn(data.Circles, circleID) {
+		data.Values["circle_id"] = circleID
+	}
+	renderPostForm(w, r, http.StatusOK, data)
+}
+
+// createPostHandler handles the composer's submission: publishing the post
+// or keeping it as a draft, depending on the button pressed.
+func createPostHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	data, err := newPostFormPageData(r, "New post", userID)
+	if err != nil {
+		log.Printf("Error loading circles for composer: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	id, ok := ownDraftID(w, r, userID)
+	if !ok {
+		return
+	}
+	if r.FormValue("draft_id") != "" {
+		data.DraftID = id
+	}
+
+	publishing := r.FormValue("action") != "draft"
+	d := readPostForm(r, &data, publishing)
+	if !publishing && d.Content == "" && len(data.Media) == 0 {
+		data.Errors["content"] = "There's nothing to save yet."
+	}
+	if len(data.Errors) > 0 {
+		renderPostForm(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	ctx := r.Context()
+	d.ID = id
+	d.UpdatedAt = time.Now()
+	if err := dataStore.SaveDraft(ctx, userID, d); err != nil {
+		log.Printf("Error saving draft %s: %v", d.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if publishing {
+		if err := dataStore.PublishDraft(ctx, userID, d.ID, time.Now()); err != nil {
+			log.Printf("Error publishing post %s: %v", d.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Post %s published by %s", d.ID, userID)
+	}
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+// autosaveDraftHandler saves the composer as a draft while it is being
+// written. It answers HTMX with the save status and the draft's id.
+func autosaveDraftHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	data, err := newPostFormPageData(r, "New post", userID)
+	if err != nil {
+		log.Printf("Error loading circles for composer: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	d := readPostForm(r, &data, false)
+	empty := d.Content == "" && len(data.Media) == 0
+	switch {
+	case len(data.Errors) > 0:
+		data.SavedAt = "Not saved yet: fix the highlighted fields."
+		data.DraftID = r.FormValue("draft_id")
+	case empty && r.FormValue("draft_id") == "":
+	default:
+		id, ok := ownDraftID(w, r, userID)
+		if !ok {
+			return
+		}
+		d.ID = id
+		d.UpdatedAt = time.Now()
+		if err := dataStore.SaveDraft(r.Context(), userID, d); err != nil {
+			log.Printf("Error autosaving draft %s: %v", d.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		data.DraftID = d.ID
+		data.SavedAt = "Draft saved " + d.UpdatedAt.Format("15:04")
+	}
+
+	render(w, r, templates.View{Set: "post-form", Fragment: "draft-autosave", Data: data})
+}
+
+// publishDraftHandler publishes a draft from the profile's draft list. A
+// draft that can't be published yet opens in the composer with the reason.
+func publishDraftHandler(w http.ResponseWriter, r *http.Request, draftID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	ctx := r.Context()
+	d, err := dataStore.GetDraft(ctx, userID, draftID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading draft %s: %v", draftID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	data, err := newPostFormPageData(r, "Edit draft", userID)
+	if err != nil {
+		log.Printf("Error loading circles for composer: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	data.DraftID = d.ID
+	fillPostForm(&data, d.Content, d.CircleID, d.Image, d.Video, d.Gallery)
+	if d.Content == "" && d.Image == nil && d.Video == nil && len(d.Gallery) == 0 {
+		data.Errors["content"] = "Write something or add media before posting."
+	}
+	if d.CircleID != "" && !canPostIn(data.Circles, d.CircleID) {
+		data.Errors["circle_id"] = "You can no longer post in that circle. Choose another."
+	}
+	if len(data.Errors) > 0 {
+		renderPostForm(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	if err := dataStore.PublishDraft(ctx, userID, d.ID, time.Now()); err != nil {
+		log.Printf("Error publishing draft %s: %v", d.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Post %s published by %s", d.ID, userID)
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+func deleteDraftHandler(w http.ResponseWriter, r *http.Request, draftID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	err := dataStore.DeleteDraft(r.Context(), userID, draftID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting draft %s: %v", draftID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	removedAfter(w, r, "/profile")
+}
+
+// removedAfter answers a deletion. HTMX requests get an empty body to swap
+// in place of the removed item; others go back to target.
+func removedAfter(w http.ResponseWriter, r *http.Request, target string) {
+	if isHTMX(r) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// loadOwnPost loads a published post for a change by userID, answering the
+// request itself when it doesn't exist or sits in an archived circle.
+// Posts in circles come with userID's role there.
+func loadOwnPost(w http.ResponseWriter, r *http.Request, postID, userID string) (models.Post, authz.Role, bool) {
+	ctx := r.Context()
+	post, err := dataStore.GetPost(ctx, postID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return post, "", false
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", postID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return post, "", false
+	}
+	if post.CircleID == "" {
+		return post, "", true
+	}
+
+	circle, err := dataStore.GetCircle(ctx, post.CircleID, userID)
+	if err != nil {
+		log.Printf("Error loading circle %s of post %s: %v", post.CircleID, postID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return post, "", false
+	}
+	if circle.Archived() {
+		renderForbidden(w, r, circle.Name+" is archived, so its posts can't be changed.")
+		return post, "", false
+	}
+	return post, authz.Role(circle.UserRole), true
+}
+
+// editPostHandler lets authors change a published post. Saved edits mark
+// the post as edited.
+func editPostHandler(w http.ResponseWriter, r *http.Request, postID, userID string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+	}
+	post, _, ok := loadOwnPost(w, r, postID, userID)
+	if !ok {
+		return
+	}
+	if post.User.ID != userID {
+		renderForbidden(w, r, "Only the author can edit this post.")
+		return
+	}
+
+	data := models.PostFormPageData{
+		BaseData: newBaseData(r.Context(), "Edit post", "profile"),
+		Post:     &post,
+		Kinds:    postKinds,
+		Values:   map[string]string{},
+		Errors:   map[string]string{},
+	}
+	if r.Method == http.MethodGet {
+		fillPostForm(&data, post.Content, post.CircleID, post.Image, post.Video, post.Gallery)
+		renderPostForm(w, r, http.StatusOK, data)
+		return
+	}
+
+	d := readPostForm(r, &data, true)
+	if len(data.Errors) > 0 {
+		renderPostForm(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+	post.Content, post.Image, post.Video, post.Gallery = d.Content, d.Image, d.Video, d.Gallery
+	if err := dataStore.EditPost(r.Context(), post, time.Now()); err != nil {
+		log.Printf("Error editing post %s: %v", post.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+// deletePostHandler removes a post from view. Authors can delete their own
+// posts and circle moderators any post in their circle.
+func deletePostHandler(w http.ResponseWriter, r *http.Request, postID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	post, role, ok := loadOwnPost(w, r, postID, userID)
+	if !ok {
+		return
+	}
+	if post.User.ID != userID && !role.Can(authz.PermModerate) {
+		renderForbidden(w, r, "Only the author or the circle's moderators can delete this post.")
+		return
+	}
+	if err := dataStore.DeletePost(r.Context(), post.ID, time.Now()); err != nil {
+		log.Printf("Error deleting post %s: %v", post.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Post %s deleted by %s", post.ID, userID)
+	removedAfter(w, r, "/profile")
+}
@@ -1,47 +1,175 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
 
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
 	"circles.diy/internal/templates"
 )
 
+const profilePostPageSize = 10
+
 func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
+	viewerID := currentUserID(r)
 
 	// Check if this is the internal profile view (/profile) or external (/profile/:handle)
 	if path == "/profile" {
 		// Internal profile view (owner's dashboard)
-		data := templates.GetMockProfileInternalData()
+		userID, ok := requireUser(w, r)
+		if !ok {
+			return
+		}
 
-		err := templates.GetTemplates().ProfileInternal.ExecuteTemplate(w, "profile-internal", data)
+		data, err := loadInternalProfileData(r.Context(), userID, r.URL.Query().Get("after"))
+		if errors.Is(err, store.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if invalidCursor(err) {
+			http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+			return
+		}
 		if err != nil {
-			log.Printf("Error rendering profile-internal template: %v", err)
+			log.Printf("Error loading profile data: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+
+		render(w, r, templates.View{Set: "profile-internal", Page: "profile-internal", Data: data})
 	} else if strings.HasPrefix(path, "/profile/") {
 		// External profile view (/profile/:handle)
-		// Extract handle from URL path
-		handle := strings.TrimPrefix(path, "/profile/")
+		handle, rest, _ := strings.Cut(strings.TrimPrefix(path, "/profile/"), "/")
 		if handle == "" {
 			http.NotFound(w, r)
 			return
 		}
+		if !strings.HasPrefix(handle, "@") {
+			handle = "@" + handle
+		}
+		switch rest {
+		case "":
+		case "posts":
+			profilePostsHandler(w, r, handle, viewerID)
+			return
+		default:
+			http.NotFound(w, r)
+			return
+		}
 
-		// For demo purposes, we'll use the mock data regardless of handle
-		// In a real app, you'd look up the user by handle
-		data := templates.GetMockProfileData(handle, false) // isOwner = false for external view
-
-		err := templates.GetTemplates().ProfilePublic.ExecuteTemplate(w, "profile-public", data)
+		data, err := loadPublicProfileData(r.Context(), handle, viewerID, r.URL.Query().Get("after"))
+		if errors.Is(err, store.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if invalidCursor(err) {
+			http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+			return
+		}
 		if err != nil {
-			log.Printf("Error rendering profile-public template: %v", err)
+			log.Printf("Error loading profile %s: %v", handle, err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+
+		render(w, r, templates.View{Set: "profile-public", Page: "profile-public", Data: data})
 	} else {
 		http.NotFound(w, r)
 	}
-}
\ No newline at end of file
+}
+
+// profilePostsHandler renders the page of a member's posts after ?after=,
+// with the button for the page after it. ?view=own gives the owner the
+// posts as their own profile lists them, with edit controls.
+func profilePostsHandler(w http.ResponseWriter, r *http.Request, handle, viewerID string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	var data models.ProfileData
+	var err error
+	if data.Profile, err = dataStore.GetProfile(ctx, handle, viewerID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error loading profile %s: %v", handle, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	data.IsOwner = data.Profile.ID == viewerID
+
+	data.Posts, data.PostCursor, err = dataStore.ListPostsByAuthor(ctx, data.Profile.ID, profilePostPageSize, r.URL.Query().Get("after"))
+	if invalidCursor(err) {
+		http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading posts of %s: %v", handle, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	set := "profile-public"
+	if data.IsOwner && r.URL.Query().Get("view") == "own" {
+		set = "profile-internal"
+	}
+	render(w, r, templates.View{
+		Set:      set,
+		Fragment: "profile-posts-page",
+		Data:     data,
+		OOB:      []templates.OOB{{Target: "profile-posts-more", Name: "profile-posts-more", Data: data}},
+	})
+}
+
+// loadPublicProfileData loads a member's profile with the page of their
+// posts after the cursor.
+func loadPublicProfileData(ctx context.Context, handle, viewerID, after string) (models.ProfileData, error) {
+	data := models.ProfileData{BaseData: newBaseData(ctx, fmt.Sprintf("%s - Profile", handle), "profile")}
+
+	var err error
+	if data.Profile, err = dataStore.GetProfile(ctx, handle, viewerID); err != nil {
+		return data, err
+	}
+	data.IsOwner = data.Profile.ID == viewerID
+
+	if data.Posts, data.PostCursor, err = dataStore.ListPostsByAuthor(ctx, data.Profile.ID, profilePostPageSize, after); err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+func loadInternalProfileData(ctx context.Context, userID, after string) (models.ProfileData, error) {
+	user, err := dataStore.GetUser(ctx, userID)
+	if err != nil {
+		return models.ProfileData{}, err
+	}
+
+	data, err := loadPublicProfileData(ctx, user.Handle, userID, after)
+	if err != nil {
+		return data, err
+	}
+	data.BaseData = newBaseData(ctx, "My Profile", "profile")
+
+	if data.Extensions, err = dataStore.ListExtensions(ctx, userID); err != nil {
+		return data, err
+	}
+	if data.Analytics, err = dataStore.GetAnalytics(ctx, userID); err != nil {
+		return data, err
+	}
+	if data.Drafts, err = dataStore.ListDrafts(ctx, userID); err != nil {
+		return data, err
+	}
+	data.DraftCount = len(data.Drafts)
+
+	return data, nil
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"circles.diy/internal/templates"
+)
+
+// render answers with v, or with a 500 when its templates fail. In
+// development the failure is shown in the browser.
+func render(w http.ResponseWriter, r *http.Request, v templates.View) {
+	if err := v.Render(w, r); err != nil {
+		log.Printf("Error rendering template: %v", err)
+		if !templates.Overlay(w, err) {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// isHTMX reports whether HTMX sent r, boosted or not.
+func isHTMX(r *http.Request) bool {
+	return templates.HTMXRequest(r).Request
+}
+
+// wantsFragment reports whether r is an HTMX request for part of a page.
+func wantsFragment(r *http.Request) bool {
+	return templates.HTMXRequest(r).Partial()
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"circles.diy/internal/authz"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+	"circles.diy/internal/utils"
+)
+
+const (
+	maxReplyLength = 2000
+	// threadReplies is how many replies a thread shows per level, and
+	// threadDepth how many levels below the top it loads. Deeper replies
+	// are reached through "continue thread" links.
+	threadReplies = 10
+	threadDepth   = 4
+	// replyPageDepth is how many levels load below each reply fetched by
+	// a "load more" button.
+	replyPageDepth = 2
+)
+
+// loadThreadPost loads a published post for userID, checking their role in
+// the post's circle grants perm. Posts outside circles are open to every
+// signed-in user.
+func loadThreadPost(w http.ResponseWriter, r *http.Request, postID string, perm authz.Permission) (models.Post, bool) {
+	post, err := dataStore.GetPost(r.Context(), postID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return post, false
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", postID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return post, false
+	}
+	if post.CircleID != "" {
+		if _, _, ok := authorizeCircle(w, r, post.CircleID, perm); !ok {
+			return post, false
+		}
+	}
+	return post, true
+}
+
+// loadThread fills data with the post's top-level replies, or the subtree
+// under threadID when it is set.
+func loadThread(ctx context.Context, data *models.PostThreadPageData, threadID string) error {
+	postID := data.Post.ID
+	if threadID == "" {
+		var err error
+		data.Replies, data.MoreReplies, err = dataStore.ListReplies(ctx, postID, "", threadDepth, threadReplies, "")
+		return err
+	}
+	reply, err := dataStore.GetReply(ctx, postID, threadID)
+	if err != nil {
+		return err
+	}
+	reply.Replies, reply.MoreReplies, err = dataStore.ListReplies(ctx, postID, reply.ID, threadDepth, threadReplies, "")
+	data.Thread = &reply
+	return err
+}
+
+func newPostThreadPageData(ctx context.Context, post models.Post) models.PostThreadPageData {
+	// The thread is rendered below the post, not in its preview
+	post.Replies, post.MoreReplies = nil, ""
+	return models.PostThreadPageData{
+		BaseData: newBaseData(ctx, "Post by "+post.User.Handle, ""),
+		Post:     post,
+		Values:   map[string]string{},
+		Errors:   map[string]string{},
+	}
+}
+
+func renderPostThread(w http.ResponseWriter, r *http.Request, status int, data models.PostThreadPageData) {
+	render(w, r, templates.View{
+		Set:       "post-thread",
+		Page:      "post-thread",
+		Fragments: map[string]templates.Fragment{"post-" + data.Post.ID: {Name: "post", Data: data.Post}},
+		Data:      data,
+		Status:    status,
+	})
+}
+
+// postThreadHandler shows a post with its replies. ?thread= focuses on one
+// reply and the replies below it.
+func postThreadHandler(w http.ResponseWriter, r *http.Request, postID string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	post, ok := loadThreadPost(w, r, postID, authz.PermView)
+	if !ok {
+		return
+	}
+
+	data := newPostThreadPageData(r.Context(), post)
+	err := loadThread(r.Context(), &data, r.URL.Query().Get("thread"))
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading replies of post %s: %v", post.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	renderPostThread(w, r, http.StatusOK, data)
+}
+
+// repliesHandler routes /posts/{id}/replies: GET loads the next page of a
+// reply list for HTMX and POST adds a reply.
+func repliesHandler(w http.ResponseWriter, r *http.Request, postID, userID string) {
+	switch r.Method {
+	case http.MethodGet:
+		replyPageHandler(w, r, postID)
+	case http.MethodPost:
+		createReplyHandler(w, r, postID, userID)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// replyPageHandler renders the page of replies after ?after= under
+// ?parent=, with the button for the page after it.
+func replyPageHandler(w http.ResponseWriter, r *http.Request, postID string) {
+	post, ok := loadThreadPost(w, r, postID, authz.PermView)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	page := models.ReplyPage{PostID: post.ID, ParentID: q.Get("parent")}
+	var err error
+	page.Replies, page.Next, err = dataStore.ListReplies(r.Context(), post.ID, page.ParentID, replyPageDepth, threadReplies, q.Get("after"))
+	if errors.Is(err, store.ErrInvalidCursor) {
+		http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading replies of post %s: %v", post.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, templates.View{Set: "post-thread", Fragment: "reply-page", Data: page})
+}
+
+// createReplyHandler adds a reply to a post, under parent_id when set.
+// HTMX gets the new reply to append to its list; others go to it in the
+// thread.
+func createReplyHandler(w http.ResponseWriter, r *http.Request, postID, userID string) {
+	if !postForm(w, r) {
+		return
+	}
+	post, ok := loadThreadPost(w, r, postID, authz.PermPost)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	parentID := r.FormValue("parent_id")
+	if parentID != "" {
+		_, err := dataStore.GetReply(ctx, post.ID, parentID)
+		if errors.Is(err, store.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading reply %s: %v", parentID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	content := strings.TrimSpace(r.FormValue("content"))
+	var problem string
+	switch {
+	case content == "":
+		problem = "Write something to reply."
+	case utf8.RuneCountInString(content) > maxReplyLength:
+		problem = "Keep replies under 2000 characters."
+	}
+	if problem != "" {
+		if wantsFragment(r) {
+			http.Error(w, problem, http.StatusUnprocessableEntity)
+			return
+		}
+		data := newPostThreadPageData(ctx, post)
+		if err := loadThread(ctx, &data, parentID); err != nil {
+			log.Printf("Error loading replies of post %s: %v", post.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		data.Values["content"] = content
+		data.Errors["content"] = problem
+		renderPostThread(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	reply := models.Reply{
+		ID:        utils.NewID(),
+		User:      models.User{ID: userID},
+		Content:   content,
+		CreatedAt: time.Now(),
+	}
+	err := dataStore.SaveReply(ctx, post.ID, parentID, reply)
+	if errors.Is(err, store.ErrNotFound) {
+		// The post or the parent went away meanwhile
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving reply to post %s: %v", post.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !wantsFragment(r) {
+		target := "/posts/" + url.PathEscape(post.ID)
+		if parentID != "" {
+			target += "?thread=" + url.QueryEscape(parentID)
+		}
+		http.Redirect(w, r, target+"#reply-"+reply.ID, http.StatusSeeOther)
+		return
+	}
+	saved, err := dataStore.GetReply(ctx, post.ID, reply.ID)
+	if err == nil {
+		post, err = dataStore.GetPost(ctx, post.ID)
+	}
+	if err != nil {
+		log.Printf("Error loading reply %s: %v", reply.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// Lets pages update the reply counts they show
+	templates.Trigger(w, "reply-created", map[string]any{
+		"postId":   post.ID,
+		"parentId": parentID,
+		"replyId":  saved.ID,
+		"replies":  post.Stats.Replies,
+	})
+	render(w, r, templates.View{Set: "post-thread", Fragment: "reply-tree", Data: saved})
+}
@@ -1,93 +1,148 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
 	"strings"
 	"time"
+
+	"circles.diy/internal/assets"
+	"circles.diy/internal/middleware"
 )
 
-func ServeStaticFile(w http.ResponseWriter, r *http.Request, filePath, contentType string) {
-	// Security: prevent path traversal
-	if strings.Contains(filePath, "..") {
-		http.Error(w, "Invalid file path", http.StatusBadRequest)
+// assetFiles holds the static files, set at startup by SetAssets.
+var assetFiles fs.FS
+
+// SetAssets sets the files static files are served from.
+func SetAssets(files fs.FS) {
+	assetFiles = files
+}
+
+const (
+	// Fingerprinted URLs change whenever their content does, so they can
+	// be cached for as long as browsers allow
+	immutableCache = "public, max-age=31536000, immutable"
+	hourCache      = "public, max-age=3600"
+)
+
+// assetTypes are the content types of the files ServeAsset serves.
+var assetTypes = map[string]string{
+	".css":  "text/css; charset=utf-8",
+	".js":   "application/javascript; charset=utf-8",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".svg":  "image/svg+xml",
+	".ico":  "image/x-icon",
+}
+
+// ServeAsset serves the static files in the asset manifest, by their
+// fingerprinted URL or their plain one, precompressed when the client
+// accepts a copy built for it.
+func ServeAsset(w http.ResponseWriter, r *http.Request) {
+	asset, fingerprinted, ok := assets.Current().Lookup(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
 		return
 	}
-
-	// Get file info for cache headers
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			http.NotFound(w, r)
-		} else {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		}
+	contentType, ok := assetTypes[strings.ToLower(path.Ext(asset.Path))]
+	if !ok {
+		http.Error(w, "Unsupported file type", http.StatusBadRequest)
 		return
 	}
 
-	// Set cache headers for production performance
-	lastModified := fileInfo.ModTime().UTC().Format(http.TimeFormat)
-	ifModifiedSince := r.Header.Get("If-Modified-Since")
+	cacheControl := hourCache
+	if fingerprinted {
+		cacheControl = immutableCache
+	}
 
-	if ifModifiedSince != "" {
-		if t, err := time.Parse(http.TimeFormat, ifModifiedSince); err == nil {
-			if fileInfo.ModTime().UTC().Before(t.Add(1 * time.Second)) {
-				w.WriteHeader(http.StatusNotModified)
-				return
+	filePath := asset.Path
+	if len(asset.Encodings) > 0 {
+		offered := make([]string, 0, len(asset.Encodings))
+		for _, encoding := range []string{middleware.EncodingBrotli, middleware.EncodingGzip} {
+			if _, ok := asset.Encodings[encoding]; ok {
+				offered = append(offered, encoding)
 			}
 		}
+		if encoding := middleware.AcceptedEncoding(r, offered...); encoding != "" {
+			filePath = asset.Encodings[encoding]
+			w.Header().Set("Content-Encoding", encoding)
+		}
 	}
 
-	// Set response headers
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Last-Modified", lastModified)
-	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
-
-	// For CSS files, set additional headers
-	if strings.HasSuffix(filePath, ".css") {
-		w.Header().Set("Vary", "Accept-Encoding")
+	file, err := assetFiles.Open(filePath)
+	if err != nil {
+		log.Printf("Error opening %s: %v", filePath, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
-	// Serve the file
-	http.ServeFile(w, r, filePath)
+	// The ETag names the file's content; the compression middleware adds
+	// the encoding when a compressed copy is sent
+	setStaticHeaders(w, contentType, cacheControl, asset.Hash)
+	http.ServeContent(w, r, "", time.Time{}, content)
+}
+
+// ServeServiceWorker serves sw.js precaching the current fingerprinted
+// assets. Browsers check it for updates on every visit, so it is never
+// cached for long itself.
+func ServeServiceWorker(w http.ResponseWriter, r *http.Request) {
+	script, err := assets.Current().ServiceWorker(assetFiles)
+	if err != nil {
+		log.Printf("Error generating service worker: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	serveContent(w, r, script, "application/javascript; charset=utf-8", "no-cache")
 }
 
-func ServeStaticImage(w http.ResponseWriter, r *http.Request) {
-	// Extract the image path from URL
-	imagePath := strings.TrimPrefix(r.URL.Path, "/static/img/")
-	
+// ServeStaticFile serves a static file that keeps the same URL across
+// releases, such as the web app manifest.
+func ServeStaticFile(w http.ResponseWriter, r *http.Request, filePath, contentType string) {
 	// Security: prevent path traversal
-	if strings.Contains(imagePath, "..") || imagePath == "" {
+	if strings.Contains(filePath, "..") || !fs.ValidPath(filePath) {
 		http.Error(w, "Invalid file path", http.StatusBadRequest)
 		return
 	}
-	
-	// Construct full file path
-	fullPath := filepath.Join("static", "img", imagePath)
-	
-	// Determine content type based on file extension
-	ext := strings.ToLower(filepath.Ext(imagePath))
-	var contentType string
-	
-	switch ext {
-	case ".jpg", ".jpeg":
-		contentType = "image/jpeg"
-	case ".png":
-		contentType = "image/png"
-	case ".gif":
-		contentType = "image/gif"
-	case ".webp":
-		contentType = "image/webp"
-	case ".svg":
-		contentType = "image/svg+xml"
-	case ".ico":
-		contentType = "image/x-icon"
-	default:
-		http.Error(w, "Unsupported image format", http.StatusBadRequest)
+
+	content, err := fs.ReadFile(assetFiles, filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
 		return
 	}
-	
-	// Use the existing ServeStaticFile function
-	ServeStaticFile(w, r, fullPath, contentType)
-}
\ No newline at end of file
+	serveContent(w, r, content, contentType, hourCache)
+}
+
+// serveContent serves content with a strong ETag of its hash, answering a
+// matching If-None-Match with 304.
+func serveContent(w http.ResponseWriter, r *http.Request, content []byte, contentType, cacheControl string) {
+	sum := sha256.Sum256(content)
+	setStaticHeaders(w, contentType, cacheControl, hex.EncodeToString(sum[:16]))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+}
+
+func setStaticHeaders(w http.ResponseWriter, contentType, cacheControl, hash string) {
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Cache-Control", cacheControl)
+	h.Set("ETag", `"`+hash+`"`)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"circles.diy/internal/auth"
+	"circles.diy/internal/middleware"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+)
+
+var dataStore store.Store
+
+// SetStore sets the store the page handlers read from.
+func SetStore(s store.Store) {
+	dataStore = s
+}
+
+// currentUserID returns the signed-in user's ID, or "" for visitors.
+func currentUserID(r *http.Request) string {
+	user, _ := auth.CurrentUser(r.Context())
+	return user.ID
+}
+
+// requireUser returns the signed-in user's ID. Visitors are sent to the
+// login page, coming back here afterwards, and ok is false.
+func requireUser(w http.ResponseWriter, r *http.Request) (userID string, ok bool) {
+	user, ok := auth.CurrentUser(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		return "", false
+	}
+	return user.ID, true
+}
+
+func newBaseData(ctx context.Context, title, activeNav string) models.BaseData {
+	data := models.BaseData{
+		Title:     title,
+		ActiveNav: activeNav,
+		Theme: models.ThemeSettings{
+			Mode:   "system",
+			Radius: "0",
+		},
+		CSRFToken: middleware.CSRFToken(ctx),
+		Nonce:     middleware.CSPNonce(ctx),
+	}
+	if user, ok := auth.CurrentUser(ctx); ok {
+		data.CurrentUser = &user
+	}
+	return data
+}
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"circles.diy/internal/utils"
+)
+
+// FileMailer writes each message to its own .eml file in Dir, for
+// development and for inspecting mail in tests.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0750); err != nil {
+		return fmt.Errorf("failed to create mail directory: %v", err)
+	}
+	name := time.Now().UTC().Format("20060102-150405") + "-" + utils.NewID()[:8] + ".eml"
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, encode(m.From, msg), 0640); err != nil {
+		return fmt.Errorf("failed to write mail file: %v", err)
+	}
+	log.Printf("Mail to %s written to %s", msg.To, path)
+	return nil
+}
+
+// LogMailer prints messages to the server log instead of sending them.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
@@ -0,0 +1,64 @@
+// Package mail sends the site's outgoing email through a pluggable
+// transport: SMTP in production, files or the log in development.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"time"
+
+	"circles.diy/internal/config"
+	"circles.diy/internal/utils"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the Mailer selected by cfg.MailTransport.
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.MailTransport {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("MAIL_TRANSPORT=smtp requires SMTP_HOST")
+		}
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}, nil
+	case "file":
+		return &FileMailer{Dir: cfg.MailDir, From: cfg.MailFrom}, nil
+	case "log":
+		return LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.MailTransport)
+	}
+}
+
+// encode renders msg as an RFC 5322 message.
+func encode(from string, msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@circles.diy>\r\n", utils.NewID())
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.Write(bytes.ReplaceAll([]byte(msg.Text), []byte("\n"), []byte("\r\n")))
+	return b.Bytes()
+}
@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTPMailer delivers through an SMTP relay, upgrading to TLS with STARTTLS
+// when the server offers it. Credentials are optional so a local sink such
+// as Mailpit works without them.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %v", err)
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// net/smtp has no context support; give up early if already cancelled
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(m.Host, m.Port)
+	if err := smtp.SendMail(addr, auth, from.Address, []string{msg.To}, encode(m.From, msg)); err != nil {
+		return fmt.Errorf("failed to send mail via %s: %v", addr, err)
+	}
+	return nil
+}
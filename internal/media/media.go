@@ -0,0 +1,156 @@
+// Package media works out what an uploaded file is from its content, never
+// its name or the type the browser claimed, and makes image thumbnails.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"unicode/utf8"
+
+	// Decoders for the images thumbnails are made of
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Kinds of upload, which are also the chat message types they are sent as.
+const (
+	Image = "image"
+	Voice = "voice"
+	File  = "file"
+)
+
+const (
+	// SniffLen is how much of a file Sniff wants to see. Voice notes name
+	// their codec a little way in.
+	SniffLen = 4096
+	// ThumbnailSize bounds the longer side of a thumbnail
+	ThumbnailSize = 320
+	// maxPixels refuses images that would take too much memory to decode
+	maxPixels = 40_000_000
+	// samples is how many source pixels along each side are averaged into
+	// a thumbnail pixel
+	samples = 4
+)
+
+// Size limits by kind.
+var MaxSize = map[string]int64{
+	Image: 10 << 20,
+	Voice: 5 << 20,
+	File:  20 << 20,
+}
+
+// ErrUnreadableImage is returned for images that can't be decoded, or are
+// too large to.
+var ErrUnreadableImage = errors.New("media: unreadable image")
+
+// Sniff works out what a file is from its first SniffLen bytes, returning
+// its kind and the content type to serve it with. voice is whether it was
+// recorded as a voice note, which must be Opus audio in WebM or Ogg. ok is
+// false for anything that can't be sent.
+func Sniff(head []byte, voice bool) (kind, contentType string, ok bool) {
+	detected := http.DetectContentType(head)
+	if voice {
+		switch {
+		case detected == "video/webm" && bytes.Contains(head, []byte("A_OPUS")):
+			return Voice, "audio/webm", true
+		case detected == "application/ogg" && bytes.Contains(head, []byte("OpusHead")):
+			return Voice, "audio/ogg", true
+		}
+		return "", "", false
+	}
+
+	switch detected {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return Image, detected, true
+	// Documents, with text only as UTF-8
+	case "application/pdf", "application/zip":
+		return File, detected, true
+	case "text/plain; charset=utf-8":
+		// Any text that isn't binary is labelled UTF-8
+		if isUTF8(head) {
+			return File, detected, true
+		}
+	}
+	return "", "", false
+}
+
+// isUTF8 reports whether the start of a file is UTF-8, allowing for a
+// character cut off where it ends.
+func isUTF8(head []byte) bool {
+	for i := 1; i < utf8.UTFMax && i <= len(head); i++ {
+		if utf8.RuneStart(head[len(head)-i]) {
+			if !utf8.FullRune(head[len(head)-i:]) {
+				head = head[:len(head)-i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(head)
+}
+
+// Thumbnail scales an image to fit within ThumbnailSize and encodes it as
+// JPEG, flattened onto white. It returns nil without an error for formats
+// it can't decode, such as WebP, which are shown as they are.
+func Thumbnail(data []byte, contentType string) ([]byte, error) {
+	if contentType == "image/webp" {
+		return nil, nil
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxPixels {
+		return nil, ErrUnreadableImage
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnreadableImage
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scale(img), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scale shrinks img to fit within ThumbnailSize, averaging a few pixels of
+// the area each thumbnail pixel covers.
+func scale(img image.Image) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > ThumbnailSize || h > ThumbnailSize {
+		if w >= h {
+			tw, th = ThumbnailSize, max(1, h*ThumbnailSize/w)
+		} else {
+			tw, th = max(1, w*ThumbnailSize/h), ThumbnailSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy += max(1, (y1-y0)/samples) {
+				for sx := x0; sx < x1; sx += max(1, (x1-x0)/samples) {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			// Colours are premultiplied, so adding the missing alpha
+			// composites onto white
+			white := 0xffff - a/n
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r/n + white),
+				G: uint16(g/n + white),
+				B: uint16(bl/n + white),
+				A: 0xffff,
+			})
+		}
+	}
+	return dst
+}
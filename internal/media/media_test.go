@@ -0,0 +1,169 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// Just enough of each format for Sniff.
+const (
+	webmOpus = "\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm\x42\x87\x81\x04A_OPUS"
+	webmVP8  = "\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm\x42\x87\x81\x04V_VP8"
+	oggOpus  = "OggS\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00OpusHead"
+	oggOther = "OggS\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00\x01vorbis"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniff(t *testing.T) {
+	pngData := encodePNG(t, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	tests := []struct {
+		name        string
+		head        string
+		voice       bool
+		kind        string
+		contentType string
+	}{
+		{"png", string(pngData), false, Image, "image/png"},
+		{"jpeg", "\xff\xd8\xff\xe0\x00\x10JFIF\x00", false, Image, "image/jpeg"},
+		{"gif", "GIF89a\x01\x00\x01\x00", false, Image, "image/gif"},
+		{"webp", "RIFF\x24\x00\x00\x00WEBPVP8 ", false, Image, "image/webp"},
+		{"pdf", "%PDF-1.7\n", false, File, "application/pdf"},
+		{"zip", "PK\x03\x04\x14\x00", false, File, "application/zip"},
+		{"utf-8 text", "café notes\n", false, File, "text/plain; charset=utf-8"},
+		// Served as a download with this type, never rendered
+		{"svg as text", "<svg xmlns='http://www.w3.org/2000/svg'><script/></svg>", false, File, "text/plain; charset=utf-8"},
+		{"html", "<!DOCTYPE html><script>alert(1)</script>", false, "", ""},
+		{"latin-1 text", "caf\xe9 notes\n", false, "", ""},
+		{"utf-16 text", "\xfe\xff\x00h\x00i", false, "", ""},
+		{"executable", "MZ\x90\x00\x03\x00\x00\x00", false, "", ""},
+		{"mp3", "ID3\x03\x00\x00\x00\x00\x00\x00", false, "", ""},
+		{"voice note as a file", webmOpus, false, "", ""},
+
+		{"webm opus", webmOpus, true, Voice, "audio/webm"},
+		{"ogg opus", oggOpus, true, Voice, "audio/ogg"},
+		{"webm video", webmVP8, true, "", ""},
+		{"ogg vorbis", oggOther, true, "", ""},
+		{"image as a voice note", string(pngData), true, "", ""},
+		{"mp3 as a voice note", "ID3\x03\x00\x00\x00\x00\x00\x00", true, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, contentType, ok := Sniff([]byte(tt.head), tt.voice)
+			if ok != (tt.kind != "") || kind != tt.kind || contentType != tt.contentType {
+				t.Errorf("Sniff = %q, %q, %v; want %q, %q", kind, contentType, ok, tt.kind, tt.contentType)
+			}
+		})
+	}
+}
+
+// Text cut off mid-character where the sniffed part ends is still text.
+func TestSniffCutCharacter(t *testing.T) {
+	head := []byte(strings.Repeat("a", SniffLen-1) + "é")[:SniffLen]
+	if kind, _, ok := Sniff(head, false); !ok || kind != File {
+		t.Errorf("Sniff = %q, %v; want a file", kind, ok)
+	}
+}
+
+func TestThumbnailSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		w, h         int
+		wantW, wantH int
+	}{
+		{"landscape", 800, 400, 320, 160},
+		{"portrait", 100, 1000, 32, 320},
+		{"square", 640, 640, 320, 320},
+		{"small", 50, 30, 50, 30},
+		{"thin", 2000, 3, 320, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodePNG(t, image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)))
+			thumb, err := Thumbnail(data, "image/png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := jpeg.DecodeConfig(bytes.NewReader(thumb))
+			if err != nil {
+				t.Fatalf("thumbnail isn't a JPEG: %v", err)
+			}
+			if config.Width != tt.wantW || config.Height != tt.wantH {
+				t.Errorf("thumbnail is %dx%d, want %dx%d", config.Width, config.Height, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+// Transparent pixels come out white rather than black.
+func TestThumbnailFlattensOntoWhite(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	img.Set(0, 0, color.NRGBA{A: 0})
+	thumb, err := Thumbnail(encodePNG(t, img), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := decoded.At(5, 5).RGBA(); r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Errorf("transparent pixel became %d,%d,%d, want white", r>>8, g>>8, b>>8)
+	}
+}
+
+// hugePNG is a PNG header claiming w by h pixels, with a valid checksum.
+func hugePNG(w, h uint32) []byte {
+	ihdr := []byte("IHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, w)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, h)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestThumbnailRejects(t *testing.T) {
+	valid := encodePNG(t, image.NewRGBA(image.Rect(0, 0, 20, 20)))
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+	}{
+		{"too many pixels", hugePNG(10000, 10000), "image/png"},
+		{"header only", hugePNG(100, 100), "image/png"},
+		{"garbage after the signature", []byte("\x89PNG\r\n\x1a\nnot really"), "image/png"},
+		{"truncated", valid[:len(valid)/2], "image/png"},
+		{"truncated jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), "image/jpeg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if thumb, err := Thumbnail(tt.data, tt.contentType); !errors.Is(err, ErrUnreadableImage) || thumb != nil {
+				t.Errorf("Thumbnail = %d bytes, %v; want ErrUnreadableImage", len(thumb), err)
+			}
+		})
+	}
+}
+
+// WebP can't be decoded here, so it is shown as it is.
+func TestThumbnailSkipsWebP(t *testing.T) {
+	if thumb, err := Thumbnail([]byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "image/webp"); thumb != nil || err != nil {
+		t.Errorf("Thumbnail(webp) = %d bytes, %v; want none", len(thumb), err)
+	}
+}
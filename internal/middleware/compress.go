@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Encodings the server compresses with, in order of preference.
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// minCompressSize is the smallest response worth compressing, when the
+// handler declares its length.
+const minCompressSize = 512
+
+// compressibleTypes are the content types compressed on the fly. Images
+// other than SVG are compressed already.
+var compressibleTypes = map[string]bool{
+	"text/html":                 true,
+	"text/css":                  true,
+	"text/plain":                true,
+	"text/javascript":           true,
+	"application/javascript":    true,
+	"application/json":          true,
+	"application/manifest+json": true,
+	"image/svg+xml":             true,
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}}
+	brotliWriters = sync.Pool{New: func() any {
+		return brotli.NewWriterLevel(io.Discard, 5)
+	}}
+)
+
+// AcceptedEncoding picks the first of offered that the request's
+// Accept-Encoding allows with the highest quality, or "" when the response
+// should be sent as it is.
+func AcceptedEncoding(r *http.Request, offered ...string) string {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		accepted[strings.ToLower(name)] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range offered {
+		q, ok := accepted[encoding]
+		if !ok {
+			q = accepted["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// CompressionMiddleware compresses text responses with brotli or gzip, as
+// the client accepts. Responses that already carry a Content-Encoding, such
+// as precompressed static files, pass through untouched.
+//
+// A strong ETag names one representation, so compressed responses get the
+// encoding appended to theirs ("abc" becomes "abc-br"). The suffix is taken
+// off If-None-Match before handlers see it, so they only ever compare their
+// own ETags.
+func CompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Upgraded connections carry their own framing
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       AcceptedEncoding(r, EncodingBrotli, EncodingGzip),
+			head:           r.Method == http.MethodHead,
+		}
+		if inm := r.Header.Get("If-None-Match"); inm != "" {
+			r.Header.Set("If-None-Match", cw.stripSuffixes(inm))
+		}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	head     bool
+
+	// matched is the encoding suffix taken off If-None-Match, put back on
+	// the ETag of a 304
+	matched     string
+	wroteHeader bool
+	encoder     io.WriteCloser
+}
+
+// stripSuffixes takes the encoding suffixes off each entity tag in an
+// If-None-Match header.
+func (cw *compressWriter) stripSuffixes(header string) string {
+	tags := strings.Split(header, ",")
+	for i, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		for _, encoding := range []string{EncodingBrotli, EncodingGzip} {
+			suffix := "-" + encoding + `"`
+			if strings.HasSuffix(tag, suffix) {
+				tag = strings.TrimSuffix(tag, suffix) + `"`
+				cw.matched = encoding
+				break
+			}
+		}
+		tags[i] = tag
+	}
+	return strings.Join(tags, ", ")
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+
+	contentType, _, _ := strings.Cut(h.Get("Content-Type"), ";")
+	compressible := compressibleTypes[strings.TrimSpace(contentType)]
+	if compressible || h.Get("Content-Encoding") != "" {
+		addVary(h, "Accept-Encoding")
+	}
+
+	switch {
+	case h.Get("Content-Encoding") != "":
+		// Precompressed by the handler
+		tagETag(h, h.Get("Content-Encoding"))
+	case status == http.StatusNotModified:
+		addVary(h, "Accept-Encoding")
+		tagETag(h, cw.matched)
+	case cw.encoding != "" && compressible && bodyAllowed(status) && !cw.tooSmall(h):
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		tagETag(h, cw.encoding)
+		if !cw.head {
+			cw.encoder = cw.newEncoder()
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends what has been compressed so far, for streamed responses.
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) tooSmall(h http.Header) bool {
+	n, err := strconv.Atoi(h.Get("Content-Length"))
+	return err == nil && n < minCompressSize
+}
+
+func (cw *compressWriter) newEncoder() io.WriteCloser {
+	if cw.encoding == EncodingBrotli {
+		bw := brotliWriters.Get().(*brotli.Writer)
+		bw.Reset(cw.ResponseWriter)
+		return bw
+	}
+	gw := gzipWriters.Get().(*gzip.Writer)
+	gw.Reset(cw.ResponseWriter)
+	return gw
+}
+
+// close finishes the compressed stream and returns its encoder to the pool.
+func (cw *compressWriter) close() {
+	if cw.encoder == nil {
+		return
+	}
+	cw.encoder.Close()
+	switch e := cw.encoder.(type) {
+	case *brotli.Writer:
+		brotliWriters.Put(e)
+	case *gzip.Writer:
+		gzipWriters.Put(e)
+	}
+}
+
+// tagETag appends an encoding to a strong ETag.
+func tagETag(h http.Header, encoding string) {
+	etag := h.Get("ETag")
+	if encoding == "" || etag == "" || strings.HasPrefix(etag, "W/") || strings.HasSuffix(etag, "-"+encoding+`"`) {
+		return
+	}
+	h.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+encoding+`"`)
+}
+
+// addVary adds a header to Vary unless it is listed already.
+func addVary(h http.Header, name string) {
+	for _, value := range h.Values("Vary") {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
+
+// bodyAllowed reports whether a response with status may be compressed.
+// Partial content is left alone, since its ranges count uncompressed bytes.
+func bodyAllowed(status int) bool {
+	switch status {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+	return status >= http.StatusOK
+}
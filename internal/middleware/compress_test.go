@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", EncodingGzip},
+		{"br", EncodingBrotli},
+		{"gzip, deflate, br", EncodingBrotli},
+		{"GZIP", EncodingGzip},
+		{"gzip;q=1.0, br;q=0.5", EncodingGzip},
+		{"gzip; q=0.8, br; q=0.9", EncodingBrotli},
+		{"br;q=0, gzip", EncodingGzip},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", EncodingBrotli},
+		{"*;q=0.5, gzip", EncodingGzip},
+		{"*, br;q=0", EncodingGzip},
+		{"identity", ""},
+		{"br;q=high, gzip;q=0.1", EncodingGzip},
+		{" , ,gzip", EncodingGzip},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", tt.header)
+		if got := AcceptedEncoding(r, EncodingBrotli, EncodingGzip); got != tt.want {
+			t.Errorf("AcceptedEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTagETag(t *testing.T) {
+	tests := []struct {
+		etag, encoding, want string
+	}{
+		{`"abc"`, EncodingBrotli, `"abc-br"`},
+		{`"abc"`, EncodingGzip, `"abc-gzip"`},
+		{`"abc-br"`, EncodingBrotli, `"abc-br"`},
+		{`"abc"`, "", `"abc"`},
+		{`W/"abc"`, EncodingGzip, `W/"abc"`},
+		{"", EncodingGzip, ""},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.etag != "" {
+			h.Set("ETag", tt.etag)
+		}
+		tagETag(h, tt.encoding)
+		if got := h.Get("ETag"); got != tt.want {
+			t.Errorf("tagETag(%s, %q) = %s, want %s", tt.etag, tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestStripSuffixes(t *testing.T) {
+	tests := []struct {
+		header, want, matched string
+	}{
+		{`"abc"`, `"abc"`, ""},
+		{`"abc-br"`, `"abc"`, EncodingBrotli},
+		{`"abc-gzip"`, `"abc"`, EncodingGzip},
+		{`"x", "abc-br"`, `"x", "abc"`, EncodingBrotli},
+		{`W/"abc-gzip"`, `W/"abc"`, EncodingGzip},
+		{`"abc-deflate"`, `"abc-deflate"`, ""},
+		{`*`, `*`, ""},
+	}
+	for _, tt := range tests {
+		cw := &compressWriter{}
+		if got := cw.stripSuffixes(tt.header); got != tt.want || cw.matched != tt.matched {
+			t.Errorf("stripSuffixes(%s) = %s, matched %q; want %s, %q", tt.header, got, cw.matched, tt.want, tt.matched)
+		}
+	}
+}
+
+// A compressed response carries the encoding on its ETag, and revalidating
+// with that ETag gets a 304 with the same one back.
+func TestCompressionMiddlewareETags(t *testing.T) {
+	body := strings.Repeat("body { color: red; }\n", 100)
+	h := CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		w.Header().Set("ETag", `"abc"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+	}))
+	get := func(headers map[string]string) *http.Response {
+		r := httptest.NewRequest(http.MethodGet, "/static/css/style.css", nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	resp := get(map[string]string{"Accept-Encoding": "gzip, br"})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != EncodingBrotli ||
+		resp.Header.Get("ETag") != `"abc-br"` || resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("compressed response = %d %v", resp.StatusCode, resp.Header)
+	}
+	decoded, err := io.ReadAll(brotli.NewReader(resp.Body))
+	if err != nil || string(decoded) != body {
+		t.Errorf("compressed body decodes to %d bytes, %v", len(decoded), err)
+	}
+
+	resp = get(map[string]string{"Accept-Encoding": "gzip, br", "If-None-Match": `"abc-br"`})
+	if resp.StatusCode != http.StatusNotModified || resp.Header.Get("ETag") != `"abc-br"` {
+		t.Errorf("revalidated response = %d, ETag %s; want 304, \"abc-br\"", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+
+	resp = get(nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("ETag") != `"abc"` {
+		t.Errorf("uncompressed response = %d %v", resp.StatusCode, resp.Header)
+	}
+
+	resp = get(map[string]string{"Accept-Encoding": "br", "Range": "bytes=0-9"})
+	if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("range response = %d %v; want 206 uncompressed", resp.StatusCode, resp.Header)
+	}
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPolicyWith(t *testing.T) {
+	base := Policy{}.With(DefaultSrc, Self).With(ScriptSrc, Self)
+	extended := base.With(ScriptSrc, Nonce("abc")).With(ObjectSrc, None)
+
+	if got, want := base.String(), "default-src 'self'; script-src 'self'"; got != want {
+		t.Errorf("base = %q after With, want %q", got, want)
+	}
+	if got, want := extended.String(), "default-src 'self'; script-src 'self' 'nonce-abc'; object-src 'none'"; got != want {
+		t.Errorf("extended = %q, want %q", got, want)
+	}
+	// Extending the same policy twice gives two independent policies
+	a, b := base.With(ScriptSrc, Nonce("a")), base.With(ScriptSrc, Nonce("b"))
+	if !strings.Contains(a.String(), "'nonce-a'") || strings.Contains(a.String(), "'nonce-b'") {
+		t.Errorf("a = %q, want only nonce a", a)
+	}
+	if !strings.Contains(b.String(), "'nonce-b'") || strings.Contains(b.String(), "'nonce-a'") {
+		t.Errorf("b = %q, want only nonce b", b)
+	}
+	if got := (Policy{}).String(); got != "" {
+		t.Errorf("empty policy = %q", got)
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		origin string
+		want   Source
+	}{
+		{"https://media.example.com", "https://media.example.com"},
+		{"https://media.example.com/", "https://media.example.com"},
+		{"http://localhost:9000", "http://localhost:9000"},
+		{"media.example.com", ""},
+		{"*", ""},
+		{"https://*", ""},
+		{"https://*.example.com", ""},
+		{"ftp://media.example.com", ""},
+		{"javascript:alert(1)", ""},
+		{"https://media.example.com/uploads", ""},
+		{"https://media.example.com?x=1", ""},
+		{"https://media.example.com#top", ""},
+		{"https://user@media.example.com", ""},
+		{"https://media.example.com; script-src *", ""},
+		{"https://media.example.com 'unsafe-inline'", ""},
+		{"https://a.example.com,https://b.example.com", ""},
+		{"https://media.example.com'", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, err := Host(tt.origin)
+		if got != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("Host(%q) = %q, %v; want %q", tt.origin, got, err, tt.want)
+		}
+	}
+}
+
+var nonceSource = regexp.MustCompile(`'nonce-([A-Za-z0-9_-]{22})'`)
+
+func TestSecurityMiddleware(t *testing.T) {
+	t.Cleanup(func() { basePolicy = defaultPolicy() })
+	InitSecurity(SecurityConfig{
+		ImageHosts: []string{"https://img.example.com/", "https://bad.example.com; script-src *"},
+		MediaHosts: []string{"https://video.example.com"},
+	})
+
+	var seen string
+	handler := SecurityMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = CSPNonce(r.Context())
+	}))
+	serve := func() (policy, nonce string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		policy = w.Header().Get("Content-Security-Policy")
+		m := nonceSource.FindStringSubmatch(policy)
+		if m == nil {
+			t.Fatalf("policy %q has no nonce", policy)
+		}
+		if seen != m[1] {
+			t.Errorf("handler saw nonce %q, header has %q", seen, m[1])
+		}
+		return policy, m[1]
+	}
+
+	policy, first := serve()
+	want := "default-src 'self'; " +
+		"script-src 'self' 'nonce-" + first + "'; " +
+		"style-src 'self' 'unsafe-inline'; " +
+		"img-src 'self' https://images.unsplash.com https://unsplash.com https://media.tenor.com data: https://img.example.com; " +
+		"media-src 'self' https://www.pexels.com https://videos.pexels.com data: https://video.example.com; " +
+		"font-src 'self'; " +
+		"connect-src 'self'; " +
+		"object-src 'none'; " +
+		"base-uri 'self'; " +
+		"form-action 'self'; " +
+		"frame-ancestors 'none'"
+	if policy != want {
+		t.Errorf("policy =\n%s\nwant\n%s", policy, want)
+	}
+
+	nonces := map[string]bool{first: true}
+	for i := 0; i < 10; i++ {
+		policy, nonce := serve()
+		if nonces[nonce] {
+			t.Fatalf("nonce %q reused", nonce)
+		}
+		nonces[nonce] = true
+		// Only the request's own nonce is allowed
+		if n := strings.Count(policy, "'nonce-"); n != 1 {
+			t.Errorf("policy has %d nonces, want 1: %q", n, policy)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"circles.diy/internal/auth"
+)
+
+// CSRF protection uses signed double-submit tokens. Each browser gets a
+// random secret in an HttpOnly cookie; the tokens put in pages are a fresh
+// nonce plus an HMAC over that secret, the signed-in user and the nonce, so
+// they cannot be minted without the server key or replayed across
+// accounts. Unsafe requests must carry a valid token in the X-CSRF-Token
+// header (HTMX and fetch) or the csrf_token form field, and must not come
+// from another origin. Multipart uploads must use the header: finding the
+// field would mean reading the whole upload before the handler's own size
+// limits apply.
+const (
+	CSRFCookieName = "circles_csrf"
+	CSRFHeaderName = "X-CSRF-Token"
+	CSRFFormField  = "csrf_token"
+
+	csrfSecretSize = 32
+	csrfNonceSize  = 16
+	csrfCookieTTL  = 365 * 24 * time.Hour
+)
+
+// CSRF failure reasons, passed to the failure handler.
+const (
+	CSRFReasonOrigin       = "origin_mismatch"
+	CSRFReasonMissingToken = "token_missing"
+	CSRFReasonInvalidToken = "token_invalid"
+)
+
+// CSRFConfig configures CSRFMiddleware.
+type CSRFConfig struct {
+	// Key signs tokens. It must be the same across restarts and instances
+	// for pages rendered earlier to stay valid.
+	Key []byte
+	// Secure marks the cookie HTTPS-only.
+	Secure bool
+	// TrustedOrigin is the public origin when it differs from the Host the
+	// server sees, e.g. behind a proxy.
+	TrustedOrigin string
+	// Failure renders rejected requests; CSRFFailureReason tells it why.
+	Failure http.Handler
+}
+
+var csrf CSRFConfig
+
+// InitCSRF sets how CSRFMiddleware signs tokens and answers failures.
+func InitCSRF(cfg CSRFConfig) {
+	csrf = cfg
+}
+
+type csrfContextKey int
+
+const (
+	csrfTokenKey csrfContextKey = iota
+	csrfReasonKey
+)
+
+// CSRFToken returns the token to embed in forms and HTMX headers for this
+// request.
+func CSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfTokenKey).(string)
+	return token
+}
+
+// CSRFFailureReason returns why CSRFMiddleware rejected the request.
+func CSRFFailureReason(ctx context.Context) string {
+	reason, _ := ctx.Value(csrfReasonKey).(string)
+	return reason
+}
+
+func csrfSign(secret []byte, userID string, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, csrf.Key)
+	mac.Write(secret)
+	mac.Write([]byte{0})
+	mac.Write([]byte(userID))
+	mac.Write([]byte{0})
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+func newCSRFToken(secret []byte, userID string) (string, error) {
+	nonce := make([]byte, csrfNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(nonce) + "." + enc.EncodeToString(csrfSign(secret, userID, nonce)), nil
+}
+
+func validCSRFToken(token string, secret []byte, userID string) bool {
+	nonceText, sigText, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	nonce, err := base64.RawURLEncoding.DecodeString(nonceText)
+	if err != nil || len(nonce) != csrfNonceSize {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigText)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(sig, csrfSign(secret, userID, nonce))
+}
+
+// csrfSecret returns the browser's secret, issuing one when the cookie is
+// missing or malformed. fresh reports a newly issued secret, which no
+// earlier page can hold a token for.
+func csrfSecret(w http.ResponseWriter, r *http.Request) (secret []byte, fresh bool, err error) {
+	if cookie, err := r.Cookie(CSRFCookieName); err == nil {
+		secret, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+		if err == nil && len(secret) == csrfSecretSize {
+			return secret, false, nil
+		}
+	}
+
+	secret = make([]byte, csrfSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, false, err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(secret),
+		Path:     "/",
+		MaxAge:   int(csrfCookieTTL.Seconds()),
+		Secure:   csrf.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return secret, true, nil
+}
+
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// sameOrigin checks where an unsafe request came from. Origin is preferred;
+// Referer covers older browsers. Requests carrying neither fall through to
+// the token check unless the browser flags them as cross-site.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		if ref, err := url.Parse(r.Referer()); err == nil && ref.Host != "" {
+			source = ref.Scheme + "://" + ref.Host
+		}
+	}
+	if source == "" {
+		return r.Header.Get("Sec-Fetch-Site") != "cross-site"
+	}
+	return strings.EqualFold(source, requestOrigin(r)) ||
+		(csrf.TrustedOrigin != "" && strings.EqualFold(source, csrf.TrustedOrigin))
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func submittedCSRFToken(r *http.Request) string {
+	if token := r.Header.Get(CSRFHeaderName); token != "" {
+		return token
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return r.FormValue(CSRFFormField)
+	}
+	return ""
+}
+
+func csrfFailed(w http.ResponseWriter, r *http.Request, reason string) {
+	log.Printf("CSRF check failed for %s %s from %s: %s", r.Method, r.URL.Path, clientIP(r), reason)
+	r = r.WithContext(context.WithValue(r.Context(), csrfReasonKey, reason))
+	if csrf.Failure != nil {
+		csrf.Failure.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
+
+// CSRFMiddleware rejects cross-site state-changing requests and puts the
+// token for this request on the context for CSRFToken. It must run after
+// SessionMiddleware so tokens are bound to the signed-in user.
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/static/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		secret, fresh, err := csrfSecret(w, r)
+		if err != nil {
+			log.Printf("Error issuing CSRF secret: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		user, _ := auth.CurrentUser(r.Context())
+		token, err := newCSRFToken(secret, user.ID)
+		if err != nil {
+			log.Printf("Error generating CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), csrfTokenKey, token))
+
+		if !safeMethod(r.Method) {
+			if !sameOrigin(r) {
+				csrfFailed(w, r, CSRFReasonOrigin)
+				return
+			}
+			submitted := submittedCSRFToken(r)
+			if submitted == "" {
+				csrfFailed(w, r, CSRFReasonMissingToken)
+				return
+			}
+			if fresh || !validCSRFToken(submitted, secret, user.ID) {
+				csrfFailed(w, r, CSRFReasonInvalidToken)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
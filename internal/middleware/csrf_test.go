@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func init() {
+	InitCSRF(CSRFConfig{Key: []byte("test key, not for production use")})
+}
+
+func TestCSRFTokenSignVerify(t *testing.T) {
+	secret := []byte(strings.Repeat("s", csrfSecretSize))
+	token, err := newCSRFToken(secret, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, sig, _ := strings.Cut(token, ".")
+
+	tests := []struct {
+		name   string
+		token  string
+		secret []byte
+		userID string
+		want   bool
+	}{
+		{"valid", token, secret, "user-1", true},
+		{"other user", token, secret, "user-2", false},
+		{"signed out", token, secret, "", false},
+		{"other secret", token, []byte(strings.Repeat("t", csrfSecretSize)), "user-1", false},
+		{"tampered signature", nonce + "." + strings.ToUpper(sig), secret, "user-1", false},
+		{"tampered nonce", strings.ToUpper(nonce) + "." + sig, secret, "user-1", false},
+		{"no signature", nonce, secret, "user-1", false},
+		{"short nonce", nonce[:8] + "." + sig, secret, "user-1", false},
+		{"empty", "", secret, "user-1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validCSRFToken(tt.token, tt.secret, tt.userID); got != tt.want {
+				t.Errorf("validCSRFToken = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	other, err := newCSRFToken(secret, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == token {
+		t.Error("two tokens for the same secret and user are equal")
+	}
+}
+
+// csrfSession gets a page through CSRFMiddleware and returns the cookie and
+// token a browser would hold.
+func csrfSession(t *testing.T) (*http.Cookie, string) {
+	t.Helper()
+	var token string
+	h := CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = CSRFToken(r.Context())
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CSRFCookieName || token == "" {
+		t.Fatalf("GET set cookies %v and token %q", cookies, token)
+	}
+	return cookies[0], token
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	cookie, token := csrfSession(t)
+	form := url.Values{CSRFFormField: {token}}.Encode()
+	const multipartType = "multipart/form-data; boundary=b"
+	multipartForm := "--b\r\nContent-Disposition: form-data; name=\"" + CSRFFormField + "\"\r\n\r\n" + token + "\r\n--b--\r\n"
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		body    string
+		cookie  bool
+		reason  string // empty when the request should pass
+	}{
+		{"safe method without token", http.MethodGet, nil, "", true, ""},
+		{"header token", http.MethodPost, map[string]string{CSRFHeaderName: token}, "", true, ""},
+		{"form token", http.MethodPost, map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, form, true, ""},
+		{"same origin", http.MethodDelete, map[string]string{CSRFHeaderName: token, "Origin": "http://example.com"}, "", true, ""},
+		{"same origin referer", http.MethodPost, map[string]string{CSRFHeaderName: token, "Referer": "http://example.com/circles"}, "", true, ""},
+		{"other origin", http.MethodPost, map[string]string{CSRFHeaderName: token, "Origin": "https://evil.example"}, "", true, CSRFReasonOrigin},
+		{"other referer", http.MethodPost, map[string]string{CSRFHeaderName: token, "Referer": "https://evil.example/x"}, "", true, CSRFReasonOrigin},
+		{"cross-site fetch", http.MethodPost, map[string]string{CSRFHeaderName: token, "Sec-Fetch-Site": "cross-site"}, "", true, CSRFReasonOrigin},
+		{"missing token", http.MethodPost, nil, "", true, CSRFReasonMissingToken},
+		{"multipart with header", http.MethodPost, map[string]string{CSRFHeaderName: token, "Content-Type": multipartType}, multipartForm, true, ""},
+		// Uploads aren't parsed to look for the field
+		{"multipart form token", http.MethodPost, map[string]string{"Content-Type": multipartType}, multipartForm, true, CSRFReasonMissingToken},
+		{"token in JSON body", http.MethodPost, map[string]string{"Content-Type": "application/json"}, `{"csrf_token":"` + token + `"}`, true, CSRFReasonMissingToken},
+		{"invalid token", http.MethodPost, map[string]string{CSRFHeaderName: token + "x"}, "", true, CSRFReasonInvalidToken},
+		{"no cookie", http.MethodPost, map[string]string{CSRFHeaderName: token}, "", false, CSRFReasonInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reason string
+			InitCSRF(CSRFConfig{Key: csrf.Key, Failure: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reason = CSRFFailureReason(r.Context())
+				w.WriteHeader(http.StatusForbidden)
+			})})
+			passed := false
+			h := CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				passed = true
+				// The body is left for the handler to read
+				if body, _ := io.ReadAll(r.Body); r.Form == nil && string(body) != tt.body {
+					t.Errorf("handler read body %q, want %q", body, tt.body)
+				}
+			}))
+
+			r := httptest.NewRequest(tt.method, "http://example.com/circles", strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if tt.cookie {
+				r.AddCookie(cookie)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if passed != (tt.reason == "") || reason != tt.reason {
+				t.Errorf("passed = %v, reason = %q; want reason %q", passed, reason, tt.reason)
+			}
+		})
+	}
+}
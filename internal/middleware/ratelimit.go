@@ -7,52 +7,135 @@ import (
 	"time"
 
 	"golang.org/x/time/rate"
+
+	"circles.diy/internal/utils"
 )
 
 type RateLimiter struct {
-	visitors map[string]*rate.Limiter
-	mu       sync.RWMutex
+	visitors map[string]*visitor
+	mu       sync.Mutex
+	limit    rate.Limit
+	burst    int
+	// idle is how long a key goes unseen before its limiter is full again
+	// and can be dropped
+	idle      time.Duration
+	lastPrune time.Time
+}
+
+type visitor struct {
+	limiter *rate.Limiter
+	seen    time.Time
 }
 
 func NewRateLimiter() *RateLimiter {
+	return NewRateLimiterWithLimit(rate.Every(time.Second), 10)
+}
+
+// NewRateLimiterWithLimit returns a limiter allowing burst requests per key
+// at once, refilled at limit.
+func NewRateLimiterWithLimit(limit rate.Limit, burst int) *RateLimiter {
 	return &RateLimiter{
-		visitors: make(map[string]*rate.Limiter),
+		visitors: make(map[string]*visitor),
+		limit:    limit,
+		burst:    burst,
+		idle:     time.Duration(float64(burst) / float64(limit) * float64(time.Second)),
 	}
 }
 
-func (rl *RateLimiter) getLimiter(ip string) *rate.Limiter {
-	rl.mu.RLock()
-	limiter, exists := rl.visitors[ip]
-	rl.mu.RUnlock()
+func (rl *RateLimiter) Allow(key string) bool {
+	now := time.Now()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
 
+	v, exists := rl.visitors[key]
 	if !exists {
-		rl.mu.Lock()
-		limiter = rate.NewLimiter(rate.Every(time.Second), 10)
-		rl.visitors[ip] = limiter
-		rl.mu.Unlock()
+		rl.prune(now)
+		v = &visitor{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.visitors[key] = v
 	}
-
-	return limiter
+	v.seen = now
+	return v.limiter.AllowN(now, 1)
 }
 
-func (rl *RateLimiter) Allow(ip string) bool {
-	return rl.getLimiter(ip).Allow()
+// prune drops the keys that have been idle long enough for their limiters
+// to refill, at most once per idle period, so the map holds only recent
+// keys however many are tried.
+func (rl *RateLimiter) prune(now time.Time) {
+	if now.Sub(rl.lastPrune) < rl.idle {
+		return
+	}
+	rl.lastPrune = now
+	for key, v := range rl.visitors {
+		if now.Sub(v.seen) >= rl.idle {
+			delete(rl.visitors, key)
+		}
+	}
 }
 
 var rateLimiter = NewRateLimiter()
 
+// Sign-in links are limited per client and per address, so nobody can flood
+// an inbox or probe for accounts.
+var (
+	magicLinkIPLimiter    = NewRateLimiterWithLimit(rate.Every(time.Minute), 5)
+	magicLinkEmailLimiter = NewRateLimiterWithLimit(rate.Every(5*time.Minute), 3)
+)
+
+// Each passkey sign-in started holds a challenge in memory until it is
+// finished or expires, so starting them is limited per client.
+var passkeyOptionsLimiter = NewRateLimiterWithLimit(rate.Every(6*time.Second), 10)
+
+func clientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		ip = strings.Split(forwarded, ",")[0]
+	}
+	return strings.TrimSpace(ip)
+}
+
 func RateLimitMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr
-		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-			ip = strings.Split(forwarded, ",")[0]
+		if !rateLimiter.Allow(clientIP(r)) {
+			http.Error(w, "Rate limit exceeded lol", http.StatusTooManyRequests)
+			return
 		}
 
-		if !rateLimiter.Allow(strings.TrimSpace(ip)) {
-			http.Error(w, "Rate limit exceeded lol", http.StatusTooManyRequests)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MagicLinkRateLimitMiddleware adds the sign-in link limits on top of
+// RateLimitMiddleware for requests that send a link by email.
+func MagicLinkRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Only addresses a link could be sent to are tracked, as the handler
+		// normalizes them
+		email, valid := utils.ValidateEmail(r.FormValue("email"))
+		if !magicLinkIPLimiter.Allow(clientIP(r)) || (valid && !magicLinkEmailLimiter.Allow(email)) {
+			http.Error(w, "Too many sign-in link requests. Try again in a few minutes.", http.StatusTooManyRequests)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+// PasskeyRateLimitMiddleware limits how often a client can ask for passkey
+// sign-in options, answering in the JSON the passkey script reads errors from.
+func PasskeyRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && !passkeyOptionsLimiter.Allow(clientIP(r)) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"Too many passkey sign-in attempts. Try again in a minute."}`))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	rl := NewRateLimiterWithLimit(rate.Every(time.Hour), 3)
+	for i := 0; i < 3; i++ {
+		if !rl.Allow("a") {
+			t.Fatalf("request %d refused within the burst", i+1)
+		}
+	}
+	if rl.Allow("a") {
+		t.Error("request past the burst allowed")
+	}
+	if !rl.Allow("b") {
+		t.Error("another key refused")
+	}
+}
+
+func TestRateLimiterPrunesIdleKeys(t *testing.T) {
+	rl := NewRateLimiterWithLimit(rate.Every(time.Millisecond), 2)
+	for i := 0; i < 100; i++ {
+		rl.Allow(fmt.Sprintf("key-%d", i))
+	}
+	time.Sleep(5 * time.Millisecond)
+	rl.Allow("fresh")
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if len(rl.visitors) != 1 {
+		t.Errorf("%d keys kept after they went idle, want 1", len(rl.visitors))
+	}
+}
+
+func TestPasskeyRateLimitMiddleware(t *testing.T) {
+	saved := passkeyOptionsLimiter
+	passkeyOptionsLimiter = NewRateLimiterWithLimit(rate.Every(6*time.Second), 10)
+	t.Cleanup(func() { passkeyOptionsLimiter = saved })
+	h := PasskeyRateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	code := func(method string) int {
+		r := httptest.NewRequest(method, "/login/passkey/options", nil)
+		r.RemoteAddr = "192.0.2.7:1234"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < 10; i++ {
+		if c := code(http.MethodPost); c != http.StatusOK {
+			t.Fatalf("request %d = %d within the burst", i+1, c)
+		}
+	}
+	if c := code(http.MethodPost); c != http.StatusTooManyRequests {
+		t.Errorf("request past the burst = %d, want 429", c)
+	}
+	if c := code(http.MethodGet); c != http.StatusOK {
+		t.Errorf("GET = %d, want it left alone", c)
+	}
+}
@@ -1,6 +1,74 @@
 package middleware
 
-import "net/http"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net/http"
+)
+
+// SecurityConfig configures the Content-Security-Policy SecurityMiddleware
+// sends.
+type SecurityConfig struct {
+	// ImageHosts and MediaHosts are origins allowed beyond the built-in
+	// ones for images and for audio and video.
+	ImageHosts []string
+	MediaHosts []string
+}
+
+// basePolicy is the policy every response gets, before the request's
+// script nonce is added.
+var basePolicy = defaultPolicy()
+
+func defaultPolicy() Policy {
+	return Policy{}.
+		With(DefaultSrc, Self).
+		// Scripts are self-hosted or carry the request's nonce; htmx is
+		// configured not to eval
+		With(ScriptSrc, Self).
+		// Inline styles remain for the theme system and index.html
+		With(StyleSrc, Self, UnsafeInline).
+		With(ImgSrc, Self, "https://images.unsplash.com", "https://unsplash.com", "https://media.tenor.com", Data).
+		With(MediaSrc, Self, "https://www.pexels.com", "https://videos.pexels.com", Data).
+		With(FontSrc, Self).
+		With(ConnectSrc, Self).
+		With(ObjectSrc, None).
+		With(BaseURI, Self).
+		With(FormAction, Self).
+		// Prevent framing (redundant with X-Frame-Options but good defense)
+		With(FrameAncestors, None)
+}
+
+// InitSecurity adds the configured hosts to the Content-Security-Policy.
+// Hosts that are not plain origins are logged and left out.
+func InitSecurity(cfg SecurityConfig) {
+	policy := defaultPolicy()
+	for _, extra := range []struct {
+		directive Directive
+		hosts     []string
+	}{{ImgSrc, cfg.ImageHosts}, {MediaSrc, cfg.MediaHosts}} {
+		for _, host := range extra.hosts {
+			source, err := Host(host)
+			if err != nil {
+				log.Printf("Warning: %v", err)
+				continue
+			}
+			policy = policy.With(extra.directive, source)
+		}
+	}
+	basePolicy = policy
+}
+
+type cspContextKey int
+
+const cspNonceKey cspContextKey = 0
+
+// CSPNonce returns the nonce inline scripts must carry for this request.
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceKey).(string)
+	return nonce
+}
 
 func SecurityMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -8,23 +76,17 @@ func SecurityMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("X-Frame-Options", "DENY")
 		w.Header().Set("X-XSS-Protection", "1; mode=block")
 
-		// Content Security Policy - tailored for current site content
-		csp := "default-src 'self'; " +
-			"style-src 'self' 'unsafe-inline'; " + // Allow inline styles for theme system and index.html
-			"script-src 'self' 'unsafe-inline' 'unsafe-eval'; " + // Allow self-hosted JS (htmx.min.js), inline scripts (theme manager), and eval for HTMX
-			"img-src 'self' https://images.unsplash.com https://unsplash.com https://media.tenor.com data:; " + // Allow Unsplash images, Tenor GIFs, and data URIs
-			"media-src 'self' https://www.pexels.com https://videos.pexels.com data:; " + // Allow Pexels videos and data URIs
-			"font-src 'self'; " + // Only self-hosted fonts
-			"connect-src 'self'; " + // Allow HTMX AJAX requests to same origin
-			"object-src 'none'; " + // Block plugins
-			"base-uri 'self'; " + // Restrict base URI
-			"form-action 'self'; " + // Only allow form submissions to same origin
-			"frame-ancestors 'none'" // Prevent framing (redundant with X-Frame-Options but good defense)
-
-		w.Header().Set("Content-Security-Policy", csp)
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			log.Printf("Error generating CSP nonce: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		encoded := base64.RawURLEncoding.EncodeToString(nonce)
+		w.Header().Set("Content-Security-Policy", basePolicy.With(ScriptSrc, Nonce(encoded)).String())
 		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
-		w.Header().Set("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
+		w.Header().Set("Permissions-Policy", "camera=(), microphone=(self), geolocation=()")
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), cspNonceKey, encoded)))
 	})
 }
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"circles.diy/internal/auth"
+	"circles.diy/internal/store"
+)
+
+// SessionMiddleware puts the signed-in user, if any, on the request context
+// for auth.CurrentUser. Static assets skip the session lookup.
+func SessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/static/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := auth.Authenticate(w, r)
+		if err == nil {
+			r = r.WithContext(auth.WithUser(r.Context(), user))
+		} else if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Error authenticating request: %v", err)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
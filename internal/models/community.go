@@ -1,25 +1,100 @@
 package models
 
+import "time"
+
+// Circle visibility: public circles are listed and open to all, unlisted
+// ones are reachable only by link and private ones only by members.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
 type Circle struct {
 	ID           string `json:"id"`
 	Name         string `json:"name"`
 	Description  string `json:"description"`
 	Thumbnail    string `json:"thumbnail"`
 	Banner       string `json:"banner"`
-	MemberCount  string `json:"member_count"`
-	OnlineCount  string `json:"online_count"`
-	UserRole     string `json:"user_role"`     // owner, admin, member
+	Visibility   string `json:"visibility"`
+	MemberCount  int    `json:"member_count"`
+	OnlineCount  int    `json:"online_count"` // filled in from live presence, not by the store
+	UserRole     string `json:"user_role"`    // owner, admin, moderator, member, guest; empty for non-members
 	JoinedDate   string `json:"joined_date"`
 	LastActivity string `json:"last_activity"`
+	DeletesIn    string `json:"deletes_in,omitempty"`
 	Active       bool   `json:"active"`
+	Featured     bool   `json:"featured"`
+
+	LastActivityAt time.Time `json:"last_activity_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	// ArchivedAt is set while the circle is read-only; DeleteAt when it is
+	// also scheduled to be deleted for good.
+	ArchivedAt time.Time `json:"archived_at,omitempty"`
+	DeleteAt   time.Time `json:"delete_at,omitempty"`
+}
+
+// Archived reports whether the circle has been archived or is awaiting
+// deletion.
+func (c Circle) Archived() bool {
+	return !c.ArchivedAt.IsZero()
+}
+
+// JoinRequest is a pending request to join a private circle.
+type JoinRequest struct {
+	User          User      `json:"user"`
+	Message       string    `json:"message"`
+	CreatedAt     time.Time `json:"created_at"`
+	RequestedDate string    `json:"requested_date"`
+}
+
+// CircleBan keeps a removed member from rejoining.
+type CircleBan struct {
+	User       User      `json:"user"`
+	BannedBy   string    `json:"banned_by"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+	BannedDate string    `json:"banned_date"`
+}
+
+// CircleInvite is an invite link or code. MaxUses 0 allows any number of
+// uses and a zero ExpiresAt never expires.
+type CircleInvite struct {
+	Code      string    `json:"code"`
+	CircleID  string    `json:"circle_id"`
+	CreatedBy string    `json:"created_by"`
+	MaxUses   int       `json:"max_uses"`
+	Uses      int       `json:"uses"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	RevokedAt time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresIn string    `json:"expires_in,omitempty"`
+}
+
+// Usable reports whether the invite can still admit someone at now.
+func (i CircleInvite) Usable(now time.Time) bool {
+	return i.RevokedAt.IsZero() &&
+		(i.ExpiresAt.IsZero() || now.Before(i.ExpiresAt)) &&
+		(i.MaxUses == 0 || i.Uses < i.MaxUses)
+}
+
+// CircleMember is one person's membership of a circle.
+type CircleMember struct {
+	User       User      `json:"user"`
+	Role       string    `json:"role"`
+	JoinedAt   time.Time `json:"joined_at"`
+	JoinedDate string    `json:"joined_date"`
 }
 
 type Discussion struct {
-	ID      string `json:"id"`
-	Title   string `json:"title"`
-	Preview string `json:"preview"`
-	Circle  string `json:"circle"`
-	TimeAgo string `json:"time_ago"`
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	Preview    string    `json:"preview"`
+	Circle     string    `json:"circle"`
+	CircleID   string    `json:"circle_id,omitempty"`
+	ReplyCount int       `json:"reply_count"`
+	TimeAgo    string    `json:"time_ago"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 type Event struct {
@@ -31,17 +106,20 @@ type Event struct {
 }
 
 type Ripple struct {
-	ID          string      `json:"id"`
-	User        User        `json:"user"`
-	Content     string      `json:"content"`
-	ContentType string      `json:"content_type"`
-	Image       *MediaItem  `json:"image,omitempty"`
-	Video       *MediaItem  `json:"video,omitempty"`
-	Gallery     []MediaItem `json:"gallery,omitempty"`
+	ID          string       `json:"id"`
+	User        User         `json:"user"`
+	Content     string       `json:"content"`
+	ContentType string       `json:"content_type"`
+	Image       *MediaItem   `json:"image,omitempty"`
+	Video       *MediaItem   `json:"video,omitempty"`
+	Gallery     []MediaItem  `json:"gallery,omitempty"`
 	Link        *LinkPreview `json:"link,omitempty"`
-	ExpiresIn   string      `json:"expires_in"`
-	Circle      string      `json:"circle"`
-	ViewCount   int         `json:"view_count"`
+	ExpiresIn   string       `json:"expires_in"`
+	Circle      string       `json:"circle"`
+	CircleID    string       `json:"circle_id,omitempty"`
+	ViewCount   int          `json:"view_count"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+	CreatedAt   time.Time    `json:"created_at"`
 }
 
 type LinkPreview struct {
@@ -53,19 +131,20 @@ type LinkPreview struct {
 }
 
 type CircleActivity struct {
-	ID       string `json:"id"`
-	CircleID string `json:"circle_id"`
-	Type     string `json:"type"` // post, member_joined, event, announcement
-	Title    string `json:"title"`
-	Content  string `json:"content"`
-	User     string `json:"user"`
-	TimeAgo  string `json:"time_ago"`
+	ID        string    `json:"id"`
+	CircleID  string    `json:"circle_id"`
+	Type      string    `json:"type"` // post, member_joined, event, announcement
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	User      string    `json:"user"`
+	TimeAgo   string    `json:"time_ago"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type CircleStats struct {
-	TotalPosts      int    `json:"total_posts"`
-	ActiveMembers   int    `json:"active_members"`
-	RecentActivity  string `json:"recent_activity"`
-	WeeklyGrowth    string `json:"weekly_growth"`
-	EngagementRate  string `json:"engagement_rate"`
-}
\ No newline at end of file
+	TotalPosts     int    `json:"total_posts"`
+	ActiveMembers  int    `json:"active_members"`
+	RecentActivity string `json:"recent_activity"`
+	WeeklyGrowth   string `json:"weekly_growth"`
+	EngagementRate string `json:"engagement_rate"`
+}
@@ -1,8 +1,15 @@
 package models
 
+import "time"
+
 type MediaItem struct {
 	URL string `json:"url"`
 	Alt string `json:"alt"`
+	// The rest describe files sent in chat
+	Thumbnail   string `json:"thumbnail,omitempty"`
+	Name        string `json:"name,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
 }
 
 type PostStats struct {
@@ -12,45 +19,100 @@ type PostStats struct {
 }
 
 type FeedItem struct {
-	ID      string      `json:"id"`
-	User    User        `json:"user"`
-	Content string      `json:"content"`
-	TimeAgo string      `json:"time_ago"`
-	Circle  string      `json:"circle"`
-	Image   *MediaItem  `json:"image,omitempty"`
-	Video   *MediaItem  `json:"video,omitempty"`
-	Gallery []MediaItem `json:"gallery,omitempty"`
-	CanBuy  bool        `json:"can_buy"`
-	Replies []Reply     `json:"replies,omitempty"`
+	ID          string      `json:"id"`
+	User        User        `json:"user"`
+	Content     string      `json:"content"`
+	TimeAgo     string      `json:"time_ago"`
+	Circle      string      `json:"circle"`
+	CircleID    string      `json:"circle_id,omitempty"`
+	Image       *MediaItem  `json:"image,omitempty"`
+	Video       *MediaItem  `json:"video,omitempty"`
+	Gallery     []MediaItem `json:"gallery,omitempty"`
+	CanBuy      bool        `json:"can_buy"`
+	Replies     []Reply     `json:"replies,omitempty"`
+	MoreReplies string      `json:"more_replies,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	EditedAt    time.Time   `json:"edited_at,omitempty"`
+	Signals     FeedSignals `json:"-"`
+	Reason      *FeedReason `json:"reason,omitempty"`
+}
+
+// FeedSignals are what the viewer's feed knows about an item: whether
+// they wrote it, are in its circle or are connected to its author.
+type FeedSignals struct {
+	Own        bool
+	InCircle   bool
+	Connection bool
+	Replies    int
+}
+
+// FeedReason explains why an item is in a feed. Code is stable for
+// clients and Text is for people. Items ranked by a weighted mix also
+// carry their score and the factors that made it up.
+type FeedReason struct {
+	Code    string       `json:"code"`
+	Text    string       `json:"text"`
+	Score   float64      `json:"score,omitempty"`
+	Factors []FeedFactor `json:"factors,omitempty"`
 }
 
+// FeedFactor is one weighted term of a mixed feed score. Value is in
+// [0, 1]; the term adds Weight × Value to the score.
+type FeedFactor struct {
+	Name   string  `json:"name"`
+	Label  string  `json:"label"`
+	Weight float64 `json:"weight"`
+	Value  float64 `json:"value"`
+}
+
+// Edited reports whether the post was changed after it was published.
+func (f FeedItem) Edited() bool { return !f.EditedAt.IsZero() }
+
 type Post struct {
-	ID      string      `json:"id"`
-	User    User        `json:"user"`
-	Content string      `json:"content"`
-	TimeAgo string      `json:"time_ago"`
-	Circle  string      `json:"circle"`
-	Image   *MediaItem  `json:"image,omitempty"`
-	Video   *MediaItem  `json:"video,omitempty"`
-	Gallery []MediaItem `json:"gallery,omitempty"`
-	CanBuy  bool        `json:"can_buy"`
-	Stats   *PostStats  `json:"stats,omitempty"`
-	Replies []Reply     `json:"replies,omitempty"`
+	ID          string      `json:"id"`
+	User        User        `json:"user"`
+	Content     string      `json:"content"`
+	TimeAgo     string      `json:"time_ago"`
+	Circle      string      `json:"circle"`
+	CircleID    string      `json:"circle_id,omitempty"`
+	Image       *MediaItem  `json:"image,omitempty"`
+	Video       *MediaItem  `json:"video,omitempty"`
+	Gallery     []MediaItem `json:"gallery,omitempty"`
+	CanBuy      bool        `json:"can_buy"`
+	Stats       *PostStats  `json:"stats,omitempty"`
+	Replies     []Reply     `json:"replies,omitempty"`
+	MoreReplies string      `json:"more_replies,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	EditedAt    time.Time   `json:"edited_at,omitempty"`
 }
 
+// Edited reports whether the post was changed after it was published.
+func (p Post) Edited() bool { return !p.EditedAt.IsZero() }
+
+// Reply is one reply in a post's thread. Replies holds the replies loaded
+// under it so far: ReplyCount counts all of its direct replies, and
+// MoreReplies is the cursor for the next page of them when some are left.
 type Reply struct {
-	ID        string  `json:"id"`
-	User      User    `json:"user"`
-	Content   string  `json:"content"`
-	TimeAgo   string  `json:"time_ago"`
-	Timestamp string  `json:"timestamp"`
-	Replies   []Reply `json:"replies,omitempty"`
+	ID          string    `json:"id"`
+	PostID      string    `json:"post_id,omitempty"`
+	ParentID    string    `json:"parent_id,omitempty"`
+	User        User      `json:"user"`
+	Content     string    `json:"content"`
+	TimeAgo     string    `json:"time_ago"`
+	Timestamp   string    `json:"timestamp"`
+	Depth       int       `json:"depth"`
+	ReplyCount  int       `json:"reply_count"`
+	Replies     []Reply   `json:"replies,omitempty"`
+	MoreReplies string    `json:"more_replies,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 type DraftPost struct {
-	ID      string      `json:"id"`
-	Content string      `json:"content"`
-	Image   *MediaItem  `json:"image,omitempty"`
-	Video   *MediaItem  `json:"video,omitempty"`
-	Gallery []MediaItem `json:"gallery,omitempty"`
-}
\ No newline at end of file
+	ID        string      `json:"id"`
+	Content   string      `json:"content"`
+	CircleID  string      `json:"circle_id,omitempty"`
+	Image     *MediaItem  `json:"image,omitempty"`
+	Video     *MediaItem  `json:"video,omitempty"`
+	Gallery   []MediaItem `json:"gallery,omitempty"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
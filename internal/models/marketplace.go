@@ -1,24 +1,28 @@
 package models
 
+import "time"
+
 type MarketplaceItem struct {
-	ID          string     `json:"id"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	Price       string     `json:"price"`
-	PriceType   string     `json:"price_type"` // sale, trade, free, negotiable
-	Image       *MediaItem `json:"image,omitempty"`
+	ID          string      `json:"id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Price       string      `json:"price"`
+	PriceType   string      `json:"price_type"` // sale, trade, free, negotiable
+	Image       *MediaItem  `json:"image,omitempty"`
 	Images      []MediaItem `json:"images,omitempty"`
-	Location    string     `json:"location"`
-	Distance    string     `json:"distance,omitempty"`
-	TimeAgo     string     `json:"time_ago"`
-	Seller      User       `json:"seller"`
-	Circle      string     `json:"circle,omitempty"`
-	Category    string     `json:"category"`
-	Tags        []string   `json:"tags"`
-	Condition   string     `json:"condition"` // new, like-new, good, fair, poor
-	IsAvailable bool       `json:"is_available"`
-	ViewCount   int        `json:"view_count"`
-	IsFeatured  bool       `json:"is_featured"`
+	Location    string      `json:"location"`
+	Distance    string      `json:"distance,omitempty"`
+	TimeAgo     string      `json:"time_ago"`
+	Seller      User        `json:"seller"`
+	Circle      string      `json:"circle,omitempty"`
+	CircleID    string      `json:"circle_id,omitempty"`
+	Category    string      `json:"category"`
+	Tags        []string    `json:"tags"`
+	Condition   string      `json:"condition"` // new, like-new, good, fair, poor
+	IsAvailable bool        `json:"is_available"`
+	ViewCount   int         `json:"view_count"`
+	IsFeatured  bool        `json:"is_featured"`
+	CreatedAt   time.Time   `json:"created_at"`
 }
 
 type MarketplaceCategory struct {
@@ -29,11 +33,11 @@ type MarketplaceCategory struct {
 }
 
 type MarketplaceFilter struct {
-	PriceTypes []string   `json:"price_types"`
-	Categories []string   `json:"categories"`
-	Conditions []string   `json:"conditions"`
-	Locations  []Location `json:"locations"`
-	MaxDistance int       `json:"max_distance"`
+	PriceTypes  []string   `json:"price_types"`
+	Categories  []string   `json:"categories"`
+	Conditions  []string   `json:"conditions"`
+	Locations   []Location `json:"locations"`
+	MaxDistance int        `json:"max_distance"`
 }
 
 type Location struct {
@@ -41,4 +45,4 @@ type Location struct {
 	Latitude  float64 `json:"latitude,omitempty"`
 	Longitude float64 `json:"longitude,omitempty"`
 	Count     int     `json:"count"`
-}
\ No newline at end of file
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type PageData struct {
 	Success   bool
 	CSRFToken string
@@ -15,12 +17,45 @@ type BaseData struct {
 	ActiveNav string
 	Theme     ThemeSettings
 	CSRFToken string
+	// Nonce is the Content-Security-Policy nonce inline scripts carry
+	Nonce       string
+	CurrentUser *User // nil for signed-out visitors
+}
+
+// AuthPageData backs the sign-in and registration forms. Values holds the
+// submitted fields to re-fill and Errors the messages keyed by field name,
+// with "form" for errors not tied to one field.
+type AuthPageData struct {
+	BaseData
+	Next   string
+	Values map[string]string
+	Errors map[string]string
+	Notice string
+	Token  string // sign-in link token awaiting confirmation
+}
+
+// ErrorPageData backs the full-page error responses.
+type ErrorPageData struct {
+	BaseData
+	Status  int
+	Heading string
+	Message string
+}
+
+// PasskeysPageData backs the passkey settings page. Errors is keyed by
+// passkey ID for rename failures.
+type PasskeysPageData struct {
+	BaseData
+	Passkeys []Passkey
+	Notice   string
+	Errors   map[string]string
 }
 
 type DashboardData struct {
 	BaseData
 	Feed             []FeedItem        `json:"feed"`
-	FeedOffset       int               `json:"feed_offset"`
+	FeedCursor       string            `json:"feed_cursor,omitempty"`
+	FeedSettings     FeedSettings      `json:"feed_settings"`
 	Circles          []Circle          `json:"circles"`
 	Discussions      []Discussion      `json:"discussions"`
 	Events           []Event           `json:"events"`
@@ -29,17 +64,37 @@ type DashboardData struct {
 	Impact           []ImpactItem      `json:"impact"`
 }
 
+// FeedSettings describes the member's feed strategy, the others they can
+// switch to and the weights of the mixed one.
+type FeedSettings struct {
+	Strategy   string         `json:"strategy"`
+	Strategies []FeedStrategy `json:"strategies"`
+	Weights    []FeedWeight   `json:"weights"`
+}
+
+type FeedStrategy struct {
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+}
+
+type FeedWeight struct {
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	Percent     int    `json:"percent"`
+}
+
 type ProfileData struct {
 	BaseData
-	Profile      Profile     `json:"profile"`
-	Posts        []Post      `json:"posts"`
-	PostOffset   int         `json:"post_offset"`
-	HasMorePosts bool        `json:"has_more_posts"`
-	IsOwner      bool        `json:"is_owner"`
-	Extensions   []Extension `json:"extensions"`
-	Analytics    Analytics   `json:"analytics"`
-	Drafts       []DraftPost `json:"drafts"`
-	DraftCount   int         `json:"draft_count"`
+	Profile    Profile     `json:"profile"`
+	Posts      []Post      `json:"posts"`
+	PostCursor string      `json:"post_cursor,omitempty"`
+	IsOwner    bool        `json:"is_owner"`
+	Extensions []Extension `json:"extensions"`
+	Analytics  Analytics   `json:"analytics"`
+	Drafts     []DraftPost `json:"drafts"`
+	DraftCount int         `json:"draft_count"`
 }
 
 type CirclesPageData struct {
@@ -50,85 +105,238 @@ type CirclesPageData struct {
 	FeaturedCircles []Circle         `json:"featured_circles"`
 }
 
+// CircleFormPageData backs the circle creation and settings forms. Circle
+// is empty while creating; Members lists who ownership can pass to.
+type CircleFormPageData struct {
+	BaseData
+	Circle       Circle
+	Values       map[string]string
+	Errors       map[string]string
+	Notice       string
+	Members      []CircleMember
+	Visibilities []string
+}
+
+// CircleMembersPageData backs a circle's member list. AssignableRoles are
+// the roles the viewer may hand out, empty when they manage no one.
+// Requests and Invites are only loaded for those who may invite, Bans for
+// moderators. InviteOrigin prefixes invite links.
+type CircleMembersPageData struct {
+	BaseData
+	Circle          Circle
+	Members         []CircleMember
+	AssignableRoles []string
+	Requests        []JoinRequest
+	Invites         []CircleInvite
+	Bans            []CircleBan
+	InviteOrigin    string
+	Errors          map[string]string
+	Notice          string
+}
+
+// CircleJoinPageData backs the page for joining a circle, asking to, or
+// accepting an invite to it. Invite is set when arriving by invite.
+type CircleJoinPageData struct {
+	BaseData
+	Circle    Circle
+	Invite    *CircleInvite
+	Requested bool
+	Banned    bool
+	Values    map[string]string
+	Errors    map[string]string
+	Notice    string
+}
+
+// PostFormPageData backs the post composer. Post is set when editing a
+// published post and DraftID while working on a draft. Circles are those
+// the author may post in; Media holds one slot per possible media item.
+type PostFormPageData struct {
+	BaseData
+	Post    *Post
+	DraftID string
+	Circles []Circle
+	Kinds   []string
+	Values  map[string]string
+	Media   []MediaItem
+	Errors  map[string]string
+	SavedAt string
+}
+
+// PostThreadPageData backs a post's thread page. Replies are the post's
+// top-level replies, or Thread is set when focusing on one reply's subtree.
+type PostThreadPageData struct {
+	BaseData
+	Post        Post
+	Replies     []Reply
+	MoreReplies string
+	Thread      *Reply
+	Values      map[string]string
+	Errors      map[string]string
+}
+
+// ReplyPage is a page of replies under ParentID, or the post's top-level
+// replies when it is empty, rendered on its own for HTMX.
+type ReplyPage struct {
+	PostID   string
+	ParentID string
+	Replies  []Reply
+	Next     string
+}
+
 type ChatPageData struct {
 	BaseData
 	Conversations []Conversation `json:"conversations"`
 	ActiveChat    *Conversation  `json:"active_chat,omitempty"`
 	Messages      []Message      `json:"messages"`
 	Contacts      []Contact      `json:"contacts"`
+	// LastMessageID is the newest message when the page was loaded, which
+	// the live stream picks up after
+	LastMessageID string `json:"last_message_id,omitempty"`
+	// ReadReceipts is whether the member lets others see what they've read
+	ReadReceipts bool `json:"read_receipts"`
+	// SharePresence is whether the member lets others see them online
+	SharePresence bool `json:"share_presence"`
 }
 
+// ChatGroupPageData backs the new group form and a group's settings and
+// member list. Conversation is empty while creating. Contacts are the
+// viewer's contacts who could be added, with the submitted ones in
+// Selected; Values and Errors are the group form as submitted.
+type ChatGroupPageData struct {
+	BaseData
+	Conversation Conversation
+	Members      []ConversationMember
+	Contacts     []Contact
+	Selected     map[string]bool
+	Values       map[string]string
+	Errors       map[string]string
+	Notice       string
+}
+
+// TypingIndicator shows that User is typing in a conversation.
+type TypingIndicator struct {
+	ConversationID string `json:"conversation_id"`
+	User           User   `json:"user"`
+}
+
+// Roles in a group conversation. Admins rename the group and manage who
+// is in it.
+const (
+	GroupAdmin  = "admin"
+	GroupMember = "member"
+)
+
 type Conversation struct {
-	ID           string  `json:"id"`
-	Name         string  `json:"name"`
-	Avatar       string  `json:"avatar"`
-	LastMessage  string  `json:"last_message"`
-	LastTime     string  `json:"last_time"`
-	UnreadCount  int     `json:"unread_count"`
-	IsOnline     bool    `json:"is_online"`
-	IsGroup      bool    `json:"is_group"`
-	Participants []User  `json:"participants,omitempty"`
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Avatar       string    `json:"avatar"`
+	LastMessage  string    `json:"last_message"`
+	LastTime     string    `json:"last_time"`
+	UnreadCount  int       `json:"unread_count"`
+	IsOnline     bool      `json:"is_online"`
+	IsGroup      bool      `json:"is_group"`
+	IsActive     bool      `json:"is_active"`           // open on the chat page
+	UserRole     string    `json:"user_role,omitempty"` // the viewer's role in a group
+	Status       string    `json:"status"`              // online, away or offline: the best among the other participants
+	LastSeen     string    `json:"last_seen,omitempty"`
+	Participants []User    `json:"participants,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 type Message struct {
-	ID        string     `json:"id"`
-	Content   string     `json:"content"`
-	Timestamp string     `json:"timestamp"`
-	Sender    User       `json:"sender"`
-	IsOwn     bool       `json:"is_own"`
-	IsRead    bool       `json:"is_read"`
-	Type      string     `json:"type"` // text, image, voice, video, call
-	Media     *MediaItem `json:"media,omitempty"`
+	ID             string     `json:"id"`
+	ConversationID string     `json:"conversation_id"`
+	Content        string     `json:"content"`
+	Timestamp      string     `json:"timestamp"`
+	Sender         User       `json:"sender"`
+	IsOwn          bool       `json:"is_own"`
+	IsRead         bool       `json:"is_read"` // read by someone, as shown to its sender
+	ReadBy         int        `json:"read_by"` // others who have read it and send read receipts
+	InGroup        bool       `json:"in_group"`
+	Type           string     `json:"type"` // text, image, voice, file, video, call, system
+	Media          *MediaItem `json:"media,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Attachment is a file uploaded to a conversation and sent with
+// MessageID. Kind is the message type it makes: image, voice or file.
+// Data is the file, or its thumbnail when that was asked for.
+type Attachment struct {
+	ID             string
+	ConversationID string
+	MessageID      string
+	UploaderID     string
+	Kind           string
+	Name           string
+	ContentType    string
+	Size           int64
+	Data           []byte
+	Thumbnail      []byte
+	HasThumbnail   bool
+	CreatedAt      time.Time
+}
+
+// ConversationMember is someone in a group conversation.
+type ConversationMember struct {
+	User       User      `json:"user"`
+	Role       string    `json:"role"`
+	JoinedAt   time.Time `json:"joined_at"`
+	JoinedDate string    `json:"joined_date"`
 }
 
 type Contact struct {
 	User
 	IsOnline     bool   `json:"is_online"`
+	Status       string `json:"status"` // online, away or offline
 	LastSeen     string `json:"last_seen,omitempty"`
 	Relationship string `json:"relationship"` // friend, circle_member, etc.
 }
 
 type GatherPageData struct {
 	BaseData
-	FeaturedEvents   []GatherEvent      `json:"featured_events"`
-	UpcomingEvents   []GatherEvent      `json:"upcoming_events"`
-	MyEvents         []GatherEvent      `json:"my_events"`
-	EventCategories  []EventCategory    `json:"event_categories"`
-	PopularLocations []EventLocation    `json:"popular_locations"`
+	FeaturedEvents   []GatherEvent   `json:"featured_events"`
+	UpcomingEvents   []GatherEvent   `json:"upcoming_events"`
+	UpcomingCursor   string          `json:"upcoming_cursor,omitempty"`
+	MyEvents         []GatherEvent   `json:"my_events"`
+	EventCategories  []EventCategory `json:"event_categories"`
+	PopularLocations []EventLocation `json:"popular_locations"`
 }
 
 type GatherEvent struct {
-	ID              string          `json:"id"`
-	Title           string          `json:"title"`
-	Description     string          `json:"description"`
-	Host            User            `json:"host"`
-	Circle          string          `json:"circle,omitempty"`
-	DateTime        string          `json:"date_time"`
-	TimeAgo         string          `json:"time_ago"`
-	Duration        string          `json:"duration"`
-	Location        EventLocation   `json:"location"`
-	Type            string          `json:"type"` // in-person, online, hybrid
-	Category        string          `json:"category"`
-	IsTicketed      bool            `json:"is_ticketed"`
-	Price           string          `json:"price,omitempty"`
-	Currency        string          `json:"currency,omitempty"`
-	Capacity        int             `json:"capacity"`
-	AttendeeCount   int             `json:"attendee_count"`
-	RSVPStatus      string          `json:"rsvp_status"` // going, maybe, not_going, not_responded
-	IsHost          bool            `json:"is_host"`
-	Image           *MediaItem      `json:"image,omitempty"`
-	Tags            []string        `json:"tags"`
-	Announcements   []Announcement  `json:"announcements"`
-	Attendees       []EventAttendee `json:"attendees"`
+	ID            string          `json:"id"`
+	Title         string          `json:"title"`
+	Description   string          `json:"description"`
+	Host          User            `json:"host"`
+	Circle        string          `json:"circle,omitempty"`
+	CircleID      string          `json:"circle_id,omitempty"`
+	DateTime      string          `json:"date_time"`
+	TimeAgo       string          `json:"time_ago"`
+	Duration      string          `json:"duration"`
+	Location      EventLocation   `json:"location"`
+	Type          string          `json:"type"` // in-person, online, hybrid
+	Category      string          `json:"category"`
+	IsTicketed    bool            `json:"is_ticketed"`
+	Price         string          `json:"price,omitempty"`
+	Currency      string          `json:"currency,omitempty"`
+	Capacity      int             `json:"capacity"`
+	AttendeeCount int             `json:"attendee_count"`
+	RSVPStatus    string          `json:"rsvp_status"` // going, maybe, not_going, not_responded
+	IsHost        bool            `json:"is_host"`
+	Image         *MediaItem      `json:"image,omitempty"`
+	Tags          []string        `json:"tags"`
+	Announcements []Announcement  `json:"announcements"`
+	Attendees     []EventAttendee `json:"attendees"`
+	IsFeatured    bool            `json:"is_featured"`
+	StartsAt      time.Time       `json:"starts_at"`
 }
 
 type EventLocation struct {
-	Type        string  `json:"type"` // venue, online, address
-	Name        string  `json:"name"`
-	Address     string  `json:"address,omitempty"`
-	City        string  `json:"city,omitempty"`
-	OnlineLink  string  `json:"online_link,omitempty"`
-	Coordinates string  `json:"coordinates,omitempty"`
+	Type        string `json:"type"` // venue, online, address
+	Name        string `json:"name"`
+	Address     string `json:"address,omitempty"`
+	City        string `json:"city,omitempty"`
+	OnlineLink  string `json:"online_link,omitempty"`
+	Coordinates string `json:"coordinates,omitempty"`
 }
 
 type EventCategory struct {
@@ -139,11 +347,12 @@ type EventCategory struct {
 }
 
 type Announcement struct {
-	ID      string `json:"id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	Author  User   `json:"author"`
-	TimeAgo string `json:"time_ago"`
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Author    User      `json:"author"`
+	TimeAgo   string    `json:"time_ago"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type EventAttendee struct {
@@ -154,14 +363,13 @@ type EventAttendee struct {
 
 type MarketplacePageData struct {
 	BaseData
-	Items          []MarketplaceItem      `json:"items"`
-	FeaturedItems  []MarketplaceItem      `json:"featured_items"`
-	Categories     []MarketplaceCategory  `json:"categories"`
-	PopularLocations []Location           `json:"popular_locations"`
-	TotalItems     int                    `json:"total_items"`
-	ItemsPerPage   int                    `json:"items_per_page"`
-	CurrentPage    int                    `json:"current_page"`
-	HasMore        bool                   `json:"has_more"`
-	Filters        MarketplaceFilter      `json:"filters"`
-	ActiveFilters  map[string]interface{} `json:"active_filters"`
-}
\ No newline at end of file
+	Items            []MarketplaceItem      `json:"items"`
+	FeaturedItems    []MarketplaceItem      `json:"featured_items"`
+	Categories       []MarketplaceCategory  `json:"categories"`
+	PopularLocations []Location             `json:"popular_locations"`
+	TotalItems       int                    `json:"total_items"`
+	ItemsPerPage     int                    `json:"items_per_page"`
+	NextCursor       string                 `json:"next_cursor,omitempty"`
+	Filters          MarketplaceFilter      `json:"filters"`
+	ActiveFilters    map[string]interface{} `json:"active_filters"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type User struct {
 	ID     string `json:"id"`
 	Handle string `json:"handle"`
@@ -24,4 +26,48 @@ type Profile struct {
 	Bio         string       `json:"bio"`
 	Stats       ProfileStats `json:"stats"`
 	IsConnected bool         `json:"is_connected"`
-}
\ No newline at end of file
+}
+
+// Account holds a user's sign-in credentials.
+type Account struct {
+	UserID       string    `json:"user_id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Session is a signed-in browser. ID is the hash of the cookie token, never
+// the token itself.
+type Session struct {
+	ID        string    `json:"-"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LoginToken is an emailed sign-in link. Like sessions, ID is the hash of
+// the token in the link.
+type LoginToken struct {
+	ID        string    `json:"-"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Passkey is a WebAuthn credential registered to an account. ID is the
+// base64url credential ID and PublicKey the COSE key it signs with.
+type Passkey struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Name       string    `json:"name"`
+	PublicKey  []byte    `json:"-"`
+	Algorithm  int       `json:"algorithm"`
+	SignCount  uint32    `json:"-"`
+	Transports []string  `json:"transports,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+
+	// Display fields
+	Added    string `json:"-"`
+	LastUsed string `json:"-"`
+}
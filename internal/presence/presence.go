@@ -0,0 +1,250 @@
+// Package presence works out who is online, away or offline from their
+// live connections and recent activity, and passes on who is typing. It
+// all lives in memory: nothing is written as people come, go or type, and
+// a restart starts everyone offline.
+package presence
+
+import (
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	Offline Status = "offline"
+	Online  Status = "online"
+	// Away is connected but idle for AwayAfter
+	Away Status = "away"
+)
+
+const (
+	// AwayAfter is how long a connected user can go without doing anything
+	// before they show as away
+	AwayAfter = 5 * time.Minute
+	// TypingEvery is how often one user's typing in a conversation is
+	// passed on. Clients show it for a little longer than this.
+	TypingEvery = 3 * time.Second
+	// forgetAfter is how long someone is remembered after they leave, for
+	// their last seen time
+	forgetAfter = 24 * time.Hour
+	// maxTyping bounds the typing throttle. Entries only last TypingEvery,
+	// so it is only reached under abuse, and typing is dropped until the
+	// next sweep.
+	maxTyping = 10000
+)
+
+type user struct {
+	conns      int
+	lastActive time.Time
+	lastSeen   time.Time
+	hidden     bool
+	// announced is the status onChange was last called with
+	announced Status
+}
+
+type typingKey struct {
+	userID         string
+	conversationID string
+}
+
+// Tracker holds everyone's presence. It is safe for concurrent use.
+type Tracker struct {
+	mu     sync.Mutex
+	users  map[string]*user
+	typing map[typingKey]time.Time
+	// onChange is called, outside mu, when a user's status as others see
+	// it changes
+	onChange func(userID string, status Status)
+	// now is the clock, replaced in tests
+	now func() time.Time
+}
+
+// NewTracker returns a Tracker that calls onChange whenever someone's
+// status as others see it changes.
+func NewTracker(onChange func(userID string, status Status)) *Tracker {
+	return &Tracker{
+		users:    make(map[string]*user),
+		typing:   make(map[typingKey]time.Time),
+		onChange: onChange,
+		now:      time.Now,
+	}
+}
+
+// status is what others see of u.
+func (u *user) status(now time.Time) Status {
+	switch {
+	case u == nil || u.hidden || u.conns == 0:
+		return Offline
+	case now.Sub(u.lastActive) >= AwayAfter:
+		return Away
+	default:
+		return Online
+	}
+}
+
+// changed reports whether u's status differs from the one last announced,
+// taking it as announced. t.mu must be held.
+func (u *user) changed(now time.Time) (Status, bool) {
+	s := u.status(now)
+	if s == u.announced || (u.announced == "" && s == Offline) {
+		return s, false
+	}
+	u.announced = s
+	return s, true
+}
+
+// update applies fn to userID's entry, creating it, and announces any
+// change in their status.
+func (t *Tracker) update(userID string, fn func(u *user, now time.Time)) {
+	now := t.now()
+	t.mu.Lock()
+	u, ok := t.users[userID]
+	if !ok {
+		u = &user{}
+		t.users[userID] = u
+	}
+	fn(u, now)
+	status, changed := u.changed(now)
+	t.mu.Unlock()
+
+	if changed && t.onChange != nil {
+		t.onChange(userID, status)
+	}
+}
+
+// Connect records a new live connection for userID, who counts as active.
+// hidden is whether they keep their presence to themselves. Each Connect
+// needs a Disconnect.
+func (t *Tracker) Connect(userID string, hidden bool) {
+	t.update(userID, func(u *user, now time.Time) {
+		u.conns++
+		u.lastActive = now
+		u.hidden = hidden
+	})
+}
+
+// Disconnect ends one of userID's connections. When it was the last, they
+// are offline and last seen now.
+func (t *Tracker) Disconnect(userID string) {
+	t.update(userID, func(u *user, now time.Time) {
+		if u.conns > 0 {
+			u.conns--
+		}
+		if u.conns == 0 {
+			u.lastSeen = now
+		}
+	})
+}
+
+// Touch records that userID did something, bringing them back from away.
+func (t *Tracker) Touch(userID string) {
+	t.mu.Lock()
+	_, ok := t.users[userID]
+	t.mu.Unlock()
+	if !ok {
+		// Only connected users are tracked
+		return
+	}
+	t.update(userID, func(u *user, now time.Time) {
+		u.lastActive = now
+	})
+}
+
+// SetHidden changes whether userID keeps their presence to themselves.
+func (t *Tracker) SetHidden(userID string, hidden bool) {
+	t.update(userID, func(u *user, now time.Time) {
+		u.hidden = hidden
+	})
+}
+
+// Status returns userID's status as others see it.
+func (t *Tracker) Status(userID string) Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.users[userID].status(t.now())
+}
+
+// Around returns everyone others see as online or away, in no particular
+// order.
+func (t *Tracker) Around() []string {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ids []string
+	for id, u := range t.users {
+		if u.status(now) != Offline {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// LastSeen returns when userID's last connection ended, if they have been
+// connected since the process started and don't hide their presence.
+func (t *Tracker) LastSeen(userID string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.users[userID]
+	if !ok || u.hidden || u.conns > 0 || u.lastSeen.IsZero() {
+		return time.Time{}, false
+	}
+	return u.lastSeen, true
+}
+
+// Typing records that userID is typing in a conversation, reporting whether
+// to tell the other participants: at most once every TypingEvery for each
+// user and conversation, and never for users who hide their presence.
+func (t *Tracker) Typing(userID, conversationID string) bool {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if u, ok := t.users[userID]; ok && u.hidden {
+		return false
+	}
+	key := typingKey{userID, conversationID}
+	if last, ok := t.typing[key]; ok && now.Sub(last) < TypingEvery {
+		return false
+	}
+	if len(t.typing) >= maxTyping {
+		return false
+	}
+	t.typing[key] = now
+	return true
+}
+
+// Sweep announces idle users as away, and forgets expired typing and people
+// long gone. It should run every minute or so.
+func (t *Tracker) Sweep() {
+	now := t.now()
+	changes := make(map[string]Status)
+	t.mu.Lock()
+	for key, at := range t.typing {
+		if now.Sub(at) >= TypingEvery {
+			delete(t.typing, key)
+		}
+	}
+	for id, u := range t.users {
+		if u.conns == 0 && now.Sub(u.lastSeen) >= forgetAfter {
+			delete(t.users, id)
+			continue
+		}
+		if status, changed := u.changed(now); changed {
+			changes[id] = status
+		}
+	}
+	t.mu.Unlock()
+
+	if t.onChange != nil {
+		for id, status := range changes {
+			t.onChange(id, status)
+		}
+	}
+}
+
+// Run sweeps the tracker every minute, for as long as the process runs.
+func (t *Tracker) Run() {
+	for range time.Tick(time.Minute) {
+		t.Sweep()
+	}
+}
@@ -0,0 +1,183 @@
+package presence
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testTracker returns a Tracker on a clock the test moves by hand, and
+// the status changes it announces.
+func testTracker() (*Tracker, *time.Time, *[]string) {
+	var changes []string
+	t := NewTracker(func(userID string, status Status) {
+		changes = append(changes, userID+" "+string(status))
+	})
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	t.now = func() time.Time { return clock }
+	return t, &clock, &changes
+}
+
+func TestStatus(t *testing.T) {
+	tr, clock, changes := testTracker()
+
+	if got := tr.Status("ana"); got != Offline {
+		t.Errorf("unknown user = %s, want offline", got)
+	}
+	tr.Connect("ana", false)
+	tr.Connect("ana", false)
+	if got := tr.Status("ana"); got != Online {
+		t.Errorf("connected = %s, want online", got)
+	}
+
+	*clock = clock.Add(AwayAfter)
+	if got := tr.Status("ana"); got != Away {
+		t.Errorf("idle for AwayAfter = %s, want away", got)
+	}
+	tr.Sweep()
+	tr.Touch("ana")
+	if got := tr.Status("ana"); got != Online {
+		t.Errorf("after Touch = %s, want online", got)
+	}
+
+	// One of two pages closing leaves them online
+	tr.Disconnect("ana")
+	if got := tr.Status("ana"); got != Online {
+		t.Errorf("with a page still open = %s, want online", got)
+	}
+	if _, ok := tr.LastSeen("ana"); ok {
+		t.Error("LastSeen set while still connected")
+	}
+	*clock = clock.Add(time.Minute)
+	tr.Disconnect("ana")
+	if got := tr.Status("ana"); got != Offline {
+		t.Errorf("all pages closed = %s, want offline", got)
+	}
+	if at, ok := tr.LastSeen("ana"); !ok || !at.Equal(*clock) {
+		t.Errorf("LastSeen = %v, %v; want %v", at, ok, *clock)
+	}
+
+	want := []string{"ana online", "ana away", "ana online", "ana offline"}
+	if !slices.Equal(*changes, want) {
+		t.Errorf("announced %v, want %v", *changes, want)
+	}
+}
+
+func TestHidden(t *testing.T) {
+	tr, clock, changes := testTracker()
+	tr.Connect("ana", true)
+	if got := tr.Status("ana"); got != Offline {
+		t.Errorf("hidden = %s, want offline", got)
+	}
+	if tr.Typing("ana", "d1") {
+		t.Error("hidden user's typing passed on")
+	}
+	*clock = clock.Add(time.Minute)
+	tr.Disconnect("ana")
+	if _, ok := tr.LastSeen("ana"); ok {
+		t.Error("hidden user has a last seen time")
+	}
+	if len(*changes) != 0 {
+		t.Errorf("hidden user announced %v", *changes)
+	}
+
+	tr.Connect("ana", false)
+	tr.SetHidden("ana", true)
+	if got := tr.Status("ana"); got != Offline {
+		t.Errorf("after SetHidden = %s, want offline", got)
+	}
+	if want := []string{"ana online", "ana offline"}; !slices.Equal(*changes, want) {
+		t.Errorf("announced %v, want %v", *changes, want)
+	}
+}
+
+func TestAround(t *testing.T) {
+	tr, clock, _ := testTracker()
+	tr.Connect("ana", false)
+	tr.Connect("ben", false)
+	tr.Connect("cy", true)
+	tr.Connect("dy", false)
+	tr.Disconnect("dy")
+	*clock = clock.Add(AwayAfter)
+	tr.Touch("ben")
+
+	got := tr.Around()
+	slices.Sort(got)
+	if want := []string{"ana", "ben"}; !slices.Equal(got, want) {
+		t.Errorf("Around() = %v, want %v", got, want)
+	}
+}
+
+func TestTypingThrottle(t *testing.T) {
+	tr, clock, _ := testTracker()
+	tests := []struct {
+		after          time.Duration
+		userID, convID string
+		want           bool
+	}{
+		{0, "ana", "d1", true},
+		{time.Second, "ana", "d1", false},
+		{0, "ana", "d2", true},
+		{0, "ben", "d1", true},
+		{TypingEvery - time.Second, "ana", "d1", true},
+		{time.Second, "ana", "d1", false},
+	}
+	for i, tt := range tests {
+		*clock = clock.Add(tt.after)
+		if got := tr.Typing(tt.userID, tt.convID); got != tt.want {
+			t.Errorf("%d: Typing(%s, %s) = %v, want %v", i, tt.userID, tt.convID, got, tt.want)
+		}
+	}
+}
+
+// The typing throttle stops taking entries when full, until a sweep
+// clears the expired ones.
+func TestTypingBound(t *testing.T) {
+	tr, clock, _ := testTracker()
+	for i := 0; i < maxTyping; i++ {
+		tr.typing[typingKey{"user", strconv.Itoa(i)}] = *clock
+	}
+	if tr.Typing("ana", "d1") {
+		t.Error("Typing passed on with the throttle full")
+	}
+	*clock = clock.Add(TypingEvery)
+	tr.Sweep()
+	if len(tr.typing) != 0 {
+		t.Errorf("%d typing entries left after they expired", len(tr.typing))
+	}
+	if !tr.Typing("ana", "d1") {
+		t.Error("Typing dropped after the sweep")
+	}
+}
+
+// Only connected users are tracked, and they are forgotten a day after
+// they leave.
+func TestForget(t *testing.T) {
+	tr, clock, _ := testTracker()
+	tr.Touch("ana")
+	if len(tr.users) != 0 {
+		t.Errorf("Touch tracked a user who never connected")
+	}
+
+	tr.Connect("ana", false)
+	tr.Connect("ben", false)
+	tr.Disconnect("ana")
+	*clock = clock.Add(forgetAfter - time.Second)
+	tr.Sweep()
+	if _, ok := tr.LastSeen("ana"); !ok {
+		t.Error("ana forgotten before forgetAfter")
+	}
+	*clock = clock.Add(time.Second)
+	tr.Sweep()
+	if _, ok := tr.LastSeen("ana"); ok {
+		t.Error("ana still remembered after forgetAfter")
+	}
+	if _, ok := tr.users["ana"]; ok {
+		t.Error("ana still tracked after forgetAfter")
+	}
+	// Connected users are kept however long they stay
+	if _, ok := tr.users["ben"]; !ok {
+		t.Error("ben forgotten while connected")
+	}
+}
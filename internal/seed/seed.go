@@ -0,0 +1,686 @@
+// Package seed loads the prototype's mock fixtures from
+// internal/templates into a Store, so fresh environments show the same demo
+// content the mock-backed pages did.
+package seed
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"circles.diy/internal/auth"
+	"circles.diy/internal/models"
+	"circles.diy/internal/store"
+	"circles.diy/internal/templates"
+)
+
+// DemoUserID is the account the fixtures treat as the signed-in user. It can
+// sign in with DemoEmail and DemoPassword.
+const (
+	DemoUserID   = "maia"
+	DemoEmail    = "maia@example.com"
+	DemoPassword = "circles-demo"
+)
+
+// userAliases folds fixture user IDs that refer to the same person.
+var userAliases = map[string]string{
+	"current_user": DemoUserID,
+	"maya":         "maria",
+}
+
+// circleAliases maps circle names the fixtures use in passing onto the
+// circles they describe in full.
+var circleAliases = map[string]string{
+	"Local Artists": "Sydney Artists",
+}
+
+var profileHandles = []string{"@maia", "@heathtyler", "@sara_pcb", "@zucc"}
+
+type seeder struct {
+	ctx context.Context
+	s   store.Store
+	now time.Time
+
+	users     map[string]models.User
+	userOrder []string
+	circles   map[string]string // name -> ID
+	posts     map[string]string // author + content -> post ID
+}
+
+// Run writes the fixtures into s. Every ID is derived from the fixture it
+// came from, so running it again updates rows in place rather than adding
+// duplicates. Relative times ("2h ago") are anchored to the moment Run is
+// called.
+func Run(ctx context.Context, s store.Store) error {
+	sd := &seeder{
+		ctx:     ctx,
+		s:       s,
+		now:     time.Now().UTC(),
+		users:   make(map[string]models.User),
+		circles: make(map[string]string),
+		posts:   make(map[string]string),
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"users", sd.seedUsers},
+		{"demo account", sd.seedAccount},
+		{"circles", sd.seedCircles},
+		{"profiles", sd.seedProfiles},
+		{"dashboard", sd.seedDashboard},
+		{"marketplace", sd.seedMarketplace},
+		{"events", sd.seedEvents},
+		{"chat", sd.seedChat},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			return fmt.Errorf("failed to seed %s: %v", step.name, err)
+		}
+	}
+	return nil
+}
+
+func canonicalUserID(id string) string {
+	if alias, ok := userAliases[id]; ok {
+		return alias
+	}
+	return id
+}
+
+// addUser records a user seen in the fixtures, filling in any fields an
+// earlier sighting left empty.
+func (sd *seeder) addUser(u models.User) {
+	u.ID = canonicalUserID(u.ID)
+	existing, ok := sd.users[u.ID]
+	if !ok {
+		sd.users[u.ID] = u
+		sd.userOrder = append(sd.userOrder, u.ID)
+		return
+	}
+	for _, f := range []struct{ dst, src *string }{
+		{&existing.Handle, &u.Handle},
+		{&existing.Name, &u.Name},
+		{&existing.Avatar, &u.Avatar},
+		{&existing.Bio, &u.Bio},
+		{&existing.Banner, &u.Banner},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.src
+		}
+	}
+	sd.users[u.ID] = existing
+}
+
+func (sd *seeder) addReplyUsers(replies []models.Reply) {
+	for _, r := range replies {
+		sd.addUser(r.User)
+		sd.addReplyUsers(r.Replies)
+	}
+}
+
+// ref returns the canonical reference for a fixture user.
+func (sd *seeder) ref(u models.User) models.User {
+	return models.User{ID: canonicalUserID(u.ID)}
+}
+
+func (sd *seeder) seedUsers() error {
+	// Full profiles first so their names and avatars win
+	for _, handle := range profileHandles {
+		p := templates.GetMockProfileData(handle, false).Profile
+		sd.addUser(models.User{ID: p.ID, Handle: p.Handle, Name: p.Name, Avatar: p.Avatar, Bio: p.Bio, Banner: p.Banner})
+	}
+
+	dash := templates.GetMockDashboardData()
+	for _, f := range dash.Feed {
+		sd.addUser(f.User)
+		sd.addReplyUsers(f.Replies)
+	}
+	for _, r := range dash.Ripples {
+		sd.addUser(r.User)
+	}
+	for _, handle := range profileHandles {
+		for _, p := range templates.GetMockProfileData(handle, false).Posts {
+			sd.addReplyUsers(p.Replies)
+		}
+	}
+	for _, p := range templates.GetMockProfileInternalData().Posts {
+		sd.addReplyUsers(p.Replies)
+	}
+
+	market := templates.GetMockMarketplaceData()
+	for _, item := range append(market.FeaturedItems, market.Items...) {
+		sd.addUser(item.Seller)
+	}
+
+	for _, e := range gatherEvents(templates.GetMockGatherData()) {
+		sd.addUser(e.Host)
+		for _, a := range e.Announcements {
+			sd.addUser(a.Author)
+		}
+	}
+
+	chat := templates.GetMockChatData()
+	for _, c := range chat.Contacts {
+		sd.addUser(c.User)
+	}
+	for _, c := range chat.Conversations {
+		for _, p := range c.Participants {
+			sd.addUser(p)
+		}
+	}
+	for _, m := range chat.Messages {
+		sd.addUser(m.Sender)
+	}
+	// The Book Club preview quotes a member the fixtures never define
+	sd.addUser(models.User{ID: "lisa", Handle: "@lisa", Name: "Lisa"})
+
+	for _, id := range sd.userOrder {
+		u := sd.users[id]
+		if u.Name == "" {
+			u.Name = nameFromHandle(u.Handle)
+			sd.users[id] = u
+		}
+		if err := sd.s.SaveUser(sd.ctx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sd *seeder) seedAccount() error {
+	hash, err := auth.HashPassword(DemoPassword)
+	if err != nil {
+		return err
+	}
+	return sd.s.SaveAccount(sd.ctx, models.Account{UserID: DemoUserID, Email: DemoEmail, PasswordHash: hash})
+}
+
+// nameFromHandle turns "@wood_enthusiast" into "Wood Enthusiast".
+func nameFromHandle(handle string) string {
+	words := strings.Fields(strings.ReplaceAll(strings.TrimPrefix(handle, "@"), "_", " "))
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+func slug(s string) string {
+	return strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+func (sd *seeder) seedCircles() error {
+	page := templates.GetMockCirclesPageData()
+	save := func(c models.Circle, featured bool) error {
+		c.Featured = featured
+		if c.LastActivity != "" {
+			c.LastActivityAt = ago(sd.now, c.LastActivity)
+		}
+		sd.circles[c.Name] = c.ID
+		return sd.s.SaveCircle(sd.ctx, c)
+	}
+
+	for _, c := range page.Circles {
+		if err := save(c, false); err != nil {
+			return err
+		}
+		if err := sd.s.AddMember(sd.ctx, c.ID, DemoUserID, c.UserRole, ago(sd.now, c.JoinedDate)); err != nil {
+			return err
+		}
+	}
+	for _, c := range page.FeaturedCircles {
+		if err := save(c, true); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range page.RecentActivity {
+		a.CreatedAt = ago(sd.now, a.TimeAgo)
+		if err := sd.s.SaveCircleActivity(sd.ctx, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// circleID resolves a circle the fixtures mention by name, creating a bare
+// circle for names that are only ever mentioned in passing.
+func (sd *seeder) circleID(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	if alias, ok := circleAliases[name]; ok {
+		name = alias
+	}
+	if id, ok := sd.circles[name]; ok {
+		return id, nil
+	}
+	id := slug(name)
+	if err := sd.s.SaveCircle(sd.ctx, models.Circle{ID: id, Name: name}); err != nil {
+		return "", err
+	}
+	sd.circles[name] = id
+	return id, nil
+}
+
+// joinCircle makes userID a member of the named circle unless they already
+// are one, returning the circle ID.
+func (sd *seeder) joinCircle(name, userID string, since time.Time) (string, error) {
+	id, err := sd.circleID(name)
+	if err != nil || id == "" {
+		return id, err
+	}
+	if c, err := sd.s.GetCircle(sd.ctx, id, userID); err == nil && c.UserRole != "" {
+		return id, nil
+	}
+	return id, sd.s.AddMember(sd.ctx, id, userID, "member", since)
+}
+
+func (sd *seeder) seedProfiles() error {
+	internal := templates.GetMockProfileInternalData()
+	if err := sd.seedPosts(DemoUserID, internal.Posts); err != nil {
+		return err
+	}
+	for _, d := range internal.Drafts {
+		d.UpdatedAt = sd.now.Add(-time.Hour)
+		if err := sd.s.SaveDraft(sd.ctx, DemoUserID, d); err != nil {
+			return err
+		}
+	}
+	for _, ext := range internal.Extensions {
+		if err := sd.s.SaveExtension(sd.ctx, DemoUserID, ext); err != nil {
+			return err
+		}
+	}
+	if err := sd.s.SaveAnalytics(sd.ctx, DemoUserID, internal.Analytics); err != nil {
+		return err
+	}
+
+	// The demo user's public profile repeats the internal posts
+	for _, handle := range profileHandles[1:] {
+		data := templates.GetMockProfileData(handle, false)
+		if err := sd.seedPosts(data.Profile.ID, data.Posts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func postKey(authorID, content string) string {
+	return authorID + "\x00" + strings.TrimSpace(content)
+}
+
+func (sd *seeder) seedPosts(authorID string, posts []models.Post) error {
+	for _, p := range posts {
+		p.ID = authorID + "-" + p.ID
+		p.User = models.User{ID: authorID}
+		p.CreatedAt = ago(sd.now, p.TimeAgo)
+
+		var err error
+		if p.CircleID, err = sd.joinCircle(p.Circle, authorID, p.CreatedAt); err != nil {
+			return err
+		}
+		if err := sd.s.SavePost(sd.ctx, p); err != nil {
+			return err
+		}
+		sd.posts[postKey(authorID, p.Content)] = p.ID
+		if err := sd.seedReplies(p.ID, "", p.Replies, p.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedReplies saves a reply tree. Reply IDs are only unique within a post in
+// the fixtures, so they are prefixed with the post ID.
+func (sd *seeder) seedReplies(postID, parentID string, replies []models.Reply, after time.Time) error {
+	for i, r := range replies {
+		r.ID = postID + "-" + r.ID
+		r.User = sd.ref(r.User)
+		r.CreatedAt = ago(sd.now, r.TimeAgo)
+		// Keep children after their parent and siblings in fixture order
+		if !r.CreatedAt.After(after) {
+			r.CreatedAt = after.Add(time.Duration(i+1) * time.Second)
+		}
+		if err := sd.s.SaveReply(sd.ctx, postID, parentID, r); err != nil {
+			return err
+		}
+		if err := sd.seedReplies(postID, r.ID, r.Replies, r.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sd *seeder) seedDashboard() error {
+	dash := templates.GetMockDashboardData()
+
+	// Feed items mostly repeat profile posts; attach their replies to those
+	for _, f := range dash.Feed {
+		authorID := canonicalUserID(f.User.ID)
+		postID, ok := sd.posts[postKey(authorID, f.Content)]
+		createdAt := ago(sd.now, f.TimeAgo)
+		if !ok {
+			postID = "feed-" + f.ID
+			circleID, err := sd.joinCircle(f.Circle, authorID, createdAt)
+			if err != nil {
+				return err
+			}
+			if err := sd.s.SavePost(sd.ctx, models.Post{
+				ID:        postID,
+				User:      models.User{ID: authorID},
+				Content:   f.Content,
+				CircleID:  circleID,
+				Image:     f.Image,
+				Video:     f.Video,
+				Gallery:   f.Gallery,
+				CanBuy:    f.CanBuy,
+				CreatedAt: createdAt,
+			}); err != nil {
+				return err
+			}
+		}
+		if err := sd.seedReplies(postID, "", f.Replies, createdAt); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range dash.Discussions {
+		circleID, err := sd.circleID(d.Circle)
+		if err != nil {
+			return err
+		}
+		d.CircleID = circleID
+		// TimeAgo reads "23 replies • 45m ago"
+		count, rest, _ := strings.Cut(d.TimeAgo, " replies")
+		d.ReplyCount, _ = strconv.Atoi(count)
+		d.UpdatedAt = ago(sd.now, rest)
+		if err := sd.s.SaveDiscussion(sd.ctx, d); err != nil {
+			return err
+		}
+	}
+
+	for i, r := range dash.Ripples {
+		r.User = sd.ref(r.User)
+		r.ExpiresAt = ahead(sd.now, r.ExpiresIn)
+		r.CreatedAt = sd.now.Add(-time.Duration(i+1) * time.Minute)
+		var err error
+		if r.CircleID, err = sd.joinCircle(r.Circle, r.User.ID, r.CreatedAt); err != nil {
+			return err
+		}
+		if err := sd.s.SaveRipple(sd.ctx, r); err != nil {
+			return err
+		}
+	}
+
+	return sd.s.SaveImpact(sd.ctx, DemoUserID, dash.Impact)
+}
+
+func (sd *seeder) seedMarketplace() error {
+	data := templates.GetMockMarketplaceData()
+	for _, item := range append(data.FeaturedItems, data.Items...) {
+		item.Seller = sd.ref(item.Seller)
+		item.CreatedAt = ago(sd.now, item.TimeAgo)
+		var err error
+		if item.CircleID, err = sd.joinCircle(item.Circle, item.Seller.ID, item.CreatedAt); err != nil {
+			return err
+		}
+		if err := sd.s.SaveMarketplaceItem(sd.ctx, item); err != nil {
+			return err
+		}
+	}
+	for i, c := range data.Categories {
+		if err := sd.s.SaveMarketplaceCategory(sd.ctx, c, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gatherEvents(data models.GatherPageData) []models.GatherEvent {
+	var events []models.GatherEvent
+	for _, e := range data.FeaturedEvents {
+		e.IsFeatured = true
+		events = append(events, e)
+	}
+	events = append(events, data.UpcomingEvents...)
+	return append(events, data.MyEvents...)
+}
+
+func (sd *seeder) seedEvents() error {
+	data := templates.GetMockGatherData()
+	for _, e := range gatherEvents(data) {
+		// Fixture event IDs collide between lists; titles do not
+		e.ID = slug(e.Title)
+		e.Host = sd.ref(e.Host)
+		e.StartsAt = eventStart(sd.now, e.DateTime, e.TimeAgo)
+		var err error
+		if e.CircleID, err = sd.joinCircle(e.Circle, e.Host.ID, sd.now); err != nil {
+			return err
+		}
+		if err := sd.s.SaveEvent(sd.ctx, e); err != nil {
+			return err
+		}
+
+		status := e.RSVPStatus
+		if status == "attending" {
+			status = "going"
+		}
+		if status != "" && status != "not_responded" && !e.IsHost {
+			if err := sd.s.SetRSVP(sd.ctx, e.ID, DemoUserID, status); err != nil {
+				return err
+			}
+		}
+
+		for _, a := range e.Announcements {
+			a.ID = e.ID + "-" + a.ID
+			a.Author = sd.ref(a.Author)
+			a.CreatedAt = ago(sd.now, a.TimeAgo)
+			if err := sd.s.SaveAnnouncement(sd.ctx, e.ID, a); err != nil {
+				return err
+			}
+		}
+	}
+	for i, c := range data.EventCategories {
+		if err := sd.s.SaveEventCategory(sd.ctx, c, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sd *seeder) seedChat() error {
+	data := templates.GetMockChatData()
+
+	for _, c := range data.Contacts {
+		c.User = sd.ref(c.User)
+		if err := sd.s.SaveContact(sd.ctx, DemoUserID, c); err != nil {
+			return err
+		}
+		if c.Relationship == "friend" {
+			if err := sd.s.Connect(sd.ctx, DemoUserID, c.ID); err != nil {
+				return err
+			}
+		}
+		if err := sd.s.SetPresence(sd.ctx, c.ID, c.IsOnline, ago(sd.now, c.LastSeen)); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range data.Conversations {
+		participants := sd.conversationParticipants(c)
+		lastAt := ago(sd.now, c.LastTime)
+		c.Participants = participants
+		c.CreatedAt = lastAt.Add(-30 * 24 * time.Hour)
+		if err := sd.s.SaveConversation(sd.ctx, c); err != nil {
+			return err
+		}
+		if c.IsGroup {
+			if err := sd.s.SetParticipantRole(sd.ctx, c.ID, DemoUserID, models.GroupAdmin); err != nil {
+				return err
+			}
+		}
+
+		var messages []models.Message
+		if data.ActiveChat != nil && c.ID == data.ActiveChat.ID {
+			messages = sd.activeMessages(data.Messages, lastAt)
+		} else if m, ok := sd.previewMessage(c, participants, lastAt); ok {
+			messages = append(messages, m)
+		}
+		readThrough := readThrough(messages, c.UnreadCount)
+		for i, m := range messages {
+			if err := sd.s.SaveMessage(sd.ctx, c.ID, m); err != nil {
+				return err
+			}
+			if i == readThrough {
+				if _, err := sd.s.MarkConversationRead(sd.ctx, c.ID, DemoUserID); err != nil {
+					return err
+				}
+			}
+		}
+		// Everyone else has caught up
+		for _, p := range participants[1:] {
+			if _, err := sd.s.MarkConversationRead(sd.ctx, c.ID, p.ID); err != nil {
+				return err
+			}
+		}
+
+		if c.IsOnline {
+			if err := sd.markOneOnline(participants); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// conversationParticipants returns the demo user plus the conversation's
+// other members. Direct conversations only carry the other person's name.
+func (sd *seeder) conversationParticipants(c models.Conversation) []models.User {
+	users := []models.User{{ID: DemoUserID}}
+	for _, p := range c.Participants {
+		users = append(users, sd.ref(p))
+	}
+	if !c.IsGroup {
+		if id, ok := sd.userByName(c.Name); ok {
+			users = append(users, models.User{ID: id})
+		}
+	}
+	if sender, _, ok := strings.Cut(c.LastMessage, ": "); ok && c.IsGroup {
+		if id, ok := sd.userByFirstName(sender); ok && !hasUser(users, id) {
+			users = append(users, models.User{ID: id})
+		}
+	}
+	return users
+}
+
+func hasUser(users []models.User, id string) bool {
+	for _, u := range users {
+		if u.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (sd *seeder) userByName(name string) (string, bool) {
+	for _, id := range sd.userOrder {
+		if sd.users[id].Name == name {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func (sd *seeder) userByFirstName(first string) (string, bool) {
+	for _, id := range sd.userOrder {
+		if fields := strings.Fields(sd.users[id].Name); len(fields) > 0 && fields[0] == first {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// activeMessages spaces the open conversation's messages by their clock
+// times so that the last one lands at lastAt.
+func (sd *seeder) activeMessages(fixture []models.Message, lastAt time.Time) []models.Message {
+	if len(fixture) == 0 {
+		return nil
+	}
+	last := fixture[len(fixture)-1].Timestamp
+	messages := make([]models.Message, len(fixture))
+	for i, m := range fixture {
+		m.Sender = sd.ref(m.Sender)
+		m.CreatedAt = lastAt.Add(-clockOffset(m.Timestamp, last))
+		messages[i] = m
+	}
+	return messages
+}
+
+// previewMessage rebuilds the last message of a conversation the fixtures
+// only show in the sidebar.
+func (sd *seeder) previewMessage(c models.Conversation, participants []models.User, at time.Time) (models.Message, bool) {
+	content := c.LastMessage
+	senderID := ""
+	if sender, text, ok := strings.Cut(c.LastMessage, ": "); ok && c.IsGroup {
+		if id, ok := sd.userByFirstName(sender); ok {
+			senderID, content = id, text
+		}
+	}
+	if senderID == "" && len(participants) > 1 {
+		senderID = participants[1].ID
+	}
+	if senderID == "" {
+		return models.Message{}, false
+	}
+	return models.Message{
+		ID:        c.ID + "-last",
+		Content:   content,
+		Sender:    models.User{ID: senderID},
+		Type:      "text",
+		CreatedAt: at,
+	}, true
+}
+
+// readThrough returns the index of the last message the demo user has
+// read, leaving the newest unread messages from other people unread to
+// match the fixture's unread badge. It is -1 when none have been read.
+// Sending a message reads everything before it, so conversations where the
+// demo user replied show fewer.
+func readThrough(messages []models.Message, unread int) int {
+	i := len(messages) - 1
+	for ; i >= 0 && unread > 0; i-- {
+		if messages[i].Sender.ID != DemoUserID {
+			unread--
+		}
+	}
+	return i
+}
+
+// markOneOnline shows a conversation as online by marking its first other
+// participant online, unless one already is through their contact entry.
+func (sd *seeder) markOneOnline(participants []models.User) error {
+	contacts, err := sd.s.ListContacts(sd.ctx, DemoUserID)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, c := range contacts {
+		known[c.ID] = true
+		if c.IsOnline && hasUser(participants, c.ID) {
+			return nil
+		}
+	}
+	for _, p := range participants[1:] {
+		if !known[p.ID] {
+			return sd.s.SetPresence(sd.ctx, p.ID, true, sd.now)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package seed
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relative parses the mock data's relative times ("2m ago", "3 months ago",
+// "6h left", "in 2 days") into a positive duration. Unparseable strings
+// yield zero.
+func relative(s string) time.Duration {
+	fields := strings.Fields(s)
+	var words []string
+	for _, f := range fields {
+		switch f {
+		case "ago", "left", "in", "•":
+			continue
+		}
+		words = append(words, f)
+	}
+	if len(words) == 0 {
+		return 0
+	}
+
+	// "2m" style keeps the unit attached to the number
+	num, unit := words[0], ""
+	if len(words) > 1 {
+		unit = words[1]
+	}
+	if i := strings.IndexFunc(num, func(r rune) bool { return r < '0' || r > '9' }); i > 0 {
+		num, unit = num[:i], num[i:]
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return 0
+	}
+
+	day := 24 * time.Hour
+	switch strings.TrimSuffix(unit, "s") {
+	case "m", "min", "minute":
+		return time.Duration(n) * time.Minute
+	case "h", "hour":
+		return time.Duration(n) * time.Hour
+	case "d", "day":
+		return time.Duration(n) * day
+	case "w", "week":
+		return time.Duration(n) * 7 * day
+	case "mo", "month":
+		return time.Duration(n) * 30 * day
+	case "y", "year":
+		return time.Duration(n) * 365 * day
+	}
+	return 0
+}
+
+func ago(now time.Time, s string) time.Time {
+	return now.Add(-relative(s))
+}
+
+func ahead(now time.Time, s string) time.Time {
+	return now.Add(relative(s))
+}
+
+// eventStart moves a fixture's start time to the same wall-clock time on the
+// day its relative label ("in 2 days") points at, so seeded events are
+// always upcoming.
+func eventStart(now time.Time, dateTime, label string) time.Time {
+	day := now.Add(relative(label)).UTC()
+	clock, err := time.Parse(time.RFC3339, dateTime)
+	if err != nil {
+		return day
+	}
+	clock = clock.UTC()
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, time.UTC)
+}
+
+// clockOffset returns how long before last the "10:30 AM" style timestamp ts
+// falls.
+func clockOffset(ts, last string) time.Duration {
+	t, err1 := time.Parse("3:04 PM", ts)
+	l, err2 := time.Parse("3:04 PM", last)
+	if err1 != nil || err2 != nil {
+		return 0
+	}
+	return l.Sub(t)
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+)
+
+// Page cursors are opaque to callers: they encode the sort key, a
+// timestamp and an ID, of the last item on the previous page so the next
+// page starts strictly after it, however many rows were added meanwhile.
+
+func encodeCursor(t time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(t.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+// decodeCursor returns the zero time and an empty ID for an empty cursor.
+func decodeCursor(cursor string) (time.Time, string, error) {
+	if cursor == "" {
+		return time.Time{}, "", nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return t.UTC(), id, nil
+}
+
+// keyset returns the SQL condition, and its arguments, selecting rows that
+// sort after the cursor on the timestamp column col and then id, newest
+// first when desc is set. It is empty when the cursor is.
+func keyset(col, id string, desc bool, cursor string) (string, []any, error) {
+	at, afterID, err := decodeCursor(cursor)
+	if err != nil || afterID == "" {
+		return "", nil, err
+	}
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	return `(` + col + ` ` + op + ` ? OR (` + col + ` = ? AND ` + id + ` ` + op + ` ?))`, []any{at, at, afterID}, nil
+}
+
+// sortsAfter reports whether an item with key t, id sorts after the cursor
+// position at, afterID, the in-memory counterpart of keyset.
+func sortsAfter(t time.Time, id string, at time.Time, afterID string, desc bool) bool {
+	if afterID == "" {
+		return true
+	}
+	if !t.Equal(at) {
+		return t.Before(at) == desc
+	}
+	if desc {
+		return id < afterID
+	}
+	return id > afterID
+}
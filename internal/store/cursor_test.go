@@ -0,0 +1,72 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 14, 15, 9, 26, 535897932, time.FixedZone("CET", 3600))
+	for _, id := range []string{"p1", "with|bar", "ünïcode"} {
+		gotAt, gotID, err := decodeCursor(encodeCursor(at, id))
+		if err != nil || !gotAt.Equal(at) || gotID != id {
+			t.Errorf("decodeCursor(encodeCursor(%v, %q)) = %v, %q, %v", at, id, gotAt, gotID, err)
+		}
+	}
+	if gotAt, gotID, err := decodeCursor(""); err != nil || !gotAt.IsZero() || gotID != "" {
+		t.Errorf("decodeCursor(\"\") = %v, %q, %v; want the start", gotAt, gotID, err)
+	}
+}
+
+func TestDecodeCursorRejectsTampering(t *testing.T) {
+	enc := base64.RawURLEncoding.EncodeToString
+	valid := encodeCursor(time.Now(), "p1")
+	tests := map[string]string{
+		"not base64":     "not a cursor!",
+		"padded":         valid + "==",
+		"truncated":      valid[:len(valid)-3],
+		"no separator":   enc([]byte("2026-03-14T15:09:26Z")),
+		"no ID":          enc([]byte("2026-03-14T15:09:26Z|")),
+		"bad time":       enc([]byte("yesterday|p1")),
+		"time and space": enc([]byte(" 2026-03-14T15:09:26Z|p1")),
+	}
+	for name, cursor := range tests {
+		if _, _, err := decodeCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: decodeCursor(%q) error = %v, want ErrInvalidCursor", name, cursor, err)
+		}
+		if _, _, err := keyset("created_at", "id", true, cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: keyset error = %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
+
+func TestSortsAfter(t *testing.T) {
+	at := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	earlier, later := at.Add(-time.Second), at.Add(time.Second)
+	tests := []struct {
+		name string
+		t    time.Time
+		id   string
+		desc bool
+		want bool
+	}{
+		{"newest first, older", earlier, "a", true, true},
+		{"newest first, newer", later, "z", true, false},
+		{"newest first, same time lower ID", at, "m", true, true},
+		{"newest first, same item", at, "p", true, false},
+		{"oldest first, newer", later, "a", false, true},
+		{"oldest first, older", earlier, "z", false, false},
+		{"oldest first, same time higher ID", at, "q", false, true},
+		{"oldest first, same item", at, "p", false, false},
+	}
+	for _, tt := range tests {
+		if got := sortsAfter(tt.t, tt.id, at, "p", tt.desc); got != tt.want {
+			t.Errorf("%s: sortsAfter = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if !sortsAfter(later, "z", time.Time{}, "", true) {
+		t.Error("every item sorts after the empty cursor")
+	}
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"circles.diy/internal/models"
+	"circles.diy/internal/utils"
+)
+
+// The helpers in this file turn stored timestamps and counters into the
+// display fields the templates read, so both Store implementations render
+// identically.
+
+func finishCircle(c *models.Circle, joinedAt time.Time) {
+	c.LastActivity = utils.TimeAgo(c.LastActivityAt)
+	c.JoinedDate = utils.TimeAgoLong(joinedAt)
+	if !c.DeleteAt.IsZero() {
+		c.DeletesIn = utils.TimeLeft(c.DeleteAt)
+	}
+}
+
+func finishInvite(i *models.CircleInvite) {
+	if !i.ExpiresAt.IsZero() {
+		i.ExpiresIn = utils.TimeLeft(i.ExpiresAt)
+	}
+}
+
+// finishCircleStats derives the percentage stats from raw membership
+// counts: growth is this week's joins against the membership a week ago,
+// engagement is the share of members who posted in the last 30 days.
+func finishCircleStats(stats *models.CircleStats, memberships, newMemberships, posters int) {
+	growth := 0
+	if before := memberships - newMemberships; before > 0 {
+		growth = newMemberships * 100 / before
+	}
+	stats.WeeklyGrowth = fmt.Sprintf("+%d%%", growth)
+
+	engagement := 0
+	if stats.ActiveMembers > 0 {
+		engagement = posters * 100 / stats.ActiveMembers
+	}
+	stats.EngagementRate = fmt.Sprintf("%d%%", engagement)
+}
+
+func finishDiscussion(d *models.Discussion) {
+	d.TimeAgo = fmt.Sprintf("%d replies • %s", d.ReplyCount, utils.TimeAgo(d.UpdatedAt))
+}
+
+func finishRipple(r *models.Ripple) {
+	r.ExpiresIn = utils.TimeLeft(r.ExpiresAt)
+}
+
+func finishEvent(e *models.GatherEvent, viewerID, rsvp string) {
+	e.DateTime = e.StartsAt.UTC().Format(time.RFC3339)
+	e.TimeAgo = utils.TimeUntil(e.StartsAt)
+	e.IsHost = viewerID != "" && e.Host.ID == viewerID
+	e.RSVPStatus = rsvp
+	if e.RSVPStatus == "" {
+		e.RSVPStatus = "not_responded"
+	}
+}
+
+func finishMessage(m *models.Message, viewerID string) {
+	m.Timestamp = m.CreatedAt.Local().Format("3:04 PM")
+	m.IsOwn = m.Sender.ID == viewerID
+	// Only the sender sees who has read a message
+	if !m.IsOwn {
+		m.ReadBy = 0
+	}
+	m.IsRead = m.ReadBy > 0
+}
+
+// lastMessagePreview formats the conversation list preview, prefixing the
+// sender's first name in group conversations. System messages already say
+// who did what; attachments sent without a caption are named by kind.
+func lastMessagePreview(c *models.Conversation, last *models.Message) {
+	if last == nil {
+		return
+	}
+	c.LastTime = utils.TimeAgo(last.CreatedAt)
+	c.LastMessage = last.Content
+	if c.LastMessage == "" && last.Media != nil {
+		switch last.Type {
+		case "image":
+			c.LastMessage = "Photo"
+		case "voice":
+			c.LastMessage = "Voice note"
+		default:
+			c.LastMessage = last.Media.Name
+		}
+	}
+	if c.IsGroup && last.Type != "system" && last.Sender.Name != "" {
+		first := strings.Fields(last.Sender.Name)[0]
+		c.LastMessage = first + ": " + c.LastMessage
+	}
+}
+
+func finishReply(r *models.Reply) {
+	r.TimeAgo = utils.TimeAgo(r.CreatedAt)
+	r.Timestamp = r.CreatedAt.UTC().Format(time.RFC3339)
+}
+
+// pageOf trims items fetched with one extra row to limit, returning the
+// cursor for the rest, made from key of the last item kept, when the extra
+// row was there.
+func pageOf[T any](items []T, limit int, key func(T) (time.Time, string)) ([]T, string) {
+	if len(items) <= limit {
+		return items, ""
+	}
+	return items[:limit], encodeCursor(key(items[limit-1]))
+}
+
+func replyKey(r models.Reply) (time.Time, string)          { return r.CreatedAt, r.ID }
+func postKey(p models.Post) (time.Time, string)            { return p.CreatedAt, p.ID }
+func feedKey(f models.FeedItem) (time.Time, string)        { return f.CreatedAt, f.ID }
+func eventKey(e models.GatherEvent) (time.Time, string)    { return e.StartsAt, e.ID }
+func itemKey(i models.MarketplaceItem) (time.Time, string) { return i.CreatedAt, i.ID }
+
+func feedItemFromPost(p models.Post) models.FeedItem {
+	return models.FeedItem{
+		ID:          p.ID,
+		User:        p.User,
+		Content:     p.Content,
+		TimeAgo:     p.TimeAgo,
+		Circle:      p.Circle,
+		CircleID:    p.CircleID,
+		Image:       p.Image,
+		Video:       p.Video,
+		Gallery:     p.Gallery,
+		CanBuy:      p.CanBuy,
+		Replies:     p.Replies,
+		MoreReplies: p.MoreReplies,
+		CreatedAt:   p.CreatedAt,
+		EditedAt:    p.EditedAt,
+	}
+}
+
+// feedSignals records how viewerID relates to a post in their feed, given
+// the circles they're in and the people they're connected with.
+func feedSignals(p models.Post, viewerID string, circles, connections map[string]bool) models.FeedSignals {
+	sig := models.FeedSignals{
+		Own:        p.User.ID == viewerID,
+		InCircle:   p.CircleID != "" && circles[p.CircleID],
+		Connection: connections[p.User.ID],
+	}
+	if p.Stats != nil {
+		sig.Replies = p.Stats.Replies
+	}
+	return sig
+}
+
+// circleVisibility defaults circles saved without a visibility to public.
+func circleVisibility(v string) string {
+	if v == "" {
+		return models.VisibilityPublic
+	}
+	return v
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+func orNow(t time.Time) time.Time {
+	if t.IsZero() {
+		return now()
+	}
+	return t.UTC()
+}
@@ -0,0 +1,2444 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"circles.diy/internal/authz"
+	"circles.diy/internal/models"
+	"circles.diy/internal/utils"
+)
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore is a Store held entirely in process memory. Nothing survives a
+// restart; it mirrors the SQLite behaviour closely enough for local
+// experiments and for exercising handlers without a database file.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	users       map[string]*memUser
+	connections map[string]map[string]bool
+	contacts    map[string][]memContact
+	extensions  map[string][]models.Extension
+	analytics   map[string]models.Analytics
+	impact      map[string][]models.ImpactItem
+
+	accounts    map[string]models.Account
+	sessions    map[string]models.Session
+	loginTokens map[string]*memLoginToken
+	passkeys    map[string]models.Passkey
+
+	circles     map[string]models.Circle
+	members     map[string]map[string]memMember
+	activity    map[string]models.CircleActivity
+	discussions map[string]models.Discussion
+
+	joinRequests map[string]map[string]models.JoinRequest
+	bans         map[string]map[string]models.CircleBan
+	invites      map[string]models.CircleInvite
+
+	posts   map[string]*memPost
+	replies map[string]memReply
+	ripples map[string]models.Ripple
+
+	events          map[string]models.GatherEvent
+	rsvps           map[string]map[string]string
+	announcements   map[string]map[string]models.Announcement
+	eventCategories map[string]memPositioned[models.EventCategory]
+
+	items                 map[string]models.MarketplaceItem
+	marketplaceCategories map[string]memPositioned[models.MarketplaceCategory]
+
+	conversations map[string]*memConversation
+	attachments   map[string]models.Attachment
+	messages      map[string][]models.Message
+	// messageSeq numbers messages in the order they were stored
+	messageSeq map[string]int64
+}
+
+type memUser struct {
+	models.User
+	Online       bool
+	LastSeen     time.Time
+	FeedStrategy string
+	// NoReadReceipts is set when the member turns read receipts off
+	NoReadReceipts bool
+	// HidePresence is set when the member stops sharing their presence
+	HidePresence bool
+}
+
+type memLoginToken struct {
+	models.LoginToken
+	Used bool
+}
+
+type memContact struct {
+	ContactID    string
+	Relationship string
+}
+
+type memMember struct {
+	Role     string
+	JoinedAt time.Time
+}
+
+type memPost struct {
+	models.Post
+	AuthorID  string
+	Status    string
+	UpdatedAt time.Time
+}
+
+type memReply struct {
+	PostID   string
+	ParentID string
+	AuthorID string
+	models.Reply
+}
+
+type memPositioned[T any] struct {
+	Value    T
+	Position int
+}
+
+type memConversation struct {
+	models.Conversation
+	Participants map[string]*memParticipant
+}
+
+type memParticipant struct {
+	Role string
+	// LastRead is the seq of the last message the participant has read
+	LastRead int64
+	// JoinedSeq is the last message sent before they joined. They see only
+	// the messages after it.
+	JoinedSeq int64
+	JoinedAt  time.Time
+}
+
+// newParticipant returns a member joining at now, who sees only what is
+// sent from then on. s.mu must be held.
+func (s *MemoryStore) newParticipant(at time.Time) *memParticipant {
+	seq := int64(len(s.messageSeq))
+	return &memParticipant{Role: models.GroupMember, LastRead: seq, JoinedSeq: seq, JoinedAt: at}
+}
+
+// visible reports whether the participant can see message m.
+func (s *MemoryStore) visible(p *memParticipant, m models.Message) bool {
+	return p != nil && s.messageSeq[m.ID] > p.JoinedSeq
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:                 make(map[string]*memUser),
+		connections:           make(map[string]map[string]bool),
+		contacts:              make(map[string][]memContact),
+		extensions:            make(map[string][]models.Extension),
+		analytics:             make(map[string]models.Analytics),
+		impact:                make(map[string][]models.ImpactItem),
+		accounts:              make(map[string]models.Account),
+		sessions:              make(map[string]models.Session),
+		loginTokens:           make(map[string]*memLoginToken),
+		passkeys:              make(map[string]models.Passkey),
+		circles:               make(map[string]models.Circle),
+		members:               make(map[string]map[string]memMember),
+		activity:              make(map[string]models.CircleActivity),
+		discussions:           make(map[string]models.Discussion),
+		joinRequests:          make(map[string]map[string]models.JoinRequest),
+		bans:                  make(map[string]map[string]models.CircleBan),
+		invites:               make(map[string]models.CircleInvite),
+		posts:                 make(map[string]*memPost),
+		replies:               make(map[string]memReply),
+		ripples:               make(map[string]models.Ripple),
+		events:                make(map[string]models.GatherEvent),
+		rsvps:                 make(map[string]map[string]string),
+		announcements:         make(map[string]map[string]models.Announcement),
+		eventCategories:       make(map[string]memPositioned[models.EventCategory]),
+		items:                 make(map[string]models.MarketplaceItem),
+		marketplaceCategories: make(map[string]memPositioned[models.MarketplaceCategory]),
+		conversations:         make(map[string]*memConversation),
+		attachments:           make(map[string]models.Attachment),
+		messages:              make(map[string][]models.Message),
+		messageSeq:            make(map[string]int64),
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// author returns the stored summary for userID, as the SQLite joins would.
+func (s *MemoryStore) author(userID string) models.User {
+	u, ok := s.users[userID]
+	if !ok {
+		return models.User{ID: userID}
+	}
+	return models.User{ID: u.ID, Handle: u.Handle, Name: u.Name, Avatar: u.Avatar}
+}
+
+func (s *MemoryStore) circleName(circleID string) string {
+	return s.circles[circleID].Name
+}
+
+func paginate[T any](list []T, limit, offset int) []T {
+	if offset >= len(list) {
+		return nil
+	}
+	list = list[offset:]
+	if limit > 0 && limit < len(list) {
+		list = list[:limit]
+	}
+	return list
+}
+
+// Users
+
+func (s *MemoryStore) SaveUser(ctx context.Context, user models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.users[user.ID]; ok {
+		existing.User = user
+		return nil
+	}
+	s.users[user.ID] = &memUser{User: user}
+	return nil
+}
+
+func (s *MemoryStore) GetUser(ctx context.Context, id string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return u.User, nil
+}
+
+func (s *MemoryStore) userByHandle(handle string) *memUser {
+	for _, u := range s.users {
+		if u.Handle == handle {
+			return u
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetUserByHandle(ctx context.Context, handle string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u := s.userByHandle(handle)
+	if u == nil {
+		return models.User{}, ErrNotFound
+	}
+	return u.User, nil
+}
+
+func (s *MemoryStore) GetProfile(ctx context.Context, handle, viewerID string) (models.Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u := s.userByHandle(handle)
+	if u == nil {
+		return models.Profile{}, ErrNotFound
+	}
+
+	p := models.Profile{
+		ID:          u.ID,
+		Handle:      u.Handle,
+		Name:        u.Name,
+		Avatar:      u.Avatar,
+		Banner:      u.Banner,
+		Bio:         u.Bio,
+		IsConnected: s.connections[viewerID][u.ID],
+	}
+	for _, post := range s.posts {
+		if post.AuthorID == u.ID && post.Status == "published" {
+			p.Stats.Posts++
+		}
+	}
+	p.Stats.Connections = len(s.connections[u.ID])
+	for _, members := range s.members {
+		if _, ok := members[u.ID]; ok {
+			p.Stats.Circles++
+		}
+	}
+	return p, nil
+}
+
+func (s *MemoryStore) SetPresence(ctx context.Context, userID string, online bool, lastSeen time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		u.Online = online
+		u.LastSeen = lastSeen.UTC()
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetFeedStrategy(ctx context.Context, userID string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return u.FeedStrategy, nil
+}
+
+func (s *MemoryStore) SetFeedStrategy(ctx context.Context, userID, strategy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.FeedStrategy = strategy
+	return nil
+}
+
+func (s *MemoryStore) GetReadReceipts(ctx context.Context, userID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return false, ErrNotFound
+	}
+	return !u.NoReadReceipts, nil
+}
+
+func (s *MemoryStore) SetReadReceipts(ctx context.Context, userID string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.NoReadReceipts = !enabled
+	return nil
+}
+
+func (s *MemoryStore) GetSharePresence(ctx context.Context, userID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return false, ErrNotFound
+	}
+	return !u.HidePresence, nil
+}
+
+func (s *MemoryStore) SetSharePresence(ctx context.Context, userID string, share bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.HidePresence = !share
+	return nil
+}
+
+func (s *MemoryStore) Connect(ctx context.Context, userID, otherID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pair := range [][2]string{{userID, otherID}, {otherID, userID}} {
+		if s.connections[pair[0]] == nil {
+			s.connections[pair[0]] = make(map[string]bool)
+		}
+		s.connections[pair[0]][pair[1]] = true
+	}
+	return nil
+}
+
+func (s *MemoryStore) SaveContact(ctx context.Context, userID string, contact models.Contact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.contacts[userID]
+	for i := range list {
+		if list[i].ContactID == contact.ID {
+			list[i].Relationship = contact.Relationship
+			return nil
+		}
+	}
+	s.contacts[userID] = append(list, memContact{ContactID: contact.ID, Relationship: contact.Relationship})
+	return nil
+}
+
+func (s *MemoryStore) ListContacts(ctx context.Context, userID string) ([]models.Contact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var contacts []models.Contact
+	for _, rec := range s.contacts[userID] {
+		u, ok := s.users[rec.ContactID]
+		if !ok {
+			continue
+		}
+		c := models.Contact{User: u.User, IsOnline: u.Online && !u.HidePresence, Relationship: rec.Relationship}
+		if !u.Online && !u.HidePresence && !u.LastSeen.IsZero() {
+			c.LastSeen = utils.TimeAgo(u.LastSeen)
+		}
+		contacts = append(contacts, c)
+	}
+	sort.SliceStable(contacts, func(i, j int) bool {
+		if contacts[i].IsOnline != contacts[j].IsOnline {
+			return contacts[i].IsOnline
+		}
+		return contacts[i].Name < contacts[j].Name
+	})
+	return contacts, nil
+}
+
+func (s *MemoryStore) SaveExtension(ctx context.Context, userID string, ext models.Extension) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.extensions[userID]
+	for i := range list {
+		if list[i].ID == ext.ID {
+			list[i] = ext
+			return nil
+		}
+	}
+	s.extensions[userID] = append(list, ext)
+	return nil
+}
+
+func (s *MemoryStore) ListExtensions(ctx context.Context, userID string) ([]models.Extension, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]models.Extension(nil), s.extensions[userID]...), nil
+}
+
+func (s *MemoryStore) SaveAnalytics(ctx context.Context, userID string, analytics models.Analytics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.analytics[userID] = analytics
+	return nil
+}
+
+func (s *MemoryStore) GetAnalytics(ctx context.Context, userID string) (models.Analytics, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.analytics[userID], nil
+}
+
+func (s *MemoryStore) SaveImpact(ctx context.Context, userID string, items []models.ImpactItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.impact[userID] = append([]models.ImpactItem(nil), items...)
+	return nil
+}
+
+func (s *MemoryStore) ListImpact(ctx context.Context, userID string) ([]models.ImpactItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]models.ImpactItem(nil), s.impact[userID]...), nil
+}
+
+// Accounts
+
+func (s *MemoryStore) accountByEmail(email string) (models.Account, bool) {
+	for _, a := range s.accounts {
+		if strings.EqualFold(a.Email, email) {
+			return a, true
+		}
+	}
+	return models.Account{}, false
+}
+
+func (s *MemoryStore) CreateAccount(ctx context.Context, user models.User, account models.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.userByHandle(user.Handle) != nil {
+		return ErrHandleTaken
+	}
+	if _, taken := s.accountByEmail(account.Email); taken {
+		return ErrEmailTaken
+	}
+	s.users[user.ID] = &memUser{User: user}
+	account.UserID = user.ID
+	account.CreatedAt = orNow(account.CreatedAt)
+	s.accounts[user.ID] = account
+	return nil
+}
+
+func (s *MemoryStore) SaveAccount(ctx context.Context, account models.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[account.UserID]; !ok {
+		return ErrNotFound
+	}
+	if other, taken := s.accountByEmail(account.Email); taken && other.UserID != account.UserID {
+		return ErrEmailTaken
+	}
+	if existing, ok := s.accounts[account.UserID]; ok {
+		account.CreatedAt = existing.CreatedAt
+	}
+	account.CreatedAt = orNow(account.CreatedAt)
+	s.accounts[account.UserID] = account
+	return nil
+}
+
+func (s *MemoryStore) GetAccount(ctx context.Context, userID string) (models.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.accounts[userID]
+	if !ok {
+		return models.Account{}, ErrNotFound
+	}
+	return a, nil
+}
+
+func (s *MemoryStore) GetAccountByEmail(ctx context.Context, email string) (models.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.accountByEmail(email)
+	if !ok {
+		return models.Account{}, ErrNotFound
+	}
+	return a, nil
+}
+
+func (s *MemoryStore) CreateSession(ctx context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := now()
+	for id, other := range s.sessions {
+		if other.UserID == session.UserID && !other.ExpiresAt.After(t) {
+			delete(s.sessions, id)
+		}
+	}
+	session.CreatedAt = orNow(session.CreatedAt)
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *MemoryStore) GetSession(ctx context.Context, id string) (models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[id]
+	if !ok || !session.ExpiresAt.After(now()) {
+		return models.Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (s *MemoryStore) ExtendSession(ctx context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[id]; ok {
+		session.ExpiresAt = expiresAt
+		s.sessions[id] = session
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *MemoryStore) CreateLoginToken(ctx context.Context, token models.LoginToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := now()
+	for id, other := range s.loginTokens {
+		if other.UserID == token.UserID && (other.Used || !other.ExpiresAt.After(t)) {
+			delete(s.loginTokens, id)
+		}
+	}
+	token.CreatedAt = orNow(token.CreatedAt)
+	s.loginTokens[token.ID] = &memLoginToken{LoginToken: token}
+	return nil
+}
+
+func (s *MemoryStore) ConsumeLoginToken(ctx context.Context, id string) (models.LoginToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.loginTokens[id]
+	if !ok || token.Used || !token.ExpiresAt.After(now()) {
+		return models.LoginToken{}, ErrNotFound
+	}
+	for _, other := range s.loginTokens {
+		if other.UserID == token.UserID {
+			other.Used = true
+		}
+	}
+	return token.LoginToken, nil
+}
+
+// Passkeys
+
+func (s *MemoryStore) SavePasskey(ctx context.Context, passkey models.Passkey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.passkeys[passkey.ID]; exists {
+		return fmt.Errorf("passkey %s already registered", passkey.ID)
+	}
+	passkey.CreatedAt = orNow(passkey.CreatedAt)
+	s.passkeys[passkey.ID] = passkey
+	return nil
+}
+
+func (s *MemoryStore) GetPasskey(ctx context.Context, id string) (models.Passkey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.passkeys[id]
+	if !ok {
+		return models.Passkey{}, ErrNotFound
+	}
+	return p, nil
+}
+
+func (s *MemoryStore) ListPasskeys(ctx context.Context, userID string) ([]models.Passkey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []models.Passkey
+	for _, p := range s.passkeys {
+		if p.UserID == userID {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+func (s *MemoryStore) RenamePasskey(ctx context.Context, userID, id, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.passkeys[id]
+	if !ok || p.UserID != userID {
+		return ErrNotFound
+	}
+	p.Name = name
+	s.passkeys[id] = p
+	return nil
+}
+
+func (s *MemoryStore) DeletePasskey(ctx context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.passkeys[id]; !ok || p.UserID != userID {
+		return ErrNotFound
+	}
+	delete(s.passkeys, id)
+	return nil
+}
+
+func (s *MemoryStore) UpdatePasskeyUsage(ctx context.Context, id string, signCount uint32, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.passkeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	p.SignCount = signCount
+	p.LastUsedAt = usedAt
+	s.passkeys[id] = p
+	return nil
+}
+
+// Circles
+
+func (s *MemoryStore) SaveCircle(ctx context.Context, circle models.Circle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	circle.UserRole, circle.JoinedDate, circle.LastActivity = "", "", ""
+	circle.Visibility = circleVisibility(circle.Visibility)
+	circle.CreatedAt = orNow(circle.CreatedAt)
+	s.circles[circle.ID] = circle
+	return nil
+}
+
+// viewCircle returns the circle as seen by viewerID.
+func (s *MemoryStore) viewCircle(c models.Circle, viewerID string) models.Circle {
+	var joinedAt time.Time
+	if m, ok := s.members[c.ID][viewerID]; ok {
+		c.UserRole = m.Role
+		joinedAt = m.JoinedAt
+	}
+	s.countMembers(&c)
+	finishCircle(&c, joinedAt)
+	return c
+}
+
+// countMembers fills in the member count the SQLite queries compute.
+func (s *MemoryStore) countMembers(c *models.Circle) {
+	c.MemberCount = len(s.members[c.ID])
+}
+
+func (s *MemoryStore) GetCircle(ctx context.Context, id, viewerID string) (models.Circle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.circles[id]
+	if !ok {
+		return models.Circle{}, ErrNotFound
+	}
+	return s.viewCircle(c, viewerID), nil
+}
+
+func (s *MemoryStore) CreateCircle(ctx context.Context, circle models.Circle, ownerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.circles[circle.ID]; ok {
+		return fmt.Errorf("circle %s already exists", circle.ID)
+	}
+	circle.UserRole, circle.JoinedDate, circle.LastActivity = "", "", ""
+	circle.Visibility = circleVisibility(circle.Visibility)
+	circle.CreatedAt = orNow(circle.CreatedAt)
+	circle.LastActivityAt = circle.CreatedAt
+	s.circles[circle.ID] = circle
+	s.members[circle.ID] = map[string]memMember{
+		ownerID: {Role: string(authz.RoleOwner), JoinedAt: circle.CreatedAt},
+	}
+	return nil
+}
+
+func (s *MemoryStore) UpdateCircleSettings(ctx context.Context, circle models.Circle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.circles[circle.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	c.Name, c.Description = circle.Name, circle.Description
+	c.Thumbnail, c.Banner = circle.Thumbnail, circle.Banner
+	c.Visibility = circleVisibility(circle.Visibility)
+	s.circles[circle.ID] = c
+	return nil
+}
+
+func (s *MemoryStore) TransferOwnership(ctx context.Context, circleID, fromID, toID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	from, ok := s.members[circleID][fromID]
+	if !ok || from.Role != string(authz.RoleOwner) {
+		return ErrNotFound
+	}
+	to, ok := s.members[circleID][toID]
+	if !ok || toID == fromID {
+		return ErrNotFound
+	}
+	from.Role, to.Role = string(authz.RoleAdmin), string(authz.RoleOwner)
+	s.members[circleID][fromID] = from
+	s.members[circleID][toID] = to
+	return nil
+}
+
+func (s *MemoryStore) ArchiveCircle(ctx context.Context, circleID string, at, deleteAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.circles[circleID]
+	if !ok {
+		return ErrNotFound
+	}
+	if c.ArchivedAt.IsZero() {
+		c.ArchivedAt = orNow(at)
+	}
+	c.DeleteAt = deleteAt
+	s.circles[circleID] = c
+	return nil
+}
+
+func (s *MemoryStore) RestoreCircle(ctx context.Context, circleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.circles[circleID]
+	if !ok {
+		return ErrNotFound
+	}
+	c.ArchivedAt, c.DeleteAt = time.Time{}, time.Time{}
+	s.circles[circleID] = c
+	return nil
+}
+
+// PurgeCircles mirrors the SQLite cascades: memberships, activity and
+// discussions go with the circle, posts are deleted and other content is
+// detached from it.
+func (s *MemoryStore) PurgeCircles(ctx context.Context, cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, c := range s.circles {
+		if c.DeleteAt.IsZero() || c.DeleteAt.After(cutoff) {
+			continue
+		}
+		delete(s.circles, id)
+		delete(s.members, id)
+		delete(s.joinRequests, id)
+		delete(s.bans, id)
+		for code, invite := range s.invites {
+			if invite.CircleID == id {
+				delete(s.invites, code)
+			}
+		}
+		for key, a := range s.activity {
+			if a.CircleID == id {
+				delete(s.activity, key)
+			}
+		}
+		for key, d := range s.discussions {
+			if d.CircleID == id {
+				delete(s.discussions, key)
+			}
+		}
+		for postID, p := range s.posts {
+			if p.CircleID != id {
+				continue
+			}
+			delete(s.posts, postID)
+			for replyID, r := range s.replies {
+				if r.PostID == postID {
+					delete(s.replies, replyID)
+				}
+			}
+		}
+		for key, r := range s.ripples {
+			if r.CircleID == id {
+				r.CircleID = ""
+				s.ripples[key] = r
+			}
+		}
+		for key, e := range s.events {
+			if e.CircleID == id {
+				e.CircleID = ""
+				s.events[key] = e
+			}
+		}
+		for key, item := range s.items {
+			if item.CircleID == id {
+				item.CircleID = ""
+				s.items[key] = item
+			}
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *MemoryStore) AddMember(ctx context.Context, circleID, userID, role string, joinedAt time.Time) error {
+	if _, ok := authz.ParseRole(role); !ok {
+		return ErrInvalidRole
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkOwner(circleID, userID, role); err != nil {
+		return err
+	}
+	if s.members[circleID] == nil {
+		s.members[circleID] = make(map[string]memMember)
+	}
+	if existing, ok := s.members[circleID][userID]; ok {
+		existing.Role = role
+		s.members[circleID][userID] = existing
+		return nil
+	}
+	s.members[circleID][userID] = memMember{Role: role, JoinedAt: orNow(joinedAt)}
+	return nil
+}
+
+// checkOwner enforces one owner per circle, like the SQLite unique index.
+func (s *MemoryStore) checkOwner(circleID, userID, role string) error {
+	if role != string(authz.RoleOwner) {
+		return nil
+	}
+	for id, m := range s.members[circleID] {
+		if id != userID && m.Role == role {
+			return fmt.Errorf("circle %s already has an owner", circleID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetMemberRole(ctx context.Context, circleID, userID string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.members[circleID][userID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return m.Role, nil
+}
+
+func (s *MemoryStore) SetMemberRole(ctx context.Context, circleID, userID, role string) error {
+	if _, ok := authz.ParseRole(role); !ok {
+		return ErrInvalidRole
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.members[circleID][userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := s.checkOwner(circleID, userID, role); err != nil {
+		return err
+	}
+	m.Role = role
+	s.members[circleID][userID] = m
+	return nil
+}
+
+func (s *MemoryStore) CountMembersAmong(ctx context.Context, circleIDs, userIDs []string) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, circleID := range circleIDs {
+		for _, userID := range userIDs {
+			if _, ok := s.members[circleID][userID]; ok {
+				counts[circleID]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) ListMembers(ctx context.Context, circleID string) ([]models.CircleMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var members []models.CircleMember
+	for userID, m := range s.members[circleID] {
+		user := models.User{ID: userID}
+		if u, ok := s.users[userID]; ok {
+			user = u.User
+		}
+		members = append(members, models.CircleMember{
+			User:       user,
+			Role:       m.Role,
+			JoinedAt:   m.JoinedAt,
+			JoinedDate: utils.TimeAgoLong(m.JoinedAt),
+		})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		ri, rj := authz.Role(members[i].Role).Rank(), authz.Role(members[j].Role).Rank()
+		if ri != rj {
+			return ri > rj
+		}
+		if !members[i].JoinedAt.Equal(members[j].JoinedAt) {
+			return members[i].JoinedAt.Before(members[j].JoinedAt)
+		}
+		return members[i].User.Handle < members[j].User.Handle
+	})
+	return members, nil
+}
+
+func (s *MemoryStore) isMember(circleID, userID string) bool {
+	_, ok := s.members[circleID][userID]
+	return ok
+}
+
+func (s *MemoryStore) ListCirclesForUser(ctx context.Context, userID string) ([]models.Circle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var circles []models.Circle
+	for id, c := range s.circles {
+		if s.isMember(id, userID) {
+			circles = append(circles, s.viewCircle(c, userID))
+		}
+	}
+	sort.Slice(circles, func(i, j int) bool {
+		if !circles[i].LastActivityAt.Equal(circles[j].LastActivityAt) {
+			return circles[i].LastActivityAt.After(circles[j].LastActivityAt)
+		}
+		return circles[i].Name < circles[j].Name
+	})
+	return circles, nil
+}
+
+func (s *MemoryStore) ListFeaturedCircles(ctx context.Context, viewerID string, limit int) ([]models.Circle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var circles []models.Circle
+	for id, c := range s.circles {
+		if c.Featured && c.Visibility == models.VisibilityPublic && !c.Archived() && !s.isMember(id, viewerID) {
+			s.countMembers(&c)
+			finishCircle(&c, time.Time{})
+			circles = append(circles, c)
+		}
+	}
+	sort.Slice(circles, func(i, j int) bool { return circles[i].Name < circles[j].Name })
+	return paginate(circles, limit, 0), nil
+}
+
+func (s *MemoryStore) GetCircleStats(ctx context.Context, userID string) (models.CircleStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	weekAgo := now().AddDate(0, 0, -7)
+	monthAgo := now().AddDate(0, 0, -30)
+
+	var stats models.CircleStats
+	var memberships, newMemberships int
+	coMembers := make(map[string]bool)
+	for _, members := range s.members {
+		if _, ok := members[userID]; !ok {
+			continue
+		}
+		for id, m := range members {
+			coMembers[id] = true
+			memberships++
+			if m.JoinedAt.After(weekAgo) {
+				newMemberships++
+			}
+		}
+	}
+	stats.ActiveMembers = len(coMembers)
+
+	posters := make(map[string]bool)
+	for _, p := range s.posts {
+		if p.Status != "published" || p.CircleID == "" || !s.isMember(p.CircleID, userID) {
+			continue
+		}
+		stats.TotalPosts++
+		if p.CreatedAt.After(monthAgo) {
+			posters[p.AuthorID] = true
+		}
+	}
+
+	finishCircleStats(&stats, memberships, newMemberships, len(posters))
+	return stats, nil
+}
+
+func (s *MemoryStore) SaveCircleActivity(ctx context.Context, activity models.CircleActivity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity.CreatedAt = orNow(activity.CreatedAt)
+	s.activity[activity.ID] = activity
+	return nil
+}
+
+func (s *MemoryStore) ListCircleActivity(ctx context.Context, userID string, limit int) ([]models.CircleActivity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var activity []models.CircleActivity
+	for _, a := range s.activity {
+		if s.isMember(a.CircleID, userID) {
+			a.TimeAgo = utils.TimeAgo(a.CreatedAt)
+			activity = append(activity, a)
+		}
+	}
+	sort.Slice(activity, func(i, j int) bool { return activity[i].CreatedAt.After(activity[j].CreatedAt) })
+	return paginate(activity, limit, 0), nil
+}
+
+func (s *MemoryStore) SaveDiscussion(ctx context.Context, discussion models.Discussion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	discussion.UpdatedAt = orNow(discussion.UpdatedAt)
+	s.discussions[discussion.ID] = discussion
+	return nil
+}
+
+func (s *MemoryStore) ListDiscussions(ctx context.Context, userID string, limit int) ([]models.Discussion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var discussions []models.Discussion
+	for _, d := range s.discussions {
+		if s.isMember(d.CircleID, userID) {
+			d.Circle = s.circleName(d.CircleID)
+			finishDiscussion(&d)
+			discussions = append(discussions, d)
+		}
+	}
+	sort.Slice(discussions, func(i, j int) bool { return discussions[i].UpdatedAt.After(discussions[j].UpdatedAt) })
+	return paginate(discussions, limit, 0), nil
+}
+
+// Membership
+
+func (s *MemoryStore) fullUser(userID string) models.User {
+	if u, ok := s.users[userID]; ok {
+		return u.User
+	}
+	return models.User{ID: userID}
+}
+
+// join adds a plain membership; callers hold the write lock.
+func (s *MemoryStore) join(circleID, userID string, at time.Time) error {
+	if _, banned := s.bans[circleID][userID]; banned {
+		return ErrBanned
+	}
+	if s.members[circleID] == nil {
+		s.members[circleID] = make(map[string]memMember)
+	}
+	if _, ok := s.members[circleID][userID]; !ok {
+		s.members[circleID][userID] = memMember{Role: string(authz.RoleMember), JoinedAt: orNow(at)}
+	}
+	delete(s.joinRequests[circleID], userID)
+	return nil
+}
+
+func (s *MemoryStore) JoinCircle(ctx context.Context, circleID, userID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.join(circleID, userID, at)
+}
+
+func (s *MemoryStore) RemoveMember(ctx context.Context, circleID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.members[circleID][userID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.members[circleID], userID)
+	return nil
+}
+
+func (s *MemoryStore) BanMember(ctx context.Context, circleID, userID, bannedBy, reason string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.members[circleID], userID)
+	delete(s.joinRequests[circleID], userID)
+	if s.bans[circleID] == nil {
+		s.bans[circleID] = make(map[string]models.CircleBan)
+	}
+	ban, ok := s.bans[circleID][userID]
+	if !ok {
+		ban.CreatedAt = orNow(at)
+	}
+	ban.BannedBy, ban.Reason = bannedBy, reason
+	s.bans[circleID][userID] = ban
+	return nil
+}
+
+func (s *MemoryStore) UnbanMember(ctx context.Context, circleID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bans[circleID][userID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.bans[circleID], userID)
+	return nil
+}
+
+func (s *MemoryStore) IsBanned(ctx context.Context, circleID, userID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, banned := s.bans[circleID][userID]
+	return banned, nil
+}
+
+func (s *MemoryStore) ListBans(ctx context.Context, circleID string) ([]models.CircleBan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var bans []models.CircleBan
+	for userID, b := range s.bans[circleID] {
+		b.User = s.fullUser(userID)
+		b.BannedDate = utils.TimeAgoLong(b.CreatedAt)
+		bans = append(bans, b)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].CreatedAt.After(bans[j].CreatedAt) })
+	return bans, nil
+}
+
+func (s *MemoryStore) RequestToJoin(ctx context.Context, circleID, userID, message string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, banned := s.bans[circleID][userID]; banned {
+		return ErrBanned
+	}
+	if s.joinRequests[circleID] == nil {
+		s.joinRequests[circleID] = make(map[string]models.JoinRequest)
+	}
+	jr, ok := s.joinRequests[circleID][userID]
+	if !ok {
+		jr.CreatedAt = orNow(at)
+	}
+	jr.Message = message
+	s.joinRequests[circleID][userID] = jr
+	return nil
+}
+
+func (s *MemoryStore) HasJoinRequest(ctx context.Context, circleID, userID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, pending := s.joinRequests[circleID][userID]
+	return pending, nil
+}
+
+func (s *MemoryStore) ApproveJoinRequest(ctx context.Context, circleID, userID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.joinRequests[circleID][userID]; !ok {
+		return ErrNotFound
+	}
+	return s.join(circleID, userID, at)
+}
+
+func (s *MemoryStore) DeleteJoinRequest(ctx context.Context, circleID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.joinRequests[circleID][userID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.joinRequests[circleID], userID)
+	return nil
+}
+
+func (s *MemoryStore) ListJoinRequests(ctx context.Context, circleID string) ([]models.JoinRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var requests []models.JoinRequest
+	for userID, jr := range s.joinRequests[circleID] {
+		jr.User = s.fullUser(userID)
+		jr.RequestedDate = utils.TimeAgo(jr.CreatedAt)
+		requests = append(requests, jr)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].CreatedAt.Equal(requests[j].CreatedAt) {
+			return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+		}
+		return requests[i].User.Handle < requests[j].User.Handle
+	})
+	return requests, nil
+}
+
+func (s *MemoryStore) CreateInvite(ctx context.Context, invite models.CircleInvite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.invites[invite.Code]; ok {
+		return fmt.Errorf("invite %s already exists", invite.Code)
+	}
+	invite.Uses, invite.RevokedAt = 0, time.Time{}
+	invite.CreatedAt = orNow(invite.CreatedAt)
+	s.invites[invite.Code] = invite
+	return nil
+}
+
+func (s *MemoryStore) GetInvite(ctx context.Context, code string) (models.CircleInvite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	invite, ok := s.invites[code]
+	if !ok {
+		return models.CircleInvite{}, ErrNotFound
+	}
+	finishInvite(&invite)
+	return invite, nil
+}
+
+func (s *MemoryStore) ListInvites(ctx context.Context, circleID string) ([]models.CircleInvite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var invites []models.CircleInvite
+	for _, invite := range s.invites {
+		if invite.CircleID == circleID && invite.RevokedAt.IsZero() {
+			finishInvite(&invite)
+			invites = append(invites, invite)
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool { return invites[i].CreatedAt.After(invites[j].CreatedAt) })
+	return invites, nil
+}
+
+func (s *MemoryStore) RevokeInvite(ctx context.Context, circleID, code string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invite, ok := s.invites[code]
+	if !ok || invite.CircleID != circleID || !invite.RevokedAt.IsZero() {
+		return ErrNotFound
+	}
+	invite.RevokedAt = orNow(at)
+	s.invites[code] = invite
+	return nil
+}
+
+func (s *MemoryStore) RedeemInvite(ctx context.Context, code, userID string, at time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invite, ok := s.invites[code]
+	if !ok {
+		return "", ErrNotFound
+	}
+	if s.isMember(invite.CircleID, userID) {
+		return invite.CircleID, nil
+	}
+	if !invite.Usable(orNow(at)) {
+		return invite.CircleID, ErrInviteUnusable
+	}
+	if err := s.join(invite.CircleID, userID, at); err != nil {
+		return invite.CircleID, err
+	}
+	invite.Uses++
+	s.invites[code] = invite
+	return invite.CircleID, nil
+}
+
+// Posts
+
+func (s *MemoryStore) SavePost(ctx context.Context, post models.Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	post.CreatedAt = orNow(post.CreatedAt)
+	if post.Stats != nil {
+		stats := *post.Stats
+		post.Stats = &stats
+	}
+	post.Replies, post.MoreReplies = nil, ""
+	if post.Stats == nil {
+		post.Stats = &models.PostStats{}
+	}
+	// Reply counts are kept by SaveReply
+	post.Stats.Replies = 0
+	rec := &memPost{Post: post, AuthorID: post.User.ID, Status: "published", UpdatedAt: post.CreatedAt}
+	if existing, ok := s.posts[post.ID]; ok {
+		rec.Post.CreatedAt = existing.CreatedAt
+		if existing.Stats != nil {
+			rec.Stats.Replies = existing.Stats.Replies
+		}
+	}
+	s.posts[post.ID] = rec
+	return nil
+}
+
+// viewPost copies a stored post and fills in the joined and display fields.
+func (s *MemoryStore) viewPost(rec *memPost) models.Post {
+	p := rec.Post
+	p.User = s.author(rec.AuthorID)
+	p.Circle = s.circleName(p.CircleID)
+	p.TimeAgo = utils.TimeAgo(p.CreatedAt)
+	stats := models.PostStats{}
+	if rec.Stats != nil {
+		stats = *rec.Stats
+	}
+	p.Stats = &stats
+	return p
+}
+
+// replyPage returns the replies under parentID, or postID's top-level
+// replies, after the cursor position, with depth levels below each.
+func (s *MemoryStore) replyPage(postID, parentID string, depth, limit int, afterAt time.Time, afterID string) ([]models.Reply, string) {
+	var replies []models.Reply
+	for _, r := range s.replies {
+		if r.PostID != postID || r.ParentID != parentID {
+			continue
+		}
+		if !sortsAfter(r.CreatedAt, r.ID, afterAt, afterID, false) {
+			continue
+		}
+		reply := r.Reply
+		reply.PostID, reply.ParentID = r.PostID, r.ParentID
+		reply.User = s.author(r.AuthorID)
+		finishReply(&reply)
+		replies = append(replies, reply)
+	}
+	sort.Slice(replies, func(i, j int) bool {
+		if !replies[i].CreatedAt.Equal(replies[j].CreatedAt) {
+			return replies[i].CreatedAt.Before(replies[j].CreatedAt)
+		}
+		return replies[i].ID < replies[j].ID
+	})
+	if len(replies) > limit+1 {
+		replies = replies[:limit+1]
+	}
+	replies, next := pageOf(replies, limit, replyKey)
+	if depth > 0 {
+		for i := range replies {
+			replies[i].Replies, replies[i].MoreReplies = s.replyPage(postID, replies[i].ID, depth-1, limit, time.Time{}, "")
+		}
+	}
+	return replies, next
+}
+
+func (s *MemoryStore) attachReplies(posts []models.Post) {
+	for i := range posts {
+		posts[i].Replies, posts[i].MoreReplies = s.replyPage(posts[i].ID, "", previewReplyDepth, previewReplies, time.Time{}, "")
+	}
+}
+
+func (s *MemoryStore) GetPost(ctx context.Context, id string) (models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.posts[id]
+	if !ok || rec.Status != "published" {
+		return models.Post{}, ErrNotFound
+	}
+	posts := []models.Post{s.viewPost(rec)}
+	s.attachReplies(posts)
+	return posts[0], nil
+}
+
+func (s *MemoryStore) EditPost(ctx context.Context, post models.Post, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.posts[post.ID]
+	if !ok || rec.Status != "published" {
+		return ErrNotFound
+	}
+	rec.Content = post.Content
+	rec.Image = post.Image
+	rec.Video = post.Video
+	rec.Gallery = post.Gallery
+	rec.EditedAt = orNow(at)
+	rec.UpdatedAt = rec.EditedAt
+	return nil
+}
+
+func (s *MemoryStore) DeletePost(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.posts[id]
+	if !ok || rec.Status != "published" {
+		return ErrNotFound
+	}
+	rec.Status = "deleted"
+	rec.UpdatedAt = orNow(at)
+	return nil
+}
+
+// listPosts returns a page of published posts matching keep, newest
+// first, after the cursor.
+func (s *MemoryStore) listPosts(keep func(*memPost) bool, limit int, after string) ([]models.Post, string, error) {
+	afterAt, afterID, err := decodeCursor(after)
+	if err != nil {
+		return nil, "", err
+	}
+	var recs []*memPost
+	for _, rec := range s.posts {
+		if rec.Status == "published" && keep(rec) && sortsAfter(rec.CreatedAt, rec.ID, afterAt, afterID, true) {
+			recs = append(recs, rec)
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		if !recs[i].CreatedAt.Equal(recs[j].CreatedAt) {
+			return recs[i].CreatedAt.After(recs[j].CreatedAt)
+		}
+		return recs[i].ID > recs[j].ID
+	})
+	recs = paginate(recs, limit+1, 0)
+
+	posts := make([]models.Post, len(recs))
+	for i, rec := range recs {
+		posts[i] = s.viewPost(rec)
+	}
+	posts, next := pageOf(posts, limit, postKey)
+	s.attachReplies(posts)
+	return posts, next, nil
+}
+
+func (s *MemoryStore) ListPostsByAuthor(ctx context.Context, authorID string, limit int, after string) ([]models.Post, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listPosts(func(p *memPost) bool { return p.AuthorID == authorID }, limit, after)
+}
+
+func (s *MemoryStore) ListFeed(ctx context.Context, userID string, q FeedQuery) ([]models.FeedItem, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	circles := make(map[string]bool)
+	for circleID := range s.circles {
+		if s.isMember(circleID, userID) {
+			circles[circleID] = true
+		}
+	}
+	connections := s.connections[userID]
+	posts, next, err := s.listPosts(func(p *memPost) bool {
+		if !q.Until.IsZero() && p.CreatedAt.After(q.Until) {
+			return false
+		}
+		inCircle := p.CircleID != "" && circles[p.CircleID]
+		return (q.Own && p.AuthorID == userID) ||
+			(q.Circles && inCircle) ||
+			(q.Connections && connections[p.AuthorID] && (p.CircleID == "" || inCircle))
+	}, q.Limit, q.After)
+	if err != nil {
+		return nil, "", err
+	}
+
+	feed := make([]models.FeedItem, len(posts))
+	for i, p := range posts {
+		feed[i] = feedItemFromPost(p)
+		feed[i].Signals = feedSignals(p, userID, circles, connections)
+		if !q.Until.IsZero() {
+			feed[i].Signals.Replies = 0
+			for _, r := range s.replies {
+				if r.PostID == p.ID && !r.CreatedAt.After(q.Until) {
+					feed[i].Signals.Replies++
+				}
+			}
+		}
+	}
+	return feed, next, nil
+}
+
+func (s *MemoryStore) SaveReply(ctx context.Context, postID, parentID string, reply models.Reply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.replies[reply.ID]; ok {
+		existing.Content = reply.Content
+		s.replies[reply.ID] = existing
+		return nil
+	}
+	post, ok := s.posts[postID]
+	if !ok || post.Status != "published" {
+		return ErrNotFound
+	}
+	depth := 0
+	if parentID != "" {
+		parent, ok := s.replies[parentID]
+		if !ok || parent.PostID != postID {
+			return ErrNotFound
+		}
+		parent.ReplyCount++
+		s.replies[parentID] = parent
+		depth = parent.Depth + 1
+	}
+	if post.Stats == nil {
+		post.Stats = &models.PostStats{}
+	}
+	post.Stats.Replies++
+
+	reply.CreatedAt = orNow(reply.CreatedAt)
+	reply.Depth = depth
+	reply.ReplyCount = 0
+	reply.Replies, reply.MoreReplies = nil, ""
+	s.replies[reply.ID] = memReply{PostID: postID, ParentID: parentID, AuthorID: reply.User.ID, Reply: reply}
+	return nil
+}
+
+func (s *MemoryStore) GetReply(ctx context.Context, postID, id string) (models.Reply, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.replies[id]
+	if !ok || r.PostID != postID {
+		return models.Reply{}, ErrNotFound
+	}
+	reply := r.Reply
+	reply.PostID, reply.ParentID = r.PostID, r.ParentID
+	reply.User = s.author(r.AuthorID)
+	finishReply(&reply)
+	return reply, nil
+}
+
+func (s *MemoryStore) ListReplies(ctx context.Context, postID, parentID string, depth, limit int, after string) ([]models.Reply, string, error) {
+	afterAt, afterID, err := decodeCursor(after)
+	if err != nil {
+		return nil, "", err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	replies, next := s.replyPage(postID, parentID, depth, limit, afterAt, afterID)
+	return replies, next, nil
+}
+
+func (s *MemoryStore) SaveDraft(ctx context.Context, authorID string, draft models.DraftPost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	updatedAt := orNow(draft.UpdatedAt)
+	rec := &memPost{
+		Post: models.Post{
+			ID:        draft.ID,
+			Content:   draft.Content,
+			CircleID:  draft.CircleID,
+			Image:     draft.Image,
+			Video:     draft.Video,
+			Gallery:   draft.Gallery,
+			CreatedAt: updatedAt,
+		},
+		AuthorID:  authorID,
+		Status:    "draft",
+		UpdatedAt: updatedAt,
+	}
+	if existing, ok := s.posts[draft.ID]; ok {
+		rec.CreatedAt = existing.CreatedAt
+	}
+	s.posts[draft.ID] = rec
+	return nil
+}
+
+// draft returns authorID's draft id, or nil.
+func (s *MemoryStore) draft(authorID, id string) *memPost {
+	rec, ok := s.posts[id]
+	if !ok || rec.AuthorID != authorID || rec.Status != "draft" {
+		return nil
+	}
+	return rec
+}
+
+func draftFromPost(rec *memPost) models.DraftPost {
+	return models.DraftPost{
+		ID:        rec.ID,
+		Content:   rec.Content,
+		CircleID:  rec.CircleID,
+		Image:     rec.Image,
+		Video:     rec.Video,
+		Gallery:   rec.Gallery,
+		UpdatedAt: rec.UpdatedAt,
+	}
+}
+
+func (s *MemoryStore) GetDraft(ctx context.Context, authorID, id string) (models.DraftPost, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec := s.draft(authorID, id)
+	if rec == nil {
+		return models.DraftPost{}, ErrNotFound
+	}
+	return draftFromPost(rec), nil
+}
+
+func (s *MemoryStore) ListDrafts(ctx context.Context, authorID string) ([]models.DraftPost, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var drafts []models.DraftPost
+	for _, rec := range s.posts {
+		if rec.AuthorID == authorID && rec.Status == "draft" {
+			drafts = append(drafts, draftFromPost(rec))
+		}
+	}
+	sort.Slice(drafts, func(i, j int) bool { return drafts[i].UpdatedAt.After(drafts[j].UpdatedAt) })
+	return drafts, nil
+}
+
+func (s *MemoryStore) PublishDraft(ctx context.Context, authorID, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.draft(authorID, id)
+	if rec == nil {
+		return ErrNotFound
+	}
+	rec.Status = "published"
+	rec.CreatedAt = orNow(at)
+	rec.UpdatedAt = rec.CreatedAt
+	return nil
+}
+
+func (s *MemoryStore) DeleteDraft(ctx context.Context, authorID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draft(authorID, id) == nil {
+		return ErrNotFound
+	}
+	delete(s.posts, id)
+	return nil
+}
+
+func (s *MemoryStore) SaveRipple(ctx context.Context, ripple models.Ripple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ripple.CreatedAt = orNow(ripple.CreatedAt)
+	ripple.ExpiresAt = ripple.ExpiresAt.UTC()
+	s.ripples[ripple.ID] = ripple
+	return nil
+}
+
+func (s *MemoryStore) ListRipples(ctx context.Context, limit int) ([]models.Ripple, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current := now()
+	var ripples []models.Ripple
+	for _, r := range s.ripples {
+		if !r.ExpiresAt.After(current) {
+			continue
+		}
+		r.User = s.author(r.User.ID)
+		r.Circle = s.circleName(r.CircleID)
+		finishRipple(&r)
+		ripples = append(ripples, r)
+	}
+	sort.Slice(ripples, func(i, j int) bool { return ripples[i].CreatedAt.After(ripples[j].CreatedAt) })
+	return paginate(ripples, limit, 0), nil
+}
+
+// Events
+
+func (s *MemoryStore) SaveEvent(ctx context.Context, event models.GatherEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event.StartsAt = event.StartsAt.UTC()
+	event.Announcements = nil
+	event.Attendees = nil
+	s.events[event.ID] = event
+	return nil
+}
+
+// viewEvent fills in the joined and display fields of a stored event.
+func (s *MemoryStore) viewEvent(e models.GatherEvent, viewerID string) models.GatherEvent {
+	e.Host = s.author(e.Host.ID)
+	e.Circle = s.circleName(e.CircleID)
+	finishEvent(&e, viewerID, s.rsvps[e.ID][viewerID])
+
+	for _, a := range s.announcements[e.ID] {
+		a.Author = s.author(a.Author.ID)
+		a.TimeAgo = utils.TimeAgoLong(a.CreatedAt)
+		e.Announcements = append(e.Announcements, a)
+	}
+	sort.Slice(e.Announcements, func(i, j int) bool {
+		return e.Announcements[i].CreatedAt.After(e.Announcements[j].CreatedAt)
+	})
+	return e
+}
+
+// listEvents returns future events matching keep, soonest first.
+func (s *MemoryStore) listEvents(viewerID string, keep func(models.GatherEvent) bool, limit int) []models.GatherEvent {
+	current := now()
+	var events []models.GatherEvent
+	for _, e := range s.events {
+		if e.StartsAt.After(current) && keep(e) {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].StartsAt.Equal(events[j].StartsAt) {
+			return events[i].StartsAt.Before(events[j].StartsAt)
+		}
+		return events[i].ID < events[j].ID
+	})
+	events = paginate(events, limit, 0)
+	for i := range events {
+		events[i] = s.viewEvent(events[i], viewerID)
+	}
+	return events
+}
+
+func (s *MemoryStore) GetEvent(ctx context.Context, id, viewerID string) (models.GatherEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.events[id]
+	if !ok {
+		return models.GatherEvent{}, ErrNotFound
+	}
+	return s.viewEvent(e, viewerID), nil
+}
+
+func (s *MemoryStore) ListFeaturedEvents(ctx context.Context, viewerID string, limit int) ([]models.GatherEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listEvents(viewerID, func(e models.GatherEvent) bool { return e.IsFeatured }, limit), nil
+}
+
+func (s *MemoryStore) ListUpcomingEvents(ctx context.Context, viewerID string, limit int, after string) ([]models.GatherEvent, string, error) {
+	afterAt, afterID, err := decodeCursor(after)
+	if err != nil {
+		return nil, "", err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	events := s.listEvents(viewerID, func(e models.GatherEvent) bool {
+		return !e.IsFeatured && e.Host.ID != viewerID && sortsAfter(e.StartsAt, e.ID, afterAt, afterID, false)
+	}, limit+1)
+	events, next := pageOf(events, limit, eventKey)
+	return events, next, nil
+}
+
+func (s *MemoryStore) ListHostedEvents(ctx context.Context, hostID string) ([]models.GatherEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listEvents(hostID, func(e models.GatherEvent) bool { return e.Host.ID == hostID }, 0), nil
+}
+
+func (s *MemoryStore) ListAttendingEvents(ctx context.Context, viewerID string, limit int) ([]models.GatherEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listEvents(viewerID, func(e models.GatherEvent) bool {
+		rsvp := s.rsvps[e.ID][viewerID]
+		return e.Host.ID == viewerID || rsvp == "going" || rsvp == "maybe"
+	}, limit), nil
+}
+
+func (s *MemoryStore) SetRSVP(ctx context.Context, eventID, userID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rsvps[eventID] == nil {
+		s.rsvps[eventID] = make(map[string]string)
+	}
+	s.rsvps[eventID][userID] = status
+	return nil
+}
+
+func (s *MemoryStore) SaveAnnouncement(ctx context.Context, eventID string, announcement models.Announcement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.announcements[eventID] == nil {
+		s.announcements[eventID] = make(map[string]models.Announcement)
+	}
+	announcement.CreatedAt = orNow(announcement.CreatedAt)
+	s.announcements[eventID][announcement.ID] = announcement
+	return nil
+}
+
+func (s *MemoryStore) SaveEventCategory(ctx context.Context, category models.EventCategory, position int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.eventCategories[category.ID] = memPositioned[models.EventCategory]{Value: category, Position: position}
+	return nil
+}
+
+func (s *MemoryStore) ListEventCategories(ctx context.Context) ([]models.EventCategory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	recs := sortedPositioned(s.eventCategories, func(c models.EventCategory) string { return c.Name })
+	current := now()
+	categories := make([]models.EventCategory, len(recs))
+	for i, c := range recs {
+		c.Count = 0
+		for _, e := range s.events {
+			category := strings.ToLower(e.Category)
+			if (category == c.ID || category == strings.ToLower(c.Name)) && e.StartsAt.After(current) {
+				c.Count++
+			}
+		}
+		categories[i] = c
+	}
+	return categories, nil
+}
+
+func (s *MemoryStore) ListEventLocations(ctx context.Context, limit int) ([]models.EventLocation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	first := make(map[string]models.EventLocation)
+	for _, e := range s.events {
+		if _, ok := first[e.Location.Name]; !ok {
+			first[e.Location.Name] = models.EventLocation{Type: e.Location.Type, Name: e.Location.Name, City: e.Location.City}
+		}
+		counts[e.Location.Name]++
+	}
+
+	var locations []models.EventLocation
+	for _, l := range first {
+		locations = append(locations, l)
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		ci, cj := counts[locations[i].Name], counts[locations[j].Name]
+		if ci != cj {
+			return ci > cj
+		}
+		return locations[i].Name < locations[j].Name
+	})
+	return paginate(locations, limit, 0), nil
+}
+
+func sortedPositioned[T any](m map[string]memPositioned[T], name func(T) string) []T {
+	recs := make([]memPositioned[T], 0, len(m))
+	for _, rec := range m {
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].Position != recs[j].Position {
+			return recs[i].Position < recs[j].Position
+		}
+		return name(recs[i].Value) < name(recs[j].Value)
+	})
+	values := make([]T, len(recs))
+	for i, rec := range recs {
+		values[i] = rec.Value
+	}
+	return values
+}
+
+// Marketplace
+
+func (s *MemoryStore) SaveMarketplaceItem(ctx context.Context, item models.MarketplaceItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item.CreatedAt = orNow(item.CreatedAt)
+	if existing, ok := s.items[item.ID]; ok {
+		item.CreatedAt = existing.CreatedAt
+		item.Seller.ID = existing.Seller.ID
+	}
+	s.items[item.ID] = item
+	return nil
+}
+
+func (s *MemoryStore) matchItems(q MarketplaceQuery) []models.MarketplaceItem {
+	var items []models.MarketplaceItem
+	for _, item := range s.items {
+		switch {
+		case !item.IsAvailable,
+			q.Category != "" && item.Category != q.Category,
+			q.PriceType != "" && item.PriceType != q.PriceType,
+			q.Location != "" && item.Location != q.Location,
+			q.Condition != "" && item.Condition != q.Condition,
+			q.Featured != nil && item.IsFeatured != *q.Featured:
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func (s *MemoryStore) ListMarketplaceItems(ctx context.Context, q MarketplaceQuery) ([]models.MarketplaceItem, string, error) {
+	afterAt, afterID, err := decodeCursor(q.After)
+	if err != nil {
+		return nil, "", err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []models.MarketplaceItem
+	for _, item := range s.matchItems(q) {
+		if sortsAfter(item.CreatedAt, item.ID, afterAt, afterID, true) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].CreatedAt.After(items[j].CreatedAt)
+		}
+		return items[i].ID > items[j].ID
+	})
+	var next string
+	if q.Limit > 0 {
+		items, next = pageOf(paginate(items, q.Limit+1, 0), q.Limit, itemKey)
+	}
+	for i := range items {
+		items[i].Seller = s.author(items[i].Seller.ID)
+		items[i].Circle = s.circleName(items[i].CircleID)
+		items[i].TimeAgo = utils.TimeAgo(items[i].CreatedAt)
+	}
+	return items, next, nil
+}
+
+func (s *MemoryStore) CountMarketplaceItems(ctx context.Context, q MarketplaceQuery) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.matchItems(q)), nil
+}
+
+func (s *MemoryStore) SaveMarketplaceCategory(ctx context.Context, category models.MarketplaceCategory, position int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marketplaceCategories[category.ID] = memPositioned[models.MarketplaceCategory]{Value: category, Position: position}
+	return nil
+}
+
+func (s *MemoryStore) ListMarketplaceCategories(ctx context.Context) ([]models.MarketplaceCategory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	categories := sortedPositioned(s.marketplaceCategories, func(c models.MarketplaceCategory) string { return c.Name })
+	for i := range categories {
+		categories[i].Count = len(s.matchItems(MarketplaceQuery{Category: categories[i].ID}))
+	}
+	return categories, nil
+}
+
+func (s *MemoryStore) ListMarketplaceLocations(ctx context.Context, limit int) ([]models.Location, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, item := range s.matchItems(MarketplaceQuery{}) {
+		if item.Location != "" {
+			counts[item.Location]++
+		}
+	}
+	var locations []models.Location
+	for name, count := range counts {
+		locations = append(locations, models.Location{Name: name, Count: count})
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		if locations[i].Count != locations[j].Count {
+			return locations[i].Count > locations[j].Count
+		}
+		return locations[i].Name < locations[j].Name
+	})
+	return paginate(locations, limit, 0), nil
+}
+
+// Chat
+
+func (s *MemoryStore) SaveConversation(ctx context.Context, conversation models.Conversation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveConversation(conversation)
+	return nil
+}
+
+func (s *MemoryStore) saveConversation(conversation models.Conversation) {
+	conversation.CreatedAt = orNow(conversation.CreatedAt)
+	rec, ok := s.conversations[conversation.ID]
+	if ok {
+		conversation.CreatedAt = rec.CreatedAt
+	} else {
+		rec = &memConversation{Participants: make(map[string]*memParticipant)}
+		s.conversations[conversation.ID] = rec
+	}
+	rec.Conversation = models.Conversation{
+		ID:        conversation.ID,
+		Name:      conversation.Name,
+		Avatar:    conversation.Avatar,
+		IsGroup:   conversation.IsGroup,
+		CreatedAt: conversation.CreatedAt,
+	}
+	for _, p := range conversation.Participants {
+		if _, ok := rec.Participants[p.ID]; !ok {
+			rec.Participants[p.ID] = s.newParticipant(conversation.CreatedAt)
+		}
+	}
+}
+
+func (s *MemoryStore) AddParticipant(ctx context.Context, conversationID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.conversations[conversationID]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, ok := rec.Participants[userID]; !ok {
+		rec.Participants[userID] = s.newParticipant(now())
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetParticipantRole(ctx context.Context, conversationID, userID string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.conversations[conversationID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	p, ok := rec.Participants[userID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return p.Role, nil
+}
+
+func (s *MemoryStore) SetParticipantRole(ctx context.Context, conversationID, userID, role string) error {
+	if role != models.GroupAdmin && role != models.GroupMember {
+		return ErrInvalidRole
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.conversations[conversationID]
+	if !ok {
+		return ErrNotFound
+	}
+	p, ok := rec.Participants[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	p.Role = role
+	return nil
+}
+
+func (s *MemoryStore) ListParticipants(ctx context.Context, conversationID string) ([]models.ConversationMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.conversations[conversationID]
+	if !ok {
+		return nil, nil
+	}
+	var members []models.ConversationMember
+	for id, p := range rec.Participants {
+		members = append(members, models.ConversationMember{
+			User:       s.author(id),
+			Role:       p.Role,
+			JoinedAt:   p.JoinedAt,
+			JoinedDate: utils.TimeAgoLong(p.JoinedAt),
+		})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		mi, mj := members[i], members[j]
+		if (mi.Role == models.GroupAdmin) != (mj.Role == models.GroupAdmin) {
+			return mi.Role == models.GroupAdmin
+		}
+		if !mi.JoinedAt.Equal(mj.JoinedAt) {
+			return mi.JoinedAt.Before(mj.JoinedAt)
+		}
+		return mi.User.Handle < mj.User.Handle
+	})
+	return members, nil
+}
+
+func (s *MemoryStore) RemoveParticipant(ctx context.Context, conversationID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.conversations[conversationID]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, ok := rec.Participants[userID]; !ok {
+		return ErrNotFound
+	}
+	delete(rec.Participants, userID)
+	return nil
+}
+
+func (s *MemoryStore) CreateGroup(ctx context.Context, group models.Conversation, adminID string, message models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.ContainsFunc(group.Participants, func(u models.User) bool { return u.ID == adminID }) {
+		return ErrNotFound
+	}
+	s.saveConversation(group)
+	s.conversations[group.ID].Participants[adminID].Role = models.GroupAdmin
+	return s.saveMessage(group.ID, message)
+}
+
+func (s *MemoryStore) AddGroupMembers(ctx context.Context, conversationID string, userIDs []string, message models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.conversations[conversationID]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, id := range userIDs {
+		if _, ok := s.users[id]; !ok {
+			return ErrNotFound
+		}
+	}
+	joinedAt := now()
+	for _, id := range userIDs {
+		if _, ok := rec.Participants[id]; !ok {
+			rec.Participants[id] = s.newParticipant(joinedAt)
+		}
+	}
+	return s.saveMessage(conversationID, message)
+}
+
+func (s *MemoryStore) LeaveGroup(ctx context.Context, conversationID, userID string, left models.Message, promoted func(models.User) models.Message) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.conversations[conversationID]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	if _, ok := rec.Participants[userID]; !ok {
+		return models.User{}, ErrNotFound
+	}
+	// Stored first, while the member can still see their own message
+	if err := s.saveMessage(conversationID, left); err != nil {
+		return models.User{}, err
+	}
+	delete(rec.Participants, userID)
+
+	var successor string
+	for id, p := range rec.Participants {
+		if p.Role == models.GroupAdmin {
+			return models.User{}, nil
+		}
+		if successor == "" {
+			successor = id
+			continue
+		}
+		current := rec.Participants[successor]
+		if p.JoinedAt.Before(current.JoinedAt) ||
+			(p.JoinedAt.Equal(current.JoinedAt) && s.author(id).Handle < s.author(successor).Handle) {
+			successor = id
+		}
+	}
+	if successor == "" {
+		return models.User{}, nil
+	}
+	rec.Participants[successor].Role = models.GroupAdmin
+	u := s.author(successor)
+	return u, s.saveMessage(conversationID, promoted(u))
+}
+
+// viewConversation returns the conversation as seen by userID.
+func (s *MemoryStore) viewConversation(rec *memConversation, userID string) models.Conversation {
+	c := rec.Conversation
+	me := rec.Participants[userID]
+	c.UserRole = me.Role
+	var last *models.Message
+	for _, m := range s.messages[c.ID] {
+		if !s.visible(me, m) {
+			continue
+		}
+		if m.Sender.ID != userID && s.messageSeq[m.ID] > me.LastRead {
+			c.UnreadCount++
+		}
+		last = &m
+	}
+
+	ids := make([]string, 0, len(rec.Participants))
+	for id := range rec.Participants {
+		if id != userID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		pi, pj := rec.Participants[ids[i]], rec.Participants[ids[j]]
+		if !pi.JoinedAt.Equal(pj.JoinedAt) {
+			return pi.JoinedAt.Before(pj.JoinedAt)
+		}
+		return s.author(ids[i]).Name < s.author(ids[j]).Name
+	})
+	for _, id := range ids {
+		if u, ok := s.users[id]; ok {
+			c.Participants = append(c.Participants, u.User)
+			c.IsOnline = c.IsOnline || u.Online
+		}
+	}
+
+	if !c.IsGroup && len(c.Participants) > 0 {
+		c.Name = c.Participants[0].Name
+		c.Avatar = c.Participants[0].Avatar
+	}
+	if last != nil {
+		view := s.viewMessage(*last, userID)
+		lastMessagePreview(&c, &view)
+	}
+	return c
+}
+
+func (s *MemoryStore) lastActivity(rec *memConversation) time.Time {
+	if msgs := s.messages[rec.ID]; len(msgs) > 0 {
+		return msgs[len(msgs)-1].CreatedAt
+	}
+	return rec.CreatedAt
+}
+
+func (s *MemoryStore) ListConversations(ctx context.Context, userID string) ([]models.Conversation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var recs []*memConversation
+	for _, rec := range s.conversations {
+		if _, ok := rec.Participants[userID]; ok {
+			recs = append(recs, rec)
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool { return s.lastActivity(recs[i]).After(s.lastActivity(recs[j])) })
+
+	conversations := make([]models.Conversation, len(recs))
+	for i, rec := range recs {
+		conversations[i] = s.viewConversation(rec, userID)
+	}
+	return conversations, nil
+}
+
+func (s *MemoryStore) GetConversation(ctx context.Context, conversationID, userID string) (models.Conversation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.conversations[conversationID]
+	if !ok {
+		return models.Conversation{}, ErrNotFound
+	}
+	if _, ok := rec.Participants[userID]; !ok {
+		return models.Conversation{}, ErrNotFound
+	}
+	return s.viewConversation(rec, userID), nil
+}
+
+func (s *MemoryStore) viewMessage(m models.Message, viewerID string) models.Message {
+	m.Sender = s.author(m.Sender.ID)
+	if rec, ok := s.conversations[m.ConversationID]; ok {
+		m.InGroup = rec.IsGroup
+		for id, p := range rec.Participants {
+			u, ok := s.users[id]
+			if id != m.Sender.ID && ok && !u.NoReadReceipts && s.visible(p, m) && p.LastRead >= s.messageSeq[m.ID] {
+				m.ReadBy++
+			}
+		}
+	}
+	finishMessage(&m, viewerID)
+	return m
+}
+
+func (s *MemoryStore) SaveMessage(ctx context.Context, conversationID string, message models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveMessage(conversationID, message)
+}
+
+func (s *MemoryStore) saveMessage(conversationID string, message models.Message) error {
+	rec, ok := s.conversations[conversationID]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, m := range s.messages[conversationID] {
+		if m.ID == message.ID {
+			return nil
+		}
+	}
+	message.ConversationID = conversationID
+	message.CreatedAt = orNow(message.CreatedAt)
+	if message.Type == "" {
+		message.Type = "text"
+	}
+	seq := int64(len(s.messageSeq)) + 1
+	s.messageSeq[message.ID] = seq
+
+	msgs := append(s.messages[conversationID], message)
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].CreatedAt.Before(msgs[j].CreatedAt) })
+	s.messages[conversationID] = msgs
+
+	// The sender has read what they wrote
+	if p, ok := rec.Participants[message.Sender.ID]; ok && p.LastRead < seq {
+		p.LastRead = seq
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetMessage(ctx context.Context, id, viewerID string) (models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for conversationID, rec := range s.conversations {
+		p, ok := rec.Participants[viewerID]
+		if !ok {
+			continue
+		}
+		for _, m := range s.messages[conversationID] {
+			if m.ID == id && s.visible(p, m) {
+				return s.viewMessage(m, viewerID), nil
+			}
+		}
+	}
+	return models.Message{}, ErrNotFound
+}
+
+func (s *MemoryStore) ListMessages(ctx context.Context, conversationID, viewerID string, limit int) ([]models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var msgs []models.Message
+	if rec, ok := s.conversations[conversationID]; ok {
+		p := rec.Participants[viewerID]
+		for _, m := range s.messages[conversationID] {
+			if s.visible(p, m) {
+				msgs = append(msgs, m)
+			}
+		}
+	}
+	if limit > 0 && len(msgs) > limit {
+		msgs = msgs[len(msgs)-limit:]
+	}
+	out := make([]models.Message, len(msgs))
+	for i, m := range msgs {
+		out[i] = s.viewMessage(m, viewerID)
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) ListMessagesAfter(ctx context.Context, userID, afterID string, limit int) ([]models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var after []models.Message
+	found := false
+	for id, rec := range s.conversations {
+		p, ok := rec.Participants[userID]
+		if !ok {
+			continue
+		}
+		for _, m := range s.messages[id] {
+			if !s.visible(p, m) {
+				continue
+			}
+			if m.ID == afterID {
+				found = true
+			}
+			after = append(after, m)
+		}
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	afterSeq := s.messageSeq[afterID]
+	out := after[:0]
+	for _, m := range after {
+		if s.messageSeq[m.ID] > afterSeq {
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return s.messageSeq[out[i].ID] < s.messageSeq[out[j].ID] })
+	out = paginate(out, limit, 0)
+	for i, m := range out {
+		out[i] = s.viewMessage(m, userID)
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) LatestMessageID(ctx context.Context, userID string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	latest, latestSeq := "", int64(0)
+	for id, rec := range s.conversations {
+		p, ok := rec.Participants[userID]
+		if !ok {
+			continue
+		}
+		for _, m := range s.messages[id] {
+			if seq := s.messageSeq[m.ID]; seq > latestSeq && s.visible(p, m) {
+				latest, latestSeq = m.ID, seq
+			}
+		}
+	}
+	return latest, nil
+}
+
+func (s *MemoryStore) MarkConversationRead(ctx context.Context, conversationID, userID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.conversations[conversationID]
+	if !ok {
+		return false, nil
+	}
+	p, ok := rec.Participants[userID]
+	if !ok {
+		return false, nil
+	}
+	moved := false
+	for _, m := range s.messages[conversationID] {
+		if seq := s.messageSeq[m.ID]; seq > p.LastRead {
+			p.LastRead, moved = seq, true
+		}
+	}
+	return moved, nil
+}
+
+func (s *MemoryStore) SaveAttachment(ctx context.Context, a models.Attachment, message models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.saveMessage(a.ConversationID, message); err != nil {
+		return err
+	}
+	a.CreatedAt = orNow(a.CreatedAt)
+	a.HasThumbnail = len(a.Thumbnail) > 0
+	s.attachments[a.ID] = a
+	return nil
+}
+
+func (s *MemoryStore) GetAttachment(ctx context.Context, id, viewerID string, thumbnail bool) (models.Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.attachments[id]
+	if !ok {
+		return models.Attachment{}, ErrNotFound
+	}
+	rec, ok := s.conversations[a.ConversationID]
+	if !ok {
+		return models.Attachment{}, ErrNotFound
+	}
+	p := rec.Participants[viewerID]
+	for _, m := range s.messages[a.ConversationID] {
+		if m.ID == a.MessageID && s.visible(p, m) {
+			if thumbnail && a.HasThumbnail {
+				a.Data = a.Thumbnail
+			}
+			a.Thumbnail = nil
+			return a, nil
+		}
+	}
+	return models.Attachment{}, ErrNotFound
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in migrations/ as NNNN_name.up.sql and NNNN_name.down.sql.
+// Versions are applied in order and recorded in schema_migrations; a
+// released migration must never be edited, only followed by a new one.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration and when it was applied, if it has been.
+type MigrationState struct {
+	Migration
+	AppliedAt time.Time
+}
+
+func (m MigrationState) Applied() bool {
+	return !m.AppliedAt.IsZero()
+}
+
+// loadMigrations parses the embedded migration files, sorted by version.
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join("migrations", file))
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %04d has conflicting names %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func (s *SQLiteStore) ensureMigrationTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`)
+	return err
+}
+
+// MigrationStatus lists every known migration with its applied time.
+func (s *SQLiteStore) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureMigrationTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i] = MigrationState{Migration: m, AppliedAt: applied[m.Version]}
+		delete(applied, m.Version)
+	}
+	for version := range applied {
+		return nil, fmt.Errorf("database has migration %04d applied but this binary does not know it", version)
+	}
+	return states, nil
+}
+
+// PendingMigrations returns the migrations not yet applied, oldest first.
+func (s *SQLiteStore) PendingMigrations(ctx context.Context) ([]Migration, error) {
+	states, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, st := range states {
+		if !st.Applied() {
+			pending = append(pending, st.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateUp applies every pending migration, each in its own transaction,
+// and returns the ones applied.
+func (s *SQLiteStore) MigrateUp(ctx context.Context) ([]Migration, error) {
+	pending, err := s.PendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range pending {
+		err := s.withTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, now())
+			return err
+		})
+		if err != nil {
+			return pending[:i], fmt.Errorf("failed to apply migration %04d_%s: %v", m.Version, m.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateDown reverts the most recently applied migration. It returns nil
+// when nothing is applied.
+func (s *SQLiteStore) MigrateDown(ctx context.Context) (*Migration, error) {
+	states, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var last *Migration
+	for i := len(states) - 1; i >= 0; i-- {
+		if states[i].Applied() {
+			last = &states[i].Migration
+			break
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+	if last.Down == "" {
+		return nil, fmt.Errorf("migration %04d_%s has no down file", last.Version, last.Name)
+	}
+
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, last.Down); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, last.Version)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to revert migration %04d_%s: %v", last.Version, last.Name, err)
+	}
+	return last, nil
+}
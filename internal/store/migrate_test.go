@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMigrationsInOrder(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d; versions must run 1, 2, 3…", i, m.Version)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %04d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestMigrateUpAppliesOnce(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "circles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	all, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := s.MigrateUp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(all) {
+		t.Fatalf("first MigrateUp applied %d migrations, want %d", len(applied), len(all))
+	}
+	for i, m := range applied {
+		if m.Version != all[i].Version {
+			t.Errorf("applied migration %d was %04d, want %04d", i, m.Version, all[i].Version)
+		}
+	}
+
+	again, err := s.MigrateUp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 0 {
+		t.Errorf("second MigrateUp applied %d migrations, want none", len(again))
+	}
+	states, err := s.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range states {
+		if !st.Applied() {
+			t.Errorf("migration %04d_%s not applied", st.Version, st.Name)
+		}
+	}
+}
+
+// Every migration must revert cleanly, newest first, and apply again.
+func TestMigrateDownAndUp(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+	all, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := len(all) - 1; i >= 0; i-- {
+		reverted, err := s.MigrateDown(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reverted == nil || reverted.Version != all[i].Version {
+			t.Fatalf("MigrateDown reverted %v, want %04d", reverted, all[i].Version)
+		}
+	}
+	if reverted, err := s.MigrateDown(ctx); err != nil || reverted != nil {
+		t.Errorf("MigrateDown with nothing applied = %v, %v; want nil, nil", reverted, err)
+	}
+	pending, err := s.PendingMigrations(ctx)
+	if err != nil || len(pending) != len(all) {
+		t.Errorf("PendingMigrations after reverting all = %d, %v; want %d", len(pending), err, len(all))
+	}
+	if applied, err := s.MigrateUp(ctx); err != nil || len(applied) != len(all) {
+		t.Errorf("MigrateUp after reverting all = %d, %v; want %d", len(applied), err, len(all))
+	}
+}
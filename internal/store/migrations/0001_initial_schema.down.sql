@@ -0,0 +1,22 @@
+DROP TABLE messages;
+DROP TABLE conversation_participants;
+DROP TABLE conversations;
+DROP TABLE marketplace_categories;
+DROP TABLE marketplace_items;
+DROP TABLE event_categories;
+DROP TABLE event_announcements;
+DROP TABLE event_rsvps;
+DROP TABLE events;
+DROP TABLE ripples;
+DROP TABLE replies;
+DROP TABLE posts;
+DROP TABLE discussions;
+DROP TABLE circle_activity;
+DROP TABLE circle_members;
+DROP TABLE circles;
+DROP TABLE user_impact;
+DROP TABLE user_analytics;
+DROP TABLE user_extensions;
+DROP TABLE contacts;
+DROP TABLE connections;
+DROP TABLE users;
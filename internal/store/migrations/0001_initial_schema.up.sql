@@ -0,0 +1,243 @@
+CREATE TABLE users (
+    id           TEXT PRIMARY KEY,
+    handle       TEXT NOT NULL UNIQUE,
+    name         TEXT NOT NULL DEFAULT '',
+    avatar       TEXT NOT NULL DEFAULT '',
+    bio          TEXT NOT NULL DEFAULT '',
+    banner       TEXT NOT NULL DEFAULT '',
+    is_online    INTEGER NOT NULL DEFAULT 0,
+    last_seen_at TIMESTAMP,
+    created_at   TIMESTAMP NOT NULL
+);
+
+CREATE TABLE connections (
+    user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    other_id   TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, other_id)
+);
+
+CREATE TABLE contacts (
+    user_id      TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    contact_id   TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    relationship TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (user_id, contact_id)
+);
+
+CREATE TABLE user_extensions (
+    user_id      TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    extension_id TEXT NOT NULL,
+    name         TEXT NOT NULL,
+    description  TEXT NOT NULL DEFAULT '',
+    enabled      INTEGER NOT NULL DEFAULT 0,
+    position     INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, extension_id)
+);
+
+CREATE TABLE user_analytics (
+    user_id                TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    profile_views          INTEGER NOT NULL DEFAULT 0,
+    profile_views_change   INTEGER NOT NULL DEFAULT 0,
+    post_engagement        INTEGER NOT NULL DEFAULT 0,
+    post_engagement_change INTEGER NOT NULL DEFAULT 0,
+    new_connections        INTEGER NOT NULL DEFAULT 0,
+    new_connections_change INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE user_impact (
+    user_id  TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    label    TEXT NOT NULL,
+    value    TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, label)
+);
+
+CREATE TABLE circles (
+    id               TEXT PRIMARY KEY,
+    name             TEXT NOT NULL,
+    description      TEXT NOT NULL DEFAULT '',
+    thumbnail        TEXT NOT NULL DEFAULT '',
+    banner           TEXT NOT NULL DEFAULT '',
+    member_count     TEXT NOT NULL DEFAULT '0',
+    online_count     TEXT NOT NULL DEFAULT '0',
+    active           INTEGER NOT NULL DEFAULT 0,
+    featured         INTEGER NOT NULL DEFAULT 0,
+    last_activity_at TIMESTAMP
+);
+
+CREATE TABLE circle_members (
+    circle_id TEXT NOT NULL REFERENCES circles(id) ON DELETE CASCADE,
+    user_id   TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role      TEXT NOT NULL DEFAULT 'member',
+    joined_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (circle_id, user_id)
+);
+CREATE INDEX idx_circle_members_user ON circle_members(user_id);
+
+CREATE TABLE circle_activity (
+    id         TEXT PRIMARY KEY,
+    circle_id  TEXT NOT NULL REFERENCES circles(id) ON DELETE CASCADE,
+    type       TEXT NOT NULL,
+    title      TEXT NOT NULL,
+    content    TEXT NOT NULL DEFAULT '',
+    actor      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_circle_activity_circle ON circle_activity(circle_id, created_at);
+
+CREATE TABLE discussions (
+    id          TEXT PRIMARY KEY,
+    circle_id   TEXT NOT NULL REFERENCES circles(id) ON DELETE CASCADE,
+    title       TEXT NOT NULL,
+    preview     TEXT NOT NULL DEFAULT '',
+    reply_count INTEGER NOT NULL DEFAULT 0,
+    updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE TABLE posts (
+    id          TEXT PRIMARY KEY,
+    author_id   TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    circle_id   TEXT REFERENCES circles(id) ON DELETE SET NULL,
+    status      TEXT NOT NULL DEFAULT 'published',
+    content     TEXT NOT NULL DEFAULT '',
+    image       TEXT,
+    video       TEXT,
+    gallery     TEXT,
+    can_buy     INTEGER NOT NULL DEFAULT 0,
+    reply_count INTEGER NOT NULL DEFAULT 0,
+    share_count INTEGER NOT NULL DEFAULT 0,
+    view_count  INTEGER NOT NULL DEFAULT 0,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_posts_author ON posts(author_id, status, created_at);
+CREATE INDEX idx_posts_circle ON posts(circle_id, status, created_at);
+
+CREATE TABLE replies (
+    id         TEXT PRIMARY KEY,
+    post_id    TEXT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    parent_id  TEXT REFERENCES replies(id) ON DELETE CASCADE,
+    author_id  TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content    TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_replies_post ON replies(post_id, created_at);
+
+CREATE TABLE ripples (
+    id           TEXT PRIMARY KEY,
+    author_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    circle_id    TEXT REFERENCES circles(id) ON DELETE SET NULL,
+    content      TEXT NOT NULL DEFAULT '',
+    content_type TEXT NOT NULL DEFAULT 'text',
+    image        TEXT,
+    video        TEXT,
+    gallery      TEXT,
+    link         TEXT,
+    view_count   INTEGER NOT NULL DEFAULT 0,
+    expires_at   TIMESTAMP NOT NULL,
+    created_at   TIMESTAMP NOT NULL
+);
+
+CREATE TABLE events (
+    id             TEXT PRIMARY KEY,
+    title          TEXT NOT NULL,
+    description    TEXT NOT NULL DEFAULT '',
+    host_id        TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    circle_id      TEXT REFERENCES circles(id) ON DELETE SET NULL,
+    starts_at      TIMESTAMP NOT NULL,
+    duration       TEXT NOT NULL DEFAULT '',
+    location       TEXT,
+    type           TEXT NOT NULL DEFAULT 'in-person',
+    category       TEXT NOT NULL DEFAULT '',
+    is_ticketed    INTEGER NOT NULL DEFAULT 0,
+    price          TEXT NOT NULL DEFAULT '',
+    currency       TEXT NOT NULL DEFAULT '',
+    capacity       INTEGER NOT NULL DEFAULT 0,
+    attendee_count INTEGER NOT NULL DEFAULT 0,
+    image          TEXT,
+    tags           TEXT,
+    is_featured    INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX idx_events_starts ON events(starts_at);
+
+CREATE TABLE event_rsvps (
+    event_id   TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status     TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (event_id, user_id)
+);
+
+CREATE TABLE event_announcements (
+    id         TEXT PRIMARY KEY,
+    event_id   TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    author_id  TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title      TEXT NOT NULL,
+    content    TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE event_categories (
+    id       TEXT PRIMARY KEY,
+    name     TEXT NOT NULL,
+    icon     TEXT NOT NULL DEFAULT '',
+    position INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE marketplace_items (
+    id           TEXT PRIMARY KEY,
+    title        TEXT NOT NULL,
+    description  TEXT NOT NULL DEFAULT '',
+    price        TEXT NOT NULL DEFAULT '',
+    price_type   TEXT NOT NULL DEFAULT 'sale',
+    image        TEXT,
+    images       TEXT,
+    location     TEXT NOT NULL DEFAULT '',
+    distance     TEXT NOT NULL DEFAULT '',
+    seller_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    circle_id    TEXT REFERENCES circles(id) ON DELETE SET NULL,
+    category     TEXT NOT NULL DEFAULT '',
+    tags         TEXT,
+    condition    TEXT NOT NULL DEFAULT '',
+    is_available INTEGER NOT NULL DEFAULT 1,
+    view_count   INTEGER NOT NULL DEFAULT 0,
+    is_featured  INTEGER NOT NULL DEFAULT 0,
+    created_at   TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_marketplace_items_created ON marketplace_items(created_at);
+
+CREATE TABLE marketplace_categories (
+    id       TEXT PRIMARY KEY,
+    name     TEXT NOT NULL,
+    icon     TEXT NOT NULL DEFAULT '',
+    position INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE conversations (
+    id         TEXT PRIMARY KEY,
+    name       TEXT NOT NULL DEFAULT '',
+    avatar     TEXT NOT NULL DEFAULT '',
+    is_group   INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE conversation_participants (
+    conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id         TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    unread_count    INTEGER NOT NULL DEFAULT 0,
+    joined_at       TIMESTAMP NOT NULL,
+    PRIMARY KEY (conversation_id, user_id)
+);
+CREATE INDEX idx_conversation_participants_user ON conversation_participants(user_id);
+
+CREATE TABLE messages (
+    id              TEXT PRIMARY KEY,
+    conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    sender_id       TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content         TEXT NOT NULL DEFAULT '',
+    type            TEXT NOT NULL DEFAULT 'text',
+    media           TEXT,
+    is_read         INTEGER NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_messages_conversation ON messages(conversation_id, created_at);
@@ -0,0 +1,13 @@
+CREATE TABLE passkeys (
+    id           TEXT PRIMARY KEY,
+    user_id      TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    public_key   BLOB NOT NULL,
+    algorithm    INTEGER NOT NULL,
+    sign_count   INTEGER NOT NULL DEFAULT 0,
+    transports   TEXT,
+    created_at   TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX idx_passkeys_user ON passkeys(user_id);
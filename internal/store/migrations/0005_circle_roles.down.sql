@@ -0,0 +1,15 @@
+CREATE TABLE circle_members_old (
+    circle_id TEXT NOT NULL REFERENCES circles(id) ON DELETE CASCADE,
+    user_id   TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role      TEXT NOT NULL DEFAULT 'member',
+    joined_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (circle_id, user_id)
+);
+
+INSERT INTO circle_members_old (circle_id, user_id, role, joined_at)
+SELECT circle_id, user_id, role, joined_at FROM circle_members;
+
+DROP TABLE circle_members;
+ALTER TABLE circle_members_old RENAME TO circle_members;
+
+CREATE INDEX idx_circle_members_user ON circle_members(user_id);
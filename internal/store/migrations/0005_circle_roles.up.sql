@@ -0,0 +1,22 @@
+-- Roles come from a fixed set; anything else recorded so far becomes an
+-- ordinary membership
+CREATE TABLE circle_members_new (
+    circle_id TEXT NOT NULL REFERENCES circles(id) ON DELETE CASCADE,
+    user_id   TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role      TEXT NOT NULL DEFAULT 'member'
+              CHECK (role IN ('owner', 'admin', 'moderator', 'member', 'guest')),
+    joined_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (circle_id, user_id)
+);
+
+INSERT INTO circle_members_new (circle_id, user_id, role, joined_at)
+SELECT circle_id, user_id,
+       CASE WHEN role IN ('owner', 'admin', 'moderator', 'member', 'guest') THEN role ELSE 'member' END,
+       joined_at
+FROM circle_members;
+
+DROP TABLE circle_members;
+ALTER TABLE circle_members_new RENAME TO circle_members;
+
+CREATE INDEX idx_circle_members_user ON circle_members(user_id);
+CREATE UNIQUE INDEX idx_circle_members_owner ON circle_members(circle_id) WHERE role = 'owner';
@@ -0,0 +1,5 @@
+DROP INDEX idx_circles_delete_at;
+ALTER TABLE circles DROP COLUMN delete_at;
+ALTER TABLE circles DROP COLUMN archived_at;
+ALTER TABLE circles DROP COLUMN created_at;
+ALTER TABLE circles DROP COLUMN visibility;
@@ -0,0 +1,8 @@
+ALTER TABLE circles ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'unlisted', 'private'));
+ALTER TABLE circles ADD COLUMN created_at TIMESTAMP;
+ALTER TABLE circles ADD COLUMN archived_at TIMESTAMP;
+-- Circles scheduled for deletion are removed for good once delete_at passes
+ALTER TABLE circles ADD COLUMN delete_at TIMESTAMP;
+
+CREATE INDEX idx_circles_delete_at ON circles(delete_at) WHERE delete_at IS NOT NULL;
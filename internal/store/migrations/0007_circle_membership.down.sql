@@ -0,0 +1,6 @@
+DROP TABLE circle_invites;
+DROP TABLE circle_bans;
+DROP TABLE circle_join_requests;
+
+ALTER TABLE circles ADD COLUMN member_count TEXT NOT NULL DEFAULT '0';
+ALTER TABLE circles ADD COLUMN online_count TEXT NOT NULL DEFAULT '0';
@@ -0,0 +1,33 @@
+-- Member and online counts are computed from circle_members and users
+ALTER TABLE circles DROP COLUMN member_count;
+ALTER TABLE circles DROP COLUMN online_count;
+
+CREATE TABLE circle_join_requests (
+    circle_id  TEXT NOT NULL REFERENCES circles(id) ON DELETE CASCADE,
+    user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message    TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (circle_id, user_id)
+);
+
+CREATE TABLE circle_bans (
+    circle_id  TEXT NOT NULL REFERENCES circles(id) ON DELETE CASCADE,
+    user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    banned_by  TEXT REFERENCES users(id) ON DELETE SET NULL,
+    reason     TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (circle_id, user_id)
+);
+
+-- max_uses 0 means unlimited; expires_at NULL means the invite never expires
+CREATE TABLE circle_invites (
+    code       TEXT PRIMARY KEY,
+    circle_id  TEXT NOT NULL REFERENCES circles(id) ON DELETE CASCADE,
+    created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    max_uses   INTEGER NOT NULL DEFAULT 0,
+    uses       INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_circle_invites_circle ON circle_invites(circle_id, created_at);
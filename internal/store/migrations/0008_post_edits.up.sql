@@ -0,0 +1,3 @@
+ALTER TABLE posts ADD COLUMN edited_at TIMESTAMP;
+-- Deleted posts keep status 'deleted' so their replies and history survive
+ALTER TABLE posts ADD COLUMN deleted_at TIMESTAMP;
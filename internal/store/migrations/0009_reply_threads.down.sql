@@ -0,0 +1,3 @@
+DROP INDEX idx_replies_parent;
+ALTER TABLE replies DROP COLUMN reply_count;
+ALTER TABLE replies DROP COLUMN depth;
@@ -0,0 +1,15 @@
+ALTER TABLE replies ADD COLUMN depth INTEGER NOT NULL DEFAULT 0;
+-- Number of direct replies; posts.reply_count counts the whole thread
+ALTER TABLE replies ADD COLUMN reply_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_replies_parent ON replies(parent_id, created_at, id);
+
+WITH RECURSIVE tree(id, depth) AS (
+    SELECT id, 0 FROM replies WHERE parent_id IS NULL
+    UNION ALL
+    SELECT r.id, tree.depth + 1 FROM replies r JOIN tree ON r.parent_id = tree.id
+)
+UPDATE replies SET depth = (SELECT depth FROM tree WHERE tree.id = replies.id);
+
+UPDATE replies SET reply_count = (SELECT COUNT(*) FROM replies c WHERE c.parent_id = replies.id);
+UPDATE posts SET reply_count = (SELECT COUNT(*) FROM replies r WHERE r.post_id = posts.id);
@@ -0,0 +1,2 @@
+-- Empty means the member hasn't picked a feed strategy
+ALTER TABLE users ADD COLUMN feed_strategy TEXT NOT NULL DEFAULT '';
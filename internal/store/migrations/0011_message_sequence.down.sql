@@ -0,0 +1,2 @@
+DROP INDEX idx_messages_seq;
+ALTER TABLE messages DROP COLUMN seq;
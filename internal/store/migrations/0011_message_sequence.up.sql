@@ -0,0 +1,9 @@
+-- Order messages were stored in, which live chat streams resume from
+ALTER TABLE messages ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;
+
+WITH ordered(id, seq) AS (
+    SELECT id, ROW_NUMBER() OVER (ORDER BY created_at, id) FROM messages
+)
+UPDATE messages SET seq = (SELECT seq FROM ordered WHERE ordered.id = messages.id);
+
+CREATE INDEX idx_messages_seq ON messages(seq);
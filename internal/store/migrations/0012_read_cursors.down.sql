@@ -0,0 +1,20 @@
+ALTER TABLE users DROP COLUMN read_receipts;
+
+DROP INDEX idx_messages_conversation_seq;
+
+ALTER TABLE messages ADD COLUMN is_read INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE conversation_participants ADD COLUMN unread_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE messages SET is_read = EXISTS (
+    SELECT 1 FROM conversation_participants p
+    WHERE p.conversation_id = messages.conversation_id
+        AND p.user_id != messages.sender_id
+        AND p.last_read_seq >= messages.seq);
+
+UPDATE conversation_participants SET unread_count = (
+    SELECT COUNT(*) FROM messages m
+    WHERE m.conversation_id = conversation_participants.conversation_id
+        AND m.sender_id != conversation_participants.user_id
+        AND m.seq > conversation_participants.last_read_seq);
+
+ALTER TABLE conversation_participants DROP COLUMN last_read_seq;
@@ -0,0 +1,26 @@
+-- Each participant's read cursor: the seq of the last message they have
+-- read. Unread counts and receipts are worked out from it.
+ALTER TABLE conversation_participants ADD COLUMN last_read_seq INTEGER NOT NULL DEFAULT 0;
+
+-- Read up to just before the newest unread messages from others
+UPDATE conversation_participants SET last_read_seq = CASE
+    WHEN unread_count = 0 THEN COALESCE((
+        SELECT MAX(m.seq) FROM messages m
+        WHERE m.conversation_id = conversation_participants.conversation_id), 0)
+    ELSE COALESCE((
+        SELECT MIN(m.seq) - 1 FROM messages m
+        WHERE m.conversation_id = conversation_participants.conversation_id
+            AND m.sender_id != conversation_participants.user_id
+            AND (SELECT COUNT(*) FROM messages n
+                WHERE n.conversation_id = m.conversation_id
+                    AND n.sender_id != conversation_participants.user_id
+                    AND n.seq >= m.seq) <= conversation_participants.unread_count), 0)
+END;
+
+ALTER TABLE conversation_participants DROP COLUMN unread_count;
+ALTER TABLE messages DROP COLUMN is_read;
+
+CREATE INDEX idx_messages_conversation_seq ON messages(conversation_id, seq);
+
+-- Whether the member lets others see when they have read a message
+ALTER TABLE users ADD COLUMN read_receipts INTEGER NOT NULL DEFAULT 1;
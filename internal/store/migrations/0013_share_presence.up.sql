@@ -0,0 +1,2 @@
+-- Whether the member lets others see when they are online and typing
+ALTER TABLE users ADD COLUMN share_presence INTEGER NOT NULL DEFAULT 1;
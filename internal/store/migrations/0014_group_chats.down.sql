@@ -0,0 +1,4 @@
+UPDATE messages SET type = 'text' WHERE type = 'system';
+
+ALTER TABLE conversation_participants DROP COLUMN joined_seq;
+ALTER TABLE conversation_participants DROP COLUMN role;
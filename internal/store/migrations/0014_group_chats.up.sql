@@ -0,0 +1,16 @@
+-- Admins manage a group conversation's name, avatar and members
+ALTER TABLE conversation_participants ADD COLUMN role TEXT NOT NULL DEFAULT 'member'
+    CHECK (role IN ('admin', 'member'));
+
+-- The last message stored before the participant joined: they only see
+-- what came after. Everyone here so far sees the whole history.
+ALTER TABLE conversation_participants ADD COLUMN joined_seq INTEGER NOT NULL DEFAULT 0;
+
+-- Each group starts with its longest-standing participant as admin
+UPDATE conversation_participants SET role = 'admin'
+WHERE conversation_id IN (SELECT id FROM conversations WHERE is_group = 1)
+    AND user_id = (
+        SELECT p.user_id FROM conversation_participants p
+        WHERE p.conversation_id = conversation_participants.conversation_id
+        ORDER BY p.joined_at, p.user_id
+        LIMIT 1);
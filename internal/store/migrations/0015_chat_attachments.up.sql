@@ -0,0 +1,19 @@
+-- Files sent in chat, kept in the database with the messages that carry
+-- them so a node stays a single file to back up. Images get a JPEG
+-- thumbnail. The attachment is stored before its message is sent, so
+-- message_id is not a foreign key; it is only reachable through the
+-- message, by those who can see it.
+CREATE TABLE chat_attachments (
+    id              TEXT PRIMARY KEY,
+    conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    message_id      TEXT NOT NULL,
+    uploader_id     TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind            TEXT NOT NULL CHECK (kind IN ('image', 'voice', 'file')),
+    name            TEXT NOT NULL,
+    content_type    TEXT NOT NULL,
+    size            INTEGER NOT NULL,
+    data            BLOB NOT NULL,
+    thumbnail       BLOB,
+    created_at      TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_chat_attachments_message ON chat_attachments(message_id);
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var (
+	_ Store    = (*SQLiteStore)(nil)
+	_ Migrator = (*SQLiteStore)(nil)
+)
+
+// SQLiteStore is the embedded, file-backed Store used by a running node.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens (creating if needed) the database file at path. The
+// schema is managed separately through MigrateUp.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %v", err)
+		}
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	// Transactions take the write lock as they begin. A deferred one that
+	// reads first can't upgrade its lock while another writer holds it,
+	// and fails with SQLITE_BUSY however long busy_timeout is.
+	params.Add("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// withTx runs fn inside a transaction, rolling back if it returns an error.
+func (s *SQLiteStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// jsonColumn encodes v for a nullable JSON column, storing NULL for nil
+// pointers and empty slices.
+func jsonColumn(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == "null" || string(data) == "[]" {
+		return nil, nil
+	}
+	return string(data), nil
+}
+
+func decodeJSON(col sql.NullString, dst any) error {
+	if !col.Valid || col.String == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(col.String), dst)
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// uniqueViolation reports whether err is the UNIQUE constraint on column,
+// named as table.column, failing.
+func uniqueViolation(err error, column string) bool {
+	var e *sqlite.Error
+	return errors.As(err, &e) && e.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE &&
+		strings.Contains(e.Error(), "UNIQUE constraint failed: "+column)
+}
+
+// changedOne maps an UPDATE or DELETE that matched no rows to ErrNotFound.
+func changedOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"circles.diy/internal/models"
+)
+
+// CreateAccount and SaveAccount write straight away and map the unique
+// indexes failing to ErrHandleTaken and ErrEmailTaken, so two people signing
+// up at once can't both pass a check made before either writes.
+func (s *SQLiteStore) CreateAccount(ctx context.Context, user models.User, account models.Account) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		createdAt := orNow(account.CreatedAt)
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO users (id, handle, name, avatar, bio, banner, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			user.ID, user.Handle, user.Name, user.Avatar, user.Bio, user.Banner, createdAt)
+		if uniqueViolation(err, "users.handle") {
+			return ErrHandleTaken
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO accounts (user_id, email, password_hash, created_at) VALUES (?, ?, ?, ?)`,
+			user.ID, account.Email, account.PasswordHash, createdAt)
+		if uniqueViolation(err, "accounts.email") {
+			return ErrEmailTaken
+		}
+		return err
+	})
+}
+
+func (s *SQLiteStore) SaveAccount(ctx context.Context, account models.Account) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO accounts (user_id, email, password_hash, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			email = excluded.email,
+			password_hash = excluded.password_hash`,
+		account.UserID, account.Email, account.PasswordHash, orNow(account.CreatedAt))
+	if uniqueViolation(err, "accounts.email") {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func (s *SQLiteStore) getAccount(ctx context.Context, where string, arg any) (models.Account, error) {
+	var a models.Account
+	err := s.db.QueryRowContext(ctx, `
+		SELECT user_id, email, password_hash, created_at FROM accounts WHERE `+where, arg).
+		Scan(&a.UserID, &a.Email, &a.PasswordHash, &a.CreatedAt)
+	return a, notFound(err)
+}
+
+func (s *SQLiteStore) GetAccount(ctx context.Context, userID string) (models.Account, error) {
+	return s.getAccount(ctx, `user_id = ?`, userID)
+}
+
+func (s *SQLiteStore) GetAccountByEmail(ctx context.Context, email string) (models.Account, error) {
+	return s.getAccount(ctx, `email = ?`, email)
+}
+
+func (s *SQLiteStore) CreateSession(ctx context.Context, session models.Session) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM sessions WHERE user_id = ? AND expires_at <= ?`, session.UserID, now()); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO sessions (id, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+			session.ID, session.UserID, orNow(session.CreatedAt), session.ExpiresAt.UTC())
+		return err
+	})
+}
+
+func (s *SQLiteStore) GetSession(ctx context.Context, id string) (models.Session, error) {
+	var session models.Session
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, user_id, created_at, expires_at FROM sessions
+		WHERE id = ? AND expires_at > ?`, id, now()).
+		Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt)
+	return session, notFound(err)
+}
+
+func (s *SQLiteStore) ExtendSession(ctx context.Context, id string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE sessions SET expires_at = ? WHERE id = ?`, expiresAt.UTC(), id)
+	return err
+}
+
+func (s *SQLiteStore) DeleteSession(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, id)
+	return err
+}
+
+func (s *SQLiteStore) CreateLoginToken(ctx context.Context, token models.LoginToken) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM login_tokens
+			WHERE user_id = ? AND (used_at IS NOT NULL OR expires_at <= ?)`,
+			token.UserID, now()); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO login_tokens (id, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+			token.ID, token.UserID, orNow(token.CreatedAt), token.ExpiresAt.UTC())
+		return err
+	})
+}
+
+func (s *SQLiteStore) ConsumeLoginToken(ctx context.Context, id string) (models.LoginToken, error) {
+	var token models.LoginToken
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		t := now()
+		err := tx.QueryRowContext(ctx, `
+			UPDATE login_tokens SET used_at = ?
+			WHERE id = ? AND used_at IS NULL AND expires_at > ?
+			RETURNING id, user_id, created_at, expires_at`, t, id, t).
+			Scan(&token.ID, &token.UserID, &token.CreatedAt, &token.ExpiresAt)
+		if err != nil {
+			return notFound(err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE login_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL`,
+			t, token.UserID)
+		return err
+	})
+	return token, err
+}
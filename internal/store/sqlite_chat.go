@@ -0,0 +1,447 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"circles.diy/internal/models"
+	"circles.diy/internal/utils"
+)
+
+// execer runs statements on the database or in a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (s *SQLiteStore) SaveConversation(ctx context.Context, c models.Conversation) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return saveConversation(ctx, tx, c)
+	})
+}
+
+func saveConversation(ctx context.Context, tx *sql.Tx, c models.Conversation) error {
+	createdAt := orNow(c.CreatedAt)
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO conversations (id, name, avatar, is_group, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			avatar = excluded.avatar,
+			is_group = excluded.is_group`,
+		c.ID, c.Name, c.Avatar, c.IsGroup, createdAt); err != nil {
+		return err
+	}
+	for _, p := range c.Participants {
+		if err := addParticipant(ctx, tx, c.ID, p.ID, createdAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addParticipant adds userID as a member who has read, and can see, only
+// what is sent after they join.
+func addParticipant(ctx context.Context, tx *sql.Tx, conversationID, userID string, joinedAt any) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO conversation_participants (conversation_id, user_id, joined_at, joined_seq, last_read_seq)
+		SELECT ?, ?, ?, seq, seq FROM (SELECT COALESCE(MAX(seq), 0) AS seq FROM messages) WHERE true
+		ON CONFLICT DO NOTHING`, conversationID, userID, joinedAt)
+	return err
+}
+
+func (s *SQLiteStore) AddParticipant(ctx context.Context, conversationID, userID string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return addParticipant(ctx, tx, conversationID, userID, now())
+	})
+}
+
+func (s *SQLiteStore) GetParticipantRole(ctx context.Context, conversationID, userID string) (string, error) {
+	var role string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT role FROM conversation_participants WHERE conversation_id = ? AND user_id = ?`,
+		conversationID, userID).Scan(&role)
+	return role, notFound(err)
+}
+
+func (s *SQLiteStore) SetParticipantRole(ctx context.Context, conversationID, userID, role string) error {
+	if role != models.GroupAdmin && role != models.GroupMember {
+		return ErrInvalidRole
+	}
+	return setParticipantRole(ctx, s.db, conversationID, userID, role)
+}
+
+func setParticipantRole(ctx context.Context, db execer, conversationID, userID, role string) error {
+	return changedOne(db.ExecContext(ctx, `
+		UPDATE conversation_participants SET role = ? WHERE conversation_id = ? AND user_id = ?`,
+		role, conversationID, userID))
+}
+
+func (s *SQLiteStore) ListParticipants(ctx context.Context, conversationID string) ([]models.ConversationMember, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+userColumns+`, p.role, p.joined_at
+		FROM conversation_participants p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.conversation_id = ?
+		ORDER BY CASE p.role WHEN 'admin' THEN 0 ELSE 1 END, p.joined_at, u.handle`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.ConversationMember
+	for rows.Next() {
+		var m models.ConversationMember
+		if err := rows.Scan(&m.User.ID, &m.User.Handle, &m.User.Name, &m.User.Avatar, &m.User.Bio, &m.User.Banner,
+			&m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		m.JoinedDate = utils.TimeAgoLong(m.JoinedAt)
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (s *SQLiteStore) RemoveParticipant(ctx context.Context, conversationID, userID string) error {
+	return removeParticipant(ctx, s.db, conversationID, userID)
+}
+
+func removeParticipant(ctx context.Context, db execer, conversationID, userID string) error {
+	return changedOne(db.ExecContext(ctx, `
+		DELETE FROM conversation_participants WHERE conversation_id = ? AND user_id = ?`,
+		conversationID, userID))
+}
+
+func (s *SQLiteStore) CreateGroup(ctx context.Context, group models.Conversation, adminID string, message models.Message) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := saveConversation(ctx, tx, group); err != nil {
+			return err
+		}
+		if err := setParticipantRole(ctx, tx, group.ID, adminID, models.GroupAdmin); err != nil {
+			return err
+		}
+		return saveMessage(ctx, tx, group.ID, message)
+	})
+}
+
+func (s *SQLiteStore) AddGroupMembers(ctx context.Context, conversationID string, userIDs []string, message models.Message) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		joinedAt := now()
+		for _, id := range userIDs {
+			if err := addParticipant(ctx, tx, conversationID, id, joinedAt); err != nil {
+				return err
+			}
+		}
+		return saveMessage(ctx, tx, conversationID, message)
+	})
+}
+
+func (s *SQLiteStore) LeaveGroup(ctx context.Context, conversationID, userID string, left models.Message, promoted func(models.User) models.Message) (models.User, error) {
+	var successor models.User
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Stored first, while the member can still see their own message
+		if err := saveMessage(ctx, tx, conversationID, left); err != nil {
+			return err
+		}
+		if err := removeParticipant(ctx, tx, conversationID, userID); err != nil {
+			return err
+		}
+
+		u, err := scanUser(tx.QueryRowContext(ctx, `
+			SELECT `+userColumns+`
+			FROM conversation_participants p
+			JOIN users u ON u.id = p.user_id
+			WHERE p.conversation_id = ? AND NOT EXISTS (
+				SELECT 1 FROM conversation_participants a WHERE a.conversation_id = p.conversation_id AND a.role = 'admin')
+			ORDER BY p.joined_at, u.handle
+			LIMIT 1`, conversationID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := setParticipantRole(ctx, tx, conversationID, u.ID, models.GroupAdmin); err != nil {
+			return err
+		}
+		successor = u
+		return saveMessage(ctx, tx, conversationID, promoted(u))
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return successor, nil
+}
+
+// conversationQuery selects userID's conversations with their role, the
+// number of messages from others past their read cursor, and whether any
+// other participant is online. It takes userID twice.
+const conversationQuery = `
+	SELECT c.id, c.name, c.avatar, c.is_group, c.created_at, me.role,
+		(SELECT COUNT(*) FROM messages um
+			WHERE um.conversation_id = c.id AND um.sender_id != me.user_id AND um.seq > me.last_read_seq),
+		EXISTS (SELECT 1 FROM conversation_participants op JOIN users u ON u.id = op.user_id
+			WHERE op.conversation_id = c.id AND op.user_id != ? AND u.is_online = 1)
+	FROM conversations c
+	JOIN conversation_participants me ON me.conversation_id = c.id AND me.user_id = ?`
+
+func (s *SQLiteStore) ListConversations(ctx context.Context, userID string) ([]models.Conversation, error) {
+	rows, err := s.db.QueryContext(ctx, conversationQuery+`
+		ORDER BY COALESCE((SELECT MAX(created_at) FROM messages WHERE conversation_id = c.id), c.created_at) DESC`,
+		userID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var conversations []models.Conversation
+	for rows.Next() {
+		var c models.Conversation
+		if err := rows.Scan(&c.ID, &c.Name, &c.Avatar, &c.IsGroup, &c.CreatedAt, &c.UserRole, &c.UnreadCount, &c.IsOnline); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range conversations {
+		if err := s.finishConversation(ctx, &conversations[i], userID); err != nil {
+			return nil, err
+		}
+	}
+	return conversations, nil
+}
+
+func (s *SQLiteStore) GetConversation(ctx context.Context, conversationID, userID string) (models.Conversation, error) {
+	var c models.Conversation
+	err := s.db.QueryRowContext(ctx, conversationQuery+` WHERE c.id = ?`, userID, userID, conversationID).
+		Scan(&c.ID, &c.Name, &c.Avatar, &c.IsGroup, &c.CreatedAt, &c.UserRole, &c.UnreadCount, &c.IsOnline)
+	if err != nil {
+		return c, notFound(err)
+	}
+	return c, s.finishConversation(ctx, &c, userID)
+}
+
+// finishConversation loads the other participants and the last message.
+func (s *SQLiteStore) finishConversation(ctx context.Context, c *models.Conversation, userID string) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM conversation_participants p JOIN users u ON u.id = p.user_id
+		WHERE p.conversation_id = ? AND p.user_id != ?
+		ORDER BY p.joined_at, u.name`, c.ID, userID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		c.Participants = append(c.Participants, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if !c.IsGroup && len(c.Participants) > 0 {
+		c.Name = c.Participants[0].Name
+		c.Avatar = c.Participants[0].Avatar
+	}
+
+	messages, err := s.queryMessages(ctx, userID, `
+		SELECT `+messageColumns+` `+messageJoins+`
+		WHERE m.conversation_id = ?
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT 1`, userID, c.ID)
+	if err != nil {
+		return err
+	}
+	if len(messages) > 0 {
+		lastMessagePreview(c, &messages[0])
+	}
+	return nil
+}
+
+// messageColumns selects a message with its sender, whether it is in a
+// group, and how many other participants who send read receipts have read
+// it since joining.
+const messageColumns = `m.id, m.conversation_id, m.content, m.type, m.media, m.created_at,
+	u.id, u.handle, u.name, u.avatar,
+	(SELECT is_group FROM conversations WHERE id = m.conversation_id),
+	(SELECT COUNT(*) FROM conversation_participants rp JOIN users ru ON ru.id = rp.user_id
+		WHERE rp.conversation_id = m.conversation_id AND rp.user_id != m.sender_id
+			AND rp.joined_seq < m.seq AND rp.last_read_seq >= m.seq AND ru.read_receipts = 1)`
+
+// messageJoins takes the viewer's ID and keeps to the messages they can
+// see: those in their conversations sent since they joined.
+const messageJoins = `FROM messages m JOIN users u ON u.id = m.sender_id
+	JOIN conversation_participants p ON p.conversation_id = m.conversation_id
+		AND p.user_id = ? AND m.seq > p.joined_seq`
+
+func (s *SQLiteStore) queryMessages(ctx context.Context, viewerID, query string, args ...any) ([]models.Message, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		var m models.Message
+		var media sql.NullString
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Content, &m.Type, &media, &m.CreatedAt,
+			&m.Sender.ID, &m.Sender.Handle, &m.Sender.Name, &m.Sender.Avatar, &m.InGroup, &m.ReadBy); err != nil {
+			return nil, err
+		}
+		if err := decodeJSON(media, &m.Media); err != nil {
+			return nil, err
+		}
+		finishMessage(&m, viewerID)
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (s *SQLiteStore) SaveMessage(ctx context.Context, conversationID string, m models.Message) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return saveMessage(ctx, tx, conversationID, m)
+	})
+}
+
+func saveMessage(ctx context.Context, tx *sql.Tx, conversationID string, m models.Message) error {
+	media, err := jsonColumn(m.Media)
+	if err != nil {
+		return err
+	}
+	msgType := m.Type
+	if msgType == "" {
+		msgType = "text"
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO messages (id, conversation_id, sender_id, content, type, media, created_at, seq)
+		VALUES (?, ?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM messages))
+		ON CONFLICT(id) DO NOTHING`,
+		m.ID, conversationID, m.Sender.ID, m.Content, msgType, media, orNow(m.CreatedAt))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	// The sender has read what they wrote
+	_, err = tx.ExecContext(ctx, `
+		UPDATE conversation_participants
+		SET last_read_seq = MAX(last_read_seq, (SELECT seq FROM messages WHERE id = ?))
+		WHERE conversation_id = ? AND user_id = ?`, m.ID, conversationID, m.Sender.ID)
+	return err
+}
+
+func (s *SQLiteStore) GetMessage(ctx context.Context, id, viewerID string) (models.Message, error) {
+	messages, err := s.queryMessages(ctx, viewerID, `
+		SELECT `+messageColumns+` `+messageJoins+`
+		WHERE m.id = ?`, viewerID, id)
+	if err != nil {
+		return models.Message{}, err
+	}
+	if len(messages) == 0 {
+		return models.Message{}, ErrNotFound
+	}
+	return messages[0], nil
+}
+
+// ListMessages returns the most recent messages in the conversation, oldest
+// first.
+func (s *SQLiteStore) ListMessages(ctx context.Context, conversationID, viewerID string, limit int) ([]models.Message, error) {
+	messages, err := s.queryMessages(ctx, viewerID, `
+		SELECT `+messageColumns+` `+messageJoins+`
+		WHERE m.conversation_id = ?
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ?`, viewerID, conversationID, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func (s *SQLiteStore) ListMessagesAfter(ctx context.Context, userID, afterID string, limit int) ([]models.Message, error) {
+	var seq int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT m.seq FROM messages m
+		JOIN conversation_participants p ON p.conversation_id = m.conversation_id AND p.user_id = ?
+		WHERE m.id = ? AND m.seq > p.joined_seq`, userID, afterID).Scan(&seq)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return s.queryMessages(ctx, userID, `
+		SELECT `+messageColumns+` `+messageJoins+`
+		WHERE m.seq > ?
+		ORDER BY m.seq
+		LIMIT ?`, userID, seq, limit)
+}
+
+func (s *SQLiteStore) LatestMessageID(ctx context.Context, userID string) (string, error) {
+	var id string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT m.id FROM messages m
+		JOIN conversation_participants p ON p.conversation_id = m.conversation_id AND p.user_id = ?
+		WHERE m.seq > p.joined_seq
+		ORDER BY m.seq DESC
+		LIMIT 1`, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
+func (s *SQLiteStore) MarkConversationRead(ctx context.Context, conversationID, userID string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE conversation_participants
+		SET last_read_seq = (SELECT MAX(seq) FROM messages WHERE conversation_id = ?)
+		WHERE conversation_id = ? AND user_id = ?
+			AND last_read_seq < (SELECT COALESCE(MAX(seq), 0) FROM messages WHERE conversation_id = ?)`,
+		conversationID, conversationID, userID, conversationID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLiteStore) SaveAttachment(ctx context.Context, a models.Attachment, message models.Message) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO chat_attachments
+				(id, conversation_id, message_id, uploader_id, kind, name, content_type, size, data, thumbnail, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			a.ID, a.ConversationID, a.MessageID, a.UploaderID, a.Kind, a.Name, a.ContentType, a.Size,
+			a.Data, a.Thumbnail, orNow(a.CreatedAt)); err != nil {
+			return err
+		}
+		return saveMessage(ctx, tx, a.ConversationID, message)
+	})
+}
+
+func (s *SQLiteStore) GetAttachment(ctx context.Context, id, viewerID string, thumbnail bool) (models.Attachment, error) {
+	var a models.Attachment
+	err := s.db.QueryRowContext(ctx, `
+		SELECT a.id, a.conversation_id, a.message_id, a.uploader_id, a.kind, a.name, a.content_type, a.size,
+			a.thumbnail IS NOT NULL,
+			CASE WHEN ? AND a.thumbnail IS NOT NULL THEN a.thumbnail ELSE a.data END,
+			a.created_at
+		FROM chat_attachments a
+		JOIN messages m ON m.id = a.message_id AND m.conversation_id = a.conversation_id
+		JOIN conversation_participants p ON p.conversation_id = m.conversation_id
+			AND p.user_id = ? AND m.seq > p.joined_seq
+		WHERE a.id = ?`, thumbnail, viewerID, id).
+		Scan(&a.ID, &a.ConversationID, &a.MessageID, &a.UploaderID, &a.Kind, &a.Name, &a.ContentType, &a.Size,
+			&a.HasThumbnail, &a.Data, &a.CreatedAt)
+	return a, notFound(err)
+}
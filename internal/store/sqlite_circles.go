@@ -0,0 +1,371 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"circles.diy/internal/authz"
+	"circles.diy/internal/models"
+	"circles.diy/internal/utils"
+)
+
+const circleColumns = `c.id, c.name, c.description, c.thumbnail, c.banner, c.visibility,
+	(SELECT COUNT(*) FROM circle_members cm WHERE cm.circle_id = c.id),
+	c.active, c.featured, c.last_activity_at,
+	c.created_at, c.archived_at, c.delete_at`
+
+// scanCircle scans circleColumns followed by the viewer's role and join date.
+func scanCircle(row interface{ Scan(...any) error }) (models.Circle, error) {
+	var c models.Circle
+	var lastActivity, createdAt, archivedAt, deleteAt, joinedAt sql.NullTime
+	var role sql.NullString
+	err := row.Scan(&c.ID, &c.Name, &c.Description, &c.Thumbnail, &c.Banner, &c.Visibility,
+		&c.MemberCount, &c.Active, &c.Featured, &lastActivity,
+		&createdAt, &archivedAt, &deleteAt,
+		&role, &joinedAt)
+	if err != nil {
+		return c, err
+	}
+	c.LastActivityAt = lastActivity.Time
+	c.CreatedAt = createdAt.Time
+	c.ArchivedAt = archivedAt.Time
+	c.DeleteAt = deleteAt.Time
+	c.UserRole = role.String
+	finishCircle(&c, joinedAt.Time)
+	return c, nil
+}
+
+func (s *SQLiteStore) SaveCircle(ctx context.Context, c models.Circle) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO circles (id, name, description, thumbnail, banner, visibility,
+			active, featured, last_activity_at, created_at, archived_at, delete_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			description = excluded.description,
+			thumbnail = excluded.thumbnail,
+			banner = excluded.banner,
+			visibility = excluded.visibility,
+			active = excluded.active,
+			featured = excluded.featured,
+			last_activity_at = excluded.last_activity_at,
+			created_at = excluded.created_at,
+			archived_at = excluded.archived_at,
+			delete_at = excluded.delete_at`,
+		c.ID, c.Name, c.Description, c.Thumbnail, c.Banner, circleVisibility(c.Visibility),
+		c.Active, c.Featured, nullTime(c.LastActivityAt),
+		orNow(c.CreatedAt), nullTime(c.ArchivedAt), nullTime(c.DeleteAt))
+	return err
+}
+
+func (s *SQLiteStore) CreateCircle(ctx context.Context, c models.Circle, ownerID string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		createdAt := orNow(c.CreatedAt)
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO circles (id, name, description, thumbnail, banner, visibility,
+				last_activity_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			c.ID, c.Name, c.Description, c.Thumbnail, c.Banner, circleVisibility(c.Visibility),
+			createdAt, createdAt); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO circle_members (circle_id, user_id, role, joined_at) VALUES (?, ?, 'owner', ?)`,
+			c.ID, ownerID, createdAt)
+		return err
+	})
+}
+
+func (s *SQLiteStore) UpdateCircleSettings(ctx context.Context, c models.Circle) error {
+	return changedOne(s.db.ExecContext(ctx, `
+		UPDATE circles SET name = ?, description = ?, thumbnail = ?, banner = ?, visibility = ?
+		WHERE id = ?`,
+		c.Name, c.Description, c.Thumbnail, c.Banner, circleVisibility(c.Visibility), c.ID))
+}
+
+func (s *SQLiteStore) TransferOwnership(ctx context.Context, circleID, fromID, toID string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		// Demote first: the owner index allows only one owner at a time
+		if err := changedOne(tx.ExecContext(ctx, `
+			UPDATE circle_members SET role = 'admin'
+			WHERE circle_id = ? AND user_id = ? AND role = 'owner'`, circleID, fromID)); err != nil {
+			return err
+		}
+		return changedOne(tx.ExecContext(ctx, `
+			UPDATE circle_members SET role = 'owner'
+			WHERE circle_id = ? AND user_id = ? AND user_id != ?`, circleID, toID, fromID))
+	})
+}
+
+func (s *SQLiteStore) ArchiveCircle(ctx context.Context, circleID string, at, deleteAt time.Time) error {
+	return changedOne(s.db.ExecContext(ctx, `
+		UPDATE circles SET archived_at = COALESCE(archived_at, ?), delete_at = ?
+		WHERE id = ?`, orNow(at), nullTime(deleteAt), circleID))
+}
+
+func (s *SQLiteStore) RestoreCircle(ctx context.Context, circleID string) error {
+	return changedOne(s.db.ExecContext(ctx,
+		`UPDATE circles SET archived_at = NULL, delete_at = NULL WHERE id = ?`, circleID))
+}
+
+func (s *SQLiteStore) PurgeCircles(ctx context.Context, cutoff time.Time) (int, error) {
+	var purged int64
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Posts would otherwise outlive their circle as profile posts
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM posts WHERE circle_id IN
+				(SELECT id FROM circles WHERE delete_at IS NOT NULL AND delete_at <= ?)`,
+			cutoff.UTC()); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx,
+			`DELETE FROM circles WHERE delete_at IS NOT NULL AND delete_at <= ?`, cutoff.UTC())
+		if err != nil {
+			return err
+		}
+		purged, err = res.RowsAffected()
+		return err
+	})
+	return int(purged), err
+}
+
+func (s *SQLiteStore) GetCircle(ctx context.Context, id, viewerID string) (models.Circle, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+circleColumns+`, m.role, m.joined_at
+		FROM circles c
+		LEFT JOIN circle_members m ON m.circle_id = c.id AND m.user_id = ?
+		WHERE c.id = ?`, viewerID, id)
+	c, err := scanCircle(row)
+	return c, notFound(err)
+}
+
+func (s *SQLiteStore) AddMember(ctx context.Context, circleID, userID, role string, joinedAt time.Time) error {
+	if _, ok := authz.ParseRole(role); !ok {
+		return ErrInvalidRole
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO circle_members (circle_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(circle_id, user_id) DO UPDATE SET role = excluded.role`,
+		circleID, userID, role, orNow(joinedAt))
+	return err
+}
+
+func (s *SQLiteStore) GetMemberRole(ctx context.Context, circleID, userID string) (string, error) {
+	var role string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT role FROM circle_members WHERE circle_id = ? AND user_id = ?`, circleID, userID).Scan(&role)
+	return role, notFound(err)
+}
+
+func (s *SQLiteStore) SetMemberRole(ctx context.Context, circleID, userID, role string) error {
+	if _, ok := authz.ParseRole(role); !ok {
+		return ErrInvalidRole
+	}
+	return changedOne(s.db.ExecContext(ctx,
+		`UPDATE circle_members SET role = ? WHERE circle_id = ? AND user_id = ?`, role, circleID, userID))
+}
+
+func (s *SQLiteStore) CountMembersAmong(ctx context.Context, circleIDs, userIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(circleIDs) == 0 || len(userIDs) == 0 {
+		return counts, nil
+	}
+	args := make([]any, 0, len(circleIDs)+len(userIDs))
+	for _, id := range circleIDs {
+		args = append(args, id)
+	}
+	for _, id := range userIDs {
+		args = append(args, id)
+	}
+	circlePlaceholders := strings.TrimSuffix(strings.Repeat("?,", len(circleIDs)), ",")
+	userPlaceholders := strings.TrimSuffix(strings.Repeat("?,", len(userIDs)), ",")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT circle_id, COUNT(*) FROM circle_members
+		WHERE circle_id IN (`+circlePlaceholders+`)
+			AND user_id IN (`+userPlaceholders+`)
+		GROUP BY circle_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var circleID string
+		var n int
+		if err := rows.Scan(&circleID, &n); err != nil {
+			return nil, err
+		}
+		counts[circleID] = n
+	}
+	return counts, rows.Err()
+}
+
+func (s *SQLiteStore) ListMembers(ctx context.Context, circleID string) ([]models.CircleMember, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+userColumns+`, m.role, m.joined_at
+		FROM circle_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.circle_id = ?
+		ORDER BY CASE m.role
+			WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 WHEN 'moderator' THEN 2
+			WHEN 'member' THEN 3 ELSE 4 END, m.joined_at, u.handle`, circleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.CircleMember
+	for rows.Next() {
+		var m models.CircleMember
+		if err := rows.Scan(&m.User.ID, &m.User.Handle, &m.User.Name, &m.User.Avatar, &m.User.Bio, &m.User.Banner,
+			&m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		m.JoinedDate = utils.TimeAgoLong(m.JoinedAt)
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (s *SQLiteStore) queryCircles(ctx context.Context, query string, args ...any) ([]models.Circle, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var circles []models.Circle
+	for rows.Next() {
+		c, err := scanCircle(rows)
+		if err != nil {
+			return nil, err
+		}
+		circles = append(circles, c)
+	}
+	return circles, rows.Err()
+}
+
+func (s *SQLiteStore) ListCirclesForUser(ctx context.Context, userID string) ([]models.Circle, error) {
+	return s.queryCircles(ctx, `
+		SELECT `+circleColumns+`, m.role, m.joined_at
+		FROM circles c
+		JOIN circle_members m ON m.circle_id = c.id
+		WHERE m.user_id = ?
+		ORDER BY c.last_activity_at DESC, c.name`, userID)
+}
+
+func (s *SQLiteStore) ListFeaturedCircles(ctx context.Context, viewerID string, limit int) ([]models.Circle, error) {
+	return s.queryCircles(ctx, `
+		SELECT `+circleColumns+`, NULL, NULL
+		FROM circles c
+		WHERE c.featured = 1 AND c.visibility = 'public' AND c.archived_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM circle_members m WHERE m.circle_id = c.id AND m.user_id = ?)
+		ORDER BY c.name
+		LIMIT ?`, viewerID, limit)
+}
+
+func (s *SQLiteStore) GetCircleStats(ctx context.Context, userID string) (models.CircleStats, error) {
+	var stats models.CircleStats
+	var members, newMembers, posters int
+	weekAgo := now().AddDate(0, 0, -7)
+	monthAgo := now().AddDate(0, 0, -30)
+	err := s.db.QueryRowContext(ctx, `
+		WITH mine AS (SELECT circle_id FROM circle_members WHERE user_id = ?)
+		SELECT
+			(SELECT COUNT(*) FROM posts
+				WHERE circle_id IN (SELECT circle_id FROM mine) AND status = 'published'),
+			(SELECT COUNT(DISTINCT user_id) FROM circle_members
+				WHERE circle_id IN (SELECT circle_id FROM mine)),
+			(SELECT COUNT(*) FROM circle_members
+				WHERE circle_id IN (SELECT circle_id FROM mine)),
+			(SELECT COUNT(*) FROM circle_members
+				WHERE circle_id IN (SELECT circle_id FROM mine) AND joined_at > ?),
+			(SELECT COUNT(DISTINCT author_id) FROM posts
+				WHERE circle_id IN (SELECT circle_id FROM mine) AND status = 'published' AND created_at > ?)`,
+		userID, weekAgo, monthAgo).
+		Scan(&stats.TotalPosts, &stats.ActiveMembers, &members, &newMembers, &posters)
+	if err != nil {
+		return stats, err
+	}
+	finishCircleStats(&stats, members, newMembers, posters)
+	return stats, nil
+}
+
+func (s *SQLiteStore) SaveCircleActivity(ctx context.Context, a models.CircleActivity) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO circle_activity (id, circle_id, type, title, content, actor, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			circle_id = excluded.circle_id,
+			type = excluded.type,
+			title = excluded.title,
+			content = excluded.content,
+			actor = excluded.actor,
+			created_at = excluded.created_at`,
+		a.ID, a.CircleID, a.Type, a.Title, a.Content, a.User, orNow(a.CreatedAt))
+	return err
+}
+
+func (s *SQLiteStore) ListCircleActivity(ctx context.Context, userID string, limit int) ([]models.CircleActivity, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.id, a.circle_id, a.type, a.title, a.content, a.actor, a.created_at
+		FROM circle_activity a
+		JOIN circle_members m ON m.circle_id = a.circle_id AND m.user_id = ?
+		ORDER BY a.created_at DESC
+		LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []models.CircleActivity
+	for rows.Next() {
+		var a models.CircleActivity
+		if err := rows.Scan(&a.ID, &a.CircleID, &a.Type, &a.Title, &a.Content, &a.User, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.TimeAgo = utils.TimeAgo(a.CreatedAt)
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+func (s *SQLiteStore) SaveDiscussion(ctx context.Context, d models.Discussion) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO discussions (id, circle_id, title, preview, reply_count, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			circle_id = excluded.circle_id,
+			title = excluded.title,
+			preview = excluded.preview,
+			reply_count = excluded.reply_count,
+			updated_at = excluded.updated_at`,
+		d.ID, d.CircleID, d.Title, d.Preview, d.ReplyCount, orNow(d.UpdatedAt))
+	return err
+}
+
+func (s *SQLiteStore) ListDiscussions(ctx context.Context, userID string, limit int) ([]models.Discussion, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.id, d.title, d.preview, c.name, d.circle_id, d.reply_count, d.updated_at
+		FROM discussions d
+		JOIN circles c ON c.id = d.circle_id
+		JOIN circle_members m ON m.circle_id = d.circle_id AND m.user_id = ?
+		ORDER BY d.updated_at DESC
+		LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var discussions []models.Discussion
+	for rows.Next() {
+		var d models.Discussion
+		if err := rows.Scan(&d.ID, &d.Title, &d.Preview, &d.Circle, &d.CircleID, &d.ReplyCount, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		finishDiscussion(&d)
+		discussions = append(discussions, d)
+	}
+	return discussions, rows.Err()
+}
@@ -0,0 +1,274 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"circles.diy/internal/models"
+	"circles.diy/internal/utils"
+)
+
+const eventColumns = `e.id, e.title, e.description, e.circle_id, COALESCE(c.name, ''), e.starts_at,
+	e.duration, e.location, e.type, e.category, e.is_ticketed, e.price, e.currency,
+	e.capacity, e.attendee_count, e.image, e.tags, e.is_featured,
+	h.id, h.handle, h.name, h.avatar, COALESCE(r.status, '')`
+
+// eventJoins expects the viewer ID as its only argument.
+const eventJoins = `FROM events e
+	JOIN users h ON h.id = e.host_id
+	LEFT JOIN circles c ON c.id = e.circle_id
+	LEFT JOIN event_rsvps r ON r.event_id = e.id AND r.user_id = ?`
+
+func (s *SQLiteStore) SaveEvent(ctx context.Context, e models.GatherEvent) error {
+	location, err := jsonColumn(e.Location)
+	if err != nil {
+		return err
+	}
+	image, err := jsonColumn(e.Image)
+	if err != nil {
+		return err
+	}
+	tags, err := jsonColumn(e.Tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO events (id, title, description, host_id, circle_id, starts_at, duration,
+			location, type, category, is_ticketed, price, currency, capacity, attendee_count,
+			image, tags, is_featured)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			title = excluded.title,
+			description = excluded.description,
+			host_id = excluded.host_id,
+			circle_id = excluded.circle_id,
+			starts_at = excluded.starts_at,
+			duration = excluded.duration,
+			location = excluded.location,
+			type = excluded.type,
+			category = excluded.category,
+			is_ticketed = excluded.is_ticketed,
+			price = excluded.price,
+			currency = excluded.currency,
+			capacity = excluded.capacity,
+			attendee_count = excluded.attendee_count,
+			image = excluded.image,
+			tags = excluded.tags,
+			is_featured = excluded.is_featured`,
+		e.ID, e.Title, e.Description, e.Host.ID, nullString(e.CircleID), e.StartsAt.UTC(), e.Duration,
+		location, e.Type, e.Category, e.IsTicketed, e.Price, e.Currency, e.Capacity, e.AttendeeCount,
+		image, tags, e.IsFeatured)
+	return err
+}
+
+func (s *SQLiteStore) queryEvents(ctx context.Context, viewerID, query string, args ...any) ([]models.GatherEvent, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.GatherEvent
+	for rows.Next() {
+		var e models.GatherEvent
+		var circleID, location, image, tags sql.NullString
+		var rsvp string
+		if err := rows.Scan(&e.ID, &e.Title, &e.Description, &circleID, &e.Circle, &e.StartsAt,
+			&e.Duration, &location, &e.Type, &e.Category, &e.IsTicketed, &e.Price, &e.Currency,
+			&e.Capacity, &e.AttendeeCount, &image, &tags, &e.IsFeatured,
+			&e.Host.ID, &e.Host.Handle, &e.Host.Name, &e.Host.Avatar, &rsvp); err != nil {
+			return nil, err
+		}
+		e.CircleID = circleID.String
+		if err := decodeJSON(location, &e.Location); err != nil {
+			return nil, err
+		}
+		if err := decodeJSON(image, &e.Image); err != nil {
+			return nil, err
+		}
+		if err := decodeJSON(tags, &e.Tags); err != nil {
+			return nil, err
+		}
+		finishEvent(&e, viewerID, rsvp)
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, s.attachAnnouncements(ctx, events)
+}
+
+func (s *SQLiteStore) attachAnnouncements(ctx context.Context, events []models.GatherEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ids := make([]any, len(events))
+	index := make(map[string]int, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+		index[e.ID] = i
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.event_id, a.id, a.title, a.content, a.created_at,
+			u.id, u.handle, u.name, u.avatar
+		FROM event_announcements a JOIN users u ON u.id = a.author_id
+		WHERE a.event_id IN (`+placeholders+`)
+		ORDER BY a.created_at DESC`, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventID string
+		var a models.Announcement
+		if err := rows.Scan(&eventID, &a.ID, &a.Title, &a.Content, &a.CreatedAt,
+			&a.Author.ID, &a.Author.Handle, &a.Author.Name, &a.Author.Avatar); err != nil {
+			return err
+		}
+		a.TimeAgo = utils.TimeAgoLong(a.CreatedAt)
+		i := index[eventID]
+		events[i].Announcements = append(events[i].Announcements, a)
+	}
+	return rows.Err()
+}
+
+func (s *SQLiteStore) GetEvent(ctx context.Context, id, viewerID string) (models.GatherEvent, error) {
+	events, err := s.queryEvents(ctx, viewerID, `SELECT `+eventColumns+` `+eventJoins+`
+		WHERE e.id = ?`, viewerID, id)
+	if err != nil {
+		return models.GatherEvent{}, err
+	}
+	if len(events) == 0 {
+		return models.GatherEvent{}, ErrNotFound
+	}
+	return events[0], nil
+}
+
+func (s *SQLiteStore) ListFeaturedEvents(ctx context.Context, viewerID string, limit int) ([]models.GatherEvent, error) {
+	return s.queryEvents(ctx, viewerID, `SELECT `+eventColumns+` `+eventJoins+`
+		WHERE e.is_featured = 1 AND e.starts_at > ?
+		ORDER BY e.starts_at
+		LIMIT ?`, viewerID, now(), limit)
+}
+
+func (s *SQLiteStore) ListUpcomingEvents(ctx context.Context, viewerID string, limit int, after string) ([]models.GatherEvent, string, error) {
+	page, pageArgs, err := keyset("e.starts_at", "e.id", false, after)
+	if err != nil {
+		return nil, "", err
+	}
+	where := `e.is_featured = 0 AND e.host_id != ? AND e.starts_at > ?`
+	args := []any{viewerID, viewerID, now()}
+	if page != "" {
+		where += ` AND ` + page
+		args = append(args, pageArgs...)
+	}
+	events, err := s.queryEvents(ctx, viewerID, `SELECT `+eventColumns+` `+eventJoins+`
+		WHERE `+where+`
+		ORDER BY e.starts_at, e.id
+		LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	events, next := pageOf(events, limit, eventKey)
+	return events, next, nil
+}
+
+func (s *SQLiteStore) ListHostedEvents(ctx context.Context, hostID string) ([]models.GatherEvent, error) {
+	return s.queryEvents(ctx, hostID, `SELECT `+eventColumns+` `+eventJoins+`
+		WHERE e.host_id = ? AND e.starts_at > ?
+		ORDER BY e.starts_at`, hostID, hostID, now())
+}
+
+func (s *SQLiteStore) ListAttendingEvents(ctx context.Context, viewerID string, limit int) ([]models.GatherEvent, error) {
+	return s.queryEvents(ctx, viewerID, `SELECT `+eventColumns+` `+eventJoins+`
+		WHERE (e.host_id = ? OR r.status IN ('going', 'maybe')) AND e.starts_at > ?
+		ORDER BY e.starts_at
+		LIMIT ?`, viewerID, viewerID, now(), limit)
+}
+
+func (s *SQLiteStore) SetRSVP(ctx context.Context, eventID, userID, status string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO event_rsvps (event_id, user_id, status, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(event_id, user_id) DO UPDATE SET status = excluded.status`,
+		eventID, userID, status, now())
+	return err
+}
+
+func (s *SQLiteStore) SaveAnnouncement(ctx context.Context, eventID string, a models.Announcement) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO event_announcements (id, event_id, author_id, title, content, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			title = excluded.title,
+			content = excluded.content`,
+		a.ID, eventID, a.Author.ID, a.Title, a.Content, orNow(a.CreatedAt))
+	return err
+}
+
+func (s *SQLiteStore) SaveEventCategory(ctx context.Context, c models.EventCategory, position int) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO event_categories (id, name, icon, position) VALUES (?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			icon = excluded.icon,
+			position = excluded.position`,
+		c.ID, c.Name, c.Icon, position)
+	return err
+}
+
+func (s *SQLiteStore) ListEventCategories(ctx context.Context) ([]models.EventCategory, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.id, c.name, c.icon,
+			(SELECT COUNT(*) FROM events e
+				WHERE LOWER(e.category) IN (c.id, LOWER(c.name)) AND e.starts_at > ?)
+		FROM event_categories c
+		ORDER BY c.position, c.name`, now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.EventCategory
+	for rows.Next() {
+		var c models.EventCategory
+		if err := rows.Scan(&c.ID, &c.Name, &c.Icon, &c.Count); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// ListEventLocations returns the most used event locations.
+func (s *SQLiteStore) ListEventLocations(ctx context.Context, limit int) ([]models.EventLocation, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT location FROM events
+		WHERE location IS NOT NULL
+		GROUP BY json_extract(location, '$.name')
+		ORDER BY COUNT(*) DESC, json_extract(location, '$.name')
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locations []models.EventLocation
+	for rows.Next() {
+		var col sql.NullString
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		var l models.EventLocation
+		if err := decodeJSON(col, &l); err != nil {
+			return nil, err
+		}
+		locations = append(locations, models.EventLocation{Type: l.Type, Name: l.Name, City: l.City})
+	}
+	return locations, rows.Err()
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"circles.diy/internal/models"
+	"circles.diy/internal/utils"
+)
+
+func (s *SQLiteStore) SaveMarketplaceItem(ctx context.Context, item models.MarketplaceItem) error {
+	image, err := jsonColumn(item.Image)
+	if err != nil {
+		return err
+	}
+	images, err := jsonColumn(item.Images)
+	if err != nil {
+		return err
+	}
+	tags, err := jsonColumn(item.Tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO marketplace_items (id, title, description, price, price_type, image, images,
+			location, distance, seller_id, circle_id, category, tags, condition, is_available,
+			view_count, is_featured, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			title = excluded.title,
+			description = excluded.description,
+			price = excluded.price,
+			price_type = excluded.price_type,
+			image = excluded.image,
+			images = excluded.images,
+			location = excluded.location,
+			distance = excluded.distance,
+			circle_id = excluded.circle_id,
+			category = excluded.category,
+			tags = excluded.tags,
+			condition = excluded.condition,
+			is_available = excluded.is_available,
+			view_count = excluded.view_count,
+			is_featured = excluded.is_featured`,
+		item.ID, item.Title, item.Description, item.Price, item.PriceType, image, images,
+		item.Location, item.Distance, item.Seller.ID, nullString(item.CircleID), item.Category, tags,
+		item.Condition, item.IsAvailable, item.ViewCount, item.IsFeatured, orNow(item.CreatedAt))
+	return err
+}
+
+// marketplaceWhere builds the WHERE clause shared by listing and counting.
+func marketplaceWhere(q MarketplaceQuery) (string, []any) {
+	clauses := []string{"i.is_available = 1"}
+	var args []any
+	add := func(clause string, arg any) {
+		clauses = append(clauses, clause)
+		args = append(args, arg)
+	}
+	if q.Category != "" {
+		add("i.category = ?", q.Category)
+	}
+	if q.PriceType != "" {
+		add("i.price_type = ?", q.PriceType)
+	}
+	if q.Location != "" {
+		add("i.location = ?", q.Location)
+	}
+	if q.Condition != "" {
+		add("i.condition = ?", q.Condition)
+	}
+	if q.Featured != nil {
+		add("i.is_featured = ?", *q.Featured)
+	}
+	return "WHERE " + strings.Join(clauses, " AND "), args
+}
+
+func (s *SQLiteStore) ListMarketplaceItems(ctx context.Context, q MarketplaceQuery) ([]models.MarketplaceItem, string, error) {
+	where, args := marketplaceWhere(q)
+	page, pageArgs, err := keyset("i.created_at", "i.id", true, q.After)
+	if err != nil {
+		return nil, "", err
+	}
+	if page != "" {
+		where += " AND " + page
+		args = append(args, pageArgs...)
+	}
+	limit := -1
+	if q.Limit > 0 {
+		limit = q.Limit + 1
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT i.id, i.title, i.description, i.price, i.price_type, i.image, i.images,
+			i.location, i.distance, i.circle_id, COALESCE(c.name, ''), i.category, i.tags,
+			i.condition, i.is_available, i.view_count, i.is_featured, i.created_at,
+			u.id, u.handle, u.name, u.avatar
+		FROM marketplace_items i
+		JOIN users u ON u.id = i.seller_id
+		LEFT JOIN circles c ON c.id = i.circle_id
+		`+where+`
+		ORDER BY i.created_at DESC, i.id DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var items []models.MarketplaceItem
+	for rows.Next() {
+		var item models.MarketplaceItem
+		var image, images, tags, circleID sql.NullString
+		if err := rows.Scan(&item.ID, &item.Title, &item.Description, &item.Price, &item.PriceType,
+			&image, &images, &item.Location, &item.Distance, &circleID, &item.Circle, &item.Category,
+			&tags, &item.Condition, &item.IsAvailable, &item.ViewCount, &item.IsFeatured, &item.CreatedAt,
+			&item.Seller.ID, &item.Seller.Handle, &item.Seller.Name, &item.Seller.Avatar); err != nil {
+			return nil, "", err
+		}
+		item.CircleID = circleID.String
+		if err := decodeJSON(image, &item.Image); err != nil {
+			return nil, "", err
+		}
+		if err := decodeJSON(images, &item.Images); err != nil {
+			return nil, "", err
+		}
+		if err := decodeJSON(tags, &item.Tags); err != nil {
+			return nil, "", err
+		}
+		item.TimeAgo = utils.TimeAgo(item.CreatedAt)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if q.Limit <= 0 {
+		return items, "", nil
+	}
+	items, next := pageOf(items, q.Limit, itemKey)
+	return items, next, nil
+}
+
+func (s *SQLiteStore) CountMarketplaceItems(ctx context.Context, q MarketplaceQuery) (int, error) {
+	where, args := marketplaceWhere(q)
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM marketplace_items i `+where, args...).Scan(&count)
+	return count, err
+}
+
+func (s *SQLiteStore) SaveMarketplaceCategory(ctx context.Context, c models.MarketplaceCategory, position int) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO marketplace_categories (id, name, icon, position) VALUES (?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			icon = excluded.icon,
+			position = excluded.position`,
+		c.ID, c.Name, c.Icon, position)
+	return err
+}
+
+func (s *SQLiteStore) ListMarketplaceCategories(ctx context.Context) ([]models.MarketplaceCategory, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.id, c.name, c.icon,
+			(SELECT COUNT(*) FROM marketplace_items i WHERE i.category = c.id AND i.is_available = 1)
+		FROM marketplace_categories c
+		ORDER BY c.position, c.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.MarketplaceCategory
+	for rows.Next() {
+		var c models.MarketplaceCategory
+		if err := rows.Scan(&c.ID, &c.Name, &c.Icon, &c.Count); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// ListMarketplaceLocations returns the locations with the most available
+// listings.
+func (s *SQLiteStore) ListMarketplaceLocations(ctx context.Context, limit int) ([]models.Location, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT location, COUNT(*) FROM marketplace_items
+		WHERE is_available = 1 AND location != ''
+		GROUP BY location
+		ORDER BY COUNT(*) DESC, location
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locations []models.Location
+	for rows.Next() {
+		var l models.Location
+		if err := rows.Scan(&l.Name, &l.Count); err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	return locations, rows.Err()
+}
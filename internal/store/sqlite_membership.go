@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"circles.diy/internal/models"
+	"circles.diy/internal/utils"
+)
+
+func isBanned(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, circleID, userID string) (bool, error) {
+	var banned bool
+	err := q.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM circle_bans WHERE circle_id = ? AND user_id = ?)`,
+		circleID, userID).Scan(&banned)
+	return banned, err
+}
+
+// joinTx adds a plain membership inside tx, leaving existing members alone.
+func joinTx(ctx context.Context, tx *sql.Tx, circleID, userID string, at time.Time) error {
+	banned, err := isBanned(ctx, tx, circleID, userID)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return ErrBanned
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO circle_members (circle_id, user_id, role, joined_at) VALUES (?, ?, 'member', ?)
+		ON CONFLICT(circle_id, user_id) DO NOTHING`, circleID, userID, orNow(at)); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM circle_join_requests WHERE circle_id = ? AND user_id = ?`, circleID, userID)
+	return err
+}
+
+func (s *SQLiteStore) JoinCircle(ctx context.Context, circleID, userID string, at time.Time) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return joinTx(ctx, tx, circleID, userID, at)
+	})
+}
+
+func (s *SQLiteStore) RemoveMember(ctx context.Context, circleID, userID string) error {
+	return changedOne(s.db.ExecContext(ctx,
+		`DELETE FROM circle_members WHERE circle_id = ? AND user_id = ?`, circleID, userID))
+}
+
+func (s *SQLiteStore) BanMember(ctx context.Context, circleID, userID, bannedBy, reason string, at time.Time) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, query := range []string{
+			`DELETE FROM circle_members WHERE circle_id = ? AND user_id = ?`,
+			`DELETE FROM circle_join_requests WHERE circle_id = ? AND user_id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, query, circleID, userID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO circle_bans (circle_id, user_id, banned_by, reason, created_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(circle_id, user_id) DO UPDATE SET
+				banned_by = excluded.banned_by,
+				reason = excluded.reason`,
+			circleID, userID, nullString(bannedBy), reason, orNow(at))
+		return err
+	})
+}
+
+func (s *SQLiteStore) UnbanMember(ctx context.Context, circleID, userID string) error {
+	return changedOne(s.db.ExecContext(ctx,
+		`DELETE FROM circle_bans WHERE circle_id = ? AND user_id = ?`, circleID, userID))
+}
+
+func (s *SQLiteStore) IsBanned(ctx context.Context, circleID, userID string) (bool, error) {
+	return isBanned(ctx, s.db, circleID, userID)
+}
+
+func (s *SQLiteStore) ListBans(ctx context.Context, circleID string) ([]models.CircleBan, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+userColumns+`, COALESCE(b.banned_by, ''), b.reason, b.created_at
+		FROM circle_bans b
+		JOIN users u ON u.id = b.user_id
+		WHERE b.circle_id = ?
+		ORDER BY b.created_at DESC`, circleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []models.CircleBan
+	for rows.Next() {
+		var b models.CircleBan
+		if err := rows.Scan(&b.User.ID, &b.User.Handle, &b.User.Name, &b.User.Avatar, &b.User.Bio, &b.User.Banner,
+			&b.BannedBy, &b.Reason, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		b.BannedDate = utils.TimeAgoLong(b.CreatedAt)
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
+
+func (s *SQLiteStore) RequestToJoin(ctx context.Context, circleID, userID, message string, at time.Time) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		banned, err := isBanned(ctx, tx, circleID, userID)
+		if err != nil {
+			return err
+		}
+		if banned {
+			return ErrBanned
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO circle_join_requests (circle_id, user_id, message, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(circle_id, user_id) DO UPDATE SET message = excluded.message`,
+			circleID, userID, message, orNow(at))
+		return err
+	})
+}
+
+func (s *SQLiteStore) HasJoinRequest(ctx context.Context, circleID, userID string) (bool, error) {
+	var pending bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM circle_join_requests WHERE circle_id = ? AND user_id = ?)`,
+		circleID, userID).Scan(&pending)
+	return pending, err
+}
+
+func (s *SQLiteStore) ApproveJoinRequest(ctx context.Context, circleID, userID string, at time.Time) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM circle_join_requests WHERE circle_id = ? AND user_id = ?)`,
+			circleID, userID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		return joinTx(ctx, tx, circleID, userID, at)
+	})
+}
+
+func (s *SQLiteStore) DeleteJoinRequest(ctx context.Context, circleID, userID string) error {
+	return changedOne(s.db.ExecContext(ctx,
+		`DELETE FROM circle_join_requests WHERE circle_id = ? AND user_id = ?`, circleID, userID))
+}
+
+func (s *SQLiteStore) ListJoinRequests(ctx context.Context, circleID string) ([]models.JoinRequest, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+userColumns+`, r.message, r.created_at
+		FROM circle_join_requests r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.circle_id = ?
+		ORDER BY r.created_at, u.handle`, circleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []models.JoinRequest
+	for rows.Next() {
+		var jr models.JoinRequest
+		if err := rows.Scan(&jr.User.ID, &jr.User.Handle, &jr.User.Name, &jr.User.Avatar, &jr.User.Bio, &jr.User.Banner,
+			&jr.Message, &jr.CreatedAt); err != nil {
+			return nil, err
+		}
+		jr.RequestedDate = utils.TimeAgo(jr.CreatedAt)
+		requests = append(requests, jr)
+	}
+	return requests, rows.Err()
+}
+
+const inviteColumns = `code, circle_id, COALESCE(created_by, ''), max_uses, uses,
+	expires_at, revoked_at, created_at`
+
+func scanInvite(row interface{ Scan(...any) error }) (models.CircleInvite, error) {
+	var i models.CircleInvite
+	var expiresAt, revokedAt sql.NullTime
+	if err := row.Scan(&i.Code, &i.CircleID, &i.CreatedBy, &i.MaxUses, &i.Uses,
+		&expiresAt, &revokedAt, &i.CreatedAt); err != nil {
+		return i, err
+	}
+	i.ExpiresAt = expiresAt.Time
+	i.RevokedAt = revokedAt.Time
+	finishInvite(&i)
+	return i, nil
+}
+
+func (s *SQLiteStore) CreateInvite(ctx context.Context, i models.CircleInvite) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO circle_invites (code, circle_id, created_by, max_uses, uses, expires_at, created_at)
+		VALUES (?, ?, ?, ?, 0, ?, ?)`,
+		i.Code, i.CircleID, nullString(i.CreatedBy), i.MaxUses, nullTime(i.ExpiresAt), orNow(i.CreatedAt))
+	return err
+}
+
+func (s *SQLiteStore) GetInvite(ctx context.Context, code string) (models.CircleInvite, error) {
+	i, err := scanInvite(s.db.QueryRowContext(ctx,
+		`SELECT `+inviteColumns+` FROM circle_invites WHERE code = ?`, code))
+	return i, notFound(err)
+}
+
+func (s *SQLiteStore) ListInvites(ctx context.Context, circleID string) ([]models.CircleInvite, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+inviteColumns+` FROM circle_invites
+		WHERE circle_id = ? AND revoked_at IS NULL
+		ORDER BY created_at DESC`, circleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []models.CircleInvite
+	for rows.Next() {
+		i, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, i)
+	}
+	return invites, rows.Err()
+}
+
+func (s *SQLiteStore) RevokeInvite(ctx context.Context, circleID, code string, at time.Time) error {
+	return changedOne(s.db.ExecContext(ctx, `
+		UPDATE circle_invites SET revoked_at = ?
+		WHERE circle_id = ? AND code = ? AND revoked_at IS NULL`, orNow(at), circleID, code))
+}
+
+func (s *SQLiteStore) RedeemInvite(ctx context.Context, code, userID string, at time.Time) (string, error) {
+	var circleID string
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		invite, err := scanInvite(tx.QueryRowContext(ctx,
+			`SELECT `+inviteColumns+` FROM circle_invites WHERE code = ?`, code))
+		if err != nil {
+			return notFound(err)
+		}
+		circleID = invite.CircleID
+
+		var member bool
+		if err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM circle_members WHERE circle_id = ? AND user_id = ?)`,
+			circleID, userID).Scan(&member); err != nil {
+			return err
+		}
+		if member {
+			return nil
+		}
+		if !invite.Usable(orNow(at)) {
+			return ErrInviteUnusable
+		}
+		if err := joinTx(ctx, tx, circleID, userID, at); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE circle_invites SET uses = uses + 1 WHERE code = ?`, code)
+		return err
+	})
+	return circleID, err
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"circles.diy/internal/models"
+)
+
+const passkeyColumns = `id, user_id, name, public_key, algorithm, sign_count, transports, created_at, last_used_at`
+
+func scanPasskey(row interface{ Scan(...any) error }) (models.Passkey, error) {
+	var p models.Passkey
+	var transports sql.NullString
+	var lastUsed sql.NullTime
+	if err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.PublicKey, &p.Algorithm, &p.SignCount,
+		&transports, &p.CreatedAt, &lastUsed); err != nil {
+		return p, err
+	}
+	p.LastUsedAt = lastUsed.Time
+	return p, decodeJSON(transports, &p.Transports)
+}
+
+func (s *SQLiteStore) SavePasskey(ctx context.Context, passkey models.Passkey) error {
+	transports, err := jsonColumn(passkey.Transports)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO passkeys (id, user_id, name, public_key, algorithm, sign_count, transports, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		passkey.ID, passkey.UserID, passkey.Name, passkey.PublicKey, passkey.Algorithm,
+		passkey.SignCount, transports, orNow(passkey.CreatedAt))
+	return err
+}
+
+func (s *SQLiteStore) GetPasskey(ctx context.Context, id string) (models.Passkey, error) {
+	p, err := scanPasskey(s.db.QueryRowContext(ctx,
+		`SELECT `+passkeyColumns+` FROM passkeys WHERE id = ?`, id))
+	return p, notFound(err)
+}
+
+func (s *SQLiteStore) ListPasskeys(ctx context.Context, userID string) ([]models.Passkey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+passkeyColumns+` FROM passkeys WHERE user_id = ? ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []models.Passkey
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, p)
+	}
+	return passkeys, rows.Err()
+}
+
+func (s *SQLiteStore) RenamePasskey(ctx context.Context, userID, id, name string) error {
+	return changedOne(s.db.ExecContext(ctx,
+		`UPDATE passkeys SET name = ? WHERE id = ? AND user_id = ?`, name, id, userID))
+}
+
+func (s *SQLiteStore) DeletePasskey(ctx context.Context, userID, id string) error {
+	return changedOne(s.db.ExecContext(ctx,
+		`DELETE FROM passkeys WHERE id = ? AND user_id = ?`, id, userID))
+}
+
+func (s *SQLiteStore) UpdatePasskeyUsage(ctx context.Context, id string, signCount uint32, usedAt time.Time) error {
+	return changedOne(s.db.ExecContext(ctx,
+		`UPDATE passkeys SET sign_count = ?, last_used_at = ? WHERE id = ?`, signCount, usedAt.UTC(), id))
+}
@@ -0,0 +1,416 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"circles.diy/internal/models"
+	"circles.diy/internal/utils"
+)
+
+const postColumns = `p.id, p.content, p.circle_id, COALESCE(c.name, ''), p.image, p.video, p.gallery,
+	p.can_buy, p.reply_count, p.share_count, p.view_count, p.created_at, p.edited_at,
+	au.id, au.handle, au.name, au.avatar`
+
+const postJoins = `FROM posts p
+	JOIN users au ON au.id = p.author_id
+	LEFT JOIN circles c ON c.id = p.circle_id`
+
+func scanPost(row interface{ Scan(...any) error }) (models.Post, error) {
+	var p models.Post
+	var circleID, image, video, gallery sql.NullString
+	var editedAt sql.NullTime
+	stats := &models.PostStats{}
+	err := row.Scan(&p.ID, &p.Content, &circleID, &p.Circle, &image, &video, &gallery,
+		&p.CanBuy, &stats.Replies, &stats.Shares, &stats.Views, &p.CreatedAt, &editedAt,
+		&p.User.ID, &p.User.Handle, &p.User.Name, &p.User.Avatar)
+	if err != nil {
+		return p, err
+	}
+	p.CircleID = circleID.String
+	p.EditedAt = editedAt.Time
+	p.Stats = stats
+	p.TimeAgo = utils.TimeAgo(p.CreatedAt)
+	if err := decodeJSON(image, &p.Image); err != nil {
+		return p, err
+	}
+	if err := decodeJSON(video, &p.Video); err != nil {
+		return p, err
+	}
+	if err := decodeJSON(gallery, &p.Gallery); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+func (s *SQLiteStore) SavePost(ctx context.Context, p models.Post) error {
+	return s.savePost(ctx, p.ID, p.User.ID, p.CircleID, "published", p.Content,
+		p.Image, p.Video, p.Gallery, p.CanBuy, p.Stats, p.CreatedAt)
+}
+
+func (s *SQLiteStore) SaveDraft(ctx context.Context, authorID string, d models.DraftPost) error {
+	return s.savePost(ctx, d.ID, authorID, d.CircleID, "draft", d.Content,
+		d.Image, d.Video, d.Gallery, false, nil, d.UpdatedAt)
+}
+
+// savePost upserts a post row. Its reply count is left to SaveReply.
+func (s *SQLiteStore) savePost(ctx context.Context, id, authorID, circleID, status, content string,
+	image, video *models.MediaItem, gallery []models.MediaItem, canBuy bool,
+	stats *models.PostStats, createdAt time.Time) error {
+	imageCol, err := jsonColumn(image)
+	if err != nil {
+		return err
+	}
+	videoCol, err := jsonColumn(video)
+	if err != nil {
+		return err
+	}
+	galleryCol, err := jsonColumn(gallery)
+	if err != nil {
+		return err
+	}
+	if stats == nil {
+		stats = &models.PostStats{}
+	}
+
+	ts := orNow(createdAt)
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO posts (id, author_id, circle_id, status, content, image, video, gallery,
+			can_buy, reply_count, share_count, view_count, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			circle_id = excluded.circle_id,
+			status = excluded.status,
+			content = excluded.content,
+			image = excluded.image,
+			video = excluded.video,
+			gallery = excluded.gallery,
+			can_buy = excluded.can_buy,
+			share_count = excluded.share_count,
+			view_count = excluded.view_count,
+			updated_at = excluded.updated_at`,
+		id, authorID, nullString(circleID), status, content, imageCol, videoCol, galleryCol,
+		canBuy, stats.Shares, stats.Views, ts, ts)
+	return err
+}
+
+func (s *SQLiteStore) GetPost(ctx context.Context, id string) (models.Post, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+postColumns+` `+postJoins+`
+		WHERE p.id = ? AND p.status = 'published'`, id)
+	p, err := scanPost(row)
+	if err != nil {
+		return p, notFound(err)
+	}
+	posts := []models.Post{p}
+	if err := s.attachReplies(ctx, posts); err != nil {
+		return p, err
+	}
+	return posts[0], nil
+}
+
+func (s *SQLiteStore) EditPost(ctx context.Context, p models.Post, at time.Time) error {
+	cols := make([]any, 3)
+	for i, v := range []any{p.Image, p.Video, p.Gallery} {
+		col, err := jsonColumn(v)
+		if err != nil {
+			return err
+		}
+		cols[i] = col
+	}
+	ts := orNow(at)
+	return changedOne(s.db.ExecContext(ctx, `
+		UPDATE posts SET content = ?, image = ?, video = ?, gallery = ?, edited_at = ?, updated_at = ?
+		WHERE id = ? AND status = 'published'`,
+		p.Content, cols[0], cols[1], cols[2], ts, ts, p.ID))
+}
+
+func (s *SQLiteStore) DeletePost(ctx context.Context, id string, at time.Time) error {
+	ts := orNow(at)
+	return changedOne(s.db.ExecContext(ctx, `
+		UPDATE posts SET status = 'deleted', deleted_at = ?, updated_at = ?
+		WHERE id = ? AND status = 'published'`, ts, ts, id))
+}
+
+func (s *SQLiteStore) queryPosts(ctx context.Context, query string, args ...any) ([]models.Post, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, s.attachReplies(ctx, posts)
+}
+
+func (s *SQLiteStore) ListPostsByAuthor(ctx context.Context, authorID string, limit int, after string) ([]models.Post, string, error) {
+	page, pageArgs, err := keyset("p.created_at", "p.id", true, after)
+	if err != nil {
+		return nil, "", err
+	}
+	where := `p.author_id = ? AND p.status = 'published'`
+	args := []any{authorID}
+	if page != "" {
+		where += ` AND ` + page
+		args = append(args, pageArgs...)
+	}
+	posts, err := s.queryPosts(ctx, `SELECT `+postColumns+` `+postJoins+`
+		WHERE `+where+`
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	posts, next := pageOf(posts, limit, postKey)
+	return posts, next, nil
+}
+
+func (s *SQLiteStore) ListFeed(ctx context.Context, userID string, q FeedQuery) ([]models.FeedItem, string, error) {
+	var sources []string
+	var args []any
+	if q.Own {
+		sources = append(sources, `p.author_id = ?`)
+		args = append(args, userID)
+	}
+	if q.Circles {
+		sources = append(sources, `p.circle_id IN (SELECT circle_id FROM circle_members WHERE user_id = ?)`)
+		args = append(args, userID)
+	}
+	if q.Connections {
+		sources = append(sources, `(p.author_id IN (SELECT other_id FROM connections WHERE user_id = ?)
+			AND (p.circle_id IS NULL OR p.circle_id IN (SELECT circle_id FROM circle_members WHERE user_id = ?)))`)
+		args = append(args, userID, userID)
+	}
+	if len(sources) == 0 {
+		return nil, "", nil
+	}
+	where := `p.status = 'published' AND (` + strings.Join(sources, " OR ") + `)`
+	if !q.Until.IsZero() {
+		where += ` AND p.created_at <= ?`
+		args = append(args, q.Until.UTC())
+	}
+	page, pageArgs, err := keyset("p.created_at", "p.id", true, q.After)
+	if err != nil {
+		return nil, "", err
+	}
+	if page != "" {
+		where += ` AND ` + page
+		args = append(args, pageArgs...)
+	}
+
+	posts, err := s.queryPosts(ctx, `SELECT `+postColumns+` `+postJoins+`
+		WHERE `+where+`
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT ?`, append(args, q.Limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	posts, next := pageOf(posts, q.Limit, postKey)
+
+	circles, err := s.stringSet(ctx, `SELECT circle_id FROM circle_members WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	connections, err := s.stringSet(ctx, `SELECT other_id FROM connections WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	var replies map[string]int
+	if !q.Until.IsZero() {
+		if replies, err = s.repliesUntil(ctx, posts, q.Until); err != nil {
+			return nil, "", err
+		}
+	}
+	feed := make([]models.FeedItem, len(posts))
+	for i, p := range posts {
+		feed[i] = feedItemFromPost(p)
+		feed[i].Signals = feedSignals(p, userID, circles, connections)
+		if replies != nil {
+			feed[i].Signals.Replies = replies[p.ID]
+		}
+	}
+	return feed, next, nil
+}
+
+// repliesUntil counts the replies each of posts had at the given time.
+func (s *SQLiteStore) repliesUntil(ctx context.Context, posts []models.Post, until time.Time) (map[string]int, error) {
+	counts := make(map[string]int, len(posts))
+	if len(posts) == 0 {
+		return counts, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(posts)), ",")
+	args := []any{until.UTC()}
+	for _, p := range posts {
+		args = append(args, p.ID)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT post_id, COUNT(*) FROM replies
+		WHERE created_at <= ? AND post_id IN (`+placeholders+`)
+		GROUP BY post_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+// stringSet runs a query selecting one text column into a set.
+func (s *SQLiteStore) stringSet(ctx context.Context, query string, args ...any) (map[string]bool, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	set := make(map[string]bool)
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		set[v] = true
+	}
+	return set, rows.Err()
+}
+
+const draftColumns = `id, content, circle_id, image, video, gallery, updated_at`
+
+func scanDraft(row interface{ Scan(...any) error }) (models.DraftPost, error) {
+	var d models.DraftPost
+	var circleID, image, video, gallery sql.NullString
+	if err := row.Scan(&d.ID, &d.Content, &circleID, &image, &video, &gallery, &d.UpdatedAt); err != nil {
+		return d, err
+	}
+	d.CircleID = circleID.String
+	if err := decodeJSON(image, &d.Image); err != nil {
+		return d, err
+	}
+	if err := decodeJSON(video, &d.Video); err != nil {
+		return d, err
+	}
+	return d, decodeJSON(gallery, &d.Gallery)
+}
+
+func (s *SQLiteStore) GetDraft(ctx context.Context, authorID, id string) (models.DraftPost, error) {
+	d, err := scanDraft(s.db.QueryRowContext(ctx, `SELECT `+draftColumns+`
+		FROM posts WHERE id = ? AND author_id = ? AND status = 'draft'`, id, authorID))
+	return d, notFound(err)
+}
+
+func (s *SQLiteStore) ListDrafts(ctx context.Context, authorID string) ([]models.DraftPost, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+draftColumns+`
+		FROM posts WHERE author_id = ? AND status = 'draft'
+		ORDER BY updated_at DESC`, authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []models.DraftPost
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, rows.Err()
+}
+
+func (s *SQLiteStore) PublishDraft(ctx context.Context, authorID, id string, at time.Time) error {
+	ts := orNow(at)
+	return changedOne(s.db.ExecContext(ctx, `
+		UPDATE posts SET status = 'published', created_at = ?, updated_at = ?
+		WHERE id = ? AND author_id = ? AND status = 'draft'`, ts, ts, id, authorID))
+}
+
+func (s *SQLiteStore) DeleteDraft(ctx context.Context, authorID, id string) error {
+	return changedOne(s.db.ExecContext(ctx,
+		`DELETE FROM posts WHERE id = ? AND author_id = ? AND status = 'draft'`, id, authorID))
+}
+
+func (s *SQLiteStore) SaveRipple(ctx context.Context, r models.Ripple) error {
+	cols := make([]any, 4)
+	for i, v := range []any{r.Image, r.Video, r.Gallery, r.Link} {
+		col, err := jsonColumn(v)
+		if err != nil {
+			return err
+		}
+		cols[i] = col
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO ripples (id, author_id, circle_id, content, content_type,
+			image, video, gallery, link, view_count, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			circle_id = excluded.circle_id,
+			content = excluded.content,
+			content_type = excluded.content_type,
+			image = excluded.image,
+			video = excluded.video,
+			gallery = excluded.gallery,
+			link = excluded.link,
+			view_count = excluded.view_count,
+			expires_at = excluded.expires_at`,
+		r.ID, r.User.ID, nullString(r.CircleID), r.Content, r.ContentType,
+		cols[0], cols[1], cols[2], cols[3], r.ViewCount, r.ExpiresAt.UTC(), orNow(r.CreatedAt))
+	return err
+}
+
+func (s *SQLiteStore) ListRipples(ctx context.Context, limit int) ([]models.Ripple, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.id, r.content, r.content_type, r.image, r.video, r.gallery, r.link,
+			r.circle_id, COALESCE(c.name, ''), r.view_count, r.expires_at, r.created_at,
+			u.id, u.handle, u.name, u.avatar
+		FROM ripples r
+		JOIN users u ON u.id = r.author_id
+		LEFT JOIN circles c ON c.id = r.circle_id
+		WHERE r.expires_at > ?
+		ORDER BY r.created_at DESC
+		LIMIT ?`, now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ripples []models.Ripple
+	for rows.Next() {
+		var r models.Ripple
+		var image, video, gallery, link, circleID sql.NullString
+		if err := rows.Scan(&r.ID, &r.Content, &r.ContentType, &image, &video, &gallery, &link,
+			&circleID, &r.Circle, &r.ViewCount, &r.ExpiresAt, &r.CreatedAt,
+			&r.User.ID, &r.User.Handle, &r.User.Name, &r.User.Avatar); err != nil {
+			return nil, err
+		}
+		r.CircleID = circleID.String
+		for _, pair := range []struct {
+			col sql.NullString
+			dst any
+		}{{image, &r.Image}, {video, &r.Video}, {gallery, &r.Gallery}, {link, &r.Link}} {
+			if err := decodeJSON(pair.col, pair.dst); err != nil {
+				return nil, err
+			}
+		}
+		finishRipple(&r)
+		ripples = append(ripples, r)
+	}
+	return ripples, rows.Err()
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"circles.diy/internal/models"
+)
+
+const replyColumns = `r.id, r.post_id, COALESCE(r.parent_id, ''), r.content, r.depth, r.reply_count, r.created_at,
+	u.id, u.handle, u.name, u.avatar`
+
+func scanReply(row interface{ Scan(...any) error }) (models.Reply, error) {
+	var r models.Reply
+	err := row.Scan(&r.ID, &r.PostID, &r.ParentID, &r.Content, &r.Depth, &r.ReplyCount, &r.CreatedAt,
+		&r.User.ID, &r.User.Handle, &r.User.Name, &r.User.Avatar)
+	if err != nil {
+		return r, err
+	}
+	finishReply(&r)
+	return r, nil
+}
+
+func (s *SQLiteStore) SaveReply(ctx context.Context, postID, parentID string, r models.Reply) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		// Write first so the transaction holds the write lock throughout
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO replies (id, post_id, parent_id, author_id, content, depth, created_at)
+			SELECT ?, ?, ?, ?, ?, COALESCE((SELECT depth + 1 FROM replies WHERE id = ?), 0), ?
+			WHERE true
+			ON CONFLICT(id) DO NOTHING`,
+			r.ID, postID, nullString(parentID), r.User.ID, r.Content, parentID, orNow(r.CreatedAt))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			_, err := tx.ExecContext(ctx, `UPDATE replies SET content = ? WHERE id = ?`, r.Content, r.ID)
+			return err
+		}
+
+		if parentID != "" {
+			if err := changedOne(tx.ExecContext(ctx, `
+				UPDATE replies SET reply_count = reply_count + 1
+				WHERE id = ? AND post_id = ?`, parentID, postID)); err != nil {
+				return err
+			}
+		}
+		return changedOne(tx.ExecContext(ctx, `
+			UPDATE posts SET reply_count = reply_count + 1
+			WHERE id = ? AND status = 'published'`, postID))
+	})
+}
+
+func (s *SQLiteStore) GetReply(ctx context.Context, postID, id string) (models.Reply, error) {
+	r, err := scanReply(s.db.QueryRowContext(ctx, `SELECT `+replyColumns+`
+		FROM replies r JOIN users u ON u.id = r.author_id
+		WHERE r.id = ? AND r.post_id = ?`, id, postID))
+	return r, notFound(err)
+}
+
+func (s *SQLiteStore) ListReplies(ctx context.Context, postID, parentID string, depth, limit int, after string) ([]models.Reply, string, error) {
+	page, pageArgs, err := keyset("r.created_at", "r.id", false, after)
+	if err != nil {
+		return nil, "", err
+	}
+
+	parentCond := `r.parent_id = ?`
+	args := []any{postID, parentID}
+	if parentID == "" {
+		parentCond = `r.parent_id IS NULL`
+		args = args[:1]
+	}
+	if page != "" {
+		parentCond += ` AND ` + page
+		args = append(args, pageArgs...)
+	}
+	args = append(args, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+replyColumns+`
+		FROM replies r JOIN users u ON u.id = r.author_id
+		WHERE r.post_id = ? AND `+parentCond+`
+		ORDER BY r.created_at, r.id
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var replies []models.Reply
+	for rows.Next() {
+		r, err := scanReply(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		replies = append(replies, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	replies, next := pageOf(replies, limit, replyKey)
+	return replies, next, s.loadReplyLevels(ctx, replyPointers(replies), depth, limit)
+}
+
+// childReplies loads the first limit+1 replies under each of ids, where
+// column is "parent_id", or "post_id" for top-level replies, keyed by id.
+func (s *SQLiteStore) childReplies(ctx context.Context, column string, ids []string, limit int) (map[string][]models.Reply, error) {
+	args := make([]any, 0, len(ids)+1)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, limit+1)
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+
+	where := `r.parent_id IN (` + placeholders + `)`
+	if column == "post_id" {
+		where = `r.post_id IN (` + placeholders + `) AND r.parent_id IS NULL`
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+replyColumns+` FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY `+column+` ORDER BY created_at, id) AS n
+			FROM replies r WHERE `+where+`
+		) r JOIN users u ON u.id = r.author_id
+		WHERE r.n <= ?
+		ORDER BY r.created_at, r.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	children := make(map[string][]models.Reply)
+	for rows.Next() {
+		r, err := scanReply(rows)
+		if err != nil {
+			return nil, err
+		}
+		key := r.ParentID
+		if column == "post_id" {
+			key = r.PostID
+		}
+		children[key] = append(children[key], r)
+	}
+	return children, rows.Err()
+}
+
+func replyPointers(replies []models.Reply) []*models.Reply {
+	ptrs := make([]*models.Reply, len(replies))
+	for i := range replies {
+		ptrs[i] = &replies[i]
+	}
+	return ptrs
+}
+
+// loadReplyLevels fills in depth levels of replies below level, one
+// query per level, keeping limit replies per parent.
+func (s *SQLiteStore) loadReplyLevels(ctx context.Context, level []*models.Reply, depth, limit int) error {
+	for ; depth > 0 && len(level) > 0; depth-- {
+		var ids []string
+		for _, r := range level {
+			if r.ReplyCount > 0 {
+				ids = append(ids, r.ID)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		children, err := s.childReplies(ctx, "parent_id", ids, limit)
+		if err != nil {
+			return err
+		}
+
+		var next []*models.Reply
+		for _, r := range level {
+			r.Replies, r.MoreReplies = pageOf(children[r.ID], limit, replyKey)
+			next = append(next, replyPointers(r.Replies)...)
+		}
+		level = next
+	}
+	return nil
+}
+
+// attachReplies loads the thread previews for posts.
+func (s *SQLiteStore) attachReplies(ctx context.Context, posts []models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]string, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	children, err := s.childReplies(ctx, "post_id", ids, previewReplies)
+	if err != nil {
+		return err
+	}
+
+	var top []*models.Reply
+	for i := range posts {
+		posts[i].Replies, posts[i].MoreReplies = pageOf(children[posts[i].ID], previewReplies, replyKey)
+		top = append(top, replyPointers(posts[i].Replies)...)
+	}
+	return s.loadReplyLevels(ctx, top, previewReplyDepth, previewReplies)
+}
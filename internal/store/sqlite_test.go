@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"circles.diy/internal/models"
+)
+
+// newTestSQLite opens a migrated database in a temporary directory.
+func newTestSQLite(t *testing.T) *SQLiteStore {
+	t.Helper()
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "circles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if _, err := s.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Transactions that read before they write must wait for each other
+// rather than fail to upgrade their lock.
+func TestWithTxConcurrentReadThenWrite(t *testing.T) {
+	s := newTestSQLite(t)
+	ctx := context.Background()
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.withTx(ctx, func(tx *sql.Tx) error {
+				var n int
+				if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&n); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, `
+					INSERT INTO users (id, handle, name, avatar, bio, banner, created_at)
+					VALUES (?, ?, '', '', '', '', CURRENT_TIMESTAMP)`,
+					fmt.Sprintf("user-%d", i), fmt.Sprintf("user%d-after-%d", i, n))
+				return err
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("withTx: %v", err)
+		}
+	}
+
+	var n int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != writers {
+		t.Errorf("got %d users, want %d", n, writers)
+	}
+}
+
+// An attachment whose message can't be saved is not kept.
+func TestSaveAttachmentRollsBack(t *testing.T) {
+	s := newTestSQLite(t)
+	ctx := context.Background()
+	saveUsers(t, s, "ana", "ben")
+	now := time.Now()
+	err := s.SaveConversation(ctx, models.Conversation{
+		ID: "d1", CreatedAt: now, Participants: []models.User{{ID: "ana"}, {ID: "ben"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attachment := models.Attachment{
+		ID: "a1", ConversationID: "d1", MessageID: "m1", UploaderID: "ana", Kind: "file",
+		Name: "notes.txt", ContentType: "text/plain", Size: 4, Data: []byte("data"), CreatedAt: now,
+	}
+	// The sender isn't a user, so the message breaks a foreign key
+	message := models.Message{ID: "m1", Type: "file", Sender: models.User{ID: "nobody"}, CreatedAt: now}
+	if err := s.SaveAttachment(ctx, attachment, message); err == nil {
+		t.Fatal("SaveAttachment with an unknown sender succeeded")
+	}
+	var n int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM chat_attachments`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("got %d attachments after the failed save, want 0", n)
+	}
+}
@@ -0,0 +1,246 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"circles.diy/internal/models"
+	"circles.diy/internal/utils"
+)
+
+const userColumns = `u.id, u.handle, u.name, u.avatar, u.bio, u.banner`
+
+func scanUser(row interface{ Scan(...any) error }) (models.User, error) {
+	var u models.User
+	err := row.Scan(&u.ID, &u.Handle, &u.Name, &u.Avatar, &u.Bio, &u.Banner)
+	return u, err
+}
+
+func (s *SQLiteStore) SaveUser(ctx context.Context, user models.User) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO users (id, handle, name, avatar, bio, banner, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			handle = excluded.handle,
+			name = excluded.name,
+			avatar = excluded.avatar,
+			bio = excluded.bio,
+			banner = excluded.banner`,
+		user.ID, user.Handle, user.Name, user.Avatar, user.Bio, user.Banner, now())
+	return err
+}
+
+func (s *SQLiteStore) GetUser(ctx context.Context, id string) (models.User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users u WHERE u.id = ?`, id)
+	u, err := scanUser(row)
+	return u, notFound(err)
+}
+
+func (s *SQLiteStore) GetUserByHandle(ctx context.Context, handle string) (models.User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users u WHERE u.handle = ?`, handle)
+	u, err := scanUser(row)
+	return u, notFound(err)
+}
+
+func (s *SQLiteStore) GetProfile(ctx context.Context, handle, viewerID string) (models.Profile, error) {
+	var p models.Profile
+	err := s.db.QueryRowContext(ctx, `
+		SELECT u.id, u.handle, u.name, u.avatar, u.banner, u.bio,
+			(SELECT COUNT(*) FROM posts WHERE author_id = u.id AND status = 'published'),
+			(SELECT COUNT(*) FROM connections WHERE user_id = u.id),
+			(SELECT COUNT(*) FROM circle_members WHERE user_id = u.id),
+			EXISTS (SELECT 1 FROM connections WHERE user_id = ? AND other_id = u.id)
+		FROM users u WHERE u.handle = ?`, viewerID, handle).
+		Scan(&p.ID, &p.Handle, &p.Name, &p.Avatar, &p.Banner, &p.Bio,
+			&p.Stats.Posts, &p.Stats.Connections, &p.Stats.Circles, &p.IsConnected)
+	return p, notFound(err)
+}
+
+func (s *SQLiteStore) SetPresence(ctx context.Context, userID string, online bool, lastSeen time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE users SET is_online = ?, last_seen_at = ? WHERE id = ?`,
+		online, lastSeen.UTC(), userID)
+	return err
+}
+
+func (s *SQLiteStore) GetFeedStrategy(ctx context.Context, userID string) (string, error) {
+	var strategy string
+	err := s.db.QueryRowContext(ctx, `SELECT feed_strategy FROM users WHERE id = ?`, userID).Scan(&strategy)
+	return strategy, notFound(err)
+}
+
+func (s *SQLiteStore) SetFeedStrategy(ctx context.Context, userID, strategy string) error {
+	return changedOne(s.db.ExecContext(ctx, `UPDATE users SET feed_strategy = ? WHERE id = ?`, strategy, userID))
+}
+
+func (s *SQLiteStore) GetReadReceipts(ctx context.Context, userID string) (bool, error) {
+	var enabled bool
+	err := s.db.QueryRowContext(ctx, `SELECT read_receipts FROM users WHERE id = ?`, userID).Scan(&enabled)
+	return enabled, notFound(err)
+}
+
+func (s *SQLiteStore) SetReadReceipts(ctx context.Context, userID string, enabled bool) error {
+	return changedOne(s.db.ExecContext(ctx, `UPDATE users SET read_receipts = ? WHERE id = ?`, enabled, userID))
+}
+
+func (s *SQLiteStore) GetSharePresence(ctx context.Context, userID string) (bool, error) {
+	var share bool
+	err := s.db.QueryRowContext(ctx, `SELECT share_presence FROM users WHERE id = ?`, userID).Scan(&share)
+	return share, notFound(err)
+}
+
+func (s *SQLiteStore) SetSharePresence(ctx context.Context, userID string, share bool) error {
+	return changedOne(s.db.ExecContext(ctx, `UPDATE users SET share_presence = ? WHERE id = ?`, share, userID))
+}
+
+func (s *SQLiteStore) Connect(ctx context.Context, userID, otherID string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, pair := range [][2]string{{userID, otherID}, {otherID, userID}} {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO connections (user_id, other_id, created_at) VALUES (?, ?, ?)
+				ON CONFLICT DO NOTHING`, pair[0], pair[1], now()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStore) SaveContact(ctx context.Context, userID string, contact models.Contact) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO contacts (user_id, contact_id, relationship) VALUES (?, ?, ?)
+		ON CONFLICT(user_id, contact_id) DO UPDATE SET relationship = excluded.relationship`,
+		userID, contact.ID, contact.Relationship)
+	return err
+}
+
+func (s *SQLiteStore) ListContacts(ctx context.Context, userID string) ([]models.Contact, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+userColumns+`, u.is_online, u.last_seen_at, u.share_presence, c.relationship
+		FROM contacts c JOIN users u ON u.id = c.contact_id
+		WHERE c.user_id = ?
+		ORDER BY u.is_online DESC, u.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contacts []models.Contact
+	for rows.Next() {
+		var c models.Contact
+		var lastSeen sql.NullTime
+		var share bool
+		if err := rows.Scan(&c.ID, &c.Handle, &c.Name, &c.Avatar, &c.Bio, &c.Banner,
+			&c.IsOnline, &lastSeen, &share, &c.Relationship); err != nil {
+			return nil, err
+		}
+		// Members who don't share their presence are never shown around
+		if !share {
+			c.IsOnline, lastSeen.Valid = false, false
+		}
+		if !c.IsOnline && lastSeen.Valid {
+			c.LastSeen = utils.TimeAgo(lastSeen.Time)
+		}
+		contacts = append(contacts, c)
+	}
+	return contacts, rows.Err()
+}
+
+func (s *SQLiteStore) SaveExtension(ctx context.Context, userID string, ext models.Extension) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_extensions (user_id, extension_id, name, description, enabled, position)
+		VALUES (?, ?, ?, ?, ?, (SELECT COUNT(*) FROM user_extensions WHERE user_id = ?))
+		ON CONFLICT(user_id, extension_id) DO UPDATE SET
+			name = excluded.name,
+			description = excluded.description,
+			enabled = excluded.enabled`,
+		userID, ext.ID, ext.Name, ext.Description, ext.Enabled, userID)
+	return err
+}
+
+func (s *SQLiteStore) ListExtensions(ctx context.Context, userID string) ([]models.Extension, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT extension_id, name, description, enabled FROM user_extensions
+		WHERE user_id = ? ORDER BY position`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exts []models.Extension
+	for rows.Next() {
+		var e models.Extension
+		if err := rows.Scan(&e.ID, &e.Name, &e.Description, &e.Enabled); err != nil {
+			return nil, err
+		}
+		exts = append(exts, e)
+	}
+	return exts, rows.Err()
+}
+
+func (s *SQLiteStore) SaveAnalytics(ctx context.Context, userID string, a models.Analytics) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_analytics (user_id, profile_views, profile_views_change,
+			post_engagement, post_engagement_change, new_connections, new_connections_change)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			profile_views = excluded.profile_views,
+			profile_views_change = excluded.profile_views_change,
+			post_engagement = excluded.post_engagement,
+			post_engagement_change = excluded.post_engagement_change,
+			new_connections = excluded.new_connections,
+			new_connections_change = excluded.new_connections_change`,
+		userID, a.ProfileViews, a.ProfileViewsChange, a.PostEngagement,
+		a.PostEngagementChange, a.NewConnections, a.NewConnectionsChange)
+	return err
+}
+
+func (s *SQLiteStore) GetAnalytics(ctx context.Context, userID string) (models.Analytics, error) {
+	var a models.Analytics
+	err := s.db.QueryRowContext(ctx, `
+		SELECT profile_views, profile_views_change, post_engagement,
+			post_engagement_change, new_connections, new_connections_change
+		FROM user_analytics WHERE user_id = ?`, userID).
+		Scan(&a.ProfileViews, &a.ProfileViewsChange, &a.PostEngagement,
+			&a.PostEngagementChange, &a.NewConnections, &a.NewConnectionsChange)
+	if err == sql.ErrNoRows {
+		return a, nil
+	}
+	return a, err
+}
+
+func (s *SQLiteStore) SaveImpact(ctx context.Context, userID string, items []models.ImpactItem) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_impact WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+		for i, item := range items {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO user_impact (user_id, label, value, position) VALUES (?, ?, ?, ?)`,
+				userID, item.Label, item.Value, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStore) ListImpact(ctx context.Context, userID string) ([]models.ImpactItem, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT label, value FROM user_impact WHERE user_id = ? ORDER BY position`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.ImpactItem
+	for rows.Next() {
+		var item models.ImpactItem
+		if err := rows.Scan(&item.Label, &item.Value); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,400 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"circles.diy/internal/models"
+)
+
+// ErrNotFound is returned when a lookup by ID or handle matches nothing.
+var ErrNotFound = errors.New("store: not found")
+
+// ErrHandleTaken and ErrEmailTaken are returned when an account would reuse
+// another user's handle or email address.
+var (
+	ErrHandleTaken = errors.New("store: handle already taken")
+	ErrEmailTaken  = errors.New("store: email already registered")
+)
+
+// ErrInvalidRole is returned when a membership would get a role outside
+// the authz role set, or a conversation participant one other than
+// models.GroupAdmin or models.GroupMember.
+var ErrInvalidRole = errors.New("store: invalid role")
+
+// ErrBanned is returned when a user banned from a circle tries to join it
+// or ask to.
+var ErrBanned = errors.New("store: banned from circle")
+
+// ErrInviteUnusable is returned when redeeming an invite that was revoked,
+// has expired or has no uses left.
+var ErrInviteUnusable = errors.New("store: invite no longer usable")
+
+// ErrInvalidCursor is returned when a page cursor was not made by the
+// store or has been tampered with.
+var ErrInvalidCursor = errors.New("store: invalid page cursor")
+
+// Store is the persistence boundary for everything the handlers render.
+// The SQLite implementation backs a running node; the memory implementation
+// exists so handlers and helpers can be exercised without a database file.
+type Store interface {
+	UserStore
+	AccountStore
+	PasskeyStore
+	CircleStore
+	MembershipStore
+	PostStore
+	EventStore
+	MarketplaceStore
+	ChatStore
+
+	Close() error
+}
+
+// Migrator is implemented by stores whose schema is versioned on disk.
+type Migrator interface {
+	MigrationStatus(ctx context.Context) ([]MigrationState, error)
+	PendingMigrations(ctx context.Context) ([]Migration, error)
+	MigrateUp(ctx context.Context) ([]Migration, error)
+	MigrateDown(ctx context.Context) (*Migration, error)
+}
+
+type UserStore interface {
+	SaveUser(ctx context.Context, user models.User) error
+	GetUser(ctx context.Context, id string) (models.User, error)
+	GetUserByHandle(ctx context.Context, handle string) (models.User, error)
+	// GetProfile resolves a profile by handle, with stats and the
+	// connection state as seen by viewerID.
+	GetProfile(ctx context.Context, handle, viewerID string) (models.Profile, error)
+	SetPresence(ctx context.Context, userID string, online bool, lastSeen time.Time) error
+	// GetFeedStrategy returns the feed strategy userID picked, or "" when
+	// they haven't. SetFeedStrategy stores it as given.
+	GetFeedStrategy(ctx context.Context, userID string) (string, error)
+	SetFeedStrategy(ctx context.Context, userID, strategy string) error
+	// GetReadReceipts reports whether userID lets others see when they
+	// have read a message, which they do unless they turn it off.
+	GetReadReceipts(ctx context.Context, userID string) (bool, error)
+	SetReadReceipts(ctx context.Context, userID string, enabled bool) error
+	// GetSharePresence reports whether others may see when userID is online
+	// or typing, which they may unless userID turns it off.
+	GetSharePresence(ctx context.Context, userID string) (bool, error)
+	SetSharePresence(ctx context.Context, userID string, share bool) error
+
+	Connect(ctx context.Context, userID, otherID string) error
+	SaveContact(ctx context.Context, userID string, contact models.Contact) error
+	ListContacts(ctx context.Context, userID string) ([]models.Contact, error)
+
+	SaveExtension(ctx context.Context, userID string, ext models.Extension) error
+	ListExtensions(ctx context.Context, userID string) ([]models.Extension, error)
+	SaveAnalytics(ctx context.Context, userID string, analytics models.Analytics) error
+	GetAnalytics(ctx context.Context, userID string) (models.Analytics, error)
+	SaveImpact(ctx context.Context, userID string, items []models.ImpactItem) error
+	ListImpact(ctx context.Context, userID string) ([]models.ImpactItem, error)
+}
+
+// AccountStore keeps sign-in credentials and browser sessions.
+type AccountStore interface {
+	// CreateAccount registers a new user together with their credentials.
+	CreateAccount(ctx context.Context, user models.User, account models.Account) error
+	// SaveAccount sets the credentials of an existing user.
+	SaveAccount(ctx context.Context, account models.Account) error
+	GetAccount(ctx context.Context, userID string) (models.Account, error)
+	// GetAccountByEmail matches email ignoring case.
+	GetAccountByEmail(ctx context.Context, email string) (models.Account, error)
+
+	// CreateSession stores a session and drops the user's expired ones.
+	CreateSession(ctx context.Context, session models.Session) error
+	// GetSession returns ErrNotFound for unknown and expired sessions.
+	GetSession(ctx context.Context, id string) (models.Session, error)
+	ExtendSession(ctx context.Context, id string, expiresAt time.Time) error
+	DeleteSession(ctx context.Context, id string) error
+
+	// CreateLoginToken stores a sign-in link token and drops the user's
+	// expired and used ones.
+	CreateLoginToken(ctx context.Context, token models.LoginToken) error
+	// ConsumeLoginToken marks a token used and returns it, revoking the
+	// user's other outstanding tokens. Unknown, expired and already used
+	// tokens return ErrNotFound.
+	ConsumeLoginToken(ctx context.Context, id string) (models.LoginToken, error)
+}
+
+// PasskeyStore keeps the WebAuthn credentials users sign in with. Rename
+// and delete are scoped to the owner and return ErrNotFound for anyone
+// else's passkey.
+type PasskeyStore interface {
+	SavePasskey(ctx context.Context, passkey models.Passkey) error
+	GetPasskey(ctx context.Context, id string) (models.Passkey, error)
+	// ListPasskeys returns userID's passkeys, oldest first.
+	ListPasskeys(ctx context.Context, userID string) ([]models.Passkey, error)
+	RenamePasskey(ctx context.Context, userID, id, name string) error
+	DeletePasskey(ctx context.Context, userID, id string) error
+	// UpdatePasskeyUsage records a successful sign-in and the
+	// authenticator's new signature counter.
+	UpdatePasskeyUsage(ctx context.Context, id string, signCount uint32, usedAt time.Time) error
+}
+
+type CircleStore interface {
+	SaveCircle(ctx context.Context, circle models.Circle) error
+	// GetCircle returns the circle with UserRole and JoinedDate filled in
+	// for viewerID when they are a member.
+	GetCircle(ctx context.Context, id, viewerID string) (models.Circle, error)
+	// CreateCircle saves a new circle with ownerID as its owner.
+	CreateCircle(ctx context.Context, circle models.Circle, ownerID string) error
+	// UpdateCircleSettings changes the circle's name, description, images
+	// and visibility.
+	UpdateCircleSettings(ctx context.Context, circle models.Circle) error
+	// TransferOwnership makes toID the owner and fromID, the current owner,
+	// an admin. toID must already be a member.
+	TransferOwnership(ctx context.Context, circleID, fromID, toID string) error
+	// ArchiveCircle makes the circle read-only from at. A non-zero deleteAt
+	// also schedules it for PurgeCircles.
+	ArchiveCircle(ctx context.Context, circleID string, at, deleteAt time.Time) error
+	// RestoreCircle undoes ArchiveCircle, cancelling any scheduled deletion.
+	RestoreCircle(ctx context.Context, circleID string) error
+	// PurgeCircles deletes circles whose deletion date is before cutoff,
+	// with their posts, and returns how many were removed.
+	PurgeCircles(ctx context.Context, cutoff time.Time) (int, error)
+	AddMember(ctx context.Context, circleID, userID, role string, joinedAt time.Time) error
+	// GetMemberRole returns userID's role in the circle, or ErrNotFound
+	// when they are not a member.
+	GetMemberRole(ctx context.Context, circleID, userID string) (string, error)
+	// SetMemberRole changes an existing member's role.
+	SetMemberRole(ctx context.Context, circleID, userID, role string) error
+	// CountMembersAmong returns how many of userIDs belong to each of the
+	// circles, leaving out circles with none. Online counts come from it,
+	// since the store doesn't know who is online.
+	CountMembersAmong(ctx context.Context, circleIDs, userIDs []string) (map[string]int, error)
+	// ListMembers returns the circle's members, highest role first.
+	ListMembers(ctx context.Context, circleID string) ([]models.CircleMember, error)
+	ListCirclesForUser(ctx context.Context, userID string) ([]models.Circle, error)
+	// ListFeaturedCircles returns featured circles viewerID has not joined.
+	ListFeaturedCircles(ctx context.Context, viewerID string, limit int) ([]models.Circle, error)
+	GetCircleStats(ctx context.Context, userID string) (models.CircleStats, error)
+
+	SaveCircleActivity(ctx context.Context, activity models.CircleActivity) error
+	ListCircleActivity(ctx context.Context, userID string, limit int) ([]models.CircleActivity, error)
+	SaveDiscussion(ctx context.Context, discussion models.Discussion) error
+	ListDiscussions(ctx context.Context, userID string, limit int) ([]models.Discussion, error)
+}
+
+// MembershipStore covers how people join and leave circles: open joins,
+// join requests for private circles, invites and bans.
+type MembershipStore interface {
+	// JoinCircle makes userID a member and clears any join request. It
+	// leaves existing members as they are and returns ErrBanned for banned
+	// users.
+	JoinCircle(ctx context.Context, circleID, userID string, at time.Time) error
+	RemoveMember(ctx context.Context, circleID, userID string) error
+
+	// BanMember removes userID from the circle and its join queue and keeps
+	// them out until UnbanMember.
+	BanMember(ctx context.Context, circleID, userID, bannedBy, reason string, at time.Time) error
+	UnbanMember(ctx context.Context, circleID, userID string) error
+	IsBanned(ctx context.Context, circleID, userID string) (bool, error)
+	ListBans(ctx context.Context, circleID string) ([]models.CircleBan, error)
+
+	// RequestToJoin queues userID for approval, replacing the message of an
+	// earlier request.
+	RequestToJoin(ctx context.Context, circleID, userID, message string, at time.Time) error
+	HasJoinRequest(ctx context.Context, circleID, userID string) (bool, error)
+	// ApproveJoinRequest turns a pending request into a membership.
+	ApproveJoinRequest(ctx context.Context, circleID, userID string, at time.Time) error
+	// DeleteJoinRequest declines or withdraws a pending request.
+	DeleteJoinRequest(ctx context.Context, circleID, userID string) error
+	// ListJoinRequests returns pending requests, oldest first.
+	ListJoinRequests(ctx context.Context, circleID string) ([]models.JoinRequest, error)
+
+	CreateInvite(ctx context.Context, invite models.CircleInvite) error
+	GetInvite(ctx context.Context, code string) (models.CircleInvite, error)
+	// ListInvites returns the circle's invites that have not been revoked,
+	// newest first.
+	ListInvites(ctx context.Context, circleID string) ([]models.CircleInvite, error)
+	RevokeInvite(ctx context.Context, circleID, code string, at time.Time) error
+	// RedeemInvite uses up one use of the invite to make userID a member
+	// and returns the circle's ID. Members redeeming again use nothing.
+	RedeemInvite(ctx context.Context, code, userID string, at time.Time) (string, error)
+}
+
+const (
+	previewReplies    = 3
+	previewReplyDepth = 2
+)
+
+// PostStore holds posts, drafts, replies and ripples. Posts come with a
+// preview of their thread: the first previewReplies top-level replies,
+// each with previewReplyDepth levels below it. ListReplies loads the rest.
+type PostStore interface {
+	SavePost(ctx context.Context, post models.Post) error
+	GetPost(ctx context.Context, id string) (models.Post, error)
+	// ListPostsByAuthor returns a page of authorID's published posts,
+	// newest first, starting after the cursor. next is empty on the last
+	// page.
+	ListPostsByAuthor(ctx context.Context, authorID string, limit int, after string) (posts []models.Post, next string, err error)
+	// ListFeed returns a page of the published posts query selects for
+	// userID, newest first, with the signals the feed ranks them by.
+	ListFeed(ctx context.Context, userID string, query FeedQuery) (items []models.FeedItem, next string, err error)
+	// SaveReply adds a reply to a published post, under parentID when set,
+	// keeping the post's and the parent's reply counts in step. Saving an
+	// existing reply only updates its content.
+	SaveReply(ctx context.Context, postID, parentID string, reply models.Reply) error
+	// GetReply returns one reply of postID without its own replies.
+	GetReply(ctx context.Context, postID, id string) (models.Reply, error)
+	// ListReplies returns a page of the replies directly under parentID,
+	// or postID's top-level replies when parentID is empty, oldest first
+	// and starting after the cursor. Each comes with depth further levels
+	// of its replies, up to limit per level. next is empty on the last page.
+	ListReplies(ctx context.Context, postID, parentID string, depth, limit int, after string) (replies []models.Reply, next string, err error)
+
+	// EditPost replaces a published post's content and media, marking it
+	// edited at the given time. Its circle and author stay the same.
+	EditPost(ctx context.Context, post models.Post, at time.Time) error
+	// DeletePost hides a published post from every listing. The row and its
+	// replies are kept.
+	DeletePost(ctx context.Context, id string, at time.Time) error
+
+	SaveDraft(ctx context.Context, authorID string, draft models.DraftPost) error
+	// GetDraft returns one of authorID's drafts, or ErrNotFound.
+	GetDraft(ctx context.Context, authorID, id string) (models.DraftPost, error)
+	ListDrafts(ctx context.Context, authorID string) ([]models.DraftPost, error)
+	// PublishDraft turns one of authorID's drafts into a post dated at.
+	PublishDraft(ctx context.Context, authorID, id string, at time.Time) error
+	DeleteDraft(ctx context.Context, authorID, id string) error
+
+	SaveRipple(ctx context.Context, ripple models.Ripple) error
+	// ListRipples returns ripples that have not yet expired, newest first.
+	ListRipples(ctx context.Context, limit int) ([]models.Ripple, error)
+}
+
+type EventStore interface {
+	SaveEvent(ctx context.Context, event models.GatherEvent) error
+	GetEvent(ctx context.Context, id, viewerID string) (models.GatherEvent, error)
+	ListFeaturedEvents(ctx context.Context, viewerID string, limit int) ([]models.GatherEvent, error)
+	// ListUpcomingEvents returns future events that are neither featured nor
+	// hosted by viewerID, soonest first, a page at a time.
+	ListUpcomingEvents(ctx context.Context, viewerID string, limit int, after string) (events []models.GatherEvent, next string, err error)
+	ListHostedEvents(ctx context.Context, hostID string) ([]models.GatherEvent, error)
+	// ListAttendingEvents returns future events viewerID hosts or has
+	// answered going or maybe to, soonest first.
+	ListAttendingEvents(ctx context.Context, viewerID string, limit int) ([]models.GatherEvent, error)
+	SetRSVP(ctx context.Context, eventID, userID, status string) error
+	SaveAnnouncement(ctx context.Context, eventID string, announcement models.Announcement) error
+
+	SaveEventCategory(ctx context.Context, category models.EventCategory, position int) error
+	// ListEventCategories counts upcoming events whose category matches
+	// either the category ID or its name, ignoring case.
+	ListEventCategories(ctx context.Context) ([]models.EventCategory, error)
+	ListEventLocations(ctx context.Context, limit int) ([]models.EventLocation, error)
+}
+
+// FeedQuery picks the sources of a feed: the viewer's own posts, posts in
+// their circles, and posts by their connections that they can see, which
+// are those on profiles and in circles they share. A post matching any
+// selected source is included.
+//
+// A non-zero Until leaves out posts made after it and counts only the
+// replies made by then, so the signals of a page stay the same however
+// long after the first page it is loaded.
+type FeedQuery struct {
+	Own         bool
+	Circles     bool
+	Connections bool
+	Until       time.Time
+	Limit       int
+	After       string
+}
+
+// MarketplaceQuery filters marketplace listings. Empty fields match everything.
+type MarketplaceQuery struct {
+	Category  string
+	PriceType string
+	Location  string
+	Condition string
+	Featured  *bool
+	Limit     int
+	After     string
+}
+
+type MarketplaceStore interface {
+	SaveMarketplaceItem(ctx context.Context, item models.MarketplaceItem) error
+	// ListMarketplaceItems returns a page of the matching listings, newest
+	// first. next is empty on the last page.
+	ListMarketplaceItems(ctx context.Context, query MarketplaceQuery) (items []models.MarketplaceItem, next string, err error)
+	CountMarketplaceItems(ctx context.Context, query MarketplaceQuery) (int, error)
+
+	SaveMarketplaceCategory(ctx context.Context, category models.MarketplaceCategory, position int) error
+	ListMarketplaceCategories(ctx context.Context) ([]models.MarketplaceCategory, error)
+	ListMarketplaceLocations(ctx context.Context, limit int) ([]models.Location, error)
+}
+
+type ChatStore interface {
+	// SaveConversation stores the conversation and adds every user in
+	// Participants to it as a member.
+	SaveConversation(ctx context.Context, conversation models.Conversation) error
+	// AddParticipant adds userID to the conversation as a member. They see
+	// only the messages sent after they join.
+	AddParticipant(ctx context.Context, conversationID, userID string) error
+	// GetParticipantRole returns userID's role in the conversation, or
+	// ErrNotFound when they are not in it.
+	GetParticipantRole(ctx context.Context, conversationID, userID string) (string, error)
+	SetParticipantRole(ctx context.Context, conversationID, userID, role string) error
+	// ListParticipants returns everyone in the conversation, admins first,
+	// then in the order they joined.
+	ListParticipants(ctx context.Context, conversationID string) ([]models.ConversationMember, error)
+	RemoveParticipant(ctx context.Context, conversationID, userID string) error
+	// CreateGroup saves a new group with its participants, makes adminID
+	// its admin and stores message announcing it, all or none of it.
+	CreateGroup(ctx context.Context, group models.Conversation, adminID string, message models.Message) error
+	// AddGroupMembers adds userIDs to the group as members and stores
+	// message announcing it, all or none of it. They see only the messages
+	// from message on.
+	AddGroupMembers(ctx context.Context, conversationID string, userIDs []string, message models.Message) error
+	// LeaveGroup stores left and takes userID out of the group. If that
+	// leaves it without an admin, whoever has been in it longest becomes
+	// one and the message promoted returns for them is stored too. It
+	// returns the new admin, or the zero User when there is none.
+	LeaveGroup(ctx context.Context, conversationID, userID string, left models.Message, promoted func(models.User) models.Message) (models.User, error)
+	// ListConversations returns userID's conversations, most recently
+	// active first. Direct conversations take the other participant's name
+	// and avatar.
+	ListConversations(ctx context.Context, userID string) ([]models.Conversation, error)
+	GetConversation(ctx context.Context, conversationID, userID string) (models.Conversation, error)
+	// SaveMessage stores a message. It is unread for every participant but
+	// the sender, whose read cursor moves past it.
+	SaveMessage(ctx context.Context, conversationID string, message models.Message) error
+	// GetMessage returns a message in one of viewerID's conversations.
+	GetMessage(ctx context.Context, id, viewerID string) (models.Message, error)
+	ListMessages(ctx context.Context, conversationID, viewerID string, limit int) ([]models.Message, error)
+	// ListMessagesAfter returns up to limit messages from all of userID's
+	// conversations that were stored after the message afterID, in the
+	// order they were stored. It returns ErrNotFound when afterID is not a
+	// message userID can see.
+	ListMessagesAfter(ctx context.Context, userID, afterID string, limit int) ([]models.Message, error)
+	// LatestMessageID returns the last message stored in any of userID's
+	// conversations, or "" when there are none.
+	LatestMessageID(ctx context.Context, userID string) (string, error)
+	// MarkConversationRead moves userID's read cursor to the conversation's
+	// last message, reporting whether it moved.
+	MarkConversationRead(ctx context.Context, conversationID, userID string) (bool, error)
+	// SaveAttachment stores an upload together with the message that sends
+	// it, so that neither is kept without the other.
+	SaveAttachment(ctx context.Context, attachment models.Attachment, message models.Message) error
+	// GetAttachment returns an attachment whose message viewerID can see,
+	// or ErrNotFound. Data holds its thumbnail when thumbnail is set and it
+	// has one, and the file otherwise; Thumbnail is left empty.
+	GetAttachment(ctx context.Context, id, viewerID string, thumbnail bool) (models.Attachment, error)
+}
+
+// Open returns the Store for driver: "sqlite" opens the database file at
+// path, "memory" starts an empty in-process store.
+func Open(driver, path string) (Store, error) {
+	switch driver {
+	case "sqlite":
+		return OpenSQLite(path)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", driver)
+	}
+}
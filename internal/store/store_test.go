@@ -0,0 +1,650 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"circles.diy/internal/models"
+)
+
+// eachStore runs fn against a fresh memory store and a fresh SQLite store,
+// which must behave the same.
+func eachStore(t *testing.T, fn func(t *testing.T, s Store)) {
+	t.Helper()
+	t.Run("memory", func(t *testing.T) {
+		s := NewMemoryStore()
+		t.Cleanup(func() { s.Close() })
+		fn(t, s)
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		fn(t, newTestSQLite(t))
+	})
+}
+
+func saveUsers(t *testing.T, s Store, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if err := s.SaveUser(context.Background(), models.User{ID: id, Handle: id, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUsers(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		want := models.User{ID: "u1", Handle: "ana", Name: "Ana", Avatar: "/a.png", Bio: "hi"}
+		if err := s.SaveUser(ctx, want); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := s.GetUser(ctx, "u1")
+		if err != nil || got != want {
+			t.Errorf("GetUser = %+v, %v; want %+v", got, err, want)
+		}
+		got, err = s.GetUserByHandle(ctx, "ana")
+		if err != nil || got != want {
+			t.Errorf("GetUserByHandle = %+v, %v; want %+v", got, err, want)
+		}
+		if _, err := s.GetUser(ctx, "nobody"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetUser(unknown) error = %v, want ErrNotFound", err)
+		}
+		if _, err := s.GetUserByHandle(ctx, "nobody"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetUserByHandle(unknown) error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestAccounts(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		if err := s.CreateAccount(ctx,
+			models.User{ID: "u1", Handle: "ana", Name: "Ana"},
+			models.Account{Email: "ana@example.com", PasswordHash: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name    string
+			user    models.User
+			account models.Account
+			want    error
+		}{
+			{"taken handle", models.User{ID: "u2", Handle: "ana"}, models.Account{Email: "other@example.com"}, ErrHandleTaken},
+			{"taken email", models.User{ID: "u2", Handle: "ben"}, models.Account{Email: "ana@example.com"}, ErrEmailTaken},
+			{"taken email in another case", models.User{ID: "u2", Handle: "ben"}, models.Account{Email: "ANA@example.com"}, ErrEmailTaken},
+			{"new", models.User{ID: "u2", Handle: "ben"}, models.Account{Email: "ben@example.com"}, nil},
+		}
+		for _, tt := range tests {
+			if err := s.CreateAccount(ctx, tt.user, tt.account); !errors.Is(err, tt.want) {
+				t.Errorf("%s: CreateAccount error = %v, want %v", tt.name, err, tt.want)
+			}
+		}
+
+		account, err := s.GetAccountByEmail(ctx, "Ana@Example.com")
+		if err != nil || account.UserID != "u1" || account.PasswordHash != "hash" {
+			t.Errorf("GetAccountByEmail = %+v, %v", account, err)
+		}
+		if err := s.SaveAccount(ctx, models.Account{UserID: "u2", Email: "ana@example.com"}); !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("SaveAccount with another's email error = %v, want ErrEmailTaken", err)
+		}
+		if err := s.SaveAccount(ctx, models.Account{UserID: "u2", Email: "ben@example.org", PasswordHash: "new"}); err != nil {
+			t.Fatal(err)
+		}
+		if account, err := s.GetAccount(ctx, "u2"); err != nil || account.Email != "ben@example.org" || account.PasswordHash != "new" {
+			t.Errorf("GetAccount after SaveAccount = %+v, %v", account, err)
+		}
+	})
+}
+
+// People signing up with the same email at once get one account between
+// them and ErrEmailTaken for the rest, never a locked database.
+func TestCreateAccountConcurrently(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		const signups = 10
+		var wg sync.WaitGroup
+		errs := make(chan error, signups)
+		for i := 0; i < signups; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				id := fmt.Sprintf("u%d", i)
+				errs <- s.CreateAccount(context.Background(),
+					models.User{ID: id, Handle: id}, models.Account{Email: "same@example.com"})
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		created := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				created++
+			case !errors.Is(err, ErrEmailTaken):
+				t.Errorf("CreateAccount error = %v, want nil or ErrEmailTaken", err)
+			}
+		}
+		if created != 1 {
+			t.Errorf("%d accounts created, want 1", created)
+		}
+	})
+}
+
+func TestSessionsAndLoginTokens(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		saveUsers(t, s, "u1")
+		now := time.Now()
+
+		for _, session := range []models.Session{
+			{ID: "live", UserID: "u1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+			{ID: "expired", UserID: "u1", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+		} {
+			if err := s.CreateSession(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if session, err := s.GetSession(ctx, "live"); err != nil || session.UserID != "u1" {
+			t.Errorf("GetSession(live) = %+v, %v", session, err)
+		}
+		if _, err := s.GetSession(ctx, "expired"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetSession(expired) error = %v, want ErrNotFound", err)
+		}
+		if err := s.DeleteSession(ctx, "live"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetSession(ctx, "live"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetSession after delete error = %v, want ErrNotFound", err)
+		}
+
+		for _, id := range []string{"first", "second"} {
+			token := models.LoginToken{ID: id, UserID: "u1", CreatedAt: now, ExpiresAt: now.Add(15 * time.Minute)}
+			if err := s.CreateLoginToken(ctx, token); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if token, err := s.ConsumeLoginToken(ctx, "second"); err != nil || token.UserID != "u1" {
+			t.Errorf("ConsumeLoginToken = %+v, %v", token, err)
+		}
+		for _, id := range []string{"second", "first", "unknown"} {
+			if _, err := s.ConsumeLoginToken(ctx, id); !errors.Is(err, ErrNotFound) {
+				t.Errorf("ConsumeLoginToken(%s) after use error = %v, want ErrNotFound", id, err)
+			}
+		}
+	})
+}
+
+func TestCircleMembership(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		saveUsers(t, s, "owner", "ana", "ben", "cy")
+		now := time.Now()
+		if err := s.CreateCircle(ctx, models.Circle{ID: "c1", Name: "Garden", Visibility: "public"}, "owner"); err != nil {
+			t.Fatal(err)
+		}
+
+		if role, err := s.GetMemberRole(ctx, "c1", "owner"); err != nil || role != "owner" {
+			t.Errorf("owner's role = %q, %v", role, err)
+		}
+		if _, err := s.GetMemberRole(ctx, "c1", "ana"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("non-member's role error = %v, want ErrNotFound", err)
+		}
+		if err := s.JoinCircle(ctx, "c1", "ana", now); err != nil {
+			t.Fatal(err)
+		}
+		if role, err := s.GetMemberRole(ctx, "c1", "ana"); err != nil || role != "member" {
+			t.Errorf("joiner's role = %q, %v", role, err)
+		}
+		if err := s.SetMemberRole(ctx, "c1", "ana", "captain"); !errors.Is(err, ErrInvalidRole) {
+			t.Errorf("SetMemberRole(captain) error = %v, want ErrInvalidRole", err)
+		}
+
+		if err := s.BanMember(ctx, "c1", "ana", "owner", "spam", now); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetMemberRole(ctx, "c1", "ana"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("banned member's role error = %v, want ErrNotFound", err)
+		}
+		if err := s.JoinCircle(ctx, "c1", "ana", now); !errors.Is(err, ErrBanned) {
+			t.Errorf("JoinCircle while banned error = %v, want ErrBanned", err)
+		}
+
+		invite := models.CircleInvite{Code: "abc", CircleID: "c1", CreatedBy: "owner", MaxUses: 1, CreatedAt: now}
+		if err := s.CreateInvite(ctx, invite); err != nil {
+			t.Fatal(err)
+		}
+		if circleID, err := s.RedeemInvite(ctx, "abc", "ben", now); err != nil || circleID != "c1" {
+			t.Errorf("RedeemInvite = %q, %v", circleID, err)
+		}
+		if _, err := s.RedeemInvite(ctx, "abc", "ben", now); err != nil {
+			t.Errorf("RedeemInvite again by a member error = %v, want nil", err)
+		}
+		if _, err := s.RedeemInvite(ctx, "abc", "cy", now); !errors.Is(err, ErrInviteUnusable) {
+			t.Errorf("RedeemInvite past its uses error = %v, want ErrInviteUnusable", err)
+		}
+		if _, err := s.RedeemInvite(ctx, "nope", "cy", now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RedeemInvite(unknown) error = %v, want ErrNotFound", err)
+		}
+		if got, err := s.GetInvite(ctx, "abc"); err != nil || got.Uses != 1 {
+			t.Errorf("GetInvite = %+v, %v; want 1 use", got, err)
+		}
+	})
+}
+
+// Online counts come from live presence through CountMembersAmong, never
+// from the stored presence columns.
+func TestCountMembersAmong(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		saveUsers(t, s, "ana", "ben", "cy")
+		now := time.Now()
+		if err := s.CreateCircle(ctx, models.Circle{ID: "c1", Name: "Garden", Visibility: "public"}, "ana"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CreateCircle(ctx, models.Circle{ID: "c2", Name: "Choir", Visibility: "public"}, "ben"); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []string{"ben", "cy"} {
+			if err := s.JoinCircle(ctx, "c1", id, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.SetPresence(ctx, "cy", true, now); err != nil {
+			t.Fatal(err)
+		}
+
+		if c, err := s.GetCircle(ctx, "c1", "ana"); err != nil || c.MemberCount != 3 || c.OnlineCount != 0 {
+			t.Errorf("GetCircle(c1) counts = %d members, %d online, %v; want 3, 0", c.MemberCount, c.OnlineCount, err)
+		}
+		counts, err := s.CountMembersAmong(ctx, []string{"c1", "c2", "c3"}, []string{"ana", "ben", "zed"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]int{"c1": 2, "c2": 1}
+		if len(counts) != len(want) || counts["c1"] != want["c1"] || counts["c2"] != want["c2"] {
+			t.Errorf("CountMembersAmong = %v, want %v", counts, want)
+		}
+		if counts, err := s.CountMembersAmong(ctx, []string{"c1"}, nil); err != nil || len(counts) != 0 {
+			t.Errorf("CountMembersAmong with nobody around = %v, %v; want none", counts, err)
+		}
+	})
+}
+
+// An invite redeemed by many people at once admits exactly MaxUses of them
+// and turns the rest away with ErrInviteUnusable, never a locked database.
+func TestRedeemInviteConcurrently(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		const maxUses, people = 3, 12
+		ids := make([]string, people)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("u%d", i)
+		}
+		saveUsers(t, s, append(ids, "owner")...)
+		now := time.Now()
+		if err := s.CreateCircle(ctx, models.Circle{ID: "c1", Name: "Garden", Visibility: "private"}, "owner"); err != nil {
+			t.Fatal(err)
+		}
+		invite := models.CircleInvite{Code: "abc", CircleID: "c1", CreatedBy: "owner", MaxUses: maxUses, CreatedAt: now}
+		if err := s.CreateInvite(ctx, invite); err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, people)
+		for _, id := range ids {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				_, err := s.RedeemInvite(ctx, "abc", id, now)
+				errs <- err
+			}(id)
+		}
+		wg.Wait()
+		close(errs)
+
+		redeemed := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				redeemed++
+			case !errors.Is(err, ErrInviteUnusable):
+				t.Errorf("RedeemInvite error = %v, want nil or ErrInviteUnusable", err)
+			}
+		}
+		if redeemed != maxUses {
+			t.Errorf("%d redemptions succeeded, want %d", redeemed, maxUses)
+		}
+		if got, err := s.GetInvite(ctx, "abc"); err != nil || got.Uses != maxUses {
+			t.Errorf("GetInvite = %+v, %v; want %d uses", got, err, maxUses)
+		}
+		members := 0
+		for _, id := range ids {
+			if _, err := s.GetMemberRole(ctx, "c1", id); err == nil {
+				members++
+			}
+		}
+		if members != maxUses {
+			t.Errorf("%d people joined, want %d", members, maxUses)
+		}
+	})
+}
+
+// Join requests sent and approved at the same time all go through.
+func TestJoinRequestsConcurrently(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		const people = 10
+		ids := make([]string, people)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("u%d", i)
+		}
+		saveUsers(t, s, append(ids, "owner")...)
+		now := time.Now()
+		if err := s.CreateCircle(ctx, models.Circle{ID: "c1", Name: "Garden", Visibility: "private"}, "owner"); err != nil {
+			t.Fatal(err)
+		}
+
+		run := func(name string, fn func(id string) error) {
+			var wg sync.WaitGroup
+			errs := make(chan error, people)
+			for _, id := range ids {
+				wg.Add(1)
+				go func(id string) {
+					defer wg.Done()
+					errs <- fn(id)
+				}(id)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Errorf("%s error = %v", name, err)
+				}
+			}
+		}
+		run("RequestToJoin", func(id string) error { return s.RequestToJoin(ctx, "c1", id, "hi", now) })
+		run("ApproveJoinRequest", func(id string) error { return s.ApproveJoinRequest(ctx, "c1", id, now) })
+
+		for _, id := range ids {
+			if role, err := s.GetMemberRole(ctx, "c1", id); err != nil || role != "member" {
+				t.Errorf("%s's role = %q, %v", id, role, err)
+			}
+		}
+	})
+}
+
+func TestConversations(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		saveUsers(t, s, "ana", "ben", "cy")
+		now := time.Now()
+		err := s.SaveConversation(ctx, models.Conversation{
+			ID: "g1", Name: "Plot", IsGroup: true, CreatedAt: now,
+			Participants: []models.User{{ID: "ana"}, {ID: "ben"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		send := func(id, from string, at time.Time) {
+			t.Helper()
+			err := s.SaveMessage(ctx, "g1", models.Message{ID: id, Content: id, Sender: models.User{ID: from}, CreatedAt: at})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		send("m1", "ana", now.Add(time.Second))
+
+		if _, err := s.GetMessage(ctx, "m1", "cy"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetMessage by an outsider error = %v, want ErrNotFound", err)
+		}
+		if err := s.AddParticipant(ctx, "g1", "cy"); err != nil {
+			t.Fatal(err)
+		}
+		send("m2", "ben", now.Add(2*time.Second))
+
+		tests := []struct {
+			viewer string
+			want   []string
+		}{
+			{"ana", []string{"m1", "m2"}},
+			{"ben", []string{"m1", "m2"}},
+			// cy joined after m1
+			{"cy", []string{"m2"}},
+		}
+		for _, tt := range tests {
+			messages, err := s.ListMessages(ctx, "g1", tt.viewer, 50)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, m := range messages {
+				ids = append(ids, m.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("ListMessages for %s = %v, want %v", tt.viewer, ids, tt.want)
+			}
+		}
+
+		conversation, err := s.GetConversation(ctx, "g1", "ana")
+		if err != nil || conversation.UnreadCount != 1 {
+			t.Errorf("GetConversation for ana = unread %d, %v; want 1", conversation.UnreadCount, err)
+		}
+		if moved, err := s.MarkConversationRead(ctx, "g1", "ana"); err != nil || !moved {
+			t.Errorf("MarkConversationRead = %v, %v; want true", moved, err)
+		}
+		if moved, err := s.MarkConversationRead(ctx, "g1", "ana"); err != nil || moved {
+			t.Errorf("MarkConversationRead again = %v, %v; want false", moved, err)
+		}
+
+		if err := s.RemoveParticipant(ctx, "g1", "ben"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetConversation(ctx, "g1", "ben"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetConversation after leaving error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestGroupCreateAddAndLeave(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		saveUsers(t, s, "ana", "ben", "cy", "dy", "ed")
+		now := time.Now()
+		sent := 0
+		announce := func(id, from string) models.Message {
+			sent++
+			return models.Message{ID: id, Content: id, Type: "system", Sender: models.User{ID: from},
+				CreatedAt: now.Add(time.Duration(sent) * time.Second)}
+		}
+		messages := func(viewer string) []string {
+			t.Helper()
+			list, err := s.ListMessages(ctx, "g1", viewer, 50)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, m := range list {
+				ids = append(ids, m.ID)
+			}
+			return ids
+		}
+		promote := func(u models.User) models.Message { return announce(u.ID+"-admin", u.ID) }
+
+		// Nothing is kept when the admin isn't in the group
+		err := s.CreateGroup(ctx, models.Conversation{
+			ID: "g1", Name: "Plot", IsGroup: true, CreatedAt: now,
+			Participants: []models.User{{ID: "ana"}, {ID: "ben"}},
+		}, "ed", announce("bad", "ed"))
+		if err == nil {
+			t.Fatal("CreateGroup with an outside admin succeeded")
+		}
+		if _, err := s.GetConversation(ctx, "g1", "ana"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetConversation after a failed CreateGroup error = %v, want ErrNotFound", err)
+		}
+
+		err = s.CreateGroup(ctx, models.Conversation{
+			ID: "g1", Name: "Plot", IsGroup: true, CreatedAt: now,
+			Participants: []models.User{{ID: "ana"}, {ID: "ben"}, {ID: "cy"}},
+		}, "ana", announce("created", "ana"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if role, err := s.GetParticipantRole(ctx, "g1", "ana"); err != nil || role != models.GroupAdmin {
+			t.Errorf("creator's role = %q, %v", role, err)
+		}
+		if got := messages("ben"); !slices.Equal(got, []string{"created"}) {
+			t.Errorf("ben sees %v, want [created]", got)
+		}
+		// Nobody is added when one of them can't be
+		if err := s.AddGroupMembers(ctx, "g1", []string{"dy", "nobody"}, announce("bad-add", "ana")); err == nil {
+			t.Error("AddGroupMembers with an unknown user succeeded")
+		}
+		if _, err := s.GetParticipantRole(ctx, "g1", "dy"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("role after a failed AddGroupMembers error = %v, want ErrNotFound", err)
+		}
+		if err := s.AddGroupMembers(ctx, "g1", []string{"dy"}, announce("dy-added", "ana")); err != nil {
+			t.Fatal(err)
+		}
+		if role, err := s.GetParticipantRole(ctx, "g1", "dy"); err != nil || role != models.GroupMember {
+			t.Errorf("added member's role = %q, %v", role, err)
+		}
+
+		if _, err := s.LeaveGroup(ctx, "g1", "ed", announce("ed-left", "ed"), promote); !errors.Is(err, ErrNotFound) {
+			t.Errorf("LeaveGroup by an outsider error = %v, want ErrNotFound", err)
+		}
+		if successor, err := s.LeaveGroup(ctx, "g1", "ben", announce("ben-left", "ben"), promote); err != nil || successor.ID != "" {
+			t.Errorf("member leaving = %q, %v; want no new admin", successor.ID, err)
+		}
+		// The last admin leaving hands over to whoever joined first
+		if successor, err := s.LeaveGroup(ctx, "g1", "ana", announce("ana-left", "ana"), promote); err != nil || successor.ID != "cy" {
+			t.Errorf("admin leaving = %q, %v; want cy", successor.ID, err)
+		}
+		if role, err := s.GetParticipantRole(ctx, "g1", "cy"); err != nil || role != models.GroupAdmin {
+			t.Errorf("successor's role = %q, %v", role, err)
+		}
+		if _, err := s.GetParticipantRole(ctx, "g1", "ana"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("role after leaving error = %v, want ErrNotFound", err)
+		}
+		if got, want := messages("cy"), []string{"created", "dy-added", "ben-left", "ana-left", "cy-admin"}; !slices.Equal(got, want) {
+			t.Errorf("cy sees %v, want %v", got, want)
+		}
+		if got, want := messages("dy"), []string{"dy-added", "ben-left", "ana-left", "cy-admin"}; !slices.Equal(got, want) {
+			t.Errorf("dy sees %v, want %v", got, want)
+		}
+
+		if successor, err := s.LeaveGroup(ctx, "g1", "dy", announce("dy-left", "dy"), promote); err != nil || successor.ID != "" {
+			t.Errorf("member leaving an admin = %q, %v; want no new admin", successor.ID, err)
+		}
+		if successor, err := s.LeaveGroup(ctx, "g1", "cy", announce("cy-left", "cy"), promote); err != nil || successor.ID != "" {
+			t.Errorf("last member leaving = %q, %v; want no new admin", successor.ID, err)
+		}
+	})
+}
+
+func TestAttachments(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		saveUsers(t, s, "ana", "ben", "cy")
+		now := time.Now()
+		err := s.SaveConversation(ctx, models.Conversation{
+			ID: "d1", CreatedAt: now, Participants: []models.User{{ID: "ana"}, {ID: "ben"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		attachment := models.Attachment{
+			ID: "a1", ConversationID: "d1", MessageID: "m1", UploaderID: "ana", Kind: "image",
+			Name: "cat.png", ContentType: "image/png", Size: 4,
+			Data: []byte("full"), Thumbnail: []byte("thumb"), CreatedAt: now,
+		}
+		message := models.Message{ID: "m1", Type: "image", Sender: models.User{ID: "ana"}, CreatedAt: now}
+		if err := s.SaveAttachment(ctx, attachment, message); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.GetMessage(ctx, "m1", "ben"); err != nil || got.Type != "image" {
+			t.Errorf("GetMessage(m1) = %q, %v; want the image message", got.Type, err)
+		}
+
+		lost := attachment
+		lost.ID, lost.ConversationID, lost.MessageID = "a2", "nowhere", "m2"
+		if err := s.SaveAttachment(ctx, lost, models.Message{ID: "m2", Sender: models.User{ID: "ana"}}); err == nil {
+			t.Error("SaveAttachment to a missing conversation succeeded")
+		}
+		if _, err := s.GetAttachment(ctx, "a2", "ana", false); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetAttachment(a2) = %v; want ErrNotFound", err)
+		}
+
+		tests := []struct {
+			viewer    string
+			thumbnail bool
+			want      string
+			err       error
+		}{
+			{"ben", false, "full", nil},
+			{"ben", true, "thumb", nil},
+			{"cy", false, "", ErrNotFound},
+		}
+		for _, tt := range tests {
+			got, err := s.GetAttachment(ctx, "a1", tt.viewer, tt.thumbnail)
+			if !errors.Is(err, tt.err) || string(got.Data) != tt.want {
+				t.Errorf("GetAttachment(%s, thumbnail %v) = %q, %v; want %q, %v", tt.viewer, tt.thumbnail, got.Data, err, tt.want, tt.err)
+			}
+		}
+	})
+}
+
+// Someone added to a group can't fetch what was sent before they joined,
+// even knowing its ID.
+func TestAttachmentsBeforeJoining(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		saveUsers(t, s, "ana", "ben", "cy")
+		now := time.Now()
+		err := s.CreateGroup(ctx, models.Conversation{
+			ID: "g1", Name: "Plot", IsGroup: true, CreatedAt: now,
+			Participants: []models.User{{ID: "ana"}, {ID: "ben"}},
+		}, "ana", models.Message{ID: "created", Type: "system", Sender: models.User{ID: "ana"}, CreatedAt: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+		attach := func(id, messageID string, at time.Time) {
+			t.Helper()
+			attachment := models.Attachment{
+				ID: id, ConversationID: "g1", MessageID: messageID, UploaderID: "ana", Kind: "file",
+				Name: "plan.pdf", ContentType: "application/pdf", Size: 4, Data: []byte(id), CreatedAt: at,
+			}
+			message := models.Message{ID: messageID, Type: "file", Sender: models.User{ID: "ana"}, CreatedAt: at}
+			if err := s.SaveAttachment(ctx, attachment, message); err != nil {
+				t.Fatal(err)
+			}
+		}
+		attach("a1", "m1", now.Add(time.Second))
+		added := models.Message{ID: "cy-added", Type: "system", Sender: models.User{ID: "ana"}, CreatedAt: now.Add(2 * time.Second)}
+		if err := s.AddGroupMembers(ctx, "g1", []string{"cy"}, added); err != nil {
+			t.Fatal(err)
+		}
+		attach("a2", "m2", now.Add(3*time.Second))
+
+		tests := []struct {
+			id, viewer string
+			err        error
+		}{
+			{"a1", "ben", nil},
+			{"a1", "cy", ErrNotFound},
+			{"a2", "cy", nil},
+		}
+		for _, tt := range tests {
+			got, err := s.GetAttachment(ctx, tt.id, tt.viewer, false)
+			if !errors.Is(err, tt.err) || (err == nil && string(got.Data) != tt.id) {
+				t.Errorf("GetAttachment(%s) as %s = %q, %v; want %v", tt.id, tt.viewer, got.Data, err, tt.err)
+			}
+		}
+	})
+}
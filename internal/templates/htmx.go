@@ -0,0 +1,149 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// HTMX describes how HTMX sent a request, from its request headers.
+type HTMX struct {
+	// Request is set for every request HTMX makes (HX-Request).
+	Request bool
+	// Boosted is set for boosted links and forms (HX-Boosted), which
+	// swap in the whole page like an ordinary navigation.
+	Boosted bool
+	// Target is the ID of the element the response will be swapped into
+	// (HX-Target), empty when it has none.
+	Target string
+}
+
+func HTMXRequest(r *http.Request) HTMX {
+	return HTMX{
+		Request: r.Header.Get("HX-Request") == "true",
+		Boosted: r.Header.Get("HX-Boosted") == "true",
+		Target:  r.Header.Get("HX-Target"),
+	}
+}
+
+// Partial reports whether the request wants part of a page rather than a
+// whole one.
+func (h HTMX) Partial() bool {
+	return h.Request && !h.Boosted
+}
+
+// MainID is the ID of the base layout's <main> element. HTMX requests for
+// a page that target it get the page's "main" block alone.
+const MainID = "main"
+
+// View is something a handler renders from one template set: a page,
+// or for HTMX requests the fragment of it they target.
+type View struct {
+	// Set names the page whose template set the view renders from.
+	Set string
+	// Page is rendered for ordinary and boosted requests.
+	Page string
+	// Fragments are rendered instead of Page for HTMX requests targeting
+	// each element ID.
+	Fragments map[string]Fragment
+	// Fragment is rendered for HTMX requests targeting anything else.
+	// Views that are only ever fragments leave Page empty.
+	Fragment string
+	Data     any
+	// OOB fragments follow the main one in HTMX responses, to be swapped
+	// into other elements of the page.
+	OOB    []OOB
+	Status int
+}
+
+// Fragment is a template rendered alone, with Data or, when that is nil,
+// the view's data.
+type Fragment struct {
+	Name string
+	Data any
+}
+
+// OOB is a fragment swapped out of band into the element with ID Target.
+// Swap is any hx-swap style but outerHTML, innerHTML by default: fragments
+// replacing their whole element carry their own hx-swap-oob attribute and
+// go in as the main fragment instead.
+type OOB struct {
+	Target string
+	Swap   string
+	Name   string
+	Data   any
+}
+
+// Render writes the view as the response to r. Nothing is written when a
+// template fails, leaving the caller free to answer with an error.
+func (v View) Render(w http.ResponseWriter, r *http.Request) error {
+	set, err := Lookup(v.Set)
+	if err != nil {
+		return err
+	}
+
+	hx := HTMXRequest(r)
+	name, data := v.Page, v.Data
+	if hx.Partial() || name == "" {
+		if fragment, ok := v.Fragments[hx.Target]; ok {
+			name = fragment.Name
+			if fragment.Data != nil {
+				data = fragment.Data
+			}
+		} else if hx.Target == MainID && v.Page != "" && set.Lookup("main") != nil {
+			name = "main"
+		} else if v.Fragment != "" {
+			name = v.Fragment
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := set.ExecuteTemplate(&buf, name, data); err != nil {
+		return fmt.Errorf("failed to render %s: %v", name, err)
+	}
+	if hx.Partial() {
+		for _, oob := range v.OOB {
+			swap := oob.Swap
+			if swap == "" {
+				swap = "innerHTML"
+			}
+			fmt.Fprintf(&buf, "\n<div hx-swap-oob=\"%s:#%s\">", template.HTMLEscapeString(swap), template.HTMLEscapeString(oob.Target))
+			if err := set.ExecuteTemplate(&buf, oob.Name, oob.Data); err != nil {
+				return fmt.Errorf("failed to render %s: %v", oob.Name, err)
+			}
+			buf.WriteString("</div>")
+		}
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Add("Vary", "HX-Request, HX-Boosted, HX-Target")
+	status := v.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// Trigger adds an event for HTMX to fire on the element that sent the
+// request once the response arrives, with detail as the event's detail.
+// Events from several calls are sent together in one HX-Trigger header.
+func Trigger(w http.ResponseWriter, event string, detail any) {
+	events := map[string]any{}
+	if existing := w.Header().Get("HX-Trigger"); existing != "" {
+		if err := json.Unmarshal([]byte(existing), &events); err != nil {
+			// A plain event name set by hand
+			events = map[string]any{existing: nil}
+		}
+	}
+	events[event] = detail
+	encoded, err := json.Marshal(events)
+	if err != nil {
+		return
+	}
+	w.Header().Set("HX-Trigger", string(encoded))
+}
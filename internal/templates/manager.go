@@ -3,182 +3,197 @@ package templates
 import (
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
+	"circles.diy/internal/assets"
+	"circles.diy/internal/authz"
 	"circles.diy/internal/models"
 )
 
-type Templates struct {
-	Dashboard       *template.Template
-	ProfilePublic   *template.Template
-	ProfileInternal *template.Template
-	Circles         *template.Template
-	Chat            *template.Template
-	Gather          *template.Template
-	Marketplace     *template.Template
-}
+const (
+	layoutGlob    = "templates/layouts/*.html"
+	componentGlob = "templates/components/*.html"
+	pageGlob      = "templates/pages/*.html"
+)
 
-var templates *Templates
-
-func InitTemplates() error {
-	templates = &Templates{}
-
-	// Define custom template functions
-	funcMap := template.FuncMap{
-		"sub": func(a, b int) int {
-			return a - b
-		},
-		"slice": func(s interface{}, start, end int) interface{} {
-			switch v := s.(type) {
-			case []models.MediaItem:
-				if start < 0 || end > len(v) || start > end {
-					return []models.MediaItem{}
-				}
-				return v[start:end]
-			case []interface{}:
-				if start < 0 || end > len(v) || start > end {
-					return []interface{}{}
-				}
-				return v[start:end]
-			default:
-				return s
+// funcMap holds the functions every template set can call.
+var funcMap = template.FuncMap{
+	// asset returns the fingerprinted URL of a file under static/
+	"asset": assets.URL,
+	"sub": func(a, b int) int {
+		return a - b
+	},
+	"slice": func(s interface{}, start, end int) interface{} {
+		switch v := s.(type) {
+		case []models.MediaItem:
+			if start < 0 || end > len(v) || start > end {
+				return []models.MediaItem{}
 			}
-		},
-		"add": func(a, b int) int {
-			return a + b
-		},
-	}
-
-	// Parse dashboard template
-	dashboardTemplate := template.New("dashboard").Funcs(funcMap)
-	dashboardTemplate, err := dashboardTemplate.ParseGlob("templates/layouts/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse layout templates: %v", err)
-	}
-
-	dashboardTemplate, err = dashboardTemplate.ParseGlob("templates/components/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse component templates: %v", err)
-	}
-
-	dashboardTemplate, err = dashboardTemplate.ParseFiles("templates/pages/dashboard.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse dashboard template: %v", err)
-	}
-	templates.Dashboard = dashboardTemplate
-
-	// Parse profile template
-	profileTemplate := template.New("profile").Funcs(funcMap)
-	profileTemplate, err = profileTemplate.ParseGlob("templates/layouts/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse layout templates for profile: %v", err)
-	}
-
-	profileTemplate, err = profileTemplate.ParseGlob("templates/components/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse component templates for profile: %v", err)
-	}
-
-	profileTemplate, err = profileTemplate.ParseFiles("templates/pages/profile-public.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse profile template: %v", err)
-	}
-	templates.ProfilePublic = profileTemplate
-
-	// Parse profile-internal template
-	profileInternalTemplate := template.New("profile-internal").Funcs(funcMap)
-	profileInternalTemplate, err = profileInternalTemplate.ParseGlob("templates/layouts/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse layout templates for profile-internal: %v", err)
-	}
-
-	profileInternalTemplate, err = profileInternalTemplate.ParseGlob("templates/components/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse component templates for profile-internal: %v", err)
-	}
-
-	profileInternalTemplate, err = profileInternalTemplate.ParseFiles("templates/pages/profile-internal.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse profile-internal template: %v", err)
-	}
-	templates.ProfileInternal = profileInternalTemplate
+			return v[start:end]
+		case []interface{}:
+			if start < 0 || end > len(v) || start > end {
+				return []interface{}{}
+			}
+			return v[start:end]
+		default:
+			return s
+		}
+	},
+	"add": func(a, b int) int {
+		return a + b
+	},
+	// can reports whether a circle role grants a permission
+	"can": func(role, perm string) bool {
+		return authz.Role(role).Can(authz.Permission(perm))
+	},
+	"roleLabel": func(role string) string {
+		return authz.Role(role).Label()
+	},
+	// manages reports whether actor may change target's role
+	"manages": func(actor, target string) bool {
+		a := authz.Role(actor)
+		return a.Can(authz.PermEditSettings) && a.Rank() > authz.Role(target).Rank()
+	},
+	"removes": func(actor, target string) bool {
+		return authz.CanRemove(authz.Role(actor), authz.Role(target))
+	},
+	// fileSize formats a byte count as KB or MB
+	"fileSize": func(size int64) string {
+		switch {
+		case size >= 1<<20:
+			return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+		case size >= 1<<10:
+			return fmt.Sprintf("%d KB", size>>10)
+		}
+		return fmt.Sprintf("%d bytes", size)
+	},
+}
 
-	// Parse circles template
-	circlesTemplate := template.New("circles").Funcs(funcMap)
-	circlesTemplate, err = circlesTemplate.ParseGlob("templates/layouts/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse layout templates for circles: %v", err)
-	}
+// Registry holds a template set for every page in templates/pages, each
+// parsed with the layouts and components. The set for pages/dashboard.html
+// is named "dashboard".
+type Registry struct {
+	files fs.FS
+	dev   bool
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+	// errs holds the pages that failed to parse in development, where a
+	// broken template is shown in the browser rather than stopping the
+	// server.
+	errs map[string]error
+}
 
-	circlesTemplate, err = circlesTemplate.ParseGlob("templates/components/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse component templates for circles: %v", err)
-	}
+var registry *Registry
 
-	circlesTemplate, err = circlesTemplate.ParseFiles("templates/pages/circles.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse circles template: %v", err)
+// Init parses every page from files, which holds the templates directory.
+// In development the pages are parsed again whenever a template changes.
+func Init(files fs.FS, dev bool) error {
+	r := &Registry{files: files, dev: dev}
+	if err := r.load(); err != nil {
+		return err
 	}
-	templates.Circles = circlesTemplate
-
-	// Parse chat template
-	chatTemplate := template.New("chat").Funcs(funcMap)
-	chatTemplate, err = chatTemplate.ParseGlob("templates/layouts/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse layout templates for chat: %v", err)
+	registry = r
+	if dev {
+		go r.watch()
 	}
+	log.Printf("Templates initialized successfully (%d pages)", len(r.pages)+len(r.errs))
+	return nil
+}
 
-	chatTemplate, err = chatTemplate.ParseGlob("templates/components/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse component templates for chat: %v", err)
-	}
+// Lookup returns the template set for a page.
+func Lookup(page string) (*template.Template, error) {
+	return registry.lookup(page)
+}
 
-	chatTemplate, err = chatTemplate.ParseFiles("templates/pages/chat.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse chat template: %v", err)
+func (r *Registry) lookup(page string) (*template.Template, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err, ok := r.errs[page]; ok {
+		return nil, err
 	}
-	templates.Chat = chatTemplate
-
-	// Parse gather template
-	gatherTemplate := template.New("gather").Funcs(funcMap)
-	gatherTemplate, err = gatherTemplate.ParseGlob("templates/layouts/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse layout templates for gather: %v", err)
+	set, ok := r.pages[page]
+	if !ok {
+		return nil, fmt.Errorf("no %s page template", page)
 	}
+	return set, nil
+}
 
-	gatherTemplate, err = gatherTemplate.ParseGlob("templates/components/*.html")
+// load parses every page. Outside development the first page that fails
+// is returned as an error.
+func (r *Registry) load() error {
+	files, err := fs.Glob(r.files, pageGlob)
 	if err != nil {
-		return fmt.Errorf("failed to parse component templates for gather: %v", err)
+		return fmt.Errorf("failed to list page templates: %v", err)
 	}
-
-	gatherTemplate, err = gatherTemplate.ParseFiles("templates/pages/gather.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse gather template: %v", err)
+	if len(files) == 0 {
+		return fmt.Errorf("failed to find page templates: none match %s", pageGlob)
 	}
-	templates.Gather = gatherTemplate
 
-	// Parse marketplace template
-	marketplaceTemplate := template.New("marketplace").Funcs(funcMap)
-	marketplaceTemplate, err = marketplaceTemplate.ParseGlob("templates/layouts/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse layout templates for marketplace: %v", err)
+	pages := make(map[string]*template.Template, len(files))
+	errs := map[string]error{}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".html")
+		set, err := template.New(name).Funcs(funcMap).ParseFS(r.files, layoutGlob, componentGlob, file)
+		if err != nil {
+			err = fmt.Errorf("failed to parse %s template: %v", name, err)
+			if !r.dev {
+				return err
+			}
+			log.Println(err)
+			errs[name] = err
+			continue
+		}
+		pages[name] = set
 	}
 
-	marketplaceTemplate, err = marketplaceTemplate.ParseGlob("templates/components/*.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse component templates for marketplace: %v", err)
-	}
+	r.mu.Lock()
+	r.pages, r.errs = pages, errs
+	r.mu.Unlock()
+	return nil
+}
 
-	marketplaceTemplate, err = marketplaceTemplate.ParseFiles("templates/pages/marketplace.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse marketplace template: %v", err)
+// watch parses the pages again whenever a template file changes.
+func (r *Registry) watch() {
+	lastModTime := r.modTime()
+	for {
+		time.Sleep(1 * time.Second)
+
+		modTime := r.modTime()
+		if !modTime.After(lastModTime) {
+			continue
+		}
+		lastModTime = modTime
+		log.Println("Templates changed, reloading...")
+		if err := r.load(); err != nil {
+			log.Printf("Error reloading templates: %v", err)
+		}
 	}
-	templates.Marketplace = marketplaceTemplate
-
-	log.Println("Templates initialized successfully")
-	return nil
 }
 
-func GetTemplates() *Templates {
-	return templates
+// modTime returns when a template file last changed.
+func (r *Registry) modTime() time.Time {
+	var latest time.Time
+	err := fs.WalkDir(r.files, "templates", func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error watching templates: %v", err)
+	}
+	return latest
 }
@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"circles.diy/internal/models"
-	"circles.diy/internal/utils"
 )
 
 func GetMockDashboardData() models.DashboardData {
@@ -16,7 +15,6 @@ func GetMockDashboardData() models.DashboardData {
 				Mode:   "system",
 				Radius: "0",
 			},
-			CSRFToken: utils.GenerateCSRFToken(),
 		},
 		Feed: []models.FeedItem{
 			{
@@ -183,7 +181,6 @@ func GetMockDashboardData() models.DashboardData {
 				Circle:  "Communication Software",
 			},
 		},
-		FeedOffset: 4,
 		Circles: []models.Circle{
 			{ID: "1", Name: "Woodworking", Thumbnail: "https://images.unsplash.com/photo-1504148455328-c376907d081c?w=48&h=48&fit=crop&crop=center", LastActivity: "2m ago"},
 			{ID: "2", Name: "The Crop Circle", Thumbnail: "https://images.unsplash.com/photo-1611402858501-d3de70f3c67e?q=80&w=48&auto=format&fit=crop", LastActivity: "15m ago"},
@@ -304,7 +301,6 @@ func GetMockProfileData(handle string, isOwner bool) models.ProfileData {
 			Mode:   "system",
 			Radius: "0",
 		},
-		CSRFToken: utils.GenerateCSRFToken(),
 	}
 
 	switch handle {
@@ -373,9 +369,7 @@ func GetMockProfileData(handle string, isOwner bool) models.ProfileData {
 					},
 				},
 			},
-			PostOffset:   1,
-			HasMorePosts: true,
-			IsOwner:      isOwner,
+			IsOwner: isOwner,
 		}
 
 	case "@heathtyler":
@@ -434,9 +428,7 @@ func GetMockProfileData(handle string, isOwner bool) models.ProfileData {
 					Circle:  "The Crop Circle",
 				},
 			},
-			PostOffset:   1,
-			HasMorePosts: false,
-			IsOwner:      isOwner,
+			IsOwner: isOwner,
 		}
 
 	case "@sara_pcb":
@@ -495,9 +487,7 @@ func GetMockProfileData(handle string, isOwner bool) models.ProfileData {
 					Circle:  "DIY Electronics",
 				},
 			},
-			PostOffset:   1,
-			HasMorePosts: false,
-			IsOwner:      isOwner,
+			IsOwner: isOwner,
 		}
 
 	case "@zucc":
@@ -552,9 +542,7 @@ func GetMockProfileData(handle string, isOwner bool) models.ProfileData {
 					Circle:  "Communication Software",
 				},
 			},
-			PostOffset:   1,
-			HasMorePosts: false,
-			IsOwner:      isOwner,
+			IsOwner: isOwner,
 		}
 
 	default:
@@ -623,9 +611,7 @@ func GetMockProfileData(handle string, isOwner bool) models.ProfileData {
 					},
 				},
 			},
-			PostOffset:   1,
-			HasMorePosts: true,
-			IsOwner:      isOwner,
+			IsOwner: isOwner,
 		}
 	}
 }
@@ -639,7 +625,6 @@ func GetMockProfileInternalData() models.ProfileData {
 				Mode:   "system",
 				Radius: "0",
 			},
-			CSRFToken: utils.GenerateCSRFToken(),
 		},
 		Profile: models.Profile{
 			ID:     "maia",
@@ -816,9 +801,7 @@ func GetMockProfileInternalData() models.ProfileData {
 				},
 			},
 		},
-		PostOffset:   3,
-		HasMorePosts: false,
-		IsOwner:      true,
+		IsOwner: true,
 	}
 }
 
@@ -831,7 +814,6 @@ func GetMockCirclesPageData() models.CirclesPageData {
 				Mode:   "system",
 				Radius: "0",
 			},
-			CSRFToken: utils.GenerateCSRFToken(),
 		},
 		Circles: []models.Circle{
 			{
@@ -840,8 +822,8 @@ func GetMockCirclesPageData() models.CirclesPageData {
 				Description:  "Traditional craftsmanship meets modern techniques. Share projects, ask questions, and connect with fellow makers.",
 				Thumbnail:    "https://images.unsplash.com/photo-1702195789139-4897ff9b0083?w=80&h=80&fit=crop&crop=center",
 				Banner:       "https://images.unsplash.com/photo-1497219055242-93359eeed651?w=400&h=200&fit=crop&crop=center",
-				MemberCount:  "47",
-				OnlineCount:  "8",
+				MemberCount:  47,
+				OnlineCount:  8,
 				UserRole:     "admin",
 				JoinedDate:   "6 months ago",
 				LastActivity: "2m ago",
@@ -853,8 +835,8 @@ func GetMockCirclesPageData() models.CirclesPageData {
 				Description:  "The official circle for Alienated Collective, a sydney based group of local ravers, doofers, party and music enthusiasts.",
 				Thumbnail:    "https://images.unsplash.com/photo-1611402858501-d3de70f3c67e?q=80&w=80&h=80&auto=format&fit=crop",
 				Banner:       "https://images.unsplash.com/photo-1594623930572-300a3011d9ae?w=400&h=200&fit=crop&crop=center",
-				MemberCount:  "12",
-				OnlineCount:  "3",
+				MemberCount:  12,
+				OnlineCount:  3,
 				UserRole:     "member",
 				JoinedDate:   "3 months ago",
 				LastActivity: "15m ago",
@@ -866,8 +848,8 @@ func GetMockCirclesPageData() models.CirclesPageData {
 				Description:  "Arduino, Raspberry Pi, circuit design, and everything in between. From beginner tutorials to advanced projects.",
 				Thumbnail:    "https://images.unsplash.com/photo-1603732551658-5fabbafa84eb?w=80&h=80&fit=crop&crop=center",
 				Banner:       "https://images.unsplash.com/photo-1581091226825-a6a2a5aee158?w=400&h=200&fit=crop&crop=center",
-				MemberCount:  "156",
-				OnlineCount:  "24",
+				MemberCount:  156,
+				OnlineCount:  24,
 				UserRole:     "member",
 				JoinedDate:   "8 months ago",
 				LastActivity: "1h ago",
@@ -879,8 +861,8 @@ func GetMockCirclesPageData() models.CirclesPageData {
 				Description:  "Supporting Sydney's creative community through collaboration, critique, and celebration of local talent.",
 				Thumbnail:    "https://images.unsplash.com/photo-1541961017774-22349e4a1262?w=80&h=80&fit=crop&crop=center",
 				Banner:       "https://images.unsplash.com/photo-1663505819040-00bbd0814fab?w=400&h=200&fit=crop&crop=center",
-				MemberCount:  "89",
-				OnlineCount:  "0",
+				MemberCount:  89,
+				OnlineCount:  0,
 				UserRole:     "member",
 				JoinedDate:   "4 months ago",
 				LastActivity: "2h ago",
@@ -892,8 +874,8 @@ func GetMockCirclesPageData() models.CirclesPageData {
 				Description:  "Discussing the future of digital communication, platform design, and better community building tools.",
 				Thumbnail:    "https://images.unsplash.com/photo-1526045612212-70caf35c14df?w=80&h=80&fit=crop&crop=center",
 				Banner:       "https://images.unsplash.com/photo-1451187580459-43490279c0fa?w=400&h=200&fit=crop&crop=center",
-				MemberCount:  "34",
-				OnlineCount:  "3",
+				MemberCount:  34,
+				OnlineCount:  3,
 				UserRole:     "owner",
 				JoinedDate:   "1 year ago",
 				LastActivity: "1h ago",
@@ -961,8 +943,8 @@ func GetMockCirclesPageData() models.CirclesPageData {
 				Description:  "Practical tips for reducing environmental impact through daily choices and community action.",
 				Thumbnail:    "https://images.unsplash.com/photo-1441974231531-c6227db76b6e?w=80&h=80&fit=crop&crop=center",
 				Banner:       "https://images.unsplash.com/photo-1441974231531-c6227db76b6e?w=400&h=200&fit=crop&crop=center",
-				MemberCount:  "234",
-				OnlineCount:  "18",
+				MemberCount:  234,
+				OnlineCount:  18,
 				UserRole:     "",
 				JoinedDate:   "",
 				LastActivity: "",
@@ -974,8 +956,8 @@ func GetMockCirclesPageData() models.CirclesPageData {
 				Description:  "City-based beekeeping community sharing techniques, equipment, and harvest stories.",
 				Thumbnail:    "https://images.unsplash.com/photo-1558642452-9d2a7deb7f62?w=80&h=80&fit=crop&crop=center",
 				Banner:       "https://images.unsplash.com/photo-1558642452-9d2a7deb7f62?w=400&h=200&fit=crop&crop=center",
-				MemberCount:  "78",
-				OnlineCount:  "6",
+				MemberCount:  78,
+				OnlineCount:  6,
 				UserRole:     "",
 				JoinedDate:   "",
 				LastActivity: "",
@@ -994,7 +976,6 @@ func GetMockChatData() models.ChatPageData {
 				Mode:   "system",
 				Radius: "0",
 			},
-			CSRFToken: utils.GenerateCSRFToken(),
 		},
 		Conversations: []models.Conversation{
 			{
@@ -1210,7 +1191,6 @@ func GetMockMarketplaceData() models.MarketplacePageData {
 				Mode:   "system",
 				Radius: "0",
 			},
-			CSRFToken: utils.GenerateCSRFToken(),
 		},
 		FeaturedItems: []models.MarketplaceItem{
 			{
@@ -1452,8 +1432,6 @@ func GetMockMarketplaceData() models.MarketplacePageData {
 		},
 		TotalItems:   64,
 		ItemsPerPage: 12,
-		CurrentPage:  1,
-		HasMore:      true,
 		Filters: models.MarketplaceFilter{
 			PriceTypes:  []string{"sale", "trade", "free", "negotiable"},
 			Categories:  []string{"furniture", "electronics", "art", "clothing", "garden", "tools", "books", "transport"},
@@ -1473,7 +1451,6 @@ func GetMockGatherData() models.GatherPageData {
 				Mode:   "system",
 				Radius: "0",
 			},
-			CSRFToken: utils.GenerateCSRFToken(),
 		},
 		FeaturedEvents: []models.GatherEvent{
 			{
@@ -0,0 +1,48 @@
+package templates
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// overlayTemplate is parsed from source rather than the templates directory
+// so it still works while the templates are broken.
+var overlayTemplate = template.Must(template.New("overlay").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta http-equiv="refresh" content="2">
+    <title>Template error - circles.diy</title>
+    <style>
+        body { margin: 0; padding: 2rem; background: #1e1e1e; color: #f5f5f5; font-family: system-ui, sans-serif; }
+        h1 { margin-top: 0; color: #ff6b6b; font-size: 1.25rem; }
+        pre { padding: 1rem; background: #2d2d2d; border-left: 4px solid #ff6b6b; white-space: pre-wrap; word-break: break-word; }
+        p { color: #aaa; }
+    </style>
+</head>
+<body>
+    <h1>Template error</h1>
+    <pre>{{.}}</pre>
+    <p>This page reloads every two seconds, so it shows the fixed page as soon as the templates are saved.</p>
+</body>
+</html>
+`))
+
+// Overlay answers with err shown in place of the page when running in
+// development, reporting whether it did. In production it writes nothing
+// and the caller answers as it would for any other error.
+func Overlay(w http.ResponseWriter, err error) bool {
+	if registry == nil || !registry.dev {
+		return false
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusInternalServerError)
+	if execErr := overlayTemplate.Execute(w, err.Error()); execErr != nil {
+		log.Printf("Error rendering template overlay: %v", execErr)
+	}
+	return true
+}
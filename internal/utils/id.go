@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// NewID returns a random 128-bit identifier encoded as hex.
+func NewID() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(bytes)
+}
+
+// inviteAlphabet leaves out characters that are easily confused when a
+// code is read aloud or typed: 0/O, 1/I/L.
+const inviteAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// NewInviteCode returns a random 10-character code that is short enough to
+// share by hand and serves as the invite link's path.
+func NewInviteCode() string {
+	// Bytes past the largest multiple of the alphabet size are skipped so
+	// every character is equally likely
+	limit := 256 - 256%len(inviteAlphabet)
+	code := make([]byte, 0, 10)
+	buf := make([]byte, 16)
+	for len(code) < cap(code) {
+		if _, err := rand.Read(buf); err != nil {
+			panic("crypto/rand failed: " + err.Error())
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(code) < cap(code) {
+				code = append(code, inviteAlphabet[int(b)%len(inviteAlphabet)])
+			}
+		}
+	}
+	return string(code)
+}
+
+// NormalizeInviteCode uppercases a typed code and drops the spaces and
+// dashes people add when copying it.
+func NormalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeAgo formats t in the compact style used across the feed ("2m ago", "3d ago").
+func TimeAgo(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case d < 7*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	case d < 30*24*time.Hour:
+		return fmt.Sprintf("%dw ago", int(d.Hours()/(24*7)))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%dmo ago", int(d.Hours()/(24*30)))
+	default:
+		return fmt.Sprintf("%dy ago", int(d.Hours()/(24*365)))
+	}
+}
+
+// TimeAgoLong formats t in the long style used for membership dates ("6 months ago").
+func TimeAgoLong(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	d := time.Since(t)
+	switch {
+	case d < 24*time.Hour:
+		return "today"
+	case d < 7*24*time.Hour:
+		return plural(int(d.Hours()/24), "day") + " ago"
+	case d < 30*24*time.Hour:
+		return plural(int(d.Hours()/(24*7)), "week") + " ago"
+	case d < 365*24*time.Hour:
+		return plural(int(d.Hours()/(24*30)), "month") + " ago"
+	default:
+		return plural(int(d.Hours()/(24*365)), "year") + " ago"
+	}
+}
+
+// TimeUntil formats a future time the way event listings show it ("in 2 days").
+func TimeUntil(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	d := time.Until(t)
+	switch {
+	case d < 0:
+		return TimeAgo(t)
+	case d < time.Hour:
+		return "in " + plural(int(d.Minutes()), "minute")
+	case d < 24*time.Hour:
+		return "in " + plural(int(d.Hours()), "hour")
+	}
+
+	days := int(d.Hours() / 24)
+	if days%7 == 0 {
+		return "in " + plural(days/7, "week")
+	}
+	return "in " + plural(days, "day")
+}
+
+// TimeLeft formats an expiry the way ripples show it ("2h left").
+func TimeLeft(t time.Time) string {
+	d := time.Until(t)
+	switch {
+	case d <= 0:
+		return "expired"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm left", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh left", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd left", int(d.Hours()/24))
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
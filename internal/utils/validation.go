@@ -2,8 +2,11 @@ package utils
 
 import (
 	"html"
+	"net/mail"
+	"net/url"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
 func ValidateFeedback(feedback string) (string, bool) {
@@ -33,4 +36,77 @@ func ValidateFeedback(feedback string) (string, bool) {
 	feedback = html.EscapeString(feedback)
 
 	return feedback, true
-}
\ No newline at end of file
+}
+
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// ValidateHandle normalises a handle to its stored "@name" form. Handles
+// are 3-30 lowercase letters, digits or underscores.
+func ValidateHandle(handle string) (string, bool) {
+	handle = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+	if !handlePattern.MatchString(handle) {
+		return "", false
+	}
+	return "@" + handle, true
+}
+
+// ValidateEmail returns the bare, lowercased address.
+func ValidateEmail(email string) (string, bool) {
+	email = strings.TrimSpace(email)
+	if len(email) > 254 {
+		return "", false
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", false
+	}
+	return strings.ToLower(addr.Address), true
+}
+
+// ValidateDisplayName trims a display name and checks it is 1-80 characters.
+func ValidateDisplayName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 80 {
+		return "", false
+	}
+	return name, true
+}
+
+// ValidateCircleName trims a circle name and checks it is 3-60 characters.
+func ValidateCircleName(name string) (string, bool) {
+	name = strings.Join(strings.Fields(name), " ")
+	if n := utf8.RuneCountInString(name); n < 3 || n > 60 {
+		return "", false
+	}
+	return name, true
+}
+
+// ValidateGroupName trims a group conversation name and checks it is 1-60
+// characters.
+func ValidateGroupName(name string) (string, bool) {
+	name = strings.Join(strings.Fields(name), " ")
+	if n := utf8.RuneCountInString(name); n < 1 || n > 60 {
+		return "", false
+	}
+	return name, true
+}
+
+// ValidateImageURL accepts an empty value, a site-relative /static/ path
+// or an absolute http(s) URL.
+func ValidateImageURL(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", true
+	}
+	if len(raw) > 2048 {
+		return "", false
+	}
+	if strings.HasPrefix(raw, "/static/") && !strings.Contains(raw, "..") {
+		return raw, true
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	return u.String(), true
+}
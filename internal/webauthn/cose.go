@@ -0,0 +1,155 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers accepted for credentials, in order of
+// preference.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+var supportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters (RFC 9053).
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1 // also RSA n
+	coseX   = -2 // also RSA e
+	coseY   = -3
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// PublicKey is a parsed COSE credential public key.
+type PublicKey struct {
+	Algorithm int
+	key       crypto.PublicKey
+}
+
+// ParsePublicKey parses a COSE_Key as stored with a credential.
+func ParsePublicKey(cose []byte) (PublicKey, error) {
+	v, rest, err := decodeCBOR(cose)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	if len(rest) != 0 {
+		return PublicKey{}, errors.New("trailing bytes after public key")
+	}
+	return publicKeyFromCOSE(v)
+}
+
+func publicKeyFromCOSE(v any) (PublicKey, error) {
+	m, ok := v.(map[any]any)
+	if !ok {
+		return PublicKey{}, errors.New("public key is not a COSE map")
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return PublicKey{}, errors.New("invalid P-256 public key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return PublicKey{}, errors.New("public key is not on P-256")
+		}
+		return PublicKey{Algorithm: AlgES256, key: pub}, nil
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return PublicKey{}, errors.New("invalid Ed25519 public key")
+		}
+		return PublicKey{Algorithm: AlgEdDSA, key: ed25519.PublicKey(x)}, nil
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseCrv)].([]byte)
+		e, _ := m[int64(coseX)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return PublicKey{}, errors.New("invalid RSA public key")
+		}
+		exp := int(new(big.Int).SetBytes(e).Int64())
+		return PublicKey{Algorithm: AlgRS256, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}}, nil
+	}
+	return PublicKey{}, fmt.Errorf("unsupported public key type %d with algorithm %d", kty, alg)
+}
+
+// Verify checks sig over data.
+func (k PublicKey) Verify(data, sig []byte) error {
+	switch pub := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, data, sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	}
+	return errors.New("unsupported public key")
+}
+
+// verifyPackedCertificate checks a "packed" attestation signed by the
+// leaf certificate in x5c.
+func verifyPackedCertificate(stmt map[any]any, alg int, signed, sig []byte) error {
+	chain, _ := stmt["x5c"].([]any)
+	if len(chain) == 0 {
+		return fmt.Errorf("%w: empty attestation certificate chain", ErrInvalidResponse)
+	}
+	der, _ := chain[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("%w: attestation certificate: %v", ErrInvalidResponse, err)
+	}
+
+	var key PublicKey
+	switch pub := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return fmt.Errorf("%w: unsupported attestation certificate curve", ErrInvalidResponse)
+		}
+		key = PublicKey{Algorithm: AlgES256, key: pub}
+	case ed25519.PublicKey:
+		key = PublicKey{Algorithm: AlgEdDSA, key: pub}
+	case *rsa.PublicKey:
+		key = PublicKey{Algorithm: AlgRS256, key: pub}
+	default:
+		return fmt.Errorf("%w: unsupported attestation certificate key", ErrInvalidResponse)
+	}
+	if key.Algorithm != alg {
+		return fmt.Errorf("%w: attestation algorithm mismatch", ErrInvalidResponse)
+	}
+	if err := key.Verify(signed, sig); err != nil {
+		return fmt.Errorf("%w: attestation signature: %v", ErrInvalidResponse, err)
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+// Package webauthn implements the relying party side of WebAuthn
+// (https://www.w3.org/TR/webauthn-3/): building ceremony options and
+// verifying the authenticator responses for passkey registration and
+// sign-in. It keeps no state; callers hold the challenge between the two
+// halves of a ceremony and store the resulting credentials.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Timeout is how long the browser is given to complete a ceremony.
+const Timeout = 5 * time.Minute
+
+const challengeSize = 32
+
+// Authenticator data flags.
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagBackupEligible   = 0x08
+	flagBackedUp         = 0x10
+	flagAttestedCredData = 0x40
+	flagExtensionData    = 0x80
+)
+
+var (
+	ErrInvalidResponse = errors.New("webauthn: invalid authenticator response")
+	// ErrClonedCredential means the authenticator's signature counter went
+	// backwards, a sign that the credential has been copied.
+	ErrClonedCredential = errors.New("webauthn: signature counter did not increase")
+)
+
+// RelyingParty identifies this site to authenticators. ID is the effective
+// domain credentials are scoped to and Origin the exact origin pages are
+// served from.
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// User is the account a credential is created for. ID is an opaque handle
+// returned by discoverable credentials at sign-in.
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// Credential is a verified public key credential to store for a user.
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key
+	Algorithm      int
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	BackupEligible bool
+}
+
+// Options JSON follows the WebAuthn Level 3 serialisation used by
+// PublicKeyCredential.parseCreationOptionsFromJSON, with binary values as
+// base64url strings.
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is PublicKeyCredential.toJSON() for a created
+// credential.
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse is PublicKeyCredential.toJSON() for a sign-in.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// Encode returns the base64url form used for binary values in JSON.
+func Encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode reads base64url with or without padding.
+func Decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func newChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %v", err)
+	}
+	return challenge, nil
+}
+
+func descriptors(creds []Credential) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(creds))
+	for _, c := range creds {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: Encode(c.ID), Transports: c.Transports})
+	}
+	return list
+}
+
+// BeginRegistration returns the options for navigator.credentials.create
+// and the challenge to keep until the response arrives. existing lists the
+// user's credentials so the same authenticator is not registered twice.
+func (rp RelyingParty) BeginRegistration(user User, existing []Credential) (CreationOptions, []byte, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return CreationOptions{}, nil, err
+	}
+	params := make([]CredentialParameter, len(supportedAlgorithms))
+	for i, alg := range supportedAlgorithms {
+		params[i] = CredentialParameter{Type: "public-key", Alg: alg}
+	}
+	return CreationOptions{
+		Challenge:          Encode(challenge),
+		RP:                 RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:               UserEntity{ID: Encode(user.ID), Name: user.Name, DisplayName: user.DisplayName},
+		PubKeyCredParams:   params,
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(existing),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}, challenge, nil
+}
+
+// BeginLogin returns the options for navigator.credentials.get. With no
+// allowed credentials the browser offers any passkey for this site.
+func (rp RelyingParty) BeginLogin(allowed []Credential) (RequestOptions, []byte, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return RequestOptions{}, nil, err
+	}
+	return RequestOptions{
+		Challenge:        Encode(challenge),
+		Timeout:          Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allowed),
+		UserVerification: "required",
+	}, challenge, nil
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData checks the browser-signed ceremony context and returns
+// its hash for signature verification.
+func (rp RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) ([32]byte, error) {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return [32]byte{}, fmt.Errorf("%w: malformed client data", ErrInvalidResponse)
+	}
+	if cd.Type != ceremony {
+		return [32]byte{}, fmt.Errorf("%w: client data type %q", ErrInvalidResponse, cd.Type)
+	}
+	got, err := Decode(cd.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return [32]byte{}, fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+	if cd.Origin != rp.Origin || cd.CrossOrigin {
+		return [32]byte{}, fmt.Errorf("%w: unexpected origin %q", ErrInvalidResponse, cd.Origin)
+	}
+	return sha256.Sum256(raw), nil
+}
+
+type authenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+
+	// Present when flagAttestedCredData is set
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+	ad := authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if ad.Flags&flagAttestedCredData != 0 {
+		if len(rest) < 18 {
+			return ad, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+		}
+		ad.AAGUID = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+			return ad, fmt.Errorf("%w: invalid credential ID length", ErrInvalidResponse)
+		}
+		ad.CredentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return ad, fmt.Errorf("%w: credential public key: %v", ErrInvalidResponse, err)
+		}
+		ad.PublicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if ad.Flags&flagExtensionData != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return ad, fmt.Errorf("%w: extensions: %v", ErrInvalidResponse, err)
+		}
+	}
+	if len(rest) != 0 {
+		return ad, fmt.Errorf("%w: trailing authenticator data", ErrInvalidResponse)
+	}
+	return ad, nil
+}
+
+func (rp RelyingParty) checkAuthenticatorData(ad authenticatorData) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.RPIDHash, want[:]) {
+		return fmt.Errorf("%w: relying party ID mismatch", ErrInvalidResponse)
+	}
+	if ad.Flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user not present", ErrInvalidResponse)
+	}
+	// A passkey is the only factor, so the authenticator must have checked
+	// a PIN or biometric, not just a touch
+	if ad.Flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user not verified", ErrInvalidResponse)
+	}
+	if ad.Flags&flagBackedUp != 0 && ad.Flags&flagBackupEligible == 0 {
+		return fmt.Errorf("%w: invalid backup flags", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// FinishRegistration verifies a navigator.credentials.create response
+// against the challenge from BeginRegistration. Attestation formats "none"
+// and "packed" are accepted; attestation certificates are not checked
+// against any trust root since no authenticator models are restricted.
+func (rp RelyingParty) FinishRegistration(challenge []byte, resp RegistrationResponse) (Credential, error) {
+	if resp.Type != "public-key" {
+		return Credential{}, fmt.Errorf("%w: credential type %q", ErrInvalidResponse, resp.Type)
+	}
+	rawClientData, err := Decode(resp.Response.ClientDataJSON)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: client data encoding", ErrInvalidResponse)
+	}
+	clientHash, err := rp.verifyClientData(rawClientData, "webauthn.create", challenge)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	rawAttestation, err := Decode(resp.Response.AttestationObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: attestation encoding", ErrInvalidResponse)
+	}
+	v, rest, err := decodeCBOR(rawAttestation)
+	if err != nil || len(rest) != 0 {
+		return Credential{}, fmt.Errorf("%w: malformed attestation object", ErrInvalidResponse)
+	}
+	att, ok := v.(map[any]any)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: malformed attestation object", ErrInvalidResponse)
+	}
+	format, _ := att["fmt"].(string)
+	stmt, _ := att["attStmt"].(map[any]any)
+	rawAuthData, _ := att["authData"].([]byte)
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if err := rp.checkAuthenticatorData(ad); err != nil {
+		return Credential{}, err
+	}
+	if ad.Flags&flagAttestedCredData == 0 {
+		return Credential{}, fmt.Errorf("%w: no attested credential", ErrInvalidResponse)
+	}
+	if rawID, err := Decode(resp.RawID); err != nil || !bytes.Equal(rawID, ad.CredentialID) {
+		return Credential{}, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+
+	pub, err := ParsePublicKey(ad.PublicKey)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if err := verifyAttestation(format, stmt, pub, rawAuthData, clientHash[:]); err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:             bytes.Clone(ad.CredentialID),
+		PublicKey:      bytes.Clone(ad.PublicKey),
+		Algorithm:      pub.Algorithm,
+		SignCount:      ad.SignCount,
+		AAGUID:         bytes.Clone(ad.AAGUID),
+		Transports:     resp.Response.Transports,
+		BackupEligible: ad.Flags&flagBackupEligible != 0,
+	}, nil
+}
+
+func verifyAttestation(format string, stmt map[any]any, credKey PublicKey, authData, clientHash []byte) error {
+	switch format {
+	case "none":
+		if len(stmt) != 0 {
+			return fmt.Errorf("%w: unexpected attestation statement", ErrInvalidResponse)
+		}
+		return nil
+	case "packed":
+		alg, _ := stmt["alg"].(int64)
+		sig, _ := stmt["sig"].([]byte)
+		signed := append(bytes.Clone(authData), clientHash...)
+		if _, hasCert := stmt["x5c"]; hasCert {
+			return verifyPackedCertificate(stmt, int(alg), signed, sig)
+		}
+		// Self attestation is signed by the credential key itself
+		if int(alg) != credKey.Algorithm {
+			return fmt.Errorf("%w: attestation algorithm mismatch", ErrInvalidResponse)
+		}
+		if err := credKey.Verify(signed, sig); err != nil {
+			return fmt.Errorf("%w: attestation signature: %v", ErrInvalidResponse, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported attestation format %q", ErrInvalidResponse, format)
+}
+
+// FinishLogin verifies a navigator.credentials.get response for cred
+// against the challenge from BeginLogin and returns the authenticator's new
+// signature counter to store.
+func (rp RelyingParty) FinishLogin(challenge []byte, cred Credential, resp AssertionResponse) (uint32, error) {
+	if resp.Type != "public-key" {
+		return 0, fmt.Errorf("%w: credential type %q", ErrInvalidResponse, resp.Type)
+	}
+	if rawID, err := Decode(resp.RawID); err != nil || !bytes.Equal(rawID, cred.ID) {
+		return 0, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+	rawClientData, err := Decode(resp.Response.ClientDataJSON)
+	if err != nil {
+		return 0, fmt.Errorf("%w: client data encoding", ErrInvalidResponse)
+	}
+	clientHash, err := rp.verifyClientData(rawClientData, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	rawAuthData, err := Decode(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("%w: authenticator data encoding", ErrInvalidResponse)
+	}
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.checkAuthenticatorData(ad); err != nil {
+		return 0, err
+	}
+
+	sig, err := Decode(resp.Response.Signature)
+	if err != nil {
+		return 0, fmt.Errorf("%w: signature encoding", ErrInvalidResponse)
+	}
+	pub, err := ParsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	if err := pub.Verify(append(bytes.Clone(rawAuthData), clientHash[:]...), sig); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	// Authenticators that do not count report zero every time
+	if (ad.SignCount != 0 || cred.SignCount != 0) && ad.SignCount <= cred.SignCount {
+		return 0, ErrClonedCredential
+	}
+	return ad.SignCount, nil
+}
@@ -0,0 +1,393 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+var testRP = RelyingParty{ID: "localhost", Name: "Circles", Origin: "http://localhost:8080"}
+
+// softAuthenticator is an in-memory ES256 authenticator standing in for a
+// browser. It holds any number of discoverable credentials and never
+// attests. flags are the user presence and verification flags it reports.
+type softAuthenticator struct {
+	credentials map[string]*softCredential
+	flags       byte
+}
+
+type softCredential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+func newSoftAuthenticator() *softAuthenticator {
+	return &softAuthenticator{
+		credentials: make(map[string]*softCredential),
+		flags:       flagUserPresent | flagUserVerified,
+	}
+}
+
+func softAuthData(rpID string, flags byte, signCount uint32, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	return append(data, attested...)
+}
+
+func clientDataJSON(ceremony, challenge, origin string) []byte {
+	data, _ := json.Marshal(clientData{Type: ceremony, Challenge: challenge, Origin: origin})
+	return data
+}
+
+// create answers navigator.credentials.create for origin.
+func (a *softAuthenticator) create(t *testing.T, opts CreationOptions, origin string) RegistrationResponse {
+	t.Helper()
+	userHandle, err := Decode(opts.User.ID)
+	if err != nil {
+		t.Fatalf("invalid user ID: %v", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, encodeES256PublicKey(&key.PublicKey)...)
+	authData := softAuthData(opts.RP.ID, a.flags|flagAttestedCredData, 0, attested)
+	a.credentials[Encode(id)] = &softCredential{id: id, rpID: opts.RP.ID, userHandle: userHandle, key: key}
+
+	var resp RegistrationResponse
+	resp.ID = Encode(id)
+	resp.RawID = resp.ID
+	resp.Type = "public-key"
+	resp.Response.ClientDataJSON = Encode(clientDataJSON("webauthn.create", opts.Challenge, origin))
+	resp.Response.AttestationObject = Encode(encodeCBOR(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": authData,
+	}))
+	resp.Response.Transports = []string{"internal"}
+	return resp
+}
+
+// get answers navigator.credentials.get for origin with the first
+// matching credential.
+func (a *softAuthenticator) get(t *testing.T, opts RequestOptions, origin string) AssertionResponse {
+	t.Helper()
+	var cred *softCredential
+	for _, c := range a.credentials {
+		if c.rpID != opts.RPID {
+			continue
+		}
+		if len(opts.AllowCredentials) == 0 {
+			cred = c
+			break
+		}
+		for _, allowed := range opts.AllowCredentials {
+			if allowed.ID == Encode(c.id) {
+				cred = c
+			}
+		}
+	}
+	if cred == nil {
+		t.Fatal("no matching credential")
+	}
+
+	cred.signCount++
+	authData := softAuthData(cred.rpID, a.flags, cred.signCount, nil)
+	clientData := clientDataJSON("webauthn.get", opts.Challenge, origin)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resp AssertionResponse
+	resp.ID = Encode(cred.id)
+	resp.RawID = resp.ID
+	resp.Type = "public-key"
+	resp.Response.ClientDataJSON = Encode(clientData)
+	resp.Response.AuthenticatorData = Encode(authData)
+	resp.Response.Signature = Encode(sig)
+	resp.Response.UserHandle = Encode(cred.userHandle)
+	return resp
+}
+
+// register creates a credential on a and verifies it with testRP.
+func register(t *testing.T, a *softAuthenticator) Credential {
+	t.Helper()
+	opts, challenge, err := testRP.BeginRegistration(User{ID: []byte("user-1"), Name: "maia"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := testRP.FinishRegistration(challenge, a.create(t, opts, testRP.Origin))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	return cred
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	a := newSoftAuthenticator()
+	cred := register(t, a)
+	if cred.Algorithm != AlgES256 || len(cred.ID) != 16 {
+		t.Errorf("registered credential = %+v", cred)
+	}
+
+	for want := uint32(1); want <= 2; want++ {
+		opts, challenge, err := testRP.BeginLogin([]Credential{cred})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := a.get(t, opts, testRP.Origin)
+		if handle, _ := Decode(resp.Response.UserHandle); string(handle) != "user-1" {
+			t.Errorf("user handle = %q, want user-1", handle)
+		}
+		count, err := testRP.FinishLogin(challenge, cred, resp)
+		if err != nil {
+			t.Fatalf("FinishLogin: %v", err)
+		}
+		if count != want {
+			t.Errorf("sign count = %d, want %d", count, want)
+		}
+		cred.SignCount = count
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		rp     RelyingParty
+		origin string
+		replay bool
+	}{
+		{"other challenge", testRP, testRP.Origin, true},
+		{"wrong origin", testRP, "https://circles.example", false},
+		{"wrong RP ID", RelyingParty{ID: "circles.example", Origin: testRP.Origin}, testRP.Origin, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, challenge, err := testRP.BeginRegistration(User{ID: []byte("user-1"), Name: "maia"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.replay {
+				_, challenge, _ = testRP.BeginRegistration(User{ID: []byte("user-1"), Name: "maia"}, nil)
+			}
+			resp := newSoftAuthenticator().create(t, opts, tt.origin)
+			if _, err := tt.rp.FinishRegistration(challenge, resp); !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("FinishRegistration = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(rp *RelyingParty, challenge *[]byte, cred *Credential, resp *AssertionResponse)
+		want   error
+	}{
+		{"other challenge", func(_ *RelyingParty, challenge *[]byte, _ *Credential, _ *AssertionResponse) {
+			_, *challenge, _ = testRP.BeginLogin(nil)
+		}, ErrInvalidResponse},
+		{"wrong origin", func(rp *RelyingParty, _ *[]byte, _ *Credential, _ *AssertionResponse) {
+			rp.Origin = "https://circles.example"
+		}, ErrInvalidResponse},
+		{"wrong RP ID", func(rp *RelyingParty, _ *[]byte, _ *Credential, _ *AssertionResponse) {
+			rp.ID = "circles.example"
+		}, ErrInvalidResponse},
+		{"sign count went backwards", func(_ *RelyingParty, _ *[]byte, cred *Credential, _ *AssertionResponse) {
+			cred.SignCount = 5
+		}, ErrClonedCredential},
+		{"bad signature", func(_ *RelyingParty, _ *[]byte, _ *Credential, resp *AssertionResponse) {
+			sig, _ := Decode(resp.Response.Signature)
+			sig[len(sig)-1] ^= 0xff
+			resp.Response.Signature = Encode(sig)
+		}, ErrInvalidResponse},
+		{"tampered authenticator data", func(_ *RelyingParty, _ *[]byte, _ *Credential, resp *AssertionResponse) {
+			data, _ := Decode(resp.Response.AuthenticatorData)
+			data[len(data)-1] = 0xff
+			resp.Response.AuthenticatorData = Encode(data)
+		}, ErrInvalidResponse},
+		{"other credential", func(_ *RelyingParty, _ *[]byte, cred *Credential, _ *AssertionResponse) {
+			*cred = register(t, newSoftAuthenticator())
+		}, ErrInvalidResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newSoftAuthenticator()
+			cred := register(t, a)
+			opts, challenge, err := testRP.BeginLogin([]Credential{cred})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := a.get(t, opts, testRP.Origin)
+			rp := testRP
+			tt.tamper(&rp, &challenge, &cred, &resp)
+			if _, err := rp.FinishLogin(challenge, cred, resp); !errors.Is(err, tt.want) {
+				t.Errorf("FinishLogin = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// Authenticators that only check for a touch can neither register nor
+// sign in.
+func TestUserVerificationRequired(t *testing.T) {
+	opts, challenge, err := testRP.BeginRegistration(User{ID: []byte("user-1"), Name: "maia"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.AuthenticatorSelection.UserVerification != "required" {
+		t.Errorf("registration userVerification = %q, want required", opts.AuthenticatorSelection.UserVerification)
+	}
+	unverified := newSoftAuthenticator()
+	unverified.flags = flagUserPresent
+	if _, err := testRP.FinishRegistration(challenge, unverified.create(t, opts, testRP.Origin)); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("FinishRegistration without user verification = %v, want ErrInvalidResponse", err)
+	}
+
+	a := newSoftAuthenticator()
+	cred := register(t, a)
+	loginOpts, challenge, err := testRP.BeginLogin([]Credential{cred})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loginOpts.UserVerification != "required" {
+		t.Errorf("login userVerification = %q, want required", loginOpts.UserVerification)
+	}
+	a.flags = flagUserPresent
+	if _, err := testRP.FinishLogin(challenge, cred, a.get(t, loginOpts, testRP.Origin)); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("FinishLogin without user verification = %v, want ErrInvalidResponse", err)
+	}
+}
+
+// Replaying an accepted assertion fails once its counter is stored, even
+// against the same challenge.
+func TestLoginReplayRejected(t *testing.T) {
+	a := newSoftAuthenticator()
+	cred := register(t, a)
+	opts, challenge, err := testRP.BeginLogin(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := a.get(t, opts, testRP.Origin)
+	if cred.SignCount, err = testRP.FinishLogin(challenge, cred, resp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testRP.FinishLogin(challenge, cred, resp); !errors.Is(err, ErrClonedCredential) {
+		t.Errorf("replayed FinishLogin = %v, want ErrClonedCredential", err)
+	}
+}
+
+// encodeCBOR encodes the same subset decodeCBOR reads, with map keys in
+// canonical order. It is used by the test authenticator.
+func encodeCBOR(v any) []byte {
+	var buf bytes.Buffer
+	writeCBOR(&buf, v)
+	return buf.Bytes()
+}
+
+func writeCBORHead(buf *bytes.Buffer, major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major<<5 | byte(arg))
+	case arg <= 0xff:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= 0xffff:
+		buf.WriteByte(major<<5 | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= 0xffffffff:
+		buf.WriteByte(major<<5 | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
+
+func writeCBOR(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case int:
+		writeCBOR(buf, int64(v))
+	case int64:
+		if v >= 0 {
+			writeCBORHead(buf, 0, uint64(v))
+		} else {
+			writeCBORHead(buf, 1, uint64(-1-v))
+		}
+	case []byte:
+		writeCBORHead(buf, 2, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeCBORHead(buf, 3, uint64(len(v)))
+		buf.WriteString(v)
+	case []any:
+		writeCBORHead(buf, 4, uint64(len(v)))
+		for _, item := range v {
+			writeCBOR(buf, item)
+		}
+	case map[any]any:
+		encoded := make([][2][]byte, 0, len(v))
+		for key, value := range v {
+			encoded = append(encoded, [2][]byte{encodeCBOR(key), encodeCBOR(value)})
+		}
+		// Canonical CBOR sorts keys by their encoded bytes
+		sort.Slice(encoded, func(i, j int) bool {
+			a, b := encoded[i][0], encoded[j][0]
+			if len(a) != len(b) {
+				return len(a) < len(b)
+			}
+			return bytes.Compare(a, b) < 0
+		})
+		writeCBORHead(buf, 5, uint64(len(v)))
+		for _, kv := range encoded {
+			buf.Write(kv[0])
+			buf.Write(kv[1])
+		}
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case nil:
+		buf.WriteByte(0xf6)
+	default:
+		panic(fmt.Sprintf("cbor: cannot encode %T", v))
+	}
+}
+
+// encodeES256PublicKey encodes a P-256 key as a COSE_Key.
+func encodeES256PublicKey(pub *ecdsa.PublicKey) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+	return encodeCBOR(map[any]any{
+		int64(coseKty): int64(coseKtyEC2),
+		int64(coseAlg): int64(AlgES256),
+		int64(coseCrv): int64(coseCrvP256),
+		int64(coseX):   x,
+		int64(coseY):   y,
+	})
+}
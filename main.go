@@ -1,13 +1,21 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"io/fs"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
+	"circles.diy/internal/assets"
+	"circles.diy/internal/auth"
 	"circles.diy/internal/config"
 	"circles.diy/internal/handlers"
+	"circles.diy/internal/mail"
 	"circles.diy/internal/middleware"
+	"circles.diy/internal/store"
 	"circles.diy/internal/templates"
 	"circles.diy/internal/utils"
 )
@@ -16,23 +24,84 @@ func main() {
 	// Load configuration
 	cfg := config.NewConfig()
 
-	log.Println("Building CSS...")
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Templates and static files come from the binary in production, and
+	// from disk in development so edits show without a restart
+	var files fs.FS = siteFiles
+	if cfg.IsDev {
+		files = os.DirFS(".")
+	}
+	if cfg.OverrideDir != "" {
+		if info, err := os.Stat(cfg.OverrideDir); err != nil || !info.IsDir() {
+			log.Fatalf("OVERRIDE_DIR %s is not a directory", cfg.OverrideDir)
+		}
+		log.Printf("Overriding templates and static files from %s", cfg.OverrideDir)
+		files = assets.Layer(os.DirFS(cfg.OverrideDir), files)
+	}
+
 	// Start CSS file watcher in development mode
 	if cfg.IsDev {
 		log.Println("Starting CSS file watcher...")
 		go utils.WatchCSSFiles()
-	} else {
-		if err := utils.BuildCSS(); err != nil {
-			log.Fatalf("Failed to build CSS: %v", err)
-		}
+	} else if _, err := fs.Stat(files, "static/css/style.css"); err != nil {
+		log.Fatalf("Compiled CSS is missing from the binary: run go generate before go build")
+	}
+	handlers.SetAssets(files)
+	if err := assets.Init(files, cfg.IsDev); err != nil {
+		log.Fatalf("Failed to fingerprint static files: %v", err)
 	}
 
-	// Initialize templates
 	log.Println("Initializing templates...")
-	if err := templates.InitTemplates(); err != nil {
+	if err := templates.Init(files, cfg.IsDev); err != nil {
 		log.Fatalf("Failed to initialize templates: %v", err)
 	}
 
+	// Open the data store
+	log.Printf("Opening %s store...", cfg.StoreDriver)
+	dataStore, err := store.Open(cfg.StoreDriver, cfg.DatabasePath)
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	defer dataStore.Close()
+	if err := checkMigrations(cfg, dataStore); err != nil {
+		log.Fatalf("Failed to check migrations: %v", err)
+	}
+	handlers.SetStore(dataStore)
+	go purgeCircles(dataStore)
+	go handlers.TrackPresence()
+	auth.Init(dataStore, !cfg.IsDev)
+
+	mailer, err := mail.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure mail: %v", err)
+	}
+	handlers.SetMailer(mailer, cfg.BaseURL)
+
+	csrfKey, err := signingKey(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create signing key: %v", err)
+	}
+	middleware.InitSecurity(middleware.SecurityConfig{
+		ImageHosts: cfg.CSPImageHosts,
+		MediaHosts: cfg.CSPMediaHosts,
+	})
+	middleware.InitCSRF(middleware.CSRFConfig{
+		Key:           csrfKey,
+		Secure:        !cfg.IsDev,
+		TrustedOrigin: cfg.BaseURL,
+		Failure:       http.HandlerFunc(handlers.CSRFFailureHandler),
+	})
+
 	// Setup routes
 	mux := http.NewServeMux()
 
@@ -40,11 +109,24 @@ func main() {
 	mux.HandleFunc("/", handlers.HomeHandler)
 	mux.HandleFunc("/feedback", handlers.FeedbackHandler)
 
+	// Account routes
+	mux.HandleFunc("/login", handlers.LoginHandler)
+	mux.HandleFunc("/register", handlers.RegisterHandler)
+	mux.HandleFunc("/logout", handlers.LogoutHandler)
+	mux.Handle("/login/email", middleware.MagicLinkRateLimitMiddleware(http.HandlerFunc(handlers.MagicLinkRequestHandler)))
+	mux.HandleFunc("/login/magic", handlers.MagicLinkHandler)
+	mux.HandleFunc("/login/passkey", handlers.PasskeyLoginHandler)
+	mux.Handle("/login/passkey/options", middleware.PasskeyRateLimitMiddleware(http.HandlerFunc(handlers.PasskeyLoginHandler)))
+	mux.HandleFunc("/settings/passkeys", handlers.PasskeysHandler)
+	mux.HandleFunc("/settings/passkeys/", handlers.PasskeysHandler)
+
 	// App routes
 	mux.HandleFunc("/dashboard", handlers.DashboardHandler)
 	mux.HandleFunc("/dashboard/", handlers.DashboardHandler)
 	mux.HandleFunc("/profile", handlers.ProfileHandler)
 	mux.HandleFunc("/profile/", handlers.ProfileHandler)
+	mux.HandleFunc("/posts", handlers.PostsHandler)
+	mux.HandleFunc("/posts/", handlers.PostsHandler)
 	mux.HandleFunc("/circles", handlers.CirclesHandler)
 	mux.HandleFunc("/circles/", handlers.CirclesHandler)
 	mux.HandleFunc("/chat", handlers.ChatHandler)
@@ -55,24 +137,16 @@ func main() {
 	mux.HandleFunc("/marketplace/", handlers.MarketplaceHandler)
 
 	// Static asset routes
-	mux.HandleFunc("/static/css/style.css", func(w http.ResponseWriter, r *http.Request) {
-		handlers.ServeStaticFile(w, r, "static/css/style.css", "text/css; charset=utf-8")
-	})
-	mux.HandleFunc("/static/js/htmx.min.js", func(w http.ResponseWriter, r *http.Request) {
-		handlers.ServeStaticFile(w, r, "static/js/htmx.min.js", "application/javascript; charset=utf-8")
-	})
-	mux.HandleFunc("/static/img/", handlers.ServeStaticImage)
-	
+	mux.HandleFunc("/static/", handlers.ServeAsset)
+
 	// PWA routes
 	mux.HandleFunc("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
 		handlers.ServeStaticFile(w, r, "static/manifest.json", "application/manifest+json")
 	})
-	mux.HandleFunc("/sw.js", func(w http.ResponseWriter, r *http.Request) {
-		handlers.ServeStaticFile(w, r, "static/js/sw.js", "application/javascript; charset=utf-8")
-	})
+	mux.HandleFunc("/sw.js", handlers.ServeServiceWorker)
 
 	// Apply middleware chain
-	handler := middleware.Chain(mux, middleware.SecurityMiddleware, middleware.RateLimitMiddleware)
+	handler := middleware.Chain(mux, middleware.CompressionMiddleware, middleware.SecurityMiddleware, middleware.RateLimitMiddleware, middleware.SessionMiddleware, middleware.CSRFMiddleware)
 
 	// Configure server
 	server := &http.Server{
@@ -84,7 +158,7 @@ func main() {
 	}
 
 	// Start server
-	log.Printf("Server starting on port %s", cfg.Port)
+	log.Printf("circles.diy %s starting on port %s", version, cfg.Port)
 	log.Printf("Routes available:")
 	log.Printf("  / - Manifesto landing page (index.html)")
 	log.Printf("  /dashboard - Dashboard with templates + HTMX")
@@ -94,3 +168,20 @@ func main() {
 	log.Printf("  /gather - Events page with templates + HTMX")
 	log.Fatal(server.ListenAndServe())
 }
+
+// signingKey derives the key CSRF tokens are signed with from SECRET_KEY,
+// falling back to a random key that lasts until the server restarts.
+func signingKey(cfg *config.Config) ([]byte, error) {
+	if cfg.SecretKey != "" {
+		sum := sha256.Sum256([]byte(cfg.SecretKey))
+		return sum[:], nil
+	}
+	if !cfg.IsDev {
+		log.Println("Warning: SECRET_KEY is not set; open forms will stop working when the server restarts")
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
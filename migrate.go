@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"circles.diy/internal/config"
+	"circles.diy/internal/store"
+)
+
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: migrate up|down|redo|status")
+	}
+	if cfg.StoreDriver != "sqlite" {
+		return fmt.Errorf("the %s store has no migrations", cfg.StoreDriver)
+	}
+
+	db, err := store.OpenSQLite(cfg.DatabasePath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, db)
+	case "down":
+		return migrateDown(ctx, db)
+	case "redo":
+		if err := migrateDown(ctx, db); err != nil {
+			return err
+		}
+		return migrateUp(ctx, db)
+	case "status":
+		return migrateStatus(ctx, db)
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+func migrateUp(ctx context.Context, m store.Migrator) error {
+	applied, err := m.MigrateUp(ctx)
+	for _, mig := range applied {
+		log.Printf("Applied migration %04d_%s", mig.Version, mig.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		log.Println("No pending migrations")
+	}
+	return nil
+}
+
+func migrateDown(ctx context.Context, m store.Migrator) error {
+	reverted, err := m.MigrateDown(ctx)
+	if err != nil {
+		return err
+	}
+	if reverted == nil {
+		log.Println("No migrations to revert")
+		return nil
+	}
+	log.Printf("Reverted migration %04d_%s", reverted.Version, reverted.Name)
+	return nil
+}
+
+func migrateStatus(ctx context.Context, m store.Migrator) error {
+	states, err := m.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	for _, st := range states {
+		status := "pending"
+		if st.Applied() {
+			status = "applied " + st.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", st.Version, st.Name, status)
+	}
+	return w.Flush()
+}
+
+// checkMigrations refuses to start the server against an out of date schema
+// unless auto-migrate is enabled, in which case it brings the schema up to
+// date first.
+func checkMigrations(cfg *config.Config, s store.Store) error {
+	m, ok := s.(store.Migrator)
+	if !ok {
+		return nil
+	}
+
+	ctx := context.Background()
+	pending, err := m.PendingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if !cfg.AutoMigrate {
+		return fmt.Errorf("%d pending migration(s); run the `migrate up` command or set AUTO_MIGRATE=true", len(pending))
+	}
+	return migrateUp(ctx, m)
+}
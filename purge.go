@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"circles.diy/internal/config"
+	"circles.diy/internal/store"
+)
+
+// purgeInterval is how often the server deletes circles whose grace period
+// has ended.
+const purgeInterval = time.Hour
+
+// runPurge deletes circles whose scheduled deletion date has passed. The
+// server also does this hourly; the command suits cron or a one-off run.
+func runPurge(cfg *config.Config, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: purge")
+	}
+	if cfg.StoreDriver != "sqlite" {
+		return fmt.Errorf("the %s store does not persist, so there is nothing to purge", cfg.StoreDriver)
+	}
+
+	db, err := store.OpenSQLite(cfg.DatabasePath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := checkMigrations(cfg, db); err != nil {
+		return err
+	}
+	n, err := db.PurgeCircles(context.Background(), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to purge circles: %v", err)
+	}
+	log.Printf("Purged %d deleted circles", n)
+	return nil
+}
+
+// purgeCircles runs PurgeCircles every purgeInterval for the life of the
+// server.
+func purgeCircles(s store.Store) {
+	for ; ; time.Sleep(purgeInterval) {
+		n, err := s.PurgeCircles(context.Background(), time.Now())
+		if err != nil {
+			log.Printf("Error purging deleted circles: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("Purged %d deleted circles", n)
+		}
+	}
+}
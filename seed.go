@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"circles.diy/internal/config"
+	"circles.diy/internal/seed"
+	"circles.diy/internal/store"
+)
+
+// runSeed loads the demo dataset. It is safe to run repeatedly; existing
+// rows are updated in place.
+func runSeed(cfg *config.Config, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: seed")
+	}
+	if cfg.StoreDriver != "sqlite" {
+		return fmt.Errorf("the %s store does not persist, so there is nothing to seed", cfg.StoreDriver)
+	}
+
+	db, err := store.OpenSQLite(cfg.DatabasePath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := checkMigrations(cfg, db); err != nil {
+		return err
+	}
+	if err := seed.Run(context.Background(), db); err != nil {
+		return err
+	}
+	log.Printf("Seeded demo data into %s", cfg.DatabasePath)
+	return nil
+}
@@ -0,0 +1,371 @@
+// Chat page: switching conversations, sending messages, files and voice
+// notes with HTMX and staying connected to /chat/events for new ones, over
+// a WebSocket where possible and Server-Sent Events otherwise.
+(function () {
+    'use strict';
+
+    const container = document.querySelector('.chat-container');
+    if (!container) return;
+
+    // The newest message seen, which a new connection resumes after
+    let lastID = container.dataset.lastMessageId || '';
+    let socketFailures = 0;
+    let retryDelay = 1000;
+    let readTimer = null;
+    let typingTimer = null;
+    let typingSent = 0;
+
+    // How long a typing indicator shows without word from the typist;
+    // they are sent every 3 seconds while typing goes on
+    const typingShownFor = 5000;
+
+    function isMobileView() {
+        return window.innerWidth <= 768; // --breakpoint-md
+    }
+
+    function activeConversation() {
+        const main = document.getElementById('chat-main');
+        return main ? main.dataset.conversationId : '';
+    }
+
+    function nearBottom(list) {
+        return list.scrollHeight - list.scrollTop - list.clientHeight < 80;
+    }
+
+    function scrollToBottom() {
+        const list = document.getElementById('messages-list');
+        if (list) list.scrollTop = list.scrollHeight;
+    }
+
+    // markRead tells the server the open conversation has been read, once
+    // things settle and only while the page is in view
+    function markRead() {
+        const id = activeConversation();
+        if (!id || document.visibilityState !== 'visible') return;
+        clearTimeout(readTimer);
+        readTimer = setTimeout(() => {
+            htmx.ajax('POST', '/chat/' + encodeURIComponent(id) + '/read', { source: container, swap: 'none' });
+        }, 500);
+    }
+
+    function hideTyping(userID) {
+        const indicator = document.getElementById('typing-indicator');
+        if (!indicator || (userID && indicator.dataset.userId !== userID)) return;
+        indicator.hidden = true;
+        clearTimeout(typingTimer);
+    }
+
+    function showTyping(indicator) {
+        const current = document.getElementById('typing-indicator');
+        if (!current || !indicator || indicator.dataset.conversationId !== activeConversation()) return;
+        const list = document.getElementById('messages-list');
+        const stick = list && nearBottom(list);
+        current.replaceWith(indicator);
+        if (stick) scrollToBottom();
+        clearTimeout(typingTimer);
+        typingTimer = setTimeout(() => hideTyping(), typingShownFor);
+    }
+
+    // sendTyping lets the conversation know we are typing, at most every
+    // few seconds
+    function sendTyping() {
+        const id = activeConversation();
+        if (!id || Date.now() - typingSent < 3000) return;
+        typingSent = Date.now();
+        htmx.ajax('POST', '/chat/' + encodeURIComponent(id) + '/typing', { source: container, swap: 'none' });
+    }
+
+    // replaceItem swaps in a conversation's new entry in the list, moving it
+    // to the top when it has new activity.
+    function replaceItem(item, toTop) {
+        const conversations = document.querySelector('.conversation-list');
+        if (!item || !conversations) return;
+        item.classList.toggle('active', item.dataset.conversationId === activeConversation());
+        const current = document.getElementById(item.id);
+        if (current && !toTop) {
+            current.replaceWith(item);
+        } else {
+            if (current) current.remove();
+            conversations.prepend(item);
+        }
+        htmx.process(item);
+    }
+
+    // replaceByID swaps each element in fragment for the one on the page
+    // with its ID, if there is one.
+    function replaceByID(fragment, selector) {
+        fragment.querySelectorAll(selector).forEach(el => {
+            const current = document.getElementById(el.id);
+            if (current) current.replaceWith(el);
+        });
+    }
+
+    // receive applies one event from the stream. Message events carry the
+    // message followed by its conversation's entry in the list; read events
+    // carry the entry followed by the status of our own messages in it;
+    // presence events carry the entries of the conversations with whoever
+    // came or went, with their status line; typing events carry the
+    // indicator; removed events carry the ID of a group we are no longer in.
+    function receive(event, id, data) {
+        if (event === 'reset') {
+            // Too much was missed to catch up message by message
+            window.location.reload();
+            return;
+        }
+        if (event === 'removed') {
+            const current = document.getElementById('conversation-' + data);
+            if (current) current.remove();
+            if (data === activeConversation()) window.location.assign('/chat');
+            return;
+        }
+        if (!['message', 'read', 'presence', 'typing'].includes(event)) return;
+
+        const template = document.createElement('template');
+        template.innerHTML = data;
+        const item = template.content.querySelector('.conversation-item');
+
+        switch (event) {
+        case 'read':
+            replaceItem(item, false);
+            replaceByID(template.content, '.message-status');
+            return;
+        case 'presence':
+            template.content.querySelectorAll('.conversation-item').forEach(el => replaceItem(el, false));
+            replaceByID(template.content, '.chat-status');
+            return;
+        case 'typing':
+            showTyping(template.content.querySelector('.typing-indicator'));
+            return;
+        }
+
+        if (id) lastID = id;
+        const message = template.content.querySelector('.message');
+        const list = document.getElementById('messages-list');
+        if (message && list && message.dataset.conversationId === activeConversation() && !document.getElementById(message.id)) {
+            const stick = nearBottom(list);
+            list.appendChild(message);
+            htmx.process(message);
+            if (stick) scrollToBottom();
+            if (!message.classList.contains('own')) markRead();
+            hideTyping(message.dataset.senderId);
+        }
+        replaceItem(item, true);
+    }
+
+    function eventsURL(protocol) {
+        const url = new URL('/chat/events', window.location.href);
+        if (protocol) url.protocol = protocol;
+        if (lastID) url.searchParams.set('after', lastID);
+        return url;
+    }
+
+    function connectWebSocket() {
+        const socket = new WebSocket(eventsURL(window.location.protocol === 'https:' ? 'wss:' : 'ws:'));
+        let opened = false;
+        socket.addEventListener('open', () => {
+            opened = true;
+            socketFailures = 0;
+            retryDelay = 1000;
+        });
+        socket.addEventListener('message', e => {
+            let frame;
+            try {
+                frame = JSON.parse(e.data);
+            } catch (err) {
+                return;
+            }
+            receive(frame.event, frame.id, frame.data);
+        });
+        socket.addEventListener('close', () => {
+            if (!opened) socketFailures++;
+            // Networks that will not carry WebSockets get Server-Sent Events
+            if (socketFailures >= 2) {
+                connectEventSource();
+                return;
+            }
+            setTimeout(connectWebSocket, retryDelay);
+            retryDelay = Math.min(retryDelay * 2, 30000);
+        });
+    }
+
+    // connectEventSource streams over SSE. EventSource reconnects by itself,
+    // sending the last event's ID so the server resumes after it.
+    function connectEventSource() {
+        const source = new EventSource(eventsURL());
+        ['message', 'read', 'presence', 'typing', 'removed', 'reset'].forEach(name => {
+            source.addEventListener(name, e => receive(name, e.lastEventId, e.data));
+        });
+    }
+
+    if ('WebSocket' in window) {
+        connectWebSocket();
+    } else {
+        connectEventSource();
+    }
+
+    // Auto-resize the message box, and send with Ctrl+Enter
+    document.addEventListener('input', event => {
+        const input = event.target;
+        if (!input.classList.contains('message-input')) return;
+        input.style.height = 'auto';
+        input.style.height = Math.min(input.scrollHeight, 120) + 'px';
+        if (input.value.trim()) sendTyping();
+    });
+
+    document.addEventListener('keydown', event => {
+        if (!event.target.classList.contains('message-input') || !event.ctrlKey || event.key !== 'Enter') return;
+        event.preventDefault();
+        event.target.form.requestSubmit();
+    });
+
+    document.addEventListener('click', event => {
+        const item = event.target.closest('.conversation-item');
+        if (item) {
+            document.querySelectorAll('.conversation-item').forEach(i => i.classList.remove('active'));
+            item.classList.add('active');
+            // On mobile, switch to the chat view as the conversation loads
+            if (isMobileView()) container.dataset.mobileView = 'chat';
+            return;
+        }
+        if (event.target.closest('.mobile-back-btn') && isMobileView()) {
+            container.dataset.mobileView = 'conversations';
+        }
+    });
+
+    // Messages that arrived while the page was hidden are read on return
+    document.addEventListener('visibilitychange', () => {
+        const item = document.getElementById('conversation-' + activeConversation());
+        if (item && item.querySelector('.unread-count')) markRead();
+    });
+
+    window.addEventListener('resize', () => {
+        // Reset mobile view state on desktop
+        if (!isMobileView()) container.dataset.mobileView = 'conversations';
+    });
+
+    scrollToBottom();
+    showUploadButtons();
+
+    document.addEventListener('htmx:afterSwap', event => {
+        if (event.detail.target.id !== 'chat-main') return;
+        scrollToBottom();
+        showUploadButtons();
+    });
+
+    // A message sent from this page may arrive over the stream before the
+    // response to sending it; keep whichever came first
+    document.addEventListener('htmx:load', event => {
+        const message = event.detail.elt;
+        if (!message.classList || !message.classList.contains('message')) return;
+        const copies = document.querySelectorAll('[id="' + message.id + '"]');
+        if (copies.length > 1) {
+            message.remove();
+        } else {
+            scrollToBottom();
+        }
+    });
+
+    // Choosing a file sends it straight away
+    document.addEventListener('change', event => {
+        if (event.target.id === 'attachment-input' && event.target.files.length) {
+            event.target.form.requestSubmit();
+        }
+    });
+
+    // Voice notes are recorded as Opus, in WebM where the browser can and
+    // Ogg otherwise, and sent through the voice form when recording stops
+    let recorder = null;
+
+    function voiceType() {
+        return ['audio/webm;codecs=opus', 'audio/ogg;codecs=opus'].find(type => MediaRecorder.isTypeSupported(type));
+    }
+
+    // Uploads need this script, so their buttons start hidden
+    function showUploadButtons() {
+        const attach = document.querySelector('.attach-btn');
+        if (attach) attach.hidden = false;
+        const button = document.querySelector('.voice-btn');
+        if (button && window.MediaRecorder && window.DataTransfer && navigator.mediaDevices && voiceType()) {
+            button.hidden = false;
+        }
+    }
+
+    async function toggleRecording(button) {
+        if (recorder) {
+            recorder.stop();
+            return;
+        }
+        let stream;
+        try {
+            stream = await navigator.mediaDevices.getUserMedia({ audio: true });
+        } catch (err) {
+            showComposeError('Allow microphone access to record a voice note.');
+            return;
+        }
+        const type = voiceType();
+        const chunks = [];
+        recorder = new MediaRecorder(stream, { mimeType: type });
+        recorder.addEventListener('dataavailable', e => chunks.push(e.data));
+        recorder.addEventListener('stop', () => {
+            stream.getTracks().forEach(track => track.stop());
+            recorder = null;
+            button.classList.remove('recording');
+            button.setAttribute('aria-pressed', 'false');
+            const form = document.getElementById('voice-form');
+            if (!form) return;
+            const name = type.startsWith('audio/webm') ? 'voice-note.webm' : 'voice-note.ogg';
+            const files = new DataTransfer();
+            files.items.add(new File(chunks, name, { type: type.split(';')[0] }));
+            form.querySelector('input[type="file"]').files = files.files;
+            form.requestSubmit();
+        });
+        recorder.start();
+        button.classList.add('recording');
+        button.setAttribute('aria-pressed', 'true');
+    }
+
+    document.addEventListener('click', event => {
+        const button = event.target.closest('.voice-btn');
+        if (button) toggleRecording(button);
+    });
+
+    function showComposeError(text) {
+        const error = document.getElementById('compose-error');
+        if (!error) return;
+        error.textContent = text;
+        error.hidden = !text;
+    }
+
+    document.addEventListener('htmx:afterRequest', event => {
+        const form = event.detail.elt;
+        if (form.classList.contains('attachment-form')) {
+            const xhr = event.detail.xhr;
+            form.reset();
+            if (event.detail.successful) {
+                showComposeError('');
+                const compose = document.querySelector('.message-compose');
+                if (compose) compose.reset();
+            } else if ((xhr.getResponseHeader('Content-Type') || '').startsWith('text/plain')) {
+                showComposeError(xhr.responseText.trim());
+            } else {
+                showComposeError("That couldn't be sent. Try again, or a smaller file.");
+            }
+            return;
+        }
+        if (!form.classList.contains('message-compose')) return;
+        const input = form.querySelector('.message-input');
+        if (event.detail.successful) {
+            form.reset();
+            showComposeError('');
+            input.style.height = 'auto';
+            input.removeAttribute('aria-invalid');
+        } else {
+            // Keep what was written so it can be sent again
+            input.setAttribute('aria-invalid', 'true');
+        }
+    });
+
+    document.addEventListener('htmx:responseError', event => {
+        console.error('HTMX Error:', event.detail.xhr.responseText);
+    });
+})();
@@ -0,0 +1,139 @@
+// Passkey registration and sign-in. Options and responses travel as JSON
+// with binary fields base64url encoded, matching the server's webauthn
+// package.
+(function () {
+    'use strict';
+
+    function toBytes(value) {
+        const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+        const binary = atob(base64 + '='.repeat((4 - base64.length % 4) % 4));
+        return Uint8Array.from(binary, c => c.charCodeAt(0));
+    }
+
+    function toBase64url(buffer) {
+        const bytes = new Uint8Array(buffer);
+        let binary = '';
+        bytes.forEach(b => { binary += String.fromCharCode(b); });
+        return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    }
+
+    function descriptors(list) {
+        return (list || []).map(c => Object.assign({}, c, { id: toBytes(c.id) }));
+    }
+
+    function creationOptions(json) {
+        return Object.assign({}, json, {
+            challenge: toBytes(json.challenge),
+            user: Object.assign({}, json.user, { id: toBytes(json.user.id) }),
+            excludeCredentials: descriptors(json.excludeCredentials),
+        });
+    }
+
+    function requestOptions(json) {
+        return Object.assign({}, json, {
+            challenge: toBytes(json.challenge),
+            allowCredentials: descriptors(json.allowCredentials),
+        });
+    }
+
+    function credentialJSON(cred) {
+        const r = cred.response;
+        const json = {
+            id: cred.id,
+            rawId: toBase64url(cred.rawId),
+            type: cred.type,
+            response: { clientDataJSON: toBase64url(r.clientDataJSON) },
+        };
+        if (r.attestationObject) {
+            json.response.attestationObject = toBase64url(r.attestationObject);
+            json.response.transports = r.getTransports ? r.getTransports() : [];
+        } else {
+            json.response.authenticatorData = toBase64url(r.authenticatorData);
+            json.response.signature = toBase64url(r.signature);
+            if (r.userHandle) {
+                json.response.userHandle = toBase64url(r.userHandle);
+            }
+        }
+        return json;
+    }
+
+    async function post(url, csrf, body) {
+        const res = await fetch(url, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrf },
+            credentials: 'same-origin',
+            body: JSON.stringify(body || {}),
+        });
+        const data = await res.json().catch(() => ({}));
+        if (!res.ok) {
+            throw new Error(data.error || 'Something went wrong. Please try again.');
+        }
+        return data;
+    }
+
+    function showError(message) {
+        const el = document.querySelector('[data-passkey-error]');
+        if (el) {
+            el.textContent = message;
+            el.hidden = !message;
+        }
+    }
+
+    // Cancelling the browser prompt is not an error worth showing
+    function failed(err) {
+        if (err && err.name === 'NotAllowedError') {
+            return;
+        }
+        if (err && err.name === 'InvalidStateError') {
+            showError('This device already has a passkey for your account.');
+            return;
+        }
+        showError(err.message || String(err));
+    }
+
+    const supported = 'PublicKeyCredential' in window;
+
+    const register = document.querySelector('[data-passkey-register]');
+    if (register) {
+        if (!supported) {
+            register.querySelector('[data-passkey-unsupported]').hidden = false;
+            register.querySelector('button').disabled = true;
+        }
+        register.addEventListener('submit', async (e) => {
+            e.preventDefault();
+            showError('');
+            const csrf = register.dataset.csrf;
+            try {
+                const options = await post('/settings/passkeys/options', csrf);
+                const cred = await navigator.credentials.create({ publicKey: creationOptions(options) });
+                await post('/settings/passkeys', csrf, {
+                    name: register.elements.name.value,
+                    credential: credentialJSON(cred),
+                });
+                window.location.reload();
+            } catch (err) {
+                failed(err);
+            }
+        });
+    }
+
+    const login = document.querySelector('[data-passkey-login]');
+    if (login) {
+        login.hidden = !supported;
+        login.addEventListener('click', async () => {
+            showError('');
+            const csrf = login.dataset.csrf;
+            try {
+                const options = await post('/login/passkey/options', csrf);
+                const cred = await navigator.credentials.get({ publicKey: requestOptions(options) });
+                const result = await post('/login/passkey', csrf, {
+                    next: login.dataset.next || '',
+                    credential: credentialJSON(cred),
+                });
+                window.location.assign(result.redirect);
+            } catch (err) {
+                failed(err);
+            }
+        });
+    }
+})();
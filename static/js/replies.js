@@ -0,0 +1,133 @@
+// Reply threads: showing a post's replies, collapsing subtrees (remembered
+// per reply in localStorage) and resetting reply forms once HTMX has
+// posted them.
+(function () {
+    'use strict';
+
+    const storageKey = 'collapsed-replies';
+
+    function collapsed() {
+        try {
+            return new Set(JSON.parse(localStorage.getItem(storageKey)) || []);
+        } catch (e) {
+            return new Set();
+        }
+    }
+
+    function remember(id, isCollapsed) {
+        const ids = collapsed();
+        if (isCollapsed) {
+            ids.add(id);
+        } else {
+            ids.delete(id);
+        }
+        try {
+            localStorage.setItem(storageKey, JSON.stringify([...ids]));
+        } catch (e) {
+            // Storage full or disabled: collapsing still works for this page
+        }
+    }
+
+    function setCollapsed(button, isCollapsed) {
+        const children = document.getElementById(button.getAttribute('aria-controls'));
+        if (!children) return;
+        children.hidden = isCollapsed;
+        button.setAttribute('aria-expanded', String(!isCollapsed));
+    }
+
+    // restore applies the remembered collapse state to the replies in root.
+    function restore(root) {
+        const ids = collapsed();
+        root.querySelectorAll('.reply-collapse').forEach(button => {
+            setCollapsed(button, ids.has(button.dataset.replyId));
+        });
+    }
+
+    // dedupe drops the older copy of a reply that newly loaded replies also
+    // contain, as happens when a new reply is sent before "load more".
+    function dedupe(root) {
+        [root, ...root.querySelectorAll('.reply[id]')].forEach(reply => {
+            document.querySelectorAll('[id="' + reply.id + '"]').forEach(other => {
+                if (other !== reply && !reply.contains(other) && !other.contains(reply)) {
+                    other.remove();
+                }
+            });
+        });
+    }
+
+    document.addEventListener('click', event => {
+        const toggle = event.target.closest('.replies-toggle');
+        if (toggle) {
+            const replies = document.getElementById(toggle.getAttribute('aria-controls'));
+            const open = replies.hidden;
+            replies.hidden = !open;
+            toggle.setAttribute('aria-expanded', String(open));
+            toggle.querySelector('.replies-count').textContent = open ? 'Hide replies' : 'Show replies';
+            return;
+        }
+
+        const collapse = event.target.closest('.reply-collapse');
+        if (collapse) {
+            const isCollapsed = collapse.getAttribute('aria-expanded') === 'true';
+            setCollapsed(collapse, isCollapsed);
+            remember(collapse.dataset.replyId, isCollapsed);
+        }
+    });
+
+    document.addEventListener('DOMContentLoaded', () => restore(document));
+
+    document.addEventListener('htmx:load', event => {
+        const elt = event.detail.elt;
+        restore(elt);
+        if (elt.classList && elt.classList.contains('reply')) {
+            dedupe(elt);
+        }
+    });
+
+    document.addEventListener('htmx:beforeRequest', event => {
+        const form = event.detail.elt;
+        if (form.classList.contains('reply-form')) {
+            form.querySelector('.reply-error').textContent = '';
+        }
+    });
+
+    // Show validation errors from the server next to the form that was sent
+    document.addEventListener('htmx:beforeSwap', event => {
+        const form = event.detail.elt;
+        if (!form.classList.contains('reply-form') || event.detail.xhr.status !== 422) return;
+        event.detail.shouldSwap = true;
+        event.detail.isError = false;
+        event.detail.target = form.querySelector('.reply-error');
+    });
+
+    // Keep a post's reply count in step with replies sent from this page
+    document.addEventListener('reply-created', event => {
+        const n = event.detail.replies;
+        document.querySelectorAll('.reply-count[data-post-id="' + event.detail.postId + '"]').forEach(count => {
+            count.textContent = n + (n === 1 ? ' reply' : ' replies');
+        });
+    });
+
+    document.addEventListener('htmx:afterRequest', event => {
+        const form = event.detail.elt;
+        if (!form.classList.contains('reply-form')) return;
+        if (event.detail.successful) {
+            form.reset();
+            const compose = form.closest('details');
+            if (compose) compose.open = false;
+            // Reveal the list the reply went into if it was collapsed
+            const target = event.detail.target;
+            if (target && target.hidden) {
+                const button = document.querySelector('[aria-controls="' + target.id + '"]');
+                if (button && button.classList.contains('reply-collapse')) {
+                    setCollapsed(button, false);
+                    remember(button.dataset.replyId, false);
+                } else {
+                    target.hidden = false;
+                }
+            }
+        } else if (event.detail.xhr.status !== 422) {
+            form.querySelector('.reply-error').textContent = 'Your reply could not be sent. Try again.';
+        }
+    });
+})();
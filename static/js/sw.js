@@ -1,22 +1,24 @@
 // Service Worker for circles.diy PWA
-// Basic caching strategy for static assets and core pages
+// Caches static assets only. Pages, fragments and attachments are per user
+// and change all the time, so they always come from the network.
 
+// The server fills in CACHE_NAME and points the URLs below at their
+// fingerprinted versions, so every release gets a fresh cache
 const CACHE_NAME = 'circles-diy-v1';
 const STATIC_CACHE_URLS = [
-  '/',
-  '/dashboard',
-  '/circles',
-  '/chat', 
-  '/gather',
-  '/profile',
   '/static/css/style.css',
   '/static/js/htmx.min.js',
+  '/static/js/replies.js',
   '/static/img/icon-192.png',
   '/static/img/icon-512.png',
   '/static/img/favicon-light.svg',
   '/static/img/favicon-dark.svg'
 ];
 
+function clearCaches() {
+  return caches.keys().then(cacheNames => Promise.all(cacheNames.map(cacheName => caches.delete(cacheName))));
+}
+
 // Install event - cache static resources
 self.addEventListener('install', event => {
   console.log('Service Worker installing...');
@@ -30,7 +32,8 @@ self.addEventListener('install', event => {
   );
 });
 
-// Activate event - clean up old caches
+// Activate event - clean up old caches, including any pages earlier
+// versions kept
 self.addEventListener('activate', event => {
   console.log('Service Worker activating...');
   event.waitUntil(
@@ -44,21 +47,25 @@ self.addEventListener('activate', event => {
   );
 });
 
-// Fetch event - serve from cache, fallback to network
+// Fetch event - static assets from the cache, everything else untouched
 self.addEventListener('fetch', event => {
-  // Only handle GET requests
-  if (event.request.method !== 'GET') return;
-  
-  // Skip cross-origin requests
-  if (!event.request.url.startsWith(self.location.origin)) return;
+  const url = new URL(event.request.url);
+  if (url.origin !== self.location.origin) return;
+
+  // Nothing cached outlives the session that signs out
+  if (event.request.method === 'POST' && url.pathname === '/logout') {
+    event.waitUntil(clearCaches());
+    return;
+  }
+
+  if (event.request.method !== 'GET' || !url.pathname.startsWith('/static/')) return;
 
+  // Static URLs are fingerprinted, so a cached copy is never stale
   event.respondWith(
     caches.match(event.request)
       .then(response => {
-        // Return cached version or fetch from network
         return response || fetch(event.request)
           .then(fetchResponse => {
-            // Cache successful responses for static assets
             if (fetchResponse.status === 200) {
               const responseClone = fetchResponse.clone();
               caches.open(CACHE_NAME)
@@ -69,11 +76,5 @@ self.addEventListener('fetch', event => {
             return fetchResponse;
           });
       })
-      .catch(() => {
-        // Fallback for navigation requests when offline
-        if (event.request.mode === 'navigate') {
-          return caches.match('/dashboard');
-        }
-      })
   );
-});
\ No newline at end of file
+});
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"circles.diy/internal/config"
+)
+
+// version and builtAt describe the release, set when building with
+// -ldflags "-X main.version=v1.2.0 -X main.builtAt=2025-01-31T09:00:00Z".
+var (
+	version = "dev"
+	builtAt = ""
+)
+
+// runVersion prints the release and the build metadata Go records in the
+// binary.
+func runVersion(cfg *config.Config, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: version")
+	}
+
+	fmt.Printf("circles.diy %s\n", version)
+	if builtAt != "" {
+		fmt.Printf("  built:     %s\n", builtAt)
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		vcs := map[string]string{}
+		for _, s := range info.Settings {
+			vcs[s.Key] = s.Value
+		}
+		if revision := vcs["vcs.revision"]; revision != "" {
+			if vcs["vcs.modified"] == "true" {
+				revision += " (modified)"
+			}
+			fmt.Printf("  commit:    %s\n", revision)
+			fmt.Printf("  committed: %s\n", vcs["vcs.time"])
+		}
+	}
+	fmt.Printf("  go:        %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}